@@ -7,8 +7,11 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"travel-ai/controllers/middlewares"
 	util2 "travel-ai/controllers/util"
 	"travel-ai/log"
+	"travel-ai/service/platform"
+	"travel-ai/service/platform/database_io"
 	"travel-ai/util"
 )
 
@@ -42,7 +45,62 @@ func GetUserProfileImage(c *gin.Context) {
 	c.File(filePath)
 }
 
+type getReceiptRequestDto struct {
+	ReceiptId string `form:"receipt_id" binding:"required"`
+}
+
+func GetReceipt(c *gin.Context) {
+	uid := c.GetString("uid")
+
+	var query getReceiptRequestDto
+	if err := c.ShouldBindQuery(&query); err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid request query")
+		return
+	}
+
+	receipt, err := database_io.GetReceipt(query.ReceiptId)
+	if err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusNotFound, "receipt does not exist")
+		return
+	}
+
+	// only uploader and members of the session can see it
+	yes, err := platform.CanAccessReceipt(uid, *receipt)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if !yes {
+		util2.AbortWithStrJson(c, http.StatusForbidden, "user is not in session")
+		return
+	}
+
+	filePath := platform.ReceiptFilePath(receipt.ReceiptId)
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		log.Error(err)
+		util2.AbortWithErrJson(c, http.StatusInternalServerError, errors.New("failed to read receipt"))
+		return
+	}
+
+	// receipts stored before their types were sniffed are downloaded, unless they are images
+	if platform.IsReceiptContentType(receipt.ContentType) {
+		c.Header("Content-Disposition", "inline; filename=receipt")
+		c.Header("Content-Type", receipt.ContentType)
+	} else {
+		c.Header("Content-Disposition", "attachment; filename=receipt")
+		c.Header("Content-Type", "application/octet-stream")
+	}
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Length", strconv.FormatInt(fileInfo.Size(), 10))
+	c.File(filePath)
+}
+
 func UseAssetRouter(r *gin.Engine) {
 	g := r.Group("/asset")
 	g.GET("/profile-image", GetUserProfileImage)
+	g.GET("/receipt", middlewares.AuthMiddleware, GetReceipt)
 }
@@ -5,8 +5,10 @@ import (
 	"github.com/google/uuid"
 	"math/big"
 	"net/http"
+	"time"
 	"travel-ai/controllers/socket"
 	util2 "travel-ai/controllers/util"
+	"travel-ai/libs/money"
 	"travel-ai/log"
 	"travel-ai/service/database"
 	"travel-ai/service/platform"
@@ -55,7 +57,9 @@ func Budgets(c *gin.Context) {
 		budgets[i] = BudgetGetResponseItem{
 			BudgetId:     budgetEntity.BudgetId,
 			CurrencyCode: budgetEntity.CurrencyCode,
-			Amount:       budgetEntity.Amount,
+			Amount:       budgetEntity.AmountMoney().Decimal(),
+			Category:     budgetEntity.Category,
+			Day:          budgetDay(budgetEntity),
 		}
 	}
 
@@ -73,7 +77,7 @@ func CreateBudget(c *gin.Context) {
 	}
 
 	// check if session exists
-	_, err := database_io.GetSession(body.SessionId)
+	session, err := database_io.GetSession(body.SessionId)
 	if err != nil {
 		log.Error(err)
 		util2.AbortWithStrJson(c, http.StatusBadRequest, "session does not exist")
@@ -110,11 +114,46 @@ func CreateBudget(c *gin.Context) {
 	}
 
 	// validate amount
-	if *body.Amount < 0 {
+	amount, err := money.FromDecimal(*body.Amount, body.CurrencyCode)
+	if err != nil {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid amount: "+err.Error())
+		return
+	}
+	if amount.IsNegative() {
 		util2.AbortWithStrJson(c, http.StatusBadRequest, "amount should be positive")
 		return
 	}
 
+	// budget can be scoped by category and day of the trip
+	if body.Category != nil && !platform.IsValidExpenditureCategory(*body.Category) {
+		util2.AbortWithStrJsonF(c, http.StatusBadRequest, "invalid category: %s", *body.Category)
+		return
+	}
+	var day *time.Time
+	if body.Day != nil {
+		parsed, err := time.Parse("2006-01-02", *body.Day)
+		if err != nil {
+			util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid day: "+err.Error())
+			return
+		}
+		dayString := platform.ToDayString(parsed)
+		if (session.StartAt != nil && dayString < platform.ToDayString(*session.StartAt)) ||
+			(session.EndAt != nil && dayString > platform.ToDayString(*session.EndAt)) {
+			util2.AbortWithStrJson(c, http.StatusBadRequest, "day is out of the trip")
+			return
+		}
+		day = &parsed
+	}
+	newBudget := database.BudgetEntity{
+		BudgetId:     uuid.New().String(),
+		CurrencyCode: body.CurrencyCode,
+		Amount:       amount.Amount,
+		UserId:       uid,
+		SessionId:    body.SessionId,
+		Category:     body.Category,
+		Day:          day,
+	}
+
 	tx, err := database.DB.BeginTx(c, nil)
 	if err != nil {
 		log.Error(err)
@@ -122,14 +161,28 @@ func CreateBudget(c *gin.Context) {
 		return
 	}
 
-	budgetId := uuid.New().String()
-	newBudget := database.BudgetEntity{
-		BudgetId:     budgetId,
-		CurrencyCode: body.CurrencyCode,
-		Amount:       *body.Amount,
-		UserId:       uid,
-		SessionId:    body.SessionId,
+	// the unique key rejects the same scope as well, which is checked under the lock of the session to tell why
+	if err := database_io.LockSessionTx(tx, body.SessionId); err != nil {
+		_ = tx.Rollback()
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	budgetEntities, err := database_io.GetBudgetsBySessionIdAndUserIdTx(tx, body.SessionId, uid)
+	if err != nil {
+		_ = tx.Rollback()
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	for _, budgetEntity := range budgetEntities {
+		if budgetEntity.CurrencyCode == newBudget.CurrencyCode && sameBudgetScope(budgetEntity, newBudget) {
+			_ = tx.Rollback()
+			util2.AbortWithStrJson(c, http.StatusBadRequest, "budget of the currency already exists")
+			return
+		}
 	}
+
 	if err := database_io.InsertBudgetTx(tx, newBudget); err != nil {
 		_ = tx.Rollback()
 		log.Error(err)
@@ -171,6 +224,17 @@ func EditBudget(c *gin.Context) {
 		return
 	}
 
+	// validate amount
+	amount, err := money.FromDecimal(*body.Amount, budget.CurrencyCode)
+	if err != nil {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid amount: "+err.Error())
+		return
+	}
+	if amount.IsNegative() {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "amount should be positive")
+		return
+	}
+
 	tx, err := database.DB.BeginTx(c, nil)
 	if err != nil {
 		log.Error(err)
@@ -178,7 +242,7 @@ func EditBudget(c *gin.Context) {
 		return
 	}
 
-	if err := database_io.UpdateBudgetTx(tx, body.BudgetId, *body.Amount); err != nil {
+	if err := database_io.UpdateBudgetTx(tx, body.BudgetId, amount.Amount); err != nil {
 		_ = tx.Rollback()
 		log.Error(err)
 		util2.AbortWithErrJson(c, http.StatusInternalServerError, err)
@@ -272,6 +336,14 @@ func BudgetSummary(c *gin.Context) {
 		return
 	}
 
+	// check if session exists
+	session, err := database_io.GetSession(query.SessionId)
+	if err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "session does not exist")
+		return
+	}
+
 	// get currency code
 	userEntity, err := database_io.GetUser(uid)
 	if err != nil {
@@ -293,8 +365,10 @@ func BudgetSummary(c *gin.Context) {
 	}
 
 	// get budgets
-	myTotalBudget, myTotalSpent := 0.0, 0.0
-	totalBudget, totalSpent := 0.0, 0.0
+	myTotalBudget, myTotalSpent := new(big.Rat), new(big.Rat)
+	totalBudget, totalSpent := new(big.Rat), new(big.Rat)
+	exchange := platform.SessionExchanger(session)
+	settledAt := platform.SessionSettledAt(session)
 	budgetEntities, err := database_io.GetBudgetsBySessionId(query.SessionId)
 	if err != nil {
 		log.Error(err)
@@ -303,16 +377,19 @@ func BudgetSummary(c *gin.Context) {
 	}
 
 	for _, budgetEntity := range budgetEntities {
-		amount := budgetEntity.Amount
-		exchanged, err := platform.Exchange(budgetEntity.CurrencyCode, currencyCode, amount)
+		if !platform.IsWholeBudget(budgetEntity) {
+			continue
+		}
+		rate, err := exchange(budgetEntity.CurrencyCode, currencyCode, settledAt)
 		if err != nil {
 			log.Error(err)
 			c.AbortWithStatus(http.StatusInternalServerError)
 			return
 		}
-		totalBudget += exchanged
+		exchanged := new(big.Rat).Mul(budgetEntity.AmountMoney().Rat(), rate)
+		totalBudget.Add(totalBudget, exchanged)
 		if budgetEntity.UserId == uid {
-			myTotalBudget += exchanged
+			myTotalBudget.Add(myTotalBudget, exchanged)
 		}
 	}
 
@@ -325,40 +402,52 @@ func BudgetSummary(c *gin.Context) {
 	}
 
 	// get total spent
-	spentByDay := make(map[string]float64)
+	spentByDay := make(map[string]*big.Rat)
+	mySpentByCategory := make(map[string]*big.Rat)
 	for _, dist := range dists {
-		amount, _ := big.NewRat(dist.Numerator, dist.Denominator).Float64()
-		exchanged, err := platform.Exchange(dist.CurrencyCode, currencyCode, amount)
+		rate, err := exchange(dist.CurrencyCode, currencyCode, dist.PayedAt)
 		if err != nil {
 			log.Error(err)
 			c.AbortWithStatus(http.StatusInternalServerError)
 			return
 		}
+		exchanged := new(big.Rat).Mul(big.NewRat(dist.Numerator, dist.Denominator), rate)
 
-		totalSpent += exchanged
+		totalSpent.Add(totalSpent, exchanged)
 		if dist.UserId == uid {
-			myTotalSpent += exchanged
+			myTotalSpent.Add(myTotalSpent, exchanged)
+			if _, ok := mySpentByCategory[dist.Category]; !ok {
+				mySpentByCategory[dist.Category] = new(big.Rat)
+			}
+			mySpentByCategory[dist.Category].Add(mySpentByCategory[dist.Category], exchanged)
 		}
 
 		// add to spend by day
 		dayString := platform.ToDayString(dist.PayedAt) // 2020-01-01
 		if _, ok := spentByDay[dayString]; !ok {
-			spentByDay[dayString] = 0
+			spentByDay[dayString] = new(big.Rat)
 		}
-		spentByDay[dayString] += exchanged
+		spentByDay[dayString].Add(spentByDay[dayString], exchanged)
 	}
 
 	resp := BudgetSummaryGetResponseDto{
 		CurrencyCode: currencyCode,
 		MyBudget: BudgetSummaryGetResponseBudgetItem{
-			Total: myTotalBudget,
-			Spent: myTotalSpent,
+			Total: money.FromRat(myTotalBudget, currencyCode).Decimal(),
+			Spent: money.FromRat(myTotalSpent, currencyCode).Decimal(),
 		},
 		SessionBudget: BudgetSummaryGetResponseBudgetItem{
-			Total: totalBudget,
-			Spent: totalSpent,
+			Total: money.FromRat(totalBudget, currencyCode).Decimal(),
+			Spent: money.FromRat(totalSpent, currencyCode).Decimal(),
 		},
-		SpentByDay: spentByDay,
+		SpentByDay:        make(map[string]money.Decimal),
+		MySpentByCategory: make(map[string]money.Decimal),
+	}
+	for dayString, spent := range spentByDay {
+		resp.SpentByDay[dayString] = money.FromRat(spent, currencyCode).Decimal()
+	}
+	for category, spent := range mySpentByCategory {
+		resp.MySpentByCategory[category] = money.FromRat(spent, currencyCode).Decimal()
 	}
 	c.JSON(http.StatusOK, resp)
 }
@@ -373,6 +462,14 @@ func CurrentBudget(c *gin.Context) {
 		return
 	}
 
+	// check if session exists
+	session, err := database_io.GetSession(query.SessionId)
+	if err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "session does not exist")
+		return
+	}
+
 	// get budgets
 	budgetEntities, err := database_io.GetBudgetsBySessionIdAndUserId(query.SessionId, uid)
 	if err != nil {
@@ -389,29 +486,264 @@ func CurrentBudget(c *gin.Context) {
 		return
 	}
 
-	// accumulate spent budget by currency
-	accumulatedSpentBudget := make(map[string]float64)
-	for _, dist := range dists {
-		amount, _ := big.NewRat(dist.Numerator, dist.Denominator).Float64()
-		if _, ok := accumulatedSpentBudget[dist.CurrencyCode]; !ok {
-			accumulatedSpentBudget[dist.CurrencyCode] = 0
+	// currency bought with a budget is spent from that budget, with the acquired rate
+	var acquiredRates platform.AcquiredRates
+	if session.UseAcquiredRate {
+		acquiredRates, err = platform.SessionAcquiredRates(query.SessionId)
+		if err != nil {
+			log.Error(err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
 		}
-		accumulatedSpentBudget[dist.CurrencyCode] += amount
 	}
+	spentByBudget := platform.BudgetSpent(budgetEntities, dists, acquiredRates)
 
 	resp := make(BudgetCurrentGetResponseDto, 0)
 	for _, budgetEntity := range budgetEntities {
-		spent := accumulatedSpentBudget[budgetEntity.CurrencyCode]
-		resp = append(resp, BudgetCurrentGetResponseItem{
+		spent := spentByBudget[budgetEntity.BudgetId]
+		item := BudgetCurrentGetResponseItem{
+			BudgetId:     budgetEntity.BudgetId,
 			CurrencyCode: budgetEntity.CurrencyCode,
-			Spent:        spent,
-			Total:        budgetEntity.Amount,
-		})
+			Category:     budgetEntity.Category,
+			Day:          budgetDay(budgetEntity),
+			Spent:        money.FromRat(spent, budgetEntity.CurrencyCode).Decimal(),
+			Total:        budgetEntity.AmountMoney().Decimal(),
+		}
+		if reached := platform.CrossedBudgetThresholds(budgetEntity.AmountMoney().Rat(), new(big.Rat), spent); len(reached) > 0 {
+			item.Threshold = &reached[len(reached)-1]
+		}
+		resp = append(resp, item)
 	}
 
 	c.JSON(http.StatusOK, resp)
 }
 
+// notifyBudgetThresholds alerts the users whose budgets cross a threshold by the expenditure.
+// Only the highest one crossed is sent, and it is not an error if it fails.
+func notifyBudgetThresholds(sessionId string, expenditureId string, userIds []string) {
+	session, err := database_io.GetSession(sessionId)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	var acquiredRates platform.AcquiredRates
+	if session.UseAcquiredRate {
+		acquiredRates, err = platform.SessionAcquiredRates(sessionId)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+	}
+
+	for _, userId := range userIds {
+		budgetEntities, err := database_io.GetBudgetsBySessionIdAndUserId(sessionId, userId)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		if len(budgetEntities) == 0 {
+			continue
+		}
+		dists, err := database_io.GetExpenditureDistributionsBySessionIdAndUserId(sessionId, userId)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		previousDists := make([]database_io.UserExpenditureDistributionEntity, 0, len(dists))
+		for _, dist := range dists {
+			if dist.ExpenditureId != expenditureId {
+				previousDists = append(previousDists, dist)
+			}
+		}
+		before := platform.BudgetSpent(budgetEntities, previousDists, acquiredRates)
+		after := platform.BudgetSpent(budgetEntities, dists, acquiredRates)
+
+		for _, budgetEntity := range budgetEntities {
+			total := budgetEntity.AmountMoney()
+			crossed := platform.CrossedBudgetThresholds(total.Rat(), before[budgetEntity.BudgetId], after[budgetEntity.BudgetId])
+			if len(crossed) == 0 {
+				continue
+			}
+			socket.SocketManager.Unicast(userId, socket.EventBudgetThresholdCrossed, BudgetThresholdEvent{
+				SessionId:     sessionId,
+				BudgetId:      budgetEntity.BudgetId,
+				ExpenditureId: expenditureId,
+				CurrencyCode:  budgetEntity.CurrencyCode,
+				Category:      budgetEntity.Category,
+				Day:           budgetDay(budgetEntity),
+				Spent:         money.FromRat(after[budgetEntity.BudgetId], budgetEntity.CurrencyCode).Decimal(),
+				Total:         total.Decimal(),
+				Threshold:     crossed[len(crossed)-1],
+			})
+		}
+	}
+}
+
+func BudgetForecast(c *gin.Context) {
+	uid := c.GetString("uid")
+
+	var query BudgetForecastGetRequestDto
+	if err := c.ShouldBindQuery(&query); err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid request query: "+err.Error())
+		return
+	}
+
+	// check if session exists
+	session, err := database_io.GetSession(query.SessionId)
+	if err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "session does not exist")
+		return
+	}
+
+	// check if user is in session
+	yes, err := platform.IsSessionMember(uid, query.SessionId)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if !yes {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "user is not in session")
+		return
+	}
+
+	// get currency code
+	userEntity, err := database_io.GetUser(uid)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	currencyCode := userEntity.DefaultCurrencyCode
+	ok, err := platform.IsSupportedCurrency(currencyCode)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		util2.AbortWithStrJsonF(c, http.StatusBadRequest, "invalid currency code: %s", currencyCode)
+		return
+	}
+
+	// get budgets for the whole trip
+	myBudget, sessionBudget := new(big.Rat), new(big.Rat)
+	exchange := platform.SessionExchanger(session)
+	settledAt := platform.SessionSettledAt(session)
+	budgetEntities, err := database_io.GetBudgetsBySessionId(query.SessionId)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	for _, budgetEntity := range budgetEntities {
+		if !platform.IsWholeBudget(budgetEntity) {
+			continue
+		}
+		rate, err := exchange(budgetEntity.CurrencyCode, currencyCode, settledAt)
+		if err != nil {
+			log.Error(err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		exchanged := new(big.Rat).Mul(budgetEntity.AmountMoney().Rat(), rate)
+		sessionBudget.Add(sessionBudget, exchanged)
+		if budgetEntity.UserId == uid {
+			myBudget.Add(myBudget, exchanged)
+		}
+	}
+
+	// get spending by day
+	dists, err := database_io.GetExpenditureDistributionsBySessionId(query.SessionId)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	mySpentByDay := make(map[string]*big.Rat)
+	sessionSpentByDay := make(map[string]*big.Rat)
+	for _, dist := range dists {
+		rate, err := exchange(dist.CurrencyCode, currencyCode, dist.PayedAt)
+		if err != nil {
+			log.Error(err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		exchanged := new(big.Rat).Mul(big.NewRat(dist.Numerator, dist.Denominator), rate)
+
+		dayString := platform.ToDayString(dist.PayedAt)
+		if _, ok := sessionSpentByDay[dayString]; !ok {
+			sessionSpentByDay[dayString] = new(big.Rat)
+		}
+		sessionSpentByDay[dayString].Add(sessionSpentByDay[dayString], exchanged)
+		if dist.UserId == uid {
+			if _, ok := mySpentByDay[dayString]; !ok {
+				mySpentByDay[dayString] = new(big.Rat)
+			}
+			mySpentByDay[dayString].Add(mySpentByDay[dayString], exchanged)
+		}
+	}
+
+	now := time.Now()
+	startAt, endAt := platform.SessionTripDays(session, sessionSpentByDay, now)
+	myForecast := platform.ForecastBudget(myBudget, mySpentByDay, startAt, endAt, now)
+	sessionForecast := platform.ForecastBudget(sessionBudget, sessionSpentByDay, startAt, endAt, now)
+
+	c.JSON(http.StatusOK, BudgetForecastGetResponseDto{
+		CurrencyCode:    currencyCode,
+		StartAt:         platform.ToDayString(startAt),
+		EndAt:           platform.ToDayString(endAt),
+		TripDays:        sessionForecast.TripDays,
+		ElapsedDays:     sessionForecast.ElapsedDays,
+		RemainingDays:   sessionForecast.RemainingDays,
+		MyForecast:      budgetForecastItem(myForecast, currencyCode),
+		SessionForecast: budgetForecastItem(sessionForecast, currencyCode),
+	})
+}
+
+func budgetForecastItem(forecast platform.BudgetForecast, currencyCode string) BudgetForecastItem {
+	item := BudgetForecastItem{
+		Budget:         money.FromRat(forecast.Budget, currencyCode).Decimal(),
+		Spent:          money.FromRat(forecast.Spent, currencyCode).Decimal(),
+		Remaining:      money.FromRat(forecast.Remaining, currencyCode).Decimal(),
+		DailyAverage:   money.FromRat(forecast.DailyAverage, currencyCode).Decimal(),
+		ProjectedTotal: money.FromRat(forecast.ProjectedTotal, currencyCode).Decimal(),
+		UnusualDays:    make([]BudgetForecastUnusualDayItem, len(forecast.UnusualDays)),
+	}
+	if forecast.DailyAllowance != nil {
+		allowance := money.FromRat(forecast.DailyAllowance, currencyCode).Decimal()
+		item.DailyAllowance = &allowance
+	}
+	for i, day := range forecast.UnusualDays {
+		item.UnusualDays[i] = BudgetForecastUnusualDayItem{
+			Day:   day.Day,
+			Spent: money.FromRat(day.Spent, currencyCode).Decimal(),
+			Ratio: day.Ratio,
+		}
+	}
+	return item
+}
+
+// budgetDay is the day of the budget as 2006-01-02, or nil for the whole trip
+func budgetDay(budget database.BudgetEntity) *string {
+	if budget.Day == nil {
+		return nil
+	}
+	day := platform.ToDayString(*budget.Day)
+	return &day
+}
+
+func sameBudgetScope(a database.BudgetEntity, b database.BudgetEntity) bool {
+	if (a.Category == nil) != (b.Category == nil) || (a.Category != nil && *a.Category != *b.Category) {
+		return false
+	}
+	aDay, bDay := budgetDay(a), budgetDay(b)
+	return (aDay == nil) == (bDay == nil) && (aDay == nil || *aDay == *bDay)
+}
+
 func UseBudgetRouter(g *gin.RouterGroup) {
 	rg := g.Group("/budget")
 	rg.GET("", Budgets)
@@ -420,4 +752,5 @@ func UseBudgetRouter(g *gin.RouterGroup) {
 	rg.DELETE("", DeleteBudget)
 	rg.GET("/summary", BudgetSummary)
 	rg.GET("/current", CurrentBudget)
+	rg.GET("/forecast", BudgetForecast)
 }
@@ -2,11 +2,17 @@ package platform
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"net/http"
+	"sort"
+	"time"
+	"travel-ai/controllers/socket"
 	util2 "travel-ai/controllers/util"
+	"travel-ai/libs/money"
 	"travel-ai/log"
+	"travel-ai/service/database"
 	"travel-ai/service/platform"
-	"travel-ai/third_party/fawazahmed0_currency"
+	"travel-ai/service/platform/database_io"
 )
 
 func SupportedCurrencies(c *gin.Context) {
@@ -33,8 +39,7 @@ func ExchangeRate(c *gin.Context) {
 		return
 	}
 
-	// temporary method
-	rate, err := fawazahmed0_currency.GetExchangeRate(query.FromCurrencyCode, query.ToCurrencyCode)
+	rate, err := platform.GetUpdatedExchangeRate(query.FromCurrencyCode, query.ToCurrencyCode)
 	if err != nil {
 		log.Error(err)
 		util2.AbortWithStrJson(c, http.StatusInternalServerError, "internal server error")
@@ -44,8 +49,249 @@ func ExchangeRate(c *gin.Context) {
 	c.JSON(http.StatusOK, rate)
 }
 
+func CurrencyExchanges(c *gin.Context) {
+	uid := c.GetString("uid")
+
+	var query currencyExchangesGetRequestDto
+	if err := c.ShouldBindQuery(&query); err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid request query")
+		return
+	}
+
+	// check if user is in session
+	yes, err := platform.IsSessionMember(uid, query.SessionId)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if !yes {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "user is not in session")
+		return
+	}
+
+	exchangeEntities, err := database_io.GetCurrencyExchangesBySessionId(query.SessionId)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	resp := currencyExchangesGetResponseDto{
+		Exchanges:     make([]currencyExchangesGetResponseItem, len(exchangeEntities)),
+		AcquiredRates: make([]currencyAcquiredRateItem, 0),
+	}
+	for i, exchangeEntity := range exchangeEntities {
+		resp.Exchanges[i] = currencyExchangesGetResponseItem{
+			CurrencyExchangeId: exchangeEntity.CurrencyExchangeId,
+			UserId:             exchangeEntity.UserId,
+			FromCurrencyCode:   exchangeEntity.FromCurrencyCode,
+			FromAmount:         exchangeEntity.FromAmountMoney().Decimal(),
+			ToCurrencyCode:     exchangeEntity.ToCurrencyCode,
+			ToAmount:           exchangeEntity.ToAmountMoney().Decimal(),
+			Fee:                exchangeEntity.FeeMoney().Decimal(),
+			ExchangedAt:        exchangeEntity.ExchangedAt.UnixMilli(),
+		}
+	}
+	for pair, rate := range platform.NewAcquiredRates(exchangeEntities) {
+		resp.AcquiredRates = append(resp.AcquiredRates, currencyAcquiredRateItem{
+			FromCurrencyCode: pair[0],
+			ToCurrencyCode:   pair[1],
+			Rate:             money.NewDecimal(rate, 6),
+		})
+	}
+	sort.Slice(resp.AcquiredRates, func(i, j int) bool {
+		if resp.AcquiredRates[i].FromCurrencyCode != resp.AcquiredRates[j].FromCurrencyCode {
+			return resp.AcquiredRates[i].FromCurrencyCode < resp.AcquiredRates[j].FromCurrencyCode
+		}
+		return resp.AcquiredRates[i].ToCurrencyCode < resp.AcquiredRates[j].ToCurrencyCode
+	})
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func CreateCurrencyExchange(c *gin.Context) {
+	uid := c.GetString("uid")
+
+	var body currencyExchangeCreateRequestDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	// check if session exists
+	session, err := database_io.GetSession(body.SessionId)
+	if err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "session does not exist")
+		return
+	}
+
+	// check if user is in session
+	yes, err := platform.IsSessionMember(uid, body.SessionId)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if !yes {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "user is not in session")
+		return
+	}
+
+	// are currency codes valid
+	for _, currencyCode := range []string{body.FromCurrencyCode, body.ToCurrencyCode} {
+		yes, err = platform.IsSupportedCurrency(currencyCode)
+		if err != nil {
+			log.Error(err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if !yes {
+			util2.AbortWithStrJsonF(c, http.StatusBadRequest, "invalid currency code: %s", currencyCode)
+			return
+		}
+	}
+	if body.FromCurrencyCode == body.ToCurrencyCode {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "currencies should be different")
+		return
+	}
+
+	// validate amounts
+	fromAmount, err := money.FromDecimal(*body.FromAmount, body.FromCurrencyCode)
+	if err != nil {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid from amount: "+err.Error())
+		return
+	}
+	toAmount, err := money.FromDecimal(*body.ToAmount, body.ToCurrencyCode)
+	if err != nil {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid to amount: "+err.Error())
+		return
+	}
+	if fromAmount.IsNegative() || fromAmount.IsZero() || toAmount.IsNegative() || toAmount.IsZero() {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "amounts should be positive")
+		return
+	}
+	fee := money.Zero(body.FromCurrencyCode)
+	if body.Fee != nil {
+		fee, err = money.FromDecimal(*body.Fee, body.FromCurrencyCode)
+		if err != nil {
+			util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid fee: "+err.Error())
+			return
+		}
+		if fee.IsNegative() {
+			util2.AbortWithStrJson(c, http.StatusBadRequest, "fee should not be negative")
+			return
+		}
+	}
+
+	exchangedAt := time.Now()
+	if body.ExchangedAt != 0 {
+		exchangedAt = time.UnixMilli(body.ExchangedAt)
+	}
+
+	tx, err := database.DB.BeginTx(c, nil)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	newExchange := database.CurrencyExchangeEntity{
+		CurrencyExchangeId: uuid.New().String(),
+		SessionId:          body.SessionId,
+		UserId:             uid,
+		FromCurrencyCode:   body.FromCurrencyCode,
+		FromAmount:         fromAmount.Amount,
+		ToCurrencyCode:     body.ToCurrencyCode,
+		ToAmount:           toAmount.Amount,
+		Fee:                fee.Amount,
+		ExchangedAt:        exchangedAt,
+	}
+	if err := database_io.InsertCurrencyExchangeTx(tx, newExchange); err != nil {
+		_ = tx.Rollback()
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	// acquired rate of the pair is changed
+	if session.UseAcquiredRate {
+		socket.SocketManager.Multicast(body.SessionId, uid, socket.EventSettlementChanged, nil)
+	}
+	c.JSON(http.StatusOK, newExchange.CurrencyExchangeId)
+}
+
+func DeleteCurrencyExchange(c *gin.Context) {
+	uid := c.GetString("uid")
+
+	var body currencyExchangeDeleteRequestDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	// get currency exchange
+	exchangeEntity, err := database_io.GetCurrencyExchange(body.CurrencyExchangeId)
+	if err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "currency exchange does not exist")
+		return
+	}
+
+	// only who made the exchange can delete it
+	if exchangeEntity.UserId != uid {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "user is not currency exchange owner")
+		return
+	}
+
+	session, err := database_io.GetSession(exchangeEntity.SessionId)
+	if err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "session does not exist")
+		return
+	}
+
+	tx, err := database.DB.BeginTx(c, nil)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if err := database_io.DeleteCurrencyExchangeTx(tx, body.CurrencyExchangeId); err != nil {
+		_ = tx.Rollback()
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if session.UseAcquiredRate {
+		socket.SocketManager.Multicast(session.SessionId, uid, socket.EventSettlementChanged, nil)
+	}
+	c.JSON(http.StatusOK, nil)
+}
+
 func UseCurrencyRouter(g *gin.RouterGroup) {
 	rg := g.Group("/currency")
 	rg.GET("", SupportedCurrencies)
 	rg.GET("/exchange-rate", ExchangeRate)
+	rg.GET("/exchanges", CurrencyExchanges)
+	rg.PUT("/exchange", CreateCurrencyExchange)
+	rg.DELETE("/exchange", DeleteCurrencyExchange)
 }
@@ -1,6 +1,12 @@
 package platform
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+	"travel-ai/libs/money"
+	"travel-ai/service/platform"
+	"travel-ai/service/receipt_ocr"
+)
 
 /* ---------------- Common ---------------- */
 type Fraction struct {
@@ -63,15 +69,17 @@ type locateDirectionResponseDto []locateCoordinate
 
 /* ---------------- Session ---------------- */
 type sessionsResponseItem struct {
-	SessionId     string   `json:"session_id"`
-	SessionCode   string   `json:"session_code"`
-	CreatorUserId string   `json:"creator_user_id"`
-	Name          string   `json:"name"`
-	StartAt       string   `json:"start_at"`
-	EndAt         string   `json:"end_at"`
-	CreatedAt     int64    `json:"created_at"` //timestamp
-	CountryCodes  []string `json:"country_codes"`
-	ThumbnailUrl  string   `json:"thumbnail_url"`
+	SessionId        string   `json:"session_id"`
+	SessionCode      string   `json:"session_code"`
+	CreatorUserId    string   `json:"creator_user_id"`
+	Name             string   `json:"name"`
+	StartAt          string   `json:"start_at"`
+	EndAt            string   `json:"end_at"`
+	CreatedAt        int64    `json:"created_at"` //timestamp
+	CountryCodes     []string `json:"country_codes"`
+	ThumbnailUrl     string   `json:"thumbnail_url"`
+	ExchangeRateMode string   `json:"exchange_rate_mode"`
+	UseAcquiredRate  bool     `json:"use_acquired_rate"`
 }
 
 type sessionsResponseDto []sessionsResponseItem
@@ -86,6 +94,12 @@ type sessionDeleteRequestDto struct {
 	SessionId string `json:"session_id" binding:"required"`
 }
 
+type sessionExchangeRateModeRequestDto struct {
+	SessionId        string `json:"session_id" binding:"required"`
+	ExchangeRateMode string `json:"exchange_rate_mode" binding:"required"` // payment, session_end, live
+	UseAcquiredRate  *bool  `json:"use_acquired_rate"`                     // use rates of currency exchanges for exchanged pairs
+}
+
 type sessionSupportedCurrenciesRequestDto struct {
 	SessionId string `form:"session_id" binding:"required"`
 }
@@ -277,6 +291,46 @@ type currencyExchangeRateRequestDto struct {
 	ToCurrencyCode   string `form:"to_currency_code" binding:"required"`
 }
 
+type currencyExchangesGetRequestDto struct {
+	SessionId string `form:"session_id" binding:"required"`
+}
+
+type currencyExchangesGetResponseItem struct {
+	CurrencyExchangeId string        `json:"currency_exchange_id"`
+	UserId             string        `json:"user_id"`
+	FromCurrencyCode   string        `json:"from_currency_code"`
+	FromAmount         money.Decimal `json:"from_amount"`
+	ToCurrencyCode     string        `json:"to_currency_code"`
+	ToAmount           money.Decimal `json:"to_amount"`
+	Fee                money.Decimal `json:"fee"` // in from currency
+	ExchangedAt        int64         `json:"exchanged_at"`
+}
+
+type currencyAcquiredRateItem struct {
+	FromCurrencyCode string        `json:"from_currency_code"`
+	ToCurrencyCode   string        `json:"to_currency_code"`
+	Rate             money.Decimal `json:"rate"` // weighted average including fee
+}
+
+type currencyExchangesGetResponseDto struct {
+	Exchanges     []currencyExchangesGetResponseItem `json:"exchanges"`
+	AcquiredRates []currencyAcquiredRateItem         `json:"acquired_rates"`
+}
+
+type currencyExchangeCreateRequestDto struct {
+	SessionId        string         `json:"session_id" binding:"required"`
+	FromCurrencyCode string         `json:"from_currency_code" binding:"required"`
+	FromAmount       *money.Decimal `json:"from_amount" binding:"required"`
+	ToCurrencyCode   string         `json:"to_currency_code" binding:"required"`
+	ToAmount         *money.Decimal `json:"to_amount" binding:"required"`
+	Fee              *money.Decimal `json:"fee"`          // in from currency, optional
+	ExchangedAt      int64          `json:"exchanged_at"` // timestamp (ms), now if omitted
+}
+
+type currencyExchangeDeleteRequestDto struct {
+	CurrencyExchangeId string `json:"currency_exchange_id" binding:"required"`
+}
+
 /* ---------------- Friends ---------------- */
 type friendsGetResponseItem struct {
 	UserId       string  `json:"user_id" binding:"required"`
@@ -348,22 +402,26 @@ type BudgetGetRequestDto struct {
 }
 
 type BudgetGetResponseItem struct {
-	BudgetId     string  `json:"budget_id"`
-	CurrencyCode string  `json:"currency_code"`
-	Amount       float64 `json:"amount"`
+	BudgetId     string        `json:"budget_id"`
+	CurrencyCode string        `json:"currency_code"`
+	Amount       money.Decimal `json:"amount"`
+	Category     *string       `json:"category"` // null for all categories
+	Day          *string       `json:"day"`      // 2006-01-02, null for the whole trip
 }
 
 type BudgetGetResponseDto []BudgetGetResponseItem
 
 type BudgetCreateRequestDto struct {
-	CurrencyCode string   `json:"currency_code" binding:"required"`
-	Amount       *float64 `json:"amount" binding:"required"`
-	SessionId    string   `json:"session_id" binding:"required"`
+	CurrencyCode string         `json:"currency_code" binding:"required"`
+	Amount       *money.Decimal `json:"amount" binding:"required"`
+	SessionId    string         `json:"session_id" binding:"required"`
+	Category     *string        `json:"category"` // one of categories, or null for all
+	Day          *string        `json:"day"`      // 2006-01-02 in the trip, or null for the whole trip
 }
 
 type BudgetEditRequestDto struct {
-	BudgetId string   `json:"budget_id" binding:"required"`
-	Amount   *float64 `json:"amount" binding:"required"`
+	BudgetId string         `json:"budget_id" binding:"required"`
+	Amount   *money.Decimal `json:"amount" binding:"required"`
 }
 
 type BudgetDeleteRequestDto struct {
@@ -375,15 +433,17 @@ type BudgetSummaryGetRequestDto struct {
 }
 
 type BudgetSummaryGetResponseBudgetItem struct {
-	Total float64 `json:"total"`
-	Spent float64 `json:"spent"`
+	Total money.Decimal `json:"total"`
+	Spent money.Decimal `json:"spent"`
 }
 
+// BudgetSummaryGetResponseDto sums budgets for the whole trip, as budgets of a category or a day are parts of them
 type BudgetSummaryGetResponseDto struct {
-	CurrencyCode  string                             `json:"currency_code"`
-	MyBudget      BudgetSummaryGetResponseBudgetItem `json:"my_budget"`
-	SessionBudget BudgetSummaryGetResponseBudgetItem `json:"session_budget"`
-	SpentByDay    map[string]float64                 `json:"spent_by_day"`
+	CurrencyCode      string                             `json:"currency_code"`
+	MyBudget          BudgetSummaryGetResponseBudgetItem `json:"my_budget"`
+	SessionBudget     BudgetSummaryGetResponseBudgetItem `json:"session_budget"`
+	SpentByDay        map[string]money.Decimal           `json:"spent_by_day"`
+	MySpentByCategory map[string]money.Decimal           `json:"my_spent_by_category"`
 }
 
 type BudgetCurrentGetRequestDto struct {
@@ -391,31 +451,103 @@ type BudgetCurrentGetRequestDto struct {
 }
 
 type BudgetCurrentGetResponseItem struct {
-	CurrencyCode string  `json:"currency_code"`
-	Spent        float64 `json:"spent"`
-	Total        float64 `json:"total"`
+	BudgetId     string        `json:"budget_id"`
+	CurrencyCode string        `json:"currency_code"`
+	Category     *string       `json:"category"`
+	Day          *string       `json:"day"`
+	Spent        money.Decimal `json:"spent"`
+	Total        money.Decimal `json:"total"`
+	Threshold    *int64        `json:"threshold"` // highest threshold percent reached, if any
+}
+
+// BudgetThresholdEvent is sent to the budget owner when an expenditure makes spending cross a threshold
+type BudgetThresholdEvent struct {
+	SessionId     string        `json:"session_id"`
+	BudgetId      string        `json:"budget_id"`
+	ExpenditureId string        `json:"expenditure_id"`
+	CurrencyCode  string        `json:"currency_code"`
+	Category      *string       `json:"category"`
+	Day           *string       `json:"day"`
+	Spent         money.Decimal `json:"spent"`
+	Total         money.Decimal `json:"total"`
+	Threshold     int64         `json:"threshold"` // percent, 80 or 100
 }
 
 type BudgetCurrentGetResponseDto []BudgetCurrentGetResponseItem
 
+type BudgetForecastGetRequestDto struct {
+	SessionId string `form:"session_id" binding:"required"`
+}
+
+type BudgetForecastUnusualDayItem struct {
+	Day   string        `json:"day"` // 2006-01-02
+	Spent money.Decimal `json:"spent"`
+	Ratio float64       `json:"ratio"` // to the median of days with spending
+}
+
+type BudgetForecastItem struct {
+	Budget         money.Decimal                  `json:"budget"`
+	Spent          money.Decimal                  `json:"spent"`
+	Remaining      money.Decimal                  `json:"remaining"` // negative if over budget
+	DailyAverage   money.Decimal                  `json:"daily_average"`
+	ProjectedTotal money.Decimal                  `json:"projected_total"`
+	DailyAllowance *money.Decimal                 `json:"daily_allowance"` // null if no day is left
+	UnusualDays    []BudgetForecastUnusualDayItem `json:"unusual_days"`
+}
+
+// BudgetForecastGetResponseDto projects spending to the end of the trip by the daily average so far.
+// Elapsed days include today, and remaining days are after today.
+type BudgetForecastGetResponseDto struct {
+	CurrencyCode    string             `json:"currency_code"`
+	StartAt         string             `json:"start_at"` // 2006-01-02
+	EndAt           string             `json:"end_at"`   // 2006-01-02
+	TripDays        int                `json:"trip_days"`
+	ElapsedDays     int                `json:"elapsed_days"`
+	RemainingDays   int                `json:"remaining_days"`
+	MyForecast      BudgetForecastItem `json:"my_forecast"`
+	SessionForecast BudgetForecastItem `json:"session_forecast"`
+}
+
 /* ---------------- Expenditure ---------------- */
 
 type ExpendituresGetRequestDto struct {
-	SessionId string `form:"session_id" binding:"required"`
+	SessionId      string   `form:"session_id" binding:"required"`
+	Categories     []string `form:"category"`       // any of them, repeated
+	PayerIds       []string `form:"payer_id"`       // paid by any of them, repeated
+	ParticipantIds []string `form:"participant_id"` // distributed to any of them, repeated
+	CurrencyCodes  []string `form:"currency_code"`  // any of them, repeated
+	From           int64    `form:"from"`           // unix millis of payed at, inclusive
+	To             int64    `form:"to"`             // unix millis of payed at, exclusive
+	MinAmount      string   `form:"min_amount"`     // total price in major unit, which needs currency_code
+	MaxAmount      string   `form:"max_amount"`     // total price in major unit, which needs currency_code
+	Name           string   `form:"name"`           // contained in name
+	Sort           string   `form:"sort"`           // payed_at, total_price or name, "-" prefixed for descending, -payed_at by default
+}
+
+type ExpendituresSearchRequestDto struct {
+	ExpendituresGetRequestDto
+	Cursor string `form:"cursor"` // next_cursor of the previous page
+	Limit  int    `form:"limit"`  // 50 by default
 }
 
 type ExpendituresGetResponseItem struct {
-	ExpenditureId string    `json:"expenditure_id"`
-	Category      string    `json:"category"`
-	Name          string    `json:"name"`
-	TotalPrice    float64   `json:"total_price"`
-	CurrencyCode  string    `json:"currency_code"`
-	PayedAt       time.Time `json:"payed_at"`
-	HasReceipt    bool      `json:"has_receipt"`
+	ExpenditureId string        `json:"expenditure_id"`
+	Category      string        `json:"category"`
+	Name          string        `json:"name"`
+	TotalPrice    money.Decimal `json:"total_price"`
+	CurrencyCode  string        `json:"currency_code"`
+	PayedAt       time.Time     `json:"payed_at"`
+	HasReceipt    bool          `json:"has_receipt"`
+	RefundOf      *string       `json:"refund_of"` // original expenditure, if it is a refund of that
 }
 
 type ExpendituresGetResponseDto []ExpendituresGetResponseItem
 
+type ExpendituresSearchResponseDto struct {
+	Expenditures []ExpendituresGetResponseItem `json:"expenditures"`
+	NextCursor   *string                       `json:"next_cursor"` // null on the last page
+}
+
 type ExpenditureGetRequestDto struct {
 	ExpenditureId string `form:"expenditure_id" binding:"required"`
 }
@@ -426,91 +558,339 @@ type ExpenditureGetResponseDistributionItem struct {
 }
 
 type ExpenditureGetResponseItem struct {
-	Label       string   `json:"label" binding:"required"`
-	Price       float64 `json:"price" binding:"required"`
-	Allocations []string `json:"allocations" binding:"required"`
+	ExpenditureItemId string        `json:"expenditure_item_id"`
+	Label             string        `json:"label" binding:"required"`
+	Price             money.Decimal `json:"price" binding:"required"`
+	Allocations       []string      `json:"allocations" binding:"required"`
+}
+
+type ExpenditureGetResponseReceipt struct {
+	ReceiptId string `json:"receipt_id"`
+	Url       string `json:"url"` // asset url, which needs authorization
 }
 
 type ExpenditureGetResponseDto struct {
 	Name         string                                   `json:"name"`
-	TotalPrice   float64                                  `json:"total_price"`
+	TotalPrice   money.Decimal                            `json:"total_price"`
 	CurrencyCode string                                   `json:"currency_code"`
 	Category     string                                   `json:"category"`
 	PayersId     []string                                 `json:"payers_id"`
 	Distribution []ExpenditureGetResponseDistributionItem `json:"distribution"`
 	Items        []ExpenditureGetResponseItem             `json:"items"`
+	Charges      []ExpenditureChargeDto                   `json:"charges"`
+	Receipts     []ExpenditureGetResponseReceipt          `json:"receipts"`
 	PayedAt      time.Time                                `json:"payed_at"`
+	Version      int                                      `json:"version"` // also given as ETag
+	RefundOf     *string                                  `json:"refund_of"`
+	Refunds      []ExpenditureGetResponseRefund           `json:"refunds"` // refunds linked to this
+}
+
+type ExpenditureGetResponseRefund struct {
+	ExpenditureId string        `json:"expenditure_id"`
+	Name          string        `json:"name"`
+	TotalPrice    money.Decimal `json:"total_price"` // negative
+	PayedAt       time.Time     `json:"payed_at"`
 }
 
 type ExpenditureCreateRequestDto struct {
-	ExpenditureId *string  `json:"expenditure_id"`
-	Name          string   `json:"name" binding:"required"`
-	Category      string   `json:"category" binding:"required"`
-	TotalPrice    *float64 `json:"total_price" binding:"required"`
-	CurrencyCode  string   `json:"currency_code" binding:"required"`
-	PayersId      []string `json:"payers_id" binding:"required"`
-	Distribution  []struct {
-		UserId string   `json:"user_id" binding:"required"`
-		Amount Fraction `json:"amount" binding:"required"`
-	} `json:"distribution"`
-	Items []struct {
-		Label       string   `json:"label" binding:"required"`
-		Price       *float64 `json:"price" binding:"required"`
-		Allocations []string `json:"allocations" binding:"required"`
+	ExpenditureId *string                      `json:"expenditure_id"` // required to update
+	Version       *int                         `json:"version"`        // to update, unless If-Match header is given
+	Name          string                       `json:"name" binding:"required"`
+	Category      string                       `json:"category" binding:"required"`
+	TotalPrice    *money.Decimal               `json:"total_price" binding:"required"`
+	CurrencyCode  string                       `json:"currency_code" binding:"required"`
+	PayersId      []string                     `json:"payers_id" binding:"required"` // member ids, or "kitty" alone to pay from the kitty
+	Distribution  []ExpenditureDistributionDto `json:"distribution"`
+	Split         *ExpenditureSplitDto         `json:"split"` // computed into distribution, instead of giving distribution
+	Items         []struct {
+		ExpenditureItemId *string        `json:"expenditure_item_id"` // to update the existing item
+		Label             string         `json:"label" binding:"required"`
+		Price             *money.Decimal `json:"price" binding:"required"`
+		Allocations       []string       `json:"allocations" binding:"required"`
 	} `json:"items"`
-	PayedAt   int64  `json:"payed_at" binding:"required"`
-	SessionId string `json:"session_id" binding:"required"`
+	Charges    []ExpenditureChargeDto `json:"charges"`     // tax, tip and service charge over items
+	ReceiptIds []string               `json:"receipt_ids"` // uploaded receipts to attach on create
+	PayedAt    int64                  `json:"payed_at" binding:"required"`
+	SessionId  string                 `json:"session_id" binding:"required"`
+	// RefundOf links a refund to the original expenditure. Refunds have negative total price and distribution,
+	// which credit payers who got the money back, and they may stand alone without RefundOf.
+	RefundOf *string `json:"refund_of"`
+}
+
+type ExpenditureCreateResponseDto struct {
+	ExpenditureId string `json:"expenditure_id"`
+	Version       int    `json:"version"`
+	// Duplicates are likely the same payment recorded already, which can be merged
+	Duplicates []ExpenditureDuplicateItem `json:"duplicates"`
+}
+
+type ExpenditureDuplicateItem struct {
+	ExpenditureId string        `json:"expenditure_id"`
+	Category      string        `json:"category"`
+	Name          string        `json:"name"`
+	TotalPrice    money.Decimal `json:"total_price"`
+	CurrencyCode  string        `json:"currency_code"`
+	PayedAt       time.Time     `json:"payed_at"`
+	Score         float64       `json:"score"` // how likely it is the same payment, in [0, 1]
+}
+
+type ExpenditureUpdateResponseDto struct {
+	ExpenditureId string `json:"expenditure_id"`
+	Version       int    `json:"version"`
+}
+
+type ExpenditureDistributionDto struct {
+	UserId string   `json:"user_id" binding:"required"`
+	Amount Fraction `json:"amount" binding:"required"`
+}
+
+type ExpenditureSplitDto struct {
+	Mode    string                   `json:"mode" binding:"required"` // equal, percentage, shares, exact, except
+	UserIds []string                 `json:"user_ids"`                // participants of equal, or excluded users of except
+	Values  map[string]money.Decimal `json:"values"`                  // percentages, shares or amounts by user id, positive for refunds as well
+}
+
+// ExpenditureChargeDto is either a percentage of items or a fixed amount.
+// Amount is always given in responses, computed from percent if so.
+type ExpenditureChargeDto struct {
+	Kind    string         `json:"kind" binding:"required"` // tax, tip, service
+	Label   string         `json:"label"`
+	Percent *money.Decimal `json:"percent"`
+	Amount  *money.Decimal `json:"amount"`
 }
 
 type ExpenditureDeleteRequestDto struct {
 	ExpenditureId string `json:"expenditure_id" binding:"required"`
 }
 
+// ExpenditureMergeRequestDto merges the duplicate into the expenditure, where receipts of the duplicate are moved
+type ExpenditureMergeRequestDto struct {
+	ExpenditureId string `json:"expenditure_id" binding:"required"` // kept
+	DuplicateId   string `json:"duplicate_id" binding:"required"`   // deleted
+}
+
+type ExpenditureRevisionsGetRequestDto struct {
+	ExpenditureId string `form:"expenditure_id" binding:"required"`
+}
+
+type ExpenditureRevisionsGetResponseItem struct {
+	ExpenditureRevisionId string          `json:"expenditure_revision_id"`
+	Revision              int             `json:"revision"`
+	UserId                *string         `json:"user_id"` // editor, null for the state before history was kept
+	Action                string          `json:"action"`  // created, updated, deleted, restored, merged
+	Snapshot              json.RawMessage `json:"snapshot"`
+	Diff                  json.RawMessage `json:"diff"`
+	CreatedAt             time.Time       `json:"created_at"`
+}
+
+type ExpenditureRevisionsGetResponseDto []ExpenditureRevisionsGetResponseItem
+
+type ExpenditureRevisionRestoreRequestDto struct {
+	ExpenditureRevisionId string `json:"expenditure_revision_id" binding:"required"`
+}
+
+// ExpenditureUpdatedEvent is sent to other members when an expenditure is edited or restored
+type ExpenditureUpdatedEvent struct {
+	ExpenditureId string                            `json:"expenditure_id"`
+	UserId        string                            `json:"user_id"`
+	Action        string                            `json:"action"`
+	Version       int                               `json:"version"`
+	Diff          []platform.ExpenditureFieldChange `json:"diff"`
+}
+
 // receipts
 
 type ExpenditureReceiptUploadResponseItem struct {
-	Label string  `json:"label"`
-	Price float64 `json:"price"`
+	Label string        `json:"label"`
+	Price money.Decimal `json:"price"`
+}
+
+type ExpenditureReceiptAttachRequestDto struct {
+	ReceiptId     string  `json:"receipt_id" binding:"required"`
+	ExpenditureId *string `json:"expenditure_id"` // null to detach
+}
+
+// ExpenditureReceiptDuplicateItem is a receipt of the same image uploaded before
+type ExpenditureReceiptDuplicateItem struct {
+	ReceiptId     string  `json:"receipt_id"`
+	ExpenditureId *string `json:"expenditure_id"` // expenditure made from it already, if attached
+	Url           string  `json:"url"`
+	Distance      int     `json:"distance"` // different bits of image hashes, zero for the same image
 }
 
 type ExpenditureReceiptUploadResponseDto struct {
+	ReceiptId    string                                 `json:"receipt_id"` // to attach to expenditure
 	CurrencyCode *string                                `json:"currency_code"`
 	Items        []ExpenditureReceiptUploadResponseItem `json:"items"`
+	Charges      []ExpenditureChargeDto                 `json:"charges"`
+	// fields to pre-fill the expenditure, which are null if not found or not confident
+	PayedAt     *time.Time                      `json:"payed_at"` // local time of the receipt in UTC
+	Merchant    *string                         `json:"merchant"`
+	Address     *string                         `json:"address"`
+	CountryCode *string                         `json:"country_code"` // ISO 3166-1 alpha-2
+	Latitude    *float64                        `json:"latitude"`
+	Longitude   *float64                        `json:"longitude"`
+	Category    *receipt_ocr.CategorySuggestion `json:"category"`
+	// Duplicates are likely the same receipt uploaded already by the user or for the session
+	Duplicates []ExpenditureReceiptDuplicateItem `json:"duplicates"`
+}
+
+/* ---------------- Kitty ---------------- */
+
+type KittyGetRequestDto struct {
+	SessionId string `form:"session_id" binding:"required"`
+}
+
+type KittyBalanceItem struct {
+	CurrencyCode string        `json:"currency_code"`
+	Contributed  money.Decimal `json:"contributed"`
+	Spent        money.Decimal `json:"spent"`
+	Balance      money.Decimal `json:"balance"`
+}
+
+type KittyContributionItem struct {
+	KittyContributionId string        `json:"kitty_contribution_id"`
+	UserId              string        `json:"user_id"`
+	CurrencyCode        string        `json:"currency_code"`
+	Amount              money.Decimal `json:"amount"`
+	Memo                *string       `json:"memo"`
+	ContributedAt       int64         `json:"contributed_at"`
+}
+
+// KittyGetResponseDto is the common pot of the session, which is chosen as payer by platform.KittyPayerId
+type KittyGetResponseDto struct {
+	PayerId       string                  `json:"payer_id"`
+	Balances      []KittyBalanceItem      `json:"balances"`
+	Contributions []KittyContributionItem `json:"contributions"`
+}
+
+type KittyContributeRequestDto struct {
+	SessionId     string         `json:"session_id" binding:"required"`
+	CurrencyCode  string         `json:"currency_code" binding:"required"`
+	Amount        *money.Decimal `json:"amount" binding:"required"`
+	Memo          *string        `json:"memo"`
+	ContributedAt int64          `json:"contributed_at"` // timestamp (ms), now if omitted
+}
+
+type KittyContributionDeleteRequestDto struct {
+	KittyContributionId string `json:"kitty_contribution_id" binding:"required"`
 }
 
 /* ---------------- Settlements ---------------- */
 
 type SettlementInfoGetRequestDto struct {
-	SessionId string `form:"session_id" binding:"required"`
+	SessionId     string `form:"session_id" binding:"required"`
+	Mode          string `form:"mode"`           // pairwise, simplified (default)
+	CurrencyMode  string `form:"currency_mode"`  // converted (default), per_currency
+	NetCurrencies bool   `form:"net_currencies"` // net debts in different currencies out, for per_currency
 }
 
 type SettlementInfoUsage struct {
-	Meal        float64 `json:"meal"`
-	Lodgment    float64 `json:"lodgment"`
-	Transport   float64 `json:"transport"`
-	Shopping    float64 `json:"shopping"`
-	Activity    float64 `json:"activity"`
-	Etc         float64 `json:"etc"`
-	Unknown     float64 `json:"unknown"`
-	TotalBudget float64 `json:"total_budget"`
+	Meal        money.Decimal `json:"meal"`
+	Lodgment    money.Decimal `json:"lodgment"`
+	Transport   money.Decimal `json:"transport"`
+	Shopping    money.Decimal `json:"shopping"`
+	Activity    money.Decimal `json:"activity"`
+	Etc         money.Decimal `json:"etc"`
+	Unknown     money.Decimal `json:"unknown"`
+	TotalBudget money.Decimal `json:"total_budget"`
 }
 
 type SettlementInfoSettlement struct {
-	Owed         bool    `json:"owed"`
-	TargetUserId string  `json:"target_user_id"`
-	Amount       float64 `json:"amount"`
-	CurrencyCode string  `json:"currency_code"`
+	Owed         bool          `json:"owed"`
+	TargetUserId string        `json:"target_user_id"`
+	Amount       money.Decimal `json:"amount"`
+	CurrencyCode string        `json:"currency_code"` // creditor's currency, or original currency for per_currency
+	Netted       bool          `json:"netted"`        // reduced by debts in other currencies
 }
 
 type SettlementInfoGetResponseDto struct {
-	SessionUsage SettlementInfoUsage        `json:"session_usage"`
-	MyUsage      SettlementInfoUsage        `json:"my_usage"`
-	Settlements  []SettlementInfoSettlement `json:"settlements"`
+	Mode          string                     `json:"mode"`
+	CurrencyMode  string                     `json:"currency_mode"`
+	NetCurrencies bool                       `json:"net_currencies"`
+	SessionUsage  SettlementInfoUsage        `json:"session_usage"`
+	MyUsage       SettlementInfoUsage        `json:"my_usage"`
+	Settlements   []SettlementInfoSettlement `json:"settlements"`
+	Kitty         []SettlementInfoKitty      `json:"kitty"`
+}
+
+// SettlementInfoKitty is the kitty in a currency, whose balance is refunded to contributors
+type SettlementInfoKitty struct {
+	CurrencyCode string                      `json:"currency_code"`
+	Contributed  money.Decimal               `json:"contributed"`
+	Spent        money.Decimal               `json:"spent"`
+	Balance      money.Decimal               `json:"balance"`
+	Refunds      []SettlementInfoKittyRefund `json:"refunds"` // negative amount is to make up for overspending
+}
+
+type SettlementInfoKittyRefund struct {
+	UserId string        `json:"user_id"`
+	Amount money.Decimal `json:"amount"`
 }
 
 type SettlementCompleteRequestDto struct {
-	TargetUserId string  `json:"target_user_id" binding:"required"`
-	Amount       float64 `json:"amount" binding:"required"`
-	CurrencyCode string  `json:"currency_code" binding:"required"`
-	SessionId    string  `json:"session_id" binding:"required"`
+	TargetUserId string         `json:"target_user_id" binding:"required"`
+	Amount       *money.Decimal `json:"amount" binding:"required"`
+	CurrencyCode string         `json:"currency_code" binding:"required"`
+	SessionId    string         `json:"session_id" binding:"required"`
+}
+
+type SettlementDeclareRequestDto struct {
+	SessionId    string         `json:"session_id" binding:"required"`
+	TargetUserId string         `json:"target_user_id" binding:"required"` // creditor
+	Amount       *money.Decimal `json:"amount" binding:"required"`
+	CurrencyCode string         `json:"currency_code" binding:"required"`
+	Method       *string        `json:"method"` // cash, bank_transfer, kakao_pay
+	Memo         *string        `json:"memo"`
+}
+
+type SettlementConfirmRequestDto struct {
+	TransactionId string `json:"transaction_id" binding:"required"`
+}
+
+type SettlementDisputeRequestDto struct {
+	TransactionId string  `json:"transaction_id" binding:"required"`
+	Memo          *string `json:"memo"`
+}
+
+type SettlementTransactionsGetRequestDto struct {
+	SessionId string `form:"session_id" binding:"required"`
+	Page      int    `form:"page"`      // from 1, 1 by default
+	PageSize  int    `form:"page_size"` // 20 by default
+}
+
+type SettlementTransactionAudit struct {
+	UserId    string  `json:"user_id"`
+	Action    string  `json:"action"` // created, declared, confirmed, disputed, voided
+	Memo      *string `json:"memo"`
+	CreatedAt int64   `json:"created_at"`
+}
+
+type SettlementTransaction struct {
+	TransactionId  string                       `json:"transaction_id"`
+	SenderUserId   string                       `json:"sender_user_id"`
+	ReceiverUserId string                       `json:"receiver_user_id"`
+	Amount         money.Decimal                `json:"amount"`
+	CurrencyCode   string                       `json:"currency_code"`
+	SentAt         int64                        `json:"sent_at"`
+	Status         string                       `json:"status"` // declared, confirmed, disputed
+	Method         *string                      `json:"method"`
+	Memo           *string                      `json:"memo"`
+	ConfirmedAt    *int64                       `json:"confirmed_at"`
+	Voided         bool                         `json:"voided"`
+	VoidedAt       *int64                       `json:"voided_at"`
+	VoidedBy       *string                      `json:"voided_by"`
+	Audits         []SettlementTransactionAudit `json:"audits"`
+}
+
+type SettlementTransactionsGetResponseDto struct {
+	Transactions []SettlementTransaction `json:"transactions"`
+	Page         int                     `json:"page"`
+	PageSize     int                     `json:"page_size"`
+	TotalCount   int                     `json:"total_count"`
+}
+
+type SettlementTransactionVoidRequestDto struct {
+	TransactionId string  `json:"transaction_id" binding:"required"`
+	Reason        *string `json:"reason"`
 }
@@ -1,20 +1,28 @@
 package platform
 
 import (
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"math/big"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 	"travel-ai/controllers/socket"
 	util2 "travel-ai/controllers/util"
+	"travel-ai/libs/money"
+	"travel-ai/libs/phash"
 	"travel-ai/log"
 	"travel-ai/service/database"
 	"travel-ai/service/platform"
 	"travel-ai/service/platform/database_io"
+	"travel-ai/service/receipt_ocr"
+	"travel-ai/service/split"
 	"travel-ai/third_party/opencv"
-	"travel-ai/third_party/taggun_receipt_ocr"
 	"travel-ai/util"
 )
 
@@ -28,12 +36,127 @@ func Expenditures(c *gin.Context) {
 		return
 	}
 
+	expenditureQuery, ok := expenditureQuery(c, uid, query)
+	if !ok {
+		return
+	}
+
+	expenditureEntities, err := database_io.SelectExpenditures(expenditureQuery)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	expenditures := make(ExpendituresGetResponseDto, 0)
+	for _, e := range expenditureEntities {
+		expenditures = append(expenditures, expendituresGetResponseItem(e))
+	}
+
+	c.JSON(http.StatusOK, expenditures)
+}
+
+func SearchExpenditures(c *gin.Context) {
+	uid := c.GetString("uid")
+
+	var query ExpendituresSearchRequestDto
+	if err := c.ShouldBindQuery(&query); err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid request query: "+err.Error())
+		return
+	}
+
+	expenditureQuery, ok := expenditureQuery(c, uid, query.ExpendituresGetRequestDto)
+	if !ok {
+		return
+	}
+
+	const defaultLimit, maxLimit = 50, 200
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	// one more to know if there is the next page
+	expenditureQuery.Limit = limit + 1
+
+	if query.Cursor != "" {
+		cursor, err := database_io.DecodeExpenditureCursor(query.Cursor)
+		if err != nil {
+			util2.AbortWithStrJson(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		if cursor.Sort != expenditureQuery.Sort {
+			util2.AbortWithStrJson(c, http.StatusBadRequest, "cursor is not of the sort")
+			return
+		}
+		if cursor.Descending != expenditureQuery.Descending {
+			util2.AbortWithStrJson(c, http.StatusBadRequest, "cursor is not of the order")
+			return
+		}
+		expenditureQuery.After = cursor
+	}
+
+	expenditureEntities, err := database_io.SelectExpenditures(expenditureQuery)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	resp := ExpendituresSearchResponseDto{
+		Expenditures: make([]ExpendituresGetResponseItem, 0),
+	}
+	if len(expenditureEntities) > limit {
+		expenditureEntities = expenditureEntities[:limit]
+		last := expenditureEntities[limit-1]
+		nextCursor := database_io.NewExpenditureCursor(expenditureQuery.Sort, expenditureQuery.Descending, last.ExpenditureEntity).Encode()
+		resp.NextCursor = &nextCursor
+	}
+	for _, e := range expenditureEntities {
+		resp.Expenditures = append(resp.Expenditures, expendituresGetResponseItem(e))
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func expendituresGetResponseItem(e database_io.ExpenditureHasReceiptEntity) ExpendituresGetResponseItem {
+	return ExpendituresGetResponseItem{
+		ExpenditureId: e.ExpenditureId,
+		Name:          e.Name,
+		TotalPrice:    e.TotalPriceMoney().Decimal(),
+		CurrencyCode:  e.CurrencyCode,
+		Category:      e.Category,
+		PayedAt:       e.PayedAt,
+		HasReceipt:    e.HasReceipt,
+		RefundOf:      e.RefundOf,
+	}
+}
+
+// minorAmountQuery parses amount in major unit into minor unit of the currency, or nil if not given
+func minorAmountQuery(raw string, currencyCode string) (*int64, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	decimal, err := money.ParseDecimal(raw)
+	if err != nil {
+		return nil, err
+	}
+	amount := money.FromRat(decimal.Rat(), currencyCode).Amount
+	return &amount, nil
+}
+
+// expenditureQuery checks if user can see expenditures of the session, and makes the query of filters and sort.
+// It aborts with bad request if the filters are invalid.
+func expenditureQuery(c *gin.Context, uid string, query ExpendituresGetRequestDto) (database_io.ExpenditureQuery, bool) {
 	// check if session exists
 	_, err := database_io.GetSession(query.SessionId)
 	if err != nil {
 		log.Error(err)
 		util2.AbortWithStrJson(c, http.StatusBadRequest, "session does not exist")
-		return
+		return database_io.ExpenditureQuery{}, false
 	}
 
 	// check if user is in session
@@ -41,34 +164,73 @@ func Expenditures(c *gin.Context) {
 	if err != nil {
 		log.Error(err)
 		c.AbortWithStatus(http.StatusInternalServerError)
-		return
+		return database_io.ExpenditureQuery{}, false
 	}
 	if !yes {
 		util2.AbortWithStrJson(c, http.StatusBadRequest, "user is not in session")
-		return
+		return database_io.ExpenditureQuery{}, false
 	}
 
-	expenditureEntities, err := database_io.GetExpendituresBySessionId(query.SessionId)
-	if err != nil {
-		log.Error(err)
-		c.AbortWithStatus(http.StatusInternalServerError)
-		return
+	expenditureQuery := database_io.ExpenditureQuery{
+		SessionId:      query.SessionId,
+		Categories:     query.Categories,
+		PayerIds:       query.PayerIds,
+		ParticipantIds: query.ParticipantIds,
+		CurrencyCodes:  query.CurrencyCodes,
+		Name:           strings.TrimSpace(query.Name),
+		Sort:           database_io.ExpenditureSortPayedAt,
+		Descending:     true,
 	}
 
-	expenditures := make(ExpendituresGetResponseDto, 0)
-	for _, e := range expenditureEntities {
-		expenditures = append(expenditures, ExpendituresGetResponseItem{
-			ExpenditureId: e.ExpenditureId,
-			Name:          e.Name,
-			TotalPrice:    e.TotalPrice,
-			CurrencyCode:  e.CurrencyCode,
-			Category:      e.Category,
-			PayedAt:       e.PayedAt,
-			HasReceipt:    e.HasReceipt,
-		})
+	for _, category := range query.Categories {
+		if !platform.IsValidExpenditureCategory(category) {
+			util2.AbortWithStrJsonF(c, http.StatusBadRequest, "invalid category: %s", category)
+			return database_io.ExpenditureQuery{}, false
+		}
+	}
+	if query.From != 0 {
+		from := time.UnixMilli(query.From)
+		expenditureQuery.PayedFrom = &from
+	}
+	if query.To != 0 {
+		to := time.UnixMilli(query.To)
+		expenditureQuery.PayedTo = &to
 	}
 
-	c.JSON(http.StatusOK, expenditures)
+	// amounts are compared in each currency, as they are stored in minor unit
+	if query.MinAmount != "" || query.MaxAmount != "" {
+		if len(query.CurrencyCodes) == 0 {
+			util2.AbortWithStrJson(c, http.StatusBadRequest, "amount range needs currency_code")
+			return database_io.ExpenditureQuery{}, false
+		}
+		for _, currencyCode := range query.CurrencyCodes {
+			minAmount, err := minorAmountQuery(query.MinAmount, currencyCode)
+			if err != nil {
+				util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid min amount: "+err.Error())
+				return database_io.ExpenditureQuery{}, false
+			}
+			maxAmount, err := minorAmountQuery(query.MaxAmount, currencyCode)
+			if err != nil {
+				util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid max amount: "+err.Error())
+				return database_io.ExpenditureQuery{}, false
+			}
+			expenditureQuery.AmountRanges = append(expenditureQuery.AmountRanges, database_io.ExpenditureAmountRange{
+				CurrencyCode: currencyCode,
+				Min:          minAmount,
+				Max:          maxAmount,
+			})
+		}
+	}
+
+	if query.Sort != "" {
+		expenditureQuery.Descending = strings.HasPrefix(query.Sort, "-")
+		expenditureQuery.Sort = strings.TrimPrefix(query.Sort, "-")
+		if !database_io.IsValidExpenditureSort(expenditureQuery.Sort) {
+			util2.AbortWithStrJsonF(c, http.StatusBadRequest, "invalid sort: %s", query.Sort)
+			return database_io.ExpenditureQuery{}, false
+		}
+	}
+	return expenditureQuery, true
 }
 
 func Expenditure(c *gin.Context) {
@@ -157,21 +319,90 @@ func Expenditure(c *gin.Context) {
 		}
 
 		items = append(items, ExpenditureGetResponseItem{
-			Label:       item.Label,
-			Price:       item.Price,
-			Allocations: allocatedUsers,
+			ExpenditureItemId: item.ExpenditureItemId,
+			Label:             item.Label,
+			Price:             money.New(item.Price, expenditureEntity.CurrencyCode).Decimal(),
+			Allocations:       allocatedUsers,
+		})
+	}
+
+	// get charges
+	chargeEntities, err := database_io.GetExpenditureCharges(query.ExpenditureId)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	charges := make([]ExpenditureChargeDto, 0)
+	for _, charge := range chargeEntities {
+		amount := money.New(charge.Amount, expenditureEntity.CurrencyCode).Decimal()
+		chargeDto := ExpenditureChargeDto{
+			Kind:   charge.Kind,
+			Label:  charge.Label,
+			Amount: &amount,
+		}
+		if charge.Percent != nil {
+			percent, err := money.ParseDecimal(*charge.Percent)
+			if err != nil {
+				log.Error(err)
+				c.AbortWithStatus(http.StatusInternalServerError)
+				return
+			}
+			chargeDto.Percent = &percent
+		}
+		charges = append(charges, chargeDto)
+	}
+
+	// get receipts
+	receiptEntities, err := database_io.GetReceiptsByExpenditureId(query.ExpenditureId)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	receipts := make([]ExpenditureGetResponseReceipt, 0)
+	for _, receipt := range receiptEntities {
+		receipts = append(receipts, ExpenditureGetResponseReceipt{
+			ReceiptId: receipt.ReceiptId,
+			Url:       platform.ReceiptUrl(receipt.ReceiptId),
+		})
+	}
+
+	// get refunds
+	refundEntities, err := database_io.GetRefundsOf(query.ExpenditureId)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	refunds := make([]ExpenditureGetResponseRefund, 0)
+	for _, refund := range refundEntities {
+		refunds = append(refunds, ExpenditureGetResponseRefund{
+			ExpenditureId: refund.ExpenditureId,
+			Name:          refund.Name,
+			TotalPrice:    refund.TotalPriceMoney().Decimal(),
+			PayedAt:       refund.PayedAt,
 		})
 	}
 
+	c.Header("ETag", expenditureETag(expenditureEntity.Version))
 	c.JSON(http.StatusOK, ExpenditureGetResponseDto{
 		Name:         expenditureEntity.Name,
-		TotalPrice:   expenditureEntity.TotalPrice,
+		TotalPrice:   expenditureEntity.TotalPriceMoney().Decimal(),
 		CurrencyCode: expenditureEntity.CurrencyCode,
 		Category:     expenditureEntity.Category,
 		PayersId:     payers,
 		Distribution: distribution,
 		Items:        items,
+		Charges:      charges,
+		Receipts:     receipts,
 		PayedAt:      expenditureEntity.PayedAt,
+		Version:      expenditureEntity.Version,
+		RefundOf:     expenditureEntity.RefundOf,
+		Refunds:      refunds,
 	})
 }
 
@@ -185,12 +416,151 @@ func CreateExpenditure(c *gin.Context) {
 		return
 	}
 
+	after, ok := expenditureSnapshot(c, uid, &body)
+	if !ok {
+		return
+	}
+
+	// editing with expenditure id is kept for old clients, which needs the version as well
+	if body.ExpenditureId != nil {
+		updateExpenditure(c, uid, body, after)
+		return
+	}
+
+	// receipts uploaded for the expenditure
+	for _, receiptId := range body.ReceiptIds {
+		if !checkReceiptAttachable(c, uid, receiptId, body.SessionId, nil) {
+			return
+		}
+	}
+
+	expenditureId := uuid.New().String()
+
+	tx, err := database.DB.BeginTx(c, nil)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if !checkKittyPaymentTx(c, tx, body.SessionId, "", after.PayersId, after.TotalPriceMoney()) {
+		_ = tx.Rollback()
+		return
+	}
+
+	if err := platform.InsertExpenditureSnapshotTx(tx, expenditureId, body.SessionId, after); err != nil {
+		_ = tx.Rollback()
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	for _, receiptId := range body.ReceiptIds {
+		if err := database_io.AttachReceiptTx(tx, receiptId, body.SessionId, &expenditureId); err != nil {
+			_ = tx.Rollback()
+			log.Error(err)
+			if errors.Is(err, database_io.ErrReceiptOfAnotherSession) {
+				util2.AbortWithStrJson(c, http.StatusBadRequest, err.Error())
+				return
+			}
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	_, version, err := platform.RecordExpenditureRevisionTx(tx, expenditureId, body.SessionId, uid,
+		platform.ExpenditureRevisionCreated, nil, after)
+	if err != nil {
+		_ = tx.Rollback()
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	socket.SocketManager.Multicast(body.SessionId, uid, socket.EventExpenditureCreated, database.ExpenditureEntity{
+		ExpenditureId: expenditureId,
+		Name:          body.Name,
+		TotalPrice:    after.TotalPriceMoney().Amount,
+		CurrencyCode:  body.CurrencyCode,
+		Category:      body.Category,
+		SessionId:     body.SessionId,
+		PayedAt:       after.PayedAt,
+		Version:       version,
+	})
+
+	// shares of the expenditure can make budgets cross thresholds
+	userIds := make([]string, 0, len(after.Distribution))
+	for _, distribution := range after.Distribution {
+		userIds = append(userIds, distribution.UserId)
+	}
+	notifyBudgetThresholds(body.SessionId, expenditureId, userIds)
+
+	c.JSON(http.StatusOK, ExpenditureCreateResponseDto{
+		ExpenditureId: expenditureId,
+		Version:       version,
+		Duplicates:    expenditureDuplicates(body.SessionId, expenditureId, after),
+	})
+}
+
+// expenditureDuplicates warns of the same payment recorded already, which is not an error if it fails
+func expenditureDuplicates(sessionId string, expenditureId string, after *platform.ExpenditureSnapshot) []ExpenditureDuplicateItem {
+	items := make([]ExpenditureDuplicateItem, 0)
+	duplicates, err := platform.FindDuplicateExpenditures(sessionId, expenditureId, after.Name,
+		after.TotalPriceMoney(), after.PayedAt)
+	if err != nil {
+		log.Error(err)
+		return items
+	}
+	for _, duplicate := range duplicates {
+		e := duplicate.Expenditure
+		items = append(items, ExpenditureDuplicateItem{
+			ExpenditureId: e.ExpenditureId,
+			Category:      e.Category,
+			Name:          e.Name,
+			TotalPrice:    e.TotalPriceMoney().Decimal(),
+			CurrencyCode:  e.CurrencyCode,
+			PayedAt:       e.PayedAt,
+			Score:         duplicate.Score,
+		})
+	}
+	return items
+}
+
+func UpdateExpenditure(c *gin.Context) {
+	uid := c.GetString("uid")
+
+	var body ExpenditureCreateRequestDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if body.ExpenditureId == nil {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "expenditure id is required")
+		return
+	}
+
+	after, ok := expenditureSnapshot(c, uid, &body)
+	if !ok {
+		return
+	}
+	updateExpenditure(c, uid, body, after)
+}
+
+// expenditureSnapshot validates the body into the expenditure to save, or aborts with bad request
+func expenditureSnapshot(c *gin.Context, uid string, body *ExpenditureCreateRequestDto) (*platform.ExpenditureSnapshot, bool) {
 	// check if session exists
 	_, err := database_io.GetSession(body.SessionId)
 	if err != nil {
 		log.Error(err)
 		util2.AbortWithStrJson(c, http.StatusBadRequest, "session does not exist")
-		return
+		return nil, false
 	}
 
 	// check if user is in session
@@ -198,28 +568,53 @@ func CreateExpenditure(c *gin.Context) {
 	if err != nil {
 		log.Error(err)
 		c.AbortWithStatus(http.StatusInternalServerError)
-		return
+		return nil, false
 	}
 	if !yes {
 		util2.AbortWithStrJson(c, http.StatusBadRequest, "user is not in session")
-		return
+		return nil, false
 	}
 
 	// validate name
 	if len(body.Name) == 0 {
 		log.Error("name is empty")
 		util2.AbortWithStrJson(c, http.StatusBadRequest, "name is empty")
-		return
+		return nil, false
 	}
 
 	// validate total price
+	totalPrice, err := money.FromDecimal(*body.TotalPrice, body.CurrencyCode)
+	if err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid total price: "+err.Error())
+		return nil, false
+	}
+	refundId := ""
+	if body.ExpenditureId != nil {
+		refundId = *body.ExpenditureId
+	}
+	if !checkRefund(c, body.SessionId, refundId, body.RefundOf, body.Category, totalPrice) {
+		return nil, false
+	}
+	if body.Split != nil && len(body.Distribution) > 0 {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "either distribution or split should be given")
+		return nil, false
+	}
+	if body.Split != nil {
+		distribution, ok := splitDistribution(c, body.SessionId, *body.Split, totalPrice)
+		if !ok {
+			return nil, false
+		}
+		body.Distribution = distribution
+	}
+
 	calculatedTotalPrice := big.NewRat(0, 1)
 	ratDistributions := make(map[string]*big.Rat)
 	for _, dist := range body.Distribution {
 		if dist.Amount.Denominator == 0 {
 			log.Error("denominator is zero")
 			util2.AbortWithStrJson(c, http.StatusBadRequest, "denominator is zero")
-			return
+			return nil, false
 		}
 		distribution := big.NewRat(dist.Amount.Numerator, dist.Amount.Denominator)
 		calculatedTotalPrice.Add(calculatedTotalPrice, distribution)
@@ -227,34 +622,41 @@ func CreateExpenditure(c *gin.Context) {
 		if distribution.Cmp(big.NewRat(0, 1)) == 0 {
 			continue
 		}
+		// refunds are distributed in negative, and others in positive
+		if distribution.Sign() != totalPrice.Rat().Sign() {
+			util2.AbortWithStrJson(c, http.StatusBadRequest, "distribution should have the sign of total price")
+			return nil, false
+		}
 		ratDistributions[dist.UserId] = distribution
 	}
-	totalPriceRat := platform.Float64ToRat(*body.TotalPrice)
-	if calculatedTotalPrice.Cmp(totalPriceRat) != 0 {
-		log.Errorf("total price does not match distribution: (sum) %s != (total) %s from requested (%f)",
-			calculatedTotalPrice, totalPriceRat, *body.TotalPrice)
+	if calculatedTotalPrice.Cmp(totalPrice.Rat()) != 0 {
+		log.Errorf("total price does not match distribution: (sum) %s != (total) %s",
+			calculatedTotalPrice.FloatString(money.Exponent(body.CurrencyCode)), totalPrice)
 		util2.AbortWithStrJson(c, http.StatusBadRequest, "total price does not match distribution")
-		return
+		return nil, false
 	}
 
 	// validate payers
 	if len(body.PayersId) == 0 {
 		log.Error("no payer specified")
 		util2.AbortWithStrJson(c, http.StatusBadRequest, "no payer specified")
-		return
+		return nil, false
 	}
 
-	// validate payers each
+	// validate payers each, where the kitty is checked with the currency below
 	for _, payerId := range body.PayersId {
+		if payerId == platform.KittyPayerId {
+			continue
+		}
 		yes, err := platform.IsSessionMember(payerId, body.SessionId)
 		if err != nil {
 			log.Error(err)
 			c.AbortWithStatus(http.StatusInternalServerError)
-			return
+			return nil, false
 		}
 		if !yes {
 			util2.AbortWithStrJson(c, http.StatusBadRequest, "payer is not in session")
-			return
+			return nil, false
 		}
 	}
 
@@ -263,173 +665,872 @@ func CreateExpenditure(c *gin.Context) {
 	if err != nil {
 		log.Error(err)
 		c.AbortWithStatus(http.StatusInternalServerError)
-		return
+		return nil, false
 	}
 	if !yes {
 		log.Errorf("invalid currency code: %s", body.CurrencyCode)
 		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid currency code")
-		return
+		return nil, false
+	}
+
+	// the balance of the kitty is checked in the transaction which saves the expenditure
+	if !checkKittyPayers(c, body.PayersId) {
+		return nil, false
 	}
 
 	// validate category
 	if !platform.IsValidExpenditureCategory(body.Category) {
 		log.Errorf("invalid category: %s", body.Category)
 		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid category")
-		return
+		return nil, false
 	}
 
-	if len(body.Items) > 0 {
-		// validate distribution
-		calculatedAllocatedPrice := make(map[string]*big.Rat)
-		for _, item := range body.Items {
-			price := platform.Float64ToRat(*item.Price)
-			if len(item.Allocations) == 0 {
-				log.Errorf("no allocation specified for item: %s", item.Label)
-				util2.AbortWithStrJson(c, http.StatusBadRequest, "no allocation specified for item")
-				return
-			}
-			allocatedUserCnt := big.NewRat(int64(len(item.Allocations)), 1)
-			dividedPrice := new(big.Rat)
-			dividedPrice.Quo(price, allocatedUserCnt)
+	// validate item prices
+	itemPrices := make([]money.Money, len(body.Items))
+	for i, item := range body.Items {
+		price, err := money.FromDecimal(*item.Price, body.CurrencyCode)
+		if err != nil {
+			log.Error(err)
+			util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid item price: "+err.Error())
+			return nil, false
+		}
+		if price.Rat().Sign()*totalPrice.Rat().Sign() < 0 {
+			util2.AbortWithStrJson(c, http.StatusBadRequest, "item price should have the sign of total price")
+			return nil, false
+		}
+		itemPrices[i] = price
+	}
 
-			for _, allocatedUid := range item.Allocations {
-				// check if user exists
+	// validate charges
+	if len(body.Charges) > 0 && len(body.Items) == 0 {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "charges need items")
+		return nil, false
+	}
+	if len(body.Charges) > 0 && totalPrice.IsNegative() {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "refund cannot have charges")
+		return nil, false
+	}
+	subtotal := money.Zero(body.CurrencyCode)
+	for _, price := range itemPrices {
+		subtotal.Amount += price.Amount
+	}
+	charges := make([]platform.ExpenditureSnapshotCharge, len(body.Charges))
+	chargeTotal := money.Zero(body.CurrencyCode)
+	for i, charge := range body.Charges {
+		if !split.IsValidChargeKind(charge.Kind) {
+			util2.AbortWithStrJsonF(c, http.StatusBadRequest, "invalid charge kind: %s", charge.Kind)
+			return nil, false
+		}
+		if (charge.Percent == nil) == (charge.Amount == nil) {
+			util2.AbortWithStrJson(c, http.StatusBadRequest, "either percent or amount of charge should be given")
+			return nil, false
+		}
+
+		var amount money.Money
+		if charge.Percent != nil {
+			if charge.Percent.Sign() < 0 {
+				util2.AbortWithStrJson(c, http.StatusBadRequest, "charge should not be negative")
+				return nil, false
+			}
+			amount = money.FromRat(split.PercentOf(subtotal.Rat(), charge.Percent.Rat()), body.CurrencyCode)
+		} else {
+			amount, err = money.FromDecimal(*charge.Amount, body.CurrencyCode)
+			if err != nil {
+				util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid charge amount: "+err.Error())
+				return nil, false
+			}
+			if amount.IsNegative() {
+				util2.AbortWithStrJson(c, http.StatusBadRequest, "charge should not be negative")
+				return nil, false
+			}
+		}
+		chargeTotal.Amount += amount.Amount
+
+		label := charge.Label
+		if label == "" {
+			label = charge.Kind
+		}
+		charges[i] = platform.ExpenditureSnapshotCharge{
+			Kind:    charge.Kind,
+			Label:   label,
+			Percent: charge.Percent,
+			Amount:  amount.Decimal(),
+		}
+	}
+
+	if len(body.Items) > 0 {
+		// validate distribution
+		splitItems := make([]split.Item, len(body.Items))
+		for i, item := range body.Items {
+			if len(item.Allocations) == 0 {
+				log.Errorf("no allocation specified for item: %s", item.Label)
+				util2.AbortWithStrJson(c, http.StatusBadRequest, "no allocation specified for item")
+				return nil, false
+			}
+			for _, allocatedUid := range item.Allocations {
+				// check if user exists
 				yes, err := platform.IsSessionMember(allocatedUid, body.SessionId)
 				if err != nil {
 					log.Error(err)
 					c.AbortWithStatus(http.StatusInternalServerError)
-					return
+					return nil, false
 				}
 				if !yes {
 					util2.AbortWithStrJson(c, http.StatusBadRequest, "allocated user is not in session")
-					return
+					return nil, false
 				}
+			}
+			splitItems[i] = split.Item{Price: itemPrices[i].Rat(), UserIds: item.Allocations}
+		}
+
+		// charges are spread in proportion to items of each user
+		calculatedAllocatedPrice, err := split.Itemized(splitItems, chargeTotal.Rat())
+		if err != nil {
+			log.Error(err)
+			util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid items: "+err.Error())
+			return nil, false
+		}
+
+		for userId, dist := range ratDistributions {
+			allocatedPrice, ok := calculatedAllocatedPrice[userId]
+			if !ok {
+				log.Errorf("distribution user not found in items: %s", userId)
+				util2.AbortWithStrJson(c, http.StatusBadRequest, "distribution user not found in items")
+				return nil, false
+			}
+			if allocatedPrice.Cmp(dist) != 0 {
+				log.Errorf("distribution amount does not match items: %s (calculated: %s)", dist, allocatedPrice)
+				util2.AbortWithStrJson(c, http.StatusBadRequest, "distribution amount does not match items")
+				return nil, false
+			}
+		}
+	}
+
+	after := &platform.ExpenditureSnapshot{
+		Name:         body.Name,
+		TotalPrice:   totalPrice.Decimal(),
+		CurrencyCode: body.CurrencyCode,
+		Category:     body.Category,
+		PayedAt:      time.UnixMilli(body.PayedAt),
+		PayersId:     body.PayersId,
+		Distribution: make([]platform.ExpenditureSnapshotDistribution, 0),
+		Items:        make([]platform.ExpenditureSnapshotItem, 0),
+		Charges:      charges,
+		RefundOf:     body.RefundOf,
+	}
+	for userId, dist := range ratDistributions {
+		after.Distribution = append(after.Distribution, platform.ExpenditureSnapshotDistribution{
+			UserId:      userId,
+			Numerator:   dist.Num().Int64(),
+			Denominator: dist.Denom().Int64(),
+		})
+	}
+	for i, item := range body.Items {
+		snapshotItem := platform.ExpenditureSnapshotItem{
+			Label:       item.Label,
+			Price:       itemPrices[i].Decimal(),
+			Allocations: item.Allocations,
+		}
+		if item.ExpenditureItemId != nil {
+			snapshotItem.ExpenditureItemId = *item.ExpenditureItemId
+		}
+		after.Items = append(after.Items, snapshotItem)
+	}
+
+	return after, true
+}
+
+// updateExpenditure updates the expenditure from the snapshot, only if version of the request is the latest.
+// The version is compared only if given, for old clients editing with CreateExpenditure.
+func updateExpenditure(c *gin.Context, uid string, body ExpenditureCreateRequestDto, after *platform.ExpenditureSnapshot) {
+	expenditureEntity, err := database_io.GetExpenditure(*body.ExpenditureId)
+	if err != nil {
+		log.Error(err)
+		util2.AbortWithStrJsonF(c, http.StatusBadRequest, "expenditure does not exist: %s", *body.ExpenditureId)
+		return
+	}
+	if expenditureEntity.SessionId != body.SessionId {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "expenditure is not in session")
+		return
+	}
+	expenditureId := expenditureEntity.ExpenditureId
+
+	expectedVersion := body.Version
+	if ifMatch := c.GetHeader("If-Match"); ifMatch != "" {
+		version, err := parseExpenditureETag(ifMatch)
+		if err != nil {
+			util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid If-Match header")
+			return
+		}
+		expectedVersion = &version
+	}
+	// version should be given either by If-Match header or body, so that stale edits do not overwrite others
+	if expectedVersion == nil {
+		util2.AbortWithStrJson(c, http.StatusPreconditionRequired, "version is required")
+		return
+	}
+
+	tx, err := database.DB.BeginTx(c, nil)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	// lock the expenditure, so that others wait until this update is done
+	currentVersion, err := database_io.LockExpenditureVersionTx(tx, expenditureId)
+	if err != nil {
+		_ = tx.Rollback()
+		log.Error(err)
+		util2.AbortWithStrJsonF(c, http.StatusBadRequest, "expenditure does not exist: %s", expenditureId)
+		return
+	}
+	if *expectedVersion != currentVersion {
+		_ = tx.Rollback()
+		c.Header("ETag", expenditureETag(currentVersion))
+		util2.AbortWithStrJsonF(c, http.StatusConflict,
+			"expenditure is modified by others: version %d is not the latest %d", *expectedVersion, currentVersion)
+		return
+	}
+
+	// read again after the lock, as it may have been changed since read above
+	expenditureEntity, err = database_io.GetExpenditureTx(tx, expenditureId)
+	if err != nil {
+		_ = tx.Rollback()
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	before, err := platform.LoadExpenditureSnapshotTx(tx, *expenditureEntity)
+	if err != nil {
+		_ = tx.Rollback()
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if !checkKittyPaymentTx(c, tx, body.SessionId, expenditureId, after.PayersId, after.TotalPriceMoney()) {
+		_ = tx.Rollback()
+		return
+	}
+
+	// items are matched by id, and payers, distribution and items are updated only where changed
+	if err := platform.ApplyExpenditureSnapshotTx(tx, expenditureId, before, after); err != nil {
+		_ = tx.Rollback()
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	diff, version, err := platform.RecordExpenditureRevisionTx(tx, expenditureId, body.SessionId, uid,
+		platform.ExpenditureRevisionUpdated, before, after)
+	if err != nil {
+		_ = tx.Rollback()
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	socket.SocketManager.Multicast(body.SessionId, uid, socket.EventExpenditureUpdated, ExpenditureUpdatedEvent{
+		ExpenditureId: expenditureId,
+		UserId:        uid,
+		Action:        platform.ExpenditureRevisionUpdated,
+		Version:       version,
+		Diff:          diff,
+	})
+	c.Header("ETag", expenditureETag(version))
+	c.JSON(http.StatusOK, ExpenditureUpdateResponseDto{
+		ExpenditureId: expenditureId,
+		Version:       version,
+	})
+}
+
+func expenditureETag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// parseExpenditureETag parses ETag such as "3", W/"3" or 3 into version
+func parseExpenditureETag(etag string) (int, error) {
+	etag = strings.TrimPrefix(strings.TrimSpace(etag), "W/")
+	return strconv.Atoi(strings.Trim(etag, `"`))
+}
+
+// checkRefund aborts with bad request if the refund cannot be linked to the original expenditure.
+// The original should be a positive expenditure of the session in the same currency and category,
+// and all refunds of it should not exceed its total price. expenditureId is of the refund, or empty if new.
+func checkRefund(c *gin.Context, sessionId string, expenditureId string, refundOf *string, category string,
+	totalPrice money.Money) bool {
+	if refundOf == nil {
+		return true
+	}
+	if !totalPrice.IsNegative() {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "refund should have negative total price")
+		return false
+	}
+	if expenditureId == *refundOf {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "expenditure cannot be a refund of itself")
+		return false
+	}
+
+	original, err := database_io.GetExpenditure(*refundOf)
+	if err != nil || original.SessionId != sessionId {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "original expenditure does not exist")
+		return false
+	}
+	if original.RefundOf != nil || original.TotalPrice <= 0 {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "original expenditure is a refund")
+		return false
+	}
+	if original.CurrencyCode != totalPrice.CurrencyCode {
+		util2.AbortWithStrJsonF(c, http.StatusBadRequest, "refund should be in %s", original.CurrencyCode)
+		return false
+	}
+	if original.Category != category {
+		util2.AbortWithStrJsonF(c, http.StatusBadRequest, "refund should be in category %s", original.Category)
+		return false
+	}
+
+	refunds, err := database_io.GetRefundsOf(original.ExpenditureId)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return false
+	}
+	refunded := -totalPrice.Amount
+	for _, refund := range refunds {
+		if refund.ExpenditureId == expenditureId {
+			continue
+		}
+		refunded -= refund.TotalPrice
+	}
+	if refunded > original.TotalPrice {
+		util2.AbortWithStrJsonF(c, http.StatusBadRequest, "refunds exceed %s %s of original expenditure",
+			original.TotalPriceMoney().Decimal(), original.CurrencyCode)
+		return false
+	}
+	return true
+}
+
+// checkMergedRefundsTx aborts with bad request if refunds relinked to the expenditure in tx exceed it,
+// or are not in its currency.
+func checkMergedRefundsTx(c *gin.Context, tx *sql.Tx, expenditureId string) bool {
+	expenditureEntity, err := database_io.GetExpenditureTx(tx, expenditureId)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return false
+	}
+	refunds, err := database_io.GetRefundsOfTx(tx, expenditureId)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return false
+	}
+	if len(refunds) == 0 {
+		return true
+	}
+
+	refunded := int64(0)
+	for _, refund := range refunds {
+		if refund.CurrencyCode != expenditureEntity.CurrencyCode {
+			util2.AbortWithStrJsonF(c, http.StatusBadRequest, "refunds should be in %s", expenditureEntity.CurrencyCode)
+			return false
+		}
+		refunded -= refund.TotalPrice
+	}
+	if refunded > expenditureEntity.TotalPrice {
+		util2.AbortWithStrJsonF(c, http.StatusBadRequest, "refunds exceed %s %s of merged expenditure",
+			expenditureEntity.TotalPriceMoney().Decimal(), expenditureEntity.CurrencyCode)
+		return false
+	}
+	return true
+}
+
+// splitDistribution computes distribution of the split, or aborts with bad request
+func splitDistribution(c *gin.Context, sessionId string, body ExpenditureSplitDto, totalPrice money.Money) (
+	[]ExpenditureDistributionDto, bool) {
+	if !split.IsValidMode(body.Mode) {
+		util2.AbortWithStrJsonF(c, http.StatusBadRequest, "invalid split mode: %s", body.Mode)
+		return nil, false
+	}
+
+	members, err := database_io.GetSessionMembers(sessionId)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return nil, false
+	}
+	memberIds := make([]string, len(members))
+	for i, member := range members {
+		memberIds[i] = member.UserId
+	}
+
+	spec := split.Spec{Mode: body.Mode, UserIds: body.UserIds, Values: make(map[string]*big.Rat)}
+	for userId, value := range body.Values {
+		spec.Values[userId] = value.Rat()
+	}
+	// refunds are split as positive amounts, then given back in negative
+	total := new(big.Rat).Abs(totalPrice.Rat())
+	distributions, err := split.Distribute(spec, total, memberIds)
+	if err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid split: "+err.Error())
+		return nil, false
+	}
+	if totalPrice.IsNegative() {
+		for _, amount := range distributions {
+			amount.Neg(amount)
+		}
+	}
+
+	distribution := make([]ExpenditureDistributionDto, 0, len(distributions))
+	for userId, amount := range distributions {
+		distribution = append(distribution, ExpenditureDistributionDto{
+			UserId: userId,
+			Amount: Fraction{Numerator: amount.Num().Int64(), Denominator: amount.Denom().Int64()},
+		})
+	}
+	return distribution, true
+}
+
+func DeleteExpenditure(c *gin.Context) {
+	uid := c.GetString("uid")
+
+	var body ExpenditureDeleteRequestDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid request query: "+err.Error())
+		return
+	}
+
+	// get expenditure
+	expenditureEntity, err := database_io.GetExpenditure(body.ExpenditureId)
+	if err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "expenditure does not exist")
+		return
+	}
+
+	// check if session exists
+	sessionEntity, err := database_io.GetSession(expenditureEntity.SessionId)
+	if err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "session does not exist")
+		return
+	}
+
+	// check if user is in session
+	yes, err := platform.IsSessionMember(uid, sessionEntity.SessionId)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if !yes {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "user is not in session")
+		return
+	}
+
+	tx, err := database.DB.BeginTx(c, nil)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	// the state deleted is read after the lock, so that an update in the meantime is not lost from revisions
+	if _, err := database_io.LockExpenditureVersionTx(tx, body.ExpenditureId); err != nil {
+		_ = tx.Rollback()
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "expenditure does not exist")
+		return
+	}
+	expenditureEntity, err = database_io.GetExpenditureTx(tx, body.ExpenditureId)
+	if err != nil {
+		_ = tx.Rollback()
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	before, err := platform.LoadExpenditureSnapshotTx(tx, *expenditureEntity)
+	if err != nil {
+		_ = tx.Rollback()
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if err := database_io.DeleteExpenditureTx(tx, body.ExpenditureId); err != nil {
+		_ = tx.Rollback()
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	// deleted expenditure can be restored from revisions
+	if _, _, err := platform.RecordExpenditureRevisionTx(tx, body.ExpenditureId, sessionEntity.SessionId, uid,
+		platform.ExpenditureRevisionDeleted, before, nil); err != nil {
+		_ = tx.Rollback()
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	socket.SocketManager.Multicast(sessionEntity.SessionId, uid, socket.EventExpenditureDeleted, body.ExpenditureId)
+	c.JSON(http.StatusOK, nil)
+}
+
+// MergeExpenditures deletes the duplicate of the same payment, whose receipts are moved to the kept expenditure.
+// The duplicate can be restored from its revisions as deleted one.
+func MergeExpenditures(c *gin.Context) {
+	uid := c.GetString("uid")
+
+	var body ExpenditureMergeRequestDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if body.ExpenditureId == body.DuplicateId {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "expenditure cannot be merged into itself")
+		return
+	}
+
+	expenditureEntity, err := database_io.GetExpenditure(body.ExpenditureId)
+	if err != nil {
+		log.Error(err)
+		util2.AbortWithStrJsonF(c, http.StatusBadRequest, "expenditure does not exist: %s", body.ExpenditureId)
+		return
+	}
+	duplicateEntity, err := database_io.GetExpenditure(body.DuplicateId)
+	if err != nil {
+		log.Error(err)
+		util2.AbortWithStrJsonF(c, http.StatusBadRequest, "expenditure does not exist: %s", body.DuplicateId)
+		return
+	}
+	if expenditureEntity.SessionId != duplicateEntity.SessionId {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "expenditures are not in the same session")
+		return
+	}
+	sessionId := expenditureEntity.SessionId
+	// a refund is merged only into a refund, so that refunds are never linked to a refund
+	if (expenditureEntity.TotalPrice < 0) != (duplicateEntity.TotalPrice < 0) {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "refund cannot be merged with expenditure which is not")
+		return
+	}
+
+	// check if user is in session
+	yes, err := platform.IsSessionMember(uid, sessionId)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if !yes {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "user is not in session")
+		return
+	}
+
+	receipts, err := database_io.GetReceiptsByExpenditureId(body.DuplicateId)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := database.DB.BeginTx(c, nil)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	// lock both, so that the duplicate is not edited while merged
+	version, err := database_io.LockExpenditureVersionTx(tx, body.ExpenditureId)
+	if err != nil {
+		_ = tx.Rollback()
+		log.Error(err)
+		util2.AbortWithStrJsonF(c, http.StatusBadRequest, "expenditure does not exist: %s", body.ExpenditureId)
+		return
+	}
+	if _, err := database_io.LockExpenditureVersionTx(tx, body.DuplicateId); err != nil {
+		_ = tx.Rollback()
+		log.Error(err)
+		util2.AbortWithStrJsonF(c, http.StatusBadRequest, "expenditure does not exist: %s", body.DuplicateId)
+		return
+	}
+
+	duplicateEntity, err = database_io.GetExpenditureTx(tx, body.DuplicateId)
+	if err != nil {
+		_ = tx.Rollback()
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	before, err := platform.LoadExpenditureSnapshotTx(tx, *duplicateEntity)
+	if err != nil {
+		_ = tx.Rollback()
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	for _, receipt := range receipts {
+		if err := database_io.AttachReceiptTx(tx, receipt.ReceiptId, sessionId, &body.ExpenditureId); err != nil {
+			_ = tx.Rollback()
+			log.Error(err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// refunds of the duplicate are of the kept one
+	if err := database_io.RelinkRefundsTx(tx, body.DuplicateId, body.ExpenditureId); err != nil {
+		_ = tx.Rollback()
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if !checkMergedRefundsTx(c, tx, body.ExpenditureId) {
+		_ = tx.Rollback()
+		return
+	}
+
+	if err := database_io.DeleteExpenditureTx(tx, body.DuplicateId); err != nil {
+		_ = tx.Rollback()
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if _, _, err := platform.RecordExpenditureRevisionTx(tx, body.DuplicateId, sessionId, uid,
+		platform.ExpenditureRevisionMerged, before, nil); err != nil {
+		_ = tx.Rollback()
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	socket.SocketManager.Multicast(sessionId, uid, socket.EventExpenditureDeleted, body.DuplicateId)
+	c.JSON(http.StatusOK, ExpenditureUpdateResponseDto{
+		ExpenditureId: body.ExpenditureId,
+		Version:       version,
+	})
+}
+
+func ExpenditureRevisions(c *gin.Context) {
+	uid := c.GetString("uid")
+
+	var query ExpenditureRevisionsGetRequestDto
+	if err := c.ShouldBindQuery(&query); err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid request query: "+err.Error())
+		return
+	}
+
+	// revisions are kept even if expenditure is deleted
+	revisionEntities, err := database_io.GetExpenditureRevisions(query.ExpenditureId)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if len(revisionEntities) == 0 {
+		// expenditure made before history was kept
+		expenditureEntity, err := database_io.GetExpenditure(query.ExpenditureId)
+		if err != nil {
+			log.Error(err)
+			util2.AbortWithStrJson(c, http.StatusBadRequest, "expenditure does not exist")
+			return
+		}
+		yes, err := platform.IsSessionMember(uid, expenditureEntity.SessionId)
+		if err != nil {
+			log.Error(err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if !yes {
+			util2.AbortWithStrJson(c, http.StatusBadRequest, "user is not in session")
+			return
+		}
+		c.JSON(http.StatusOK, make(ExpenditureRevisionsGetResponseDto, 0))
+		return
+	}
+
+	// check if user is in session
+	yes, err := platform.IsSessionMember(uid, revisionEntities[0].SessionId)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if !yes {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "user is not in session")
+		return
+	}
 
-				allocatedPrice, ok := calculatedAllocatedPrice[allocatedUid]
-				if !ok {
-					allocatedPrice = new(big.Rat)
-				}
-				allocatedPrice.Add(allocatedPrice, dividedPrice)
-				calculatedAllocatedPrice[allocatedUid] = allocatedPrice
-			}
+	revisions := make(ExpenditureRevisionsGetResponseDto, 0)
+	for _, revision := range revisionEntities {
+		item := ExpenditureRevisionsGetResponseItem{
+			ExpenditureRevisionId: revision.ExpenditureRevisionId,
+			Revision:              revision.Revision,
+			UserId:                revision.UserId,
+			Action:                revision.Action,
+			Diff:                  json.RawMessage(revision.Diff),
+			CreatedAt:             revision.CreatedAt,
 		}
-
-		for userId, dist := range ratDistributions {
-			allocatedPrice, ok := calculatedAllocatedPrice[userId]
-			if !ok {
-				log.Errorf("distribution user not found in items: %s", userId)
-				util2.AbortWithStrJson(c, http.StatusBadRequest, "distribution user not found in items")
-				return
-			}
-			if allocatedPrice.Cmp(dist) != 0 {
-				log.Errorf("distribution amount does not match items: %s (calculated: %s)", dist, allocatedPrice)
-				util2.AbortWithStrJson(c, http.StatusBadRequest, "distribution amount does not match items")
-				return
-			}
+		if revision.Snapshot != nil {
+			item.Snapshot = json.RawMessage(*revision.Snapshot)
 		}
+		revisions = append(revisions, item)
 	}
 
-	tx, err := database.DB.BeginTx(c, nil)
+	c.JSON(http.StatusOK, revisions)
+}
+
+func RestoreExpenditureRevision(c *gin.Context) {
+	uid := c.GetString("uid")
+
+	var body ExpenditureRevisionRestoreRequestDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	revision, err := database_io.GetExpenditureRevision(body.ExpenditureRevisionId)
+	if err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "expenditure revision does not exist")
+		return
+	}
+
+	// check if user is in session
+	yes, err := platform.IsSessionMember(uid, revision.SessionId)
 	if err != nil {
 		log.Error(err)
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
+	if !yes {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "user is not in session")
+		return
+	}
 
-	expenditureId := uuid.New().String()
+	if revision.Snapshot == nil {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "revision of deletion cannot be restored")
+		return
+	}
+	var after platform.ExpenditureSnapshot
+	if err := json.Unmarshal([]byte(*revision.Snapshot), &after); err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
 
-	// find expenditure
-	if body.ExpenditureId != nil {
-		_, err := database_io.GetExpenditure(*body.ExpenditureId)
+	// payers and users of the revision may have left the session since
+	userIds := append([]string{}, after.PayersId...)
+	for _, dist := range after.Distribution {
+		userIds = append(userIds, dist.UserId)
+	}
+	for _, item := range after.Items {
+		userIds = append(userIds, item.Allocations...)
+	}
+	for _, userId := range userIds {
+		if userId == platform.KittyPayerId {
+			continue
+		}
+		yes, err := platform.IsSessionMember(userId, revision.SessionId)
 		if err != nil {
 			log.Error(err)
-			c.AbortWithStatus(http.StatusBadRequest)
-			util2.AbortWithStrJsonF(c, http.StatusBadRequest, "expenditure does not exist: %s", *body.ExpenditureId)
+			c.AbortWithStatus(http.StatusInternalServerError)
 			return
 		}
-		expenditureId = *body.ExpenditureId
-
-		// delete expenditure
-		if err := database_io.DeleteExpenditureTx(tx, expenditureId); err != nil {
-			_ = tx.Rollback()
-			log.Error(err)
-			c.AbortWithStatus(http.StatusInternalServerError)
+		if !yes {
+			util2.AbortWithStrJson(c, http.StatusBadRequest, "user of the revision is not in session")
 			return
 		}
 	}
-
-	// insert expenditure
-	newExpenditure := database.ExpenditureEntity{
-		ExpenditureId: expenditureId,
-		Name:          body.Name,
-		TotalPrice:    *body.TotalPrice,
-		CurrencyCode:  body.CurrencyCode,
-		Category:      body.Category,
-		SessionId:     body.SessionId,
-		PayedAt:       time.UnixMilli(body.PayedAt),
+	if !checkKittyPayers(c, after.PayersId) {
+		return
 	}
-	if err := database_io.InsertExpenditureTx(tx, newExpenditure); err != nil {
-		_ = tx.Rollback()
+	// the original of a refund may have been deleted, merged or refunded by others since
+	if !checkRefund(c, revision.SessionId, revision.ExpenditureId, after.RefundOf, after.Category,
+		after.TotalPriceMoney()) {
+		return
+	}
+
+	tx, err := database.DB.BeginTx(c, nil)
+	if err != nil {
 		log.Error(err)
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
 
-	// insert payers
-	for _, payerId := range body.PayersId {
-		if err := database_io.InsertExpenditurePayerTx(tx, database.ExpenditurePayerEntity{
-			ExpenditureId: expenditureId,
-			UserId:        payerId,
-		}); err != nil {
+	// current state, or nil if deleted
+	var before *platform.ExpenditureSnapshot
+	if _, err := database_io.LockExpenditureVersionTx(tx, revision.ExpenditureId); err == nil {
+		expenditureEntity, err := database_io.GetExpenditureTx(tx, revision.ExpenditureId)
+		if err != nil {
 			_ = tx.Rollback()
 			log.Error(err)
 			c.AbortWithStatus(http.StatusInternalServerError)
 			return
 		}
-	}
-
-	// insert distribution
-	for userId, dist := range ratDistributions {
-		if err := database_io.InsertExpenditureDistributionTx(tx, database.ExpenditureDistributionEntity{
-			ExpenditureId: expenditureId,
-			UserId:        userId,
-			Numerator:     dist.Num().Int64(),
-			Denominator:   dist.Denom().Int64(),
-		}); err != nil {
+		before, err = platform.LoadExpenditureSnapshotTx(tx, *expenditureEntity)
+		if err != nil {
 			_ = tx.Rollback()
 			log.Error(err)
 			c.AbortWithStatus(http.StatusInternalServerError)
 			return
 		}
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		_ = tx.Rollback()
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if !checkKittyPaymentTx(c, tx, revision.SessionId, revision.ExpenditureId, after.PayersId, after.TotalPriceMoney()) {
+		_ = tx.Rollback()
+		return
 	}
 
-	// insert items
-	for _, item := range body.Items {
-		itemId := uuid.New().String()
-		if err := database_io.InsertExpenditureItemTx(tx, database.ExpenditureItemEntity{
-			ExpenditureItemId: itemId,
-			Label:             item.Label,
-			Price:             *item.Price,
-			ExpenditureId:     expenditureId,
-		}); err != nil {
-			_ = tx.Rollback()
-			log.Error(err)
-			c.AbortWithStatus(http.StatusInternalServerError)
-			return
-		}
+	if before != nil {
+		err = platform.ApplyExpenditureSnapshotTx(tx, revision.ExpenditureId, before, &after)
+	} else {
+		err = platform.InsertExpenditureSnapshotTx(tx, revision.ExpenditureId, revision.SessionId, &after)
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
 
-		// insert allocations
-		for _, allocatedUid := range item.Allocations {
-			if err := database_io.InsertExpenditureItemAllocationTx(tx, database.ExpenditureItemAllocationEntity{
-				ExpenditureItemId: itemId,
-				UserId:            allocatedUid,
-			}); err != nil {
-				_ = tx.Rollback()
-				log.Error(err)
-				c.AbortWithStatus(http.StatusInternalServerError)
-				return
-			}
-		}
+	diff, version, err := platform.RecordExpenditureRevisionTx(tx, revision.ExpenditureId, revision.SessionId, uid,
+		platform.ExpenditureRevisionRestored, before, &after)
+	if err != nil {
+		_ = tx.Rollback()
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -438,38 +1539,114 @@ func CreateExpenditure(c *gin.Context) {
 		return
 	}
 
-	socket.SocketManager.Multicast(body.SessionId, uid, socket.EventExpenditureCreated, newExpenditure)
-	c.JSON(http.StatusOK, nil)
+	socket.SocketManager.Multicast(revision.SessionId, uid, socket.EventExpenditureUpdated, ExpenditureUpdatedEvent{
+		ExpenditureId: revision.ExpenditureId,
+		UserId:        uid,
+		Action:        platform.ExpenditureRevisionRestored,
+		Version:       version,
+		Diff:          diff,
+	})
+	c.Header("ETag", expenditureETag(version))
+	c.JSON(http.StatusOK, ExpenditureUpdateResponseDto{
+		ExpenditureId: revision.ExpenditureId,
+		Version:       version,
+	})
 }
 
-func DeleteExpenditure(c *gin.Context) {
+// checkReceiptAttachable checks if the user can attach the receipt to the expenditure of the session, or aborts with bad request.
+// A receipt already attached to another expenditure should be detached first, and one of another session is never attached.
+func checkReceiptAttachable(c *gin.Context, uid string, receiptId string, sessionId string, expenditureId *string) bool {
+	receipt, err := database_io.GetReceipt(receiptId)
+	if err != nil {
+		log.Error(err)
+		util2.AbortWithStrJsonF(c, http.StatusBadRequest, "receipt does not exist: %s", receiptId)
+		return false
+	}
+	yes, err := platform.CanAccessReceipt(uid, *receipt)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return false
+	}
+	if !yes {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "user cannot access receipt")
+		return false
+	}
+	if receipt.SessionId != nil && *receipt.SessionId != sessionId {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "receipt belongs to another session")
+		return false
+	}
+	if receipt.ExpenditureId != nil && (expenditureId == nil || *receipt.ExpenditureId != *expenditureId) {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "receipt is attached to another expenditure")
+		return false
+	}
+	return true
+}
+
+func AttachReceipt(c *gin.Context) {
 	uid := c.GetString("uid")
 
-	var body ExpenditureDeleteRequestDto
+	var body ExpenditureReceiptAttachRequestDto
 	if err := c.ShouldBindJSON(&body); err != nil {
 		log.Error(err)
-		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid request query: "+err.Error())
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid request body: "+err.Error())
 		return
 	}
 
-	// get expenditure
-	expenditureEntity, err := database_io.GetExpenditure(body.ExpenditureId)
+	receipt, err := database_io.GetReceipt(body.ReceiptId)
 	if err != nil {
 		log.Error(err)
-		util2.AbortWithStrJson(c, http.StatusBadRequest, "expenditure does not exist")
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "receipt does not exist")
 		return
 	}
 
-	// check if session exists
-	sessionEntity, err := database_io.GetSession(expenditureEntity.SessionId)
+	// detach, while it still belongs to the session
+	if body.ExpenditureId == nil {
+		yes, err := platform.CanAccessReceipt(uid, *receipt)
+		if err != nil {
+			log.Error(err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if !yes {
+			util2.AbortWithStrJson(c, http.StatusBadRequest, "user cannot access receipt")
+			return
+		}
+		if receipt.SessionId == nil || receipt.ExpenditureId == nil {
+			c.JSON(http.StatusOK, nil)
+			return
+		}
+
+		tx, err := database.DB.BeginTx(c, nil)
+		if err != nil {
+			log.Error(err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if err := database_io.AttachReceiptTx(tx, receipt.ReceiptId, *receipt.SessionId, nil); err != nil {
+			_ = tx.Rollback()
+			log.Error(err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			log.Error(err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.JSON(http.StatusOK, nil)
+		return
+	}
+
+	expenditureEntity, err := database_io.GetExpenditure(*body.ExpenditureId)
 	if err != nil {
 		log.Error(err)
-		util2.AbortWithStrJson(c, http.StatusBadRequest, "session does not exist")
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "expenditure does not exist")
 		return
 	}
 
 	// check if user is in session
-	yes, err := platform.IsSessionMember(uid, sessionEntity.SessionId)
+	yes, err := platform.IsSessionMember(uid, expenditureEntity.SessionId)
 	if err != nil {
 		log.Error(err)
 		c.AbortWithStatus(http.StatusInternalServerError)
@@ -480,31 +1657,37 @@ func DeleteExpenditure(c *gin.Context) {
 		return
 	}
 
+	if !checkReceiptAttachable(c, uid, body.ReceiptId, expenditureEntity.SessionId, body.ExpenditureId) {
+		return
+	}
+
 	tx, err := database.DB.BeginTx(c, nil)
 	if err != nil {
 		log.Error(err)
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
-
-	if err := database_io.DeleteExpenditureTx(tx, body.ExpenditureId); err != nil {
+	if err := database_io.AttachReceiptTx(tx, body.ReceiptId, expenditureEntity.SessionId, body.ExpenditureId); err != nil {
 		_ = tx.Rollback()
 		log.Error(err)
+		if errors.Is(err, database_io.ErrReceiptOfAnotherSession) {
+			util2.AbortWithStrJson(c, http.StatusBadRequest, err.Error())
+			return
+		}
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
-
 	if err := tx.Commit(); err != nil {
 		log.Error(err)
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
-
-	socket.SocketManager.Multicast(sessionEntity.SessionId, uid, socket.EventExpenditureDeleted, body.ExpenditureId)
 	c.JSON(http.StatusOK, nil)
 }
 
 func UploadReceipt(c *gin.Context) {
+	uid := c.GetString("uid")
+
 	file, _ := c.FormFile("file")
 	if file == nil {
 		log.Error("file not found")
@@ -512,21 +1695,72 @@ func UploadReceipt(c *gin.Context) {
 		return
 	}
 
-	// save file as temp file
-	dest, _ := util.GenerateTempFilePath()
-	if err := c.SaveUploadedFile(file, dest); err != nil {
+	// session which the receipt is uploaded for, which can be given later on attaching
+	var sessionId *string
+	if formSessionId := c.PostForm("session_id"); formSessionId != "" {
+		yes, err := platform.IsSessionMember(uid, formSessionId)
+		if err != nil {
+			log.Error(err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if !yes {
+			util2.AbortWithStrJson(c, http.StatusBadRequest, "user is not in session")
+			return
+		}
+		sessionId = &formSessionId
+	}
+
+	// keep the original in receipt store, which is removed if it fails to be parsed
+	receiptId := uuid.New().String()
+	receiptPath := platform.ReceiptFilePath(receiptId)
+	if err := c.SaveUploadedFile(file, receiptPath); err != nil {
 		log.Error(err)
 		util2.AbortWithErrJson(c, http.StatusInternalServerError, err)
 		return
 	}
-	log.Debug("file temporally saved as: " + dest)
+	stored := false
+	defer func() {
+		if stored {
+			return
+		}
+		if err := os.Remove(receiptPath); err != nil {
+			log.Error(err)
+		}
+	}()
+
+	// the type is of the file itself, not the one told by the client
+	contentType, err := platform.ReceiptFileContentType(receiptPath)
+	if err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	image, err := util.OpenFileAsImage(dest)
+	image, err := util.OpenFileAsImage(receiptPath)
 	if err != nil {
 		log.Error(err)
-		util2.AbortWithErrJson(c, http.StatusInternalServerError, err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid image: "+err.Error())
+		return
+	}
+
+	// the same receipt uploaded again is warned, before it is kept
+	imageHash := phash.DifferenceHash(image)
+	duplicates, err := platform.FindDuplicateReceipts(uid, sessionId, imageHash)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
+	duplicateItems := make([]ExpenditureReceiptDuplicateItem, 0)
+	for _, duplicate := range duplicates {
+		duplicateItems = append(duplicateItems, ExpenditureReceiptDuplicateItem{
+			ReceiptId:     duplicate.Receipt.ReceiptId,
+			ExpenditureId: duplicate.Receipt.ExpenditureId,
+			Url:           platform.ReceiptUrl(duplicate.Receipt.ReceiptId),
+			Distance:      duplicate.Distance,
+		})
+	}
 
 	//processedImage, err := cloud_vision.PreprocessImage(image)
 	processedImage, err := opencv.CropReceiptSubImage(image)
@@ -536,7 +1770,8 @@ func UploadReceipt(c *gin.Context) {
 		return
 	}
 
-	// overwrite file
+	// processed image is saved as temp file
+	dest, _ := util.GenerateTempFilePath()
 	if err := util.SaveImageFileAsPng(processedImage, dest, true); err != nil {
 		log.Error(err)
 		util2.AbortWithErrJson(c, http.StatusInternalServerError, err)
@@ -564,91 +1799,113 @@ func UploadReceipt(c *gin.Context) {
 		log.Debug("temp file deleted: " + dest)
 	}(f)
 
-	taggunResp, err := taggun_receipt_ocr.ParseReceipt(f)
+	receipt, err := receipt_ocr.DefaultParser.Parse(c, f, file.Filename)
 	if err != nil {
 		log.Error(err)
 		util2.AbortWithErrJson(c, http.StatusInternalServerError, err)
 		return
 	}
 
-	totalAmount := taggunResp.TotalAmount.Data
+	if len(receipt.Unparsed) > 0 {
+		log.Debugf("%d lines of receipt are not parsed: %v", len(receipt.Unparsed), receipt.Unparsed)
+	}
+
+	merged, err := receipt_ocr.Merge(*receipt)
+	if err != nil {
+		log.Debug(receipt)
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "no item found")
+		return
+	}
 	var totalAmountUnit *string // KRW, USD, JPY, ...
-	totalAmountConfident := false
-	if taggunResp.TotalAmount.ConfidenceLevel >= 0.5 {
-		totalAmount = taggunResp.TotalAmount.Data
-		totalAmountUnit = &taggunResp.TotalAmount.CurrencyCode
-		totalAmountConfident = true
+	if merged.CurrencyConfident {
+		totalAmountUnit = &merged.CurrencyCode
 	} else {
-		log.Debugf("total amount confidence level is too low: %v", taggunResp.TotalAmount.ConfidenceLevel)
+		log.Debugf("currency confidence level is too low: %v", receipt.CurrencyCode.Confidence)
 	}
 
-	type Item struct {
-		Name   string
-		Amount int
-		Price  float64
-	}
-	items := make(map[int]Item)
-	calculatedTotalAmount := 0.0
-	for _, amountRaw := range taggunResp.Amounts {
-		itemRaw, ok := items[amountRaw.Index]
-		if !ok {
-			itemRaw = Item{
-				Amount: 1,
-			}
-		}
-		itemRaw.Name = amountRaw.Text
-		itemRaw.Price = amountRaw.Data
-		calculatedTotalAmount += itemRaw.Price
-		items[amountRaw.Index] = itemRaw
+	log.Debugf("Found %d items", len(merged.Items))
+	subItems := make([]ExpenditureReceiptUploadResponseItem, 0)
+	for _, item := range merged.Items {
+		subItems = append(subItems, ExpenditureReceiptUploadResponseItem{
+			Label: item.Label,
+			Price: item.Price.Decimal(),
+		})
 	}
-	for _, numberRaw := range taggunResp.Numbers {
-		itemRaw, ok := items[numberRaw.Index]
-		if !ok {
-			itemRaw = Item{}
-		}
-		itemRaw.Amount = numberRaw.Data
-		items[numberRaw.Index] = itemRaw
+
+	// tax is pre-filled as a charge, which is not an item
+	charges := make([]ExpenditureChargeDto, 0)
+	if merged.Tax != nil {
+		taxAmountDecimal := merged.Tax.Decimal()
+		charges = append(charges, ExpenditureChargeDto{
+			Kind:   split.ChargeTax,
+			Label:  split.ChargeTax,
+			Amount: &taxAmountDecimal,
+		})
 	}
 
-	if totalAmountConfident {
-		if calculatedTotalAmount != totalAmount {
-			// add padding item
-			items[-1] = Item{
-				Name:   "unknown",
-				Amount: 1,
-				Price:  totalAmount - calculatedTotalAmount,
-			}
-		}
+	// category is left to the user if it cannot be suggested
+	category, err := receipt_ocr.SuggestCategory(c, receipt)
+	if err != nil {
+		log.Error(err)
 	}
 
-	//log.Debugf("total amount: %v", totalAmount)
-	//log.Debugf("total amount unit: %v", totalAmountUnit)
-	if len(items) == 0 {
-		log.Debug(taggunResp)
-		log.Error("no item found")
-		util2.AbortWithStrJson(c, http.StatusBadRequest, "no item found")
+	imageHashString := imageHash.String()
+	tx, err := database.DB.BeginTx(c, nil)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
-
-	log.Debugf("Found %d items", len(items))
-	subItems := make([]ExpenditureReceiptUploadResponseItem, 0)
-	for _, item := range items {
-		if item.Name == "" && item.Price == 0 {
-			continue
-		}
-		subItems = append(subItems, ExpenditureReceiptUploadResponseItem{
-			Label: item.Name,
-			Price: item.Price,
-		})
+	if err := database_io.InsertReceiptTx(tx, database.ReceiptEntity{
+		ReceiptId:   receiptId,
+		UserId:      uid,
+		SessionId:   sessionId,
+		ContentType: contentType,
+		ImageHash:   &imageHashString,
+		CreatedAt:   time.Now(),
+	}); err != nil {
+		_ = tx.Rollback()
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
 	}
+	stored = true
 
 	resp := ExpenditureReceiptUploadResponseDto{
+		ReceiptId:    receiptId,
 		CurrencyCode: totalAmountUnit,
 		Items:        subItems,
+		Charges:      charges,
+		Duplicates:   duplicateItems,
+		Merchant:     confidentReceiptText(receipt.Merchant),
+		Address:      confidentReceiptText(receipt.MerchantAddress),
+		Category:     category,
+	}
+	if receipt.Date.Value != nil && receipt.Date.Confidence >= receipt_ocr.MinConfidence {
+		resp.PayedAt = receipt.Date.Value
+	}
+	if location := receipt.Location; location.Confidence >= receipt_ocr.MinConfidence {
+		if location.CountryCode != "" {
+			resp.CountryCode = &location.CountryCode
+		}
+		resp.Latitude, resp.Longitude = location.Latitude, location.Longitude
 	}
 	c.JSON(http.StatusOK, resp)
 }
 
+func confidentReceiptText(field receipt_ocr.TextField) *string {
+	if field.Value == "" || field.Confidence < receipt_ocr.MinConfidence {
+		return nil
+	}
+	return &field.Value
+}
+
 func Categories(c *gin.Context) {
 	c.JSON(http.StatusOK, platform.SupportedCategories)
 }
@@ -656,12 +1913,19 @@ func Categories(c *gin.Context) {
 func UseExpenditureRouter(g *gin.RouterGroup) {
 	rg := g.Group("/expenditure")
 	rg.GET("/list", Expenditures)
+	rg.GET("/search", SearchExpenditures)
 	rg.GET("", Expenditure)
 	rg.POST("", CreateExpenditure)
 	rg.PUT("", CreateExpenditure)
+	rg.PATCH("", UpdateExpenditure)
 	rg.DELETE("", DeleteExpenditure)
+	rg.POST("/merge", MergeExpenditures)
+
+	rg.GET("/revisions", ExpenditureRevisions)
+	rg.POST("/revisions/restore", RestoreExpenditureRevision)
 
 	rg.POST("/receipt", UploadReceipt)
+	rg.PUT("/receipt", AttachReceipt)
 
 	rg.GET("/categories", Categories)
 }
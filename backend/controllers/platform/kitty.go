@@ -0,0 +1,296 @@
+package platform
+
+import (
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"net/http"
+	"time"
+	"travel-ai/controllers/socket"
+	util2 "travel-ai/controllers/util"
+	"travel-ai/libs/money"
+	"travel-ai/log"
+	"travel-ai/service/database"
+	"travel-ai/service/platform"
+	"travel-ai/service/platform/database_io"
+)
+
+func Kitty(c *gin.Context) {
+	uid := c.GetString("uid")
+
+	var query KittyGetRequestDto
+	if err := c.ShouldBindQuery(&query); err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid request query: "+err.Error())
+		return
+	}
+
+	// check if user is in session
+	yes, err := platform.IsSessionMember(uid, query.SessionId)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if !yes {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "user is not in session")
+		return
+	}
+
+	contributionEntities, err := database_io.GetKittyContributionsBySessionId(query.SessionId)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	balances, err := platform.SessionKittyBalances(query.SessionId, "")
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	resp := KittyGetResponseDto{
+		PayerId:       platform.KittyPayerId,
+		Balances:      make([]KittyBalanceItem, len(balances)),
+		Contributions: make([]KittyContributionItem, len(contributionEntities)),
+	}
+	for i, balance := range balances {
+		resp.Balances[i] = KittyBalanceItem{
+			CurrencyCode: balance.CurrencyCode,
+			Contributed:  balance.Contributed.Decimal(),
+			Spent:        balance.Spent.Decimal(),
+			Balance:      balance.Balance().Decimal(),
+		}
+	}
+	for i, contributionEntity := range contributionEntities {
+		resp.Contributions[i] = KittyContributionItem{
+			KittyContributionId: contributionEntity.KittyContributionId,
+			UserId:              contributionEntity.UserId,
+			CurrencyCode:        contributionEntity.CurrencyCode,
+			Amount:              contributionEntity.AmountMoney().Decimal(),
+			Memo:                contributionEntity.Memo,
+			ContributedAt:       contributionEntity.ContributedAt.UnixMilli(),
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func ContributeKitty(c *gin.Context) {
+	uid := c.GetString("uid")
+
+	var body KittyContributeRequestDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	// check if session exists
+	_, err := database_io.GetSession(body.SessionId)
+	if err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "session does not exist")
+		return
+	}
+
+	// check if user is in session
+	yes, err := platform.IsSessionMember(uid, body.SessionId)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if !yes {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "user is not in session")
+		return
+	}
+
+	// is currency code valid
+	yes, err = platform.IsSupportedCurrency(body.CurrencyCode)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if !yes {
+		util2.AbortWithStrJsonF(c, http.StatusBadRequest, "invalid currency code: %s", body.CurrencyCode)
+		return
+	}
+
+	// validate amount
+	amount, err := money.FromDecimal(*body.Amount, body.CurrencyCode)
+	if err != nil {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid amount: "+err.Error())
+		return
+	}
+	if amount.Amount <= 0 {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "amount should be positive")
+		return
+	}
+
+	contributedAt := time.Now()
+	if body.ContributedAt != 0 {
+		contributedAt = time.UnixMilli(body.ContributedAt)
+	}
+
+	tx, err := database.DB.BeginTx(c, nil)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	newContribution := database.KittyContributionEntity{
+		KittyContributionId: uuid.New().String(),
+		SessionId:           body.SessionId,
+		UserId:              uid,
+		CurrencyCode:        body.CurrencyCode,
+		Amount:              amount.Amount,
+		Memo:                body.Memo,
+		ContributedAt:       contributedAt,
+	}
+	if err := database_io.InsertKittyContributionTx(tx, newContribution); err != nil {
+		_ = tx.Rollback()
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	// shares of kitty payments are changed as well
+	socket.SocketManager.Multicast(body.SessionId, uid, socket.EventKittyChanged, nil)
+	socket.SocketManager.Multicast(body.SessionId, uid, socket.EventSettlementChanged, nil)
+	c.JSON(http.StatusOK, newContribution.KittyContributionId)
+}
+
+func DeleteKittyContribution(c *gin.Context) {
+	uid := c.GetString("uid")
+
+	var body KittyContributionDeleteRequestDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	// get contribution
+	contributionEntity, err := database_io.GetKittyContribution(body.KittyContributionId)
+	if err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "kitty contribution does not exist")
+		return
+	}
+
+	// only who contributed can delete it
+	if contributionEntity.UserId != uid {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "user is not contributor")
+		return
+	}
+
+	tx, err := database.DB.BeginTx(c, nil)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	// money already spent from the kitty cannot be taken back, which is checked under the lock of the session
+	if err := database_io.LockSessionTx(tx, contributionEntity.SessionId); err != nil {
+		_ = tx.Rollback()
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	balances, err := platform.SessionKittyBalancesTx(tx, contributionEntity.SessionId, "")
+	if err != nil {
+		_ = tx.Rollback()
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	balance := platform.KittyBalanceOf(balances, contributionEntity.CurrencyCode).Balance()
+	if balance.Amount < contributionEntity.Amount {
+		_ = tx.Rollback()
+		util2.AbortWithStrJsonF(c, http.StatusBadRequest, "kitty has only %s %s left",
+			balance.Decimal(), contributionEntity.CurrencyCode)
+		return
+	}
+
+	if err := database_io.DeleteKittyContributionTx(tx, body.KittyContributionId); err != nil {
+		_ = tx.Rollback()
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	socket.SocketManager.Multicast(contributionEntity.SessionId, uid, socket.EventKittyChanged, nil)
+	socket.SocketManager.Multicast(contributionEntity.SessionId, uid, socket.EventSettlementChanged, nil)
+	c.JSON(http.StatusOK, nil)
+}
+
+// checkKittyPayers aborts with bad request if the kitty is a payer with others
+func checkKittyPayers(c *gin.Context, payersId []string) bool {
+	if len(payersId) > 1 && paidByKitty(payersId) {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "kitty should be the only payer")
+		return false
+	}
+	return true
+}
+
+// checkKittyPaymentTx aborts with bad request if the kitty has not enough in the currency.
+// The session is locked in tx if the kitty pays, so that the balance is kept until tx ends.
+// exceptExpenditureId is the expenditure being edited, whose current payment is given back to the kitty.
+func checkKittyPaymentTx(c *gin.Context, tx *sql.Tx, sessionId string, exceptExpenditureId string, payersId []string,
+	totalPrice money.Money) bool {
+	if !paidByKitty(payersId) {
+		return true
+	}
+
+	if err := database_io.LockSessionTx(tx, sessionId); err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return false
+	}
+	balances, err := platform.SessionKittyBalancesTx(tx, sessionId, exceptExpenditureId)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return false
+	}
+	balance := platform.KittyBalanceOf(balances, totalPrice.CurrencyCode).Balance()
+	if balance.Amount < totalPrice.Amount {
+		util2.AbortWithStrJsonF(c, http.StatusBadRequest, "kitty has only %s %s left",
+			balance.Decimal(), totalPrice.CurrencyCode)
+		return false
+	}
+	return true
+}
+
+func paidByKitty(payersId []string) bool {
+	for _, payerId := range payersId {
+		if payerId == platform.KittyPayerId {
+			return true
+		}
+	}
+	return false
+}
+
+func UseKittyRouter(g *gin.RouterGroup) {
+	rg := g.Group("/kitty")
+	rg.GET("", Kitty)
+	rg.PUT("", ContributeKitty)
+	rg.DELETE("", DeleteKittyContribution)
+}
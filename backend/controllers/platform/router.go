@@ -16,6 +16,7 @@ func UsePlatformRouter(r *gin.Engine) {
 	UseBudgetRouter(g)
 	UseExpenditureRouter(g)
 	UseSettlementRouter(g)
+	UseKittyRouter(g)
 	UseCurrencyRouter(g)
 	UseFriendsRouter(g)
 	UseUserRouter(g)
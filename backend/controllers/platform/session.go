@@ -44,15 +44,17 @@ func Sessions(c *gin.Context) {
 		}
 
 		respItems = append(respItems, sessionsResponseItem{
-			SessionId:     s.SessionId,
-			SessionCode:   s.SessionCode,
-			CreatorUserId: s.CreatorUserId,
-			Name:          *s.Name,
-			StartAt:       s.StartAt.Format("2006-01-02"),
-			EndAt:         s.EndAt.Format("2006-01-02"),
-			CreatedAt:     s.CreatedAt.UnixMilli(),
-			CountryCodes:  countryCodes,
-			ThumbnailUrl:  *s.ThumbnailUrl,
+			SessionId:        s.SessionId,
+			SessionCode:      s.SessionCode,
+			CreatorUserId:    s.CreatorUserId,
+			Name:             *s.Name,
+			StartAt:          s.StartAt.Format("2006-01-02"),
+			EndAt:            s.EndAt.Format("2006-01-02"),
+			CreatedAt:        s.CreatedAt.UnixMilli(),
+			CountryCodes:     countryCodes,
+			ThumbnailUrl:     *s.ThumbnailUrl,
+			ExchangeRateMode: s.ExchangeRateMode,
+			UseAcquiredRate:  s.UseAcquiredRate,
 		})
 	}
 
@@ -136,14 +138,15 @@ func CreateSession(c *gin.Context) {
 
 	// create session entity
 	if err := database_io.InsertSessionTx(tx, database.SessionEntity{
-		SessionId:     sessionId,
-		SessionCode:   platform.GenerateTenLengthCode(),
-		CreatorUserId: uid,
-		Name:          &sessionName,
-		StartAt:       &startAt,
-		EndAt:         &endAt,
-		CreatedAt:     time.Now(),
-		ThumbnailUrl:  &imageUrl,
+		SessionId:        sessionId,
+		SessionCode:      platform.GenerateTenLengthCode(),
+		CreatorUserId:    uid,
+		Name:             &sessionName,
+		StartAt:          &startAt,
+		EndAt:            &endAt,
+		CreatedAt:        time.Now(),
+		ThumbnailUrl:     &imageUrl,
+		ExchangeRateMode: platform.ExchangeRateModePayment,
 	}); err != nil {
 		log.Error(err)
 		log.Debug("debug")
@@ -1131,6 +1134,73 @@ func LeaveSession(c *gin.Context) {
 	c.Status(http.StatusOK)
 }
 
+func UpdateExchangeRateMode(c *gin.Context) {
+	uid := c.GetString("uid")
+
+	var body sessionExchangeRateModeRequestDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	// validate mode
+	if !platform.IsValidExchangeRateMode(body.ExchangeRateMode) {
+		util2.AbortWithStrJsonF(c, http.StatusBadRequest, "invalid exchange rate mode: %s", body.ExchangeRateMode)
+		return
+	}
+
+	// check if session exists
+	session, err := database_io.GetSession(body.SessionId)
+	if err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "session does not exist")
+		return
+	}
+
+	// keep current setting if not given
+	useAcquiredRate := session.UseAcquiredRate
+	if body.UseAcquiredRate != nil {
+		useAcquiredRate = *body.UseAcquiredRate
+	}
+
+	// check if user has permission to change session settings
+	yes, err := platform.IsSessionCreator(uid, body.SessionId)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if !yes {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	tx, err := database.DB.BeginTx(c, nil)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if err := database_io.UpdateSessionExchangeRateModeTx(tx, body.SessionId, body.ExchangeRateMode, useAcquiredRate); err != nil {
+		log.Error(err)
+		_ = tx.Rollback()
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	// every amount of settlement may be changed
+	socket.SocketManager.Multicast(body.SessionId, uid, socket.EventSettlementChanged, nil)
+	c.Status(http.StatusOK)
+}
+
 func UseSessionRouter(g *gin.RouterGroup) {
 	rg := g.Group("/session")
 	rg.GET("", Sessions)
@@ -1138,6 +1208,7 @@ func UseSessionRouter(g *gin.RouterGroup) {
 	rg.DELETE("", DeleteSession)
 	rg.GET("/currencies", Currencies)
 	rg.GET("/members", SessionMembers)
+	rg.POST("/exchange-rate-mode", UpdateExchangeRateMode)
 
 	rg.POST("/invite", InviteSession)
 	rg.POST("/invite-cancel", CancelSessionInvite)
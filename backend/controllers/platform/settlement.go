@@ -2,15 +2,17 @@ package platform
 
 import (
 	"github.com/gin-gonic/gin"
-	"math/big"
+	"github.com/google/uuid"
 	"net/http"
 	"time"
 	"travel-ai/controllers/socket"
 	util2 "travel-ai/controllers/util"
+	"travel-ai/libs/money"
 	"travel-ai/log"
 	"travel-ai/service/database"
 	"travel-ai/service/platform"
 	"travel-ai/service/platform/database_io"
+	"travel-ai/service/settlement"
 )
 
 func SettlementInfo(c *gin.Context) {
@@ -23,8 +25,24 @@ func SettlementInfo(c *gin.Context) {
 		return
 	}
 
+	// validate mode
+	if query.Mode == "" {
+		query.Mode = settlement.ModeSimplified
+	}
+	if !settlement.IsValidMode(query.Mode) {
+		util2.AbortWithStrJsonF(c, http.StatusBadRequest, "invalid settlement mode: %s", query.Mode)
+		return
+	}
+	if query.CurrencyMode == "" {
+		query.CurrencyMode = settlement.CurrencyModeConverted
+	}
+	if !settlement.IsValidCurrencyMode(query.CurrencyMode) {
+		util2.AbortWithStrJsonF(c, http.StatusBadRequest, "invalid settlement currency mode: %s", query.CurrencyMode)
+		return
+	}
+
 	// check if session exists
-	_, err := database_io.GetSession(query.SessionId)
+	session, err := database_io.GetSession(query.SessionId)
 	if err != nil {
 		log.Error(err)
 		util2.AbortWithStrJson(c, http.StatusBadRequest, "session does not exist")
@@ -51,32 +69,6 @@ func SettlementInfo(c *gin.Context) {
 		return
 	}
 
-	resp := SettlementInfoGetResponseDto{
-		SessionUsage: SettlementInfoUsage{
-			Meal:        0,
-			Lodgment:    0,
-			Transport:   0,
-			Shopping:    0,
-			Activity:    0,
-			Etc:         0,
-			Unknown:     0,
-			TotalBudget: 0,
-		},
-		MyUsage: SettlementInfoUsage{
-			Meal:        0,
-			Lodgment:    0,
-			Transport:   0,
-			Shopping:    0,
-			Activity:    0,
-			Etc:         0,
-			Unknown:     0,
-			TotalBudget: 0,
-		},
-		Settlements: nil,
-	}
-
-	currencyCode := user.DefaultCurrencyCode
-
 	// get all budgets in session
 	budgetEntities, err := database_io.GetBudgetsBySessionId(query.SessionId)
 	if err != nil {
@@ -84,19 +76,6 @@ func SettlementInfo(c *gin.Context) {
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
-	for _, budgetEntity := range budgetEntities {
-		amount := budgetEntity.Amount
-		exchanged, err := platform.Exchange(budgetEntity.CurrencyCode, currencyCode, amount)
-		if err != nil {
-			log.Error(err)
-			c.AbortWithStatus(http.StatusInternalServerError)
-			return
-		}
-		resp.SessionUsage.TotalBudget += exchanged
-		if budgetEntity.UserId == uid {
-			resp.MyUsage.TotalBudget += exchanged
-		}
-	}
 
 	// get all users in session
 	userEntities, err := database_io.GetSessionMembers(query.SessionId)
@@ -106,306 +85,533 @@ func SettlementInfo(c *gin.Context) {
 		return
 	}
 
-	type UserPayment struct {
-		Used float64
-		Paid float64
+	// get expenditure distributions with payers in session
+	expenditures, err := database_io.GetExpenditureDistributionWithPayersBySessionId(query.SessionId)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
 	}
-	userPayments := make(map[string]UserPayment)
-	sessionMembers := make(map[string]*database_io.SessionMemberEntity)
-	for _, userEntity := range userEntities {
-		userPayments[userEntity.UserId] = UserPayment{
-			Used: 0, // by $currencyCode
-			Paid: 0,
-		}
-		sessionMembers[userEntity.UserId] = userEntity
+
+	// get all transactions in session
+	transactions, err := database_io.GetTransactionsBySessionId(query.SessionId)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
 	}
 
-	// get my expenditure distributions with payers in session
-	expenditures, err := database_io.GetExpenditureDistributionWithPayersBySessionId(query.SessionId)
+	// get kitty contributions in session
+	contributions, err := database_io.GetKittyContributionsBySessionId(query.SessionId)
 	if err != nil {
 		log.Error(err)
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
 
-	for _, exp := range expenditures {
-		totalPrice := exp.TotalPrice
-		stdTotalPrice, err := platform.Exchange(exp.CurrencyCode, currencyCode, totalPrice)
-		if err != nil {
-			log.Error(err)
-			c.AbortWithStatus(http.StatusInternalServerError)
-			return
-		}
-		log.Test("payers:", exp.Payers)
-		log.Testf("[%s] stdTotalPrice: %v", exp.Name, stdTotalPrice)
+	result, err := settlement.Calculate(settlement.Input{
+		CurrencyCode:       user.DefaultCurrencyCode,
+		Mode:               query.Mode,
+		CurrencyMode:       query.CurrencyMode,
+		NetCurrencies:      query.NetCurrencies,
+		SettledAt:          platform.SessionSettledAt(session),
+		Categories:         settlementCategories(),
+		KittyPayerId:       platform.KittyPayerId,
+		Members:            settlementMembers(userEntities),
+		Expenditures:       settlementExpenditures(expenditures),
+		Budgets:            settlementBudgets(budgetEntities),
+		Transactions:       settlementTransactions(transactions),
+		KittyContributions: settlementKittyContributions(contributions),
+	}, platform.SessionExchanger(session))
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
 
-		if len(exp.Payers) == 0 {
-			log.Errorf("no payer for %s", exp.Name)
-			c.AbortWithStatus(http.StatusInternalServerError)
-			return
+	// make settlements
+	settlements := make([]SettlementInfoSettlement, 0)
+	for _, debt := range result.DebtsOf(uid) {
+		targetUserId := debt.To
+		if debt.To == uid {
+			targetUserId = debt.From
 		}
+		settlements = append(settlements, SettlementInfoSettlement{
+			Owed:         debt.From == uid,
+			TargetUserId: targetUserId,
+			Amount:       debt.Amount.Decimal(),
+			CurrencyCode: debt.Amount.CurrencyCode,
+			Netted:       debt.Netted,
+		})
+	}
 
-		// add paid amount to userPayments
-		paidDivision := stdTotalPrice / float64(len(exp.Payers))
-		for _, payer := range exp.Payers {
-			prev, ok := userPayments[payer]
-			if !ok {
-				log.Errorf("user not found: %s", payer)
-				continue
-			}
-			prev.Paid += paidDivision
-			log.Testf("[%s] %s paid %v", exp.Name, payer, paidDivision)
-			userPayments[payer] = prev
+	resp := SettlementInfoGetResponseDto{
+		Mode:          result.Mode,
+		CurrencyMode:  result.CurrencyMode,
+		NetCurrencies: result.NetCurrencies,
+		SessionUsage:  newSettlementInfoUsage(result.SessionUsage),
+		MyUsage:       newSettlementInfoUsage(result.UsageOf(uid)),
+		Settlements:   settlements,
+		Kitty:         make([]SettlementInfoKitty, len(result.Kitty)),
+	}
+	for i, kitty := range result.Kitty {
+		resp.Kitty[i] = SettlementInfoKitty{
+			CurrencyCode: kitty.CurrencyCode,
+			Contributed:  kitty.Contributed.Decimal(),
+			Spent:        kitty.Spent.Decimal(),
+			Balance:      kitty.Balance.Decimal(),
+			Refunds:      make([]SettlementInfoKittyRefund, len(kitty.Refunds)),
 		}
+		for j, refund := range kitty.Refunds {
+			resp.Kitty[i].Refunds[j] = SettlementInfoKittyRefund{UserId: refund.UserId, Amount: refund.Amount.Decimal()}
+		}
+	}
+	log.Testf("settlements: %v", resp)
+	c.JSON(http.StatusOK, resp)
+}
 
-		// add used amount to userPayments
-		currentUserUsage := 0.0
-		for _, dist := range exp.Distributions {
-			amount, _ := big.NewRat(dist.Numerator, dist.Denominator).Float64()
-			exchanged, err := platform.Exchange(exp.CurrencyCode, currencyCode, amount)
-			if err != nil {
-				log.Error(err)
-				c.AbortWithStatus(http.StatusInternalServerError)
-				return
-			}
+func settlementCategories() []string {
+	categories := make([]string, 0, len(platform.ExpenditureCategories))
+	for category := range platform.ExpenditureCategories {
+		categories = append(categories, category)
+	}
+	return categories
+}
 
-			prev, ok := userPayments[dist.UserId]
-			if !ok {
-				log.Debugf("user not found: %s", dist.UserId)
-				continue
-			}
-			prev.Used += exchanged
-			userPayments[dist.UserId] = prev
-			log.Testf("[%s] %s used %v", exp.Name, dist.UserId, exchanged)
+func settlementMembers(entities []*database_io.SessionMemberEntity) []settlement.Member {
+	members := make([]settlement.Member, len(entities))
+	for i, entity := range entities {
+		members[i] = settlement.Member{UserId: entity.UserId, DefaultCurrencyCode: entity.DefaultCurrencyCode}
+	}
+	return members
+}
 
-			if dist.UserId == uid {
-				currentUserUsage += exchanged
+// settlementExpenditures accounts expenditures of unknown category as platform.CategoryUnknown
+func settlementExpenditures(entities []*database_io.ExpenditureDistributionWithPayerMapEntity) []settlement.Expenditure {
+	expenditures := make([]settlement.Expenditure, len(entities))
+	for i, entity := range entities {
+		category := entity.Category
+		if !platform.IsValidExpenditureCategory(category) {
+			category = platform.CategoryUnknown
+		}
+		expenditures[i] = settlement.Expenditure{
+			ExpenditureId: entity.ExpenditureId,
+			Name:          entity.Name,
+			Category:      category,
+			TotalPrice:    entity.TotalPriceMoney(),
+			PayedAt:       entity.PayedAt,
+			Payers:        entity.Payers,
+			Distributions: make([]settlement.Distribution, len(entity.Distributions)),
+		}
+		for j, dist := range entity.Distributions {
+			expenditures[i].Distributions[j] = settlement.Distribution{
+				UserId:      dist.UserId,
+				Numerator:   dist.Numerator,
+				Denominator: dist.Denominator,
 			}
 		}
+	}
+	return expenditures
+}
 
-		// add to session usage
-		switch exp.Category {
-		case platform.CategoryMeal:
-			resp.SessionUsage.Meal += stdTotalPrice
-			resp.MyUsage.Meal += currentUserUsage
-		case platform.CategoryLodgment:
-			resp.SessionUsage.Lodgment += stdTotalPrice
-			resp.MyUsage.Lodgment += currentUserUsage
-		case platform.CategoryTransport:
-			resp.SessionUsage.Transport += stdTotalPrice
-			resp.MyUsage.Transport += currentUserUsage
-		case platform.CategoryShopping:
-			resp.SessionUsage.Shopping += stdTotalPrice
-			resp.MyUsage.Shopping += currentUserUsage
-		case platform.CategoryActivity:
-			resp.SessionUsage.Activity += stdTotalPrice
-			resp.MyUsage.Activity += currentUserUsage
-		case platform.CategoryEtc:
-			resp.SessionUsage.Etc += stdTotalPrice
-			resp.MyUsage.Etc += currentUserUsage
-		default:
-			resp.SessionUsage.Unknown += stdTotalPrice
-			resp.MyUsage.Unknown += currentUserUsage
+func settlementBudgets(entities []database.BudgetEntity) []settlement.Budget {
+	budgets := make([]settlement.Budget, len(entities))
+	for i, entity := range entities {
+		budgets[i] = settlement.Budget{
+			UserId:  entity.UserId,
+			Amount:  entity.AmountMoney(),
+			Partial: !platform.IsWholeBudget(entity),
 		}
 	}
+	return budgets
+}
 
-	// sanitize userPayments
-	for _, userEntity := range userEntities {
-		payment := userPayments[userEntity.UserId]
-		if payment.Used > payment.Paid {
-			payment.Used -= payment.Paid
-			payment.Paid = 0
-		} else if payment.Used < payment.Paid {
-			payment.Paid -= payment.Used
-			payment.Used = 0
-		} else {
-			delete(userPayments, userEntity.UserId)
-			continue
-		}
-		userPayments[userEntity.UserId] = payment
-	}
-	log.Testf("userPayments: %v", userPayments)
-
-	// calculates used & paid users
-	deptors := make([]string, 0)
-	creditors := make([]string, 0)
-	for userId, payment := range userPayments {
-		if payment.Used > 0 {
-			deptors = append(deptors, userId)
-		} else if payment.Paid > 0 {
-			creditors = append(creditors, userId)
+// settlementTransactions confirms only payments confirmed by the receiver and not voided
+func settlementTransactions(entities []database.TransactionEntity) []settlement.Transaction {
+	transactions := make([]settlement.Transaction, len(entities))
+	for i, entity := range entities {
+		transactions[i] = settlement.Transaction{
+			SenderUid:   entity.SenderUid,
+			ReceiverUid: entity.ReceiverUid,
+			Amount:      entity.AmountMoney(),
+			SentAt:      entity.SentAt,
+			Confirmed:   entity.VoidedAt == nil && entity.Status == platform.TransactionStatusConfirmed,
 		}
 	}
+	return transactions
+}
 
-	type Dept struct {
-		From         string
-		To           string
-		Amount       float64
-		CurrencyCode string
+func settlementKittyContributions(entities []database.KittyContributionEntity) []settlement.KittyContribution {
+	contributions := make([]settlement.KittyContribution, len(entities))
+	for i, entity := range entities {
+		contributions[i] = settlement.KittyContribution{UserId: entity.UserId, Amount: entity.AmountMoney()}
 	}
-	depts := make(map[string]map[string]Dept)
-	addDept := func(from string, to string, amount float64) {
-		if _, ok := depts[from]; !ok {
-			depts[from] = make(map[string]Dept)
-		}
-		dept, ok := depts[from][to]
-		if !ok {
-			depts[from][to] = Dept{
-				From:         from,
-				To:           to,
-				Amount:       0,
-				CurrencyCode: currencyCode,
-			}
-		}
-		dept = depts[from][to]
-		dept.Amount += amount
-		depts[from][to] = dept
-
-		// edit userPayments
-		payment := userPayments[from]
-		payment.Used -= amount
-		userPayments[from] = payment
-		payment = userPayments[to]
-		payment.Paid -= amount
-		userPayments[to] = payment
-
-		log.Testf("Added dept: %s -> %s (%v)", from, to, amount)
-		log.Testf("Dept: %v", dept)
-	}
-	log.Testf("deptors: %v", deptors)
-	log.Testf("creditors: %v", creditors)
-
-	for i, j := 0, 0; i < len(deptors) && j < len(creditors); {
-		deptor := deptors[i]
-		creditor := creditors[j]
-		dept := userPayments[deptor].Used
-		credit := userPayments[creditor].Paid
-
-		log.Testf("Comparing %s(%v) and %s(%v)", deptor, dept, creditor, credit)
-
-		if dept > credit {
-			addDept(deptor, creditor, credit)
-			j++
-		} else if dept < credit {
-			addDept(deptor, creditor, dept)
-			i++
-		} else {
-			addDept(deptor, creditor, dept)
-			i++
-			j++
-		}
+	return contributions
+}
+
+func newSettlementInfoUsage(usage settlement.Usage) SettlementInfoUsage {
+	return SettlementInfoUsage{
+		Meal:        usage.ByCategory[platform.CategoryMeal].Decimal(),
+		Lodgment:    usage.ByCategory[platform.CategoryLodgment].Decimal(),
+		Transport:   usage.ByCategory[platform.CategoryTransport].Decimal(),
+		Shopping:    usage.ByCategory[platform.CategoryShopping].Decimal(),
+		Activity:    usage.ByCategory[platform.CategoryActivity].Decimal(),
+		Etc:         usage.ByCategory[platform.CategoryEtc].Decimal(),
+		Unknown:     usage.ByCategory[platform.CategoryUnknown].Decimal(),
+		TotalBudget: usage.TotalBudget.Decimal(),
 	}
+}
 
-	// get all transactions in session
-	transactions, err := database_io.GetTransactionsBySessionId(query.SessionId)
-	if err != nil {
+func CompleteSettlement(c *gin.Context) {
+	uid := c.GetString("uid")
+
+	var body SettlementCompleteRequestDto
+	if err := c.ShouldBindJSON(&body); err != nil {
 		log.Error(err)
-		c.AbortWithStatus(http.StatusInternalServerError)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid request body: "+err.Error())
 		return
 	}
 
-	log.Testf("Found %v transactions", len(transactions))
-	log.Testf("depts: %v", depts)
+	// check if session exists
+	_, err := database_io.GetSession(body.SessionId)
+	if err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "session does not exist")
+		return
+	}
 
-	// apply transactions to depts
-	for _, transaction := range transactions {
-		amount := transaction.Amount
-		exchanged, err := platform.Exchange(transaction.CurrencyCode, currencyCode, amount)
+	// check if both users are in session
+	for _, userId := range []string{uid, body.TargetUserId} {
+		yes, err := platform.IsSessionMember(userId, body.SessionId)
 		if err != nil {
 			log.Error(err)
 			c.AbortWithStatus(http.StatusInternalServerError)
 			return
 		}
-		log.Testf("transaction: %s -> %s (%v)", transaction.SenderUid, transaction.ReceiverUid, exchanged)
-		deptsByUser, ok := depts[transaction.SenderUid]
-		if !ok {
-			continue
-		}
-		targetDept, ok := deptsByUser[transaction.ReceiverUid]
-		if !ok {
-			continue
-		}
-		targetDept.Amount -= exchanged
-		if targetDept.Amount <= 0 {
-			delete(deptsByUser, transaction.ReceiverUid)
-		} else {
-			deptsByUser[transaction.ReceiverUid] = targetDept
+		if !yes {
+			util2.AbortWithStrJson(c, http.StatusBadRequest, "user is not in session")
+			return
 		}
 	}
+	if body.TargetUserId == uid {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "cannot receive from oneself")
+		return
+	}
 
-	// filter depts by current user
-	filteredDepts := make([]Dept, 0)
-	for _, deptsByUser := range depts {
-		for _, dept := range deptsByUser {
-			if dept.From == uid && dept.To == uid {
-				log.Errorf("invalid dept: %v", dept)
-				c.AbortWithStatus(http.StatusInternalServerError)
-			}
-			if dept.From == uid || dept.To == uid {
-				filteredDepts = append(filteredDepts, dept)
-			} else {
-				log.Testf("filtered out dept: %v, because from=%s, to=%s, uid=%s, dept=%v", dept, dept.From, dept.To, uid, dept)
-			}
-		}
+	// validate amount
+	amount, err := money.FromDecimal(*body.Amount, body.CurrencyCode)
+	if err != nil {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid amount: "+err.Error())
+		return
+	}
+	if amount.Amount <= 0 {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "amount should be positive")
+		return
 	}
 
-	log.Testf("filteredDepts: %v", filteredDepts)
+	tx, err := database.DB.BeginTx(c, nil)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
 
-	// recalculate dept amount to creditor's default currency with depts (not credit)
-	for i, dept := range filteredDepts {
-		if dept.To == uid {
-			continue
-		}
+	// add transaction, which is confirmed as the receiver completes it
+	now := time.Now()
+	transaction := database.TransactionEntity{
+		TransactionId: uuid.New().String(),
+		SenderUid:     body.TargetUserId,
+		ReceiverUid:   uid,
+		CurrencyCode:  body.CurrencyCode,
+		Amount:        amount.Amount,
+		SentAt:        now,
+		SessionId:     body.SessionId,
+		Status:        platform.TransactionStatusConfirmed,
+		ConfirmedAt:   &now,
+	}
+	if err := database_io.InsertTransactionTx(tx, body.SessionId, &transaction); err != nil {
+		log.Error(err)
+		_ = tx.Rollback()
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
 
-		creditorInfo, ok := sessionMembers[dept.To]
-		if !ok {
-			log.Errorf("user not found in session: %s", dept.To)
-			c.AbortWithStatus(http.StatusInternalServerError)
-			return
-		}
+	// record who completed the settlement
+	audit := database.TransactionAuditEntity{
+		TransactionId: transaction.TransactionId,
+		UserId:        uid,
+		Action:        platform.TransactionAuditCreated,
+		CreatedAt:     now,
+	}
+	if err := database_io.InsertTransactionAuditTx(tx, audit); err != nil {
+		log.Error(err)
+		_ = tx.Rollback()
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
 
-		amount, err := platform.Exchange(currencyCode, creditorInfo.DefaultCurrencyCode, dept.Amount)
+	// commit
+	if err := tx.Commit(); err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	notifySettlementParties(transaction)
+	socket.SocketManager.Multicast(body.SessionId, uid, socket.EventSettlementTransactionAdded,
+		newSettlementTransaction(transaction, []database.TransactionAuditEntity{audit}))
+	c.JSON(http.StatusOK, nil)
+}
+
+// DeclareSettlement is called by the debtor who has paid, which is settled once the creditor confirms it
+func DeclareSettlement(c *gin.Context) {
+	uid := c.GetString("uid")
+
+	var body SettlementDeclareRequestDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	// check if session exists
+	_, err := database_io.GetSession(body.SessionId)
+	if err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "session does not exist")
+		return
+	}
+
+	// check if both users are in session
+	for _, userId := range []string{uid, body.TargetUserId} {
+		yes, err := platform.IsSessionMember(userId, body.SessionId)
 		if err != nil {
 			log.Error(err)
 			c.AbortWithStatus(http.StatusInternalServerError)
 			return
 		}
-		filteredDepts[i].Amount = amount
-		filteredDepts[i].CurrencyCode = creditorInfo.DefaultCurrencyCode
+		if !yes {
+			util2.AbortWithStrJson(c, http.StatusBadRequest, "user is not in session")
+			return
+		}
+	}
+	if body.TargetUserId == uid {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "cannot pay to oneself")
+		return
 	}
 
-	// make settlements
-	settlements := make([]SettlementInfoSettlement, 0)
-	for _, dept := range filteredDepts {
-		targetUserId := dept.To
-		if dept.To == uid {
-			targetUserId = dept.From
-		}
-		settlements = append(settlements, SettlementInfoSettlement{
-			Owed:         dept.From == uid,
-			TargetUserId: targetUserId,
-			Amount:       dept.Amount,
-			CurrencyCode: dept.CurrencyCode,
-		})
+	// validate method
+	if body.Method != nil && !platform.IsValidPaymentMethod(*body.Method) {
+		util2.AbortWithStrJsonF(c, http.StatusBadRequest, "invalid payment method: %s", *body.Method)
+		return
 	}
 
-	resp.Settlements = settlements
-	log.Testf("settlements: %v", resp)
-	c.JSON(http.StatusOK, resp)
+	// validate amount
+	amount, err := money.FromDecimal(*body.Amount, body.CurrencyCode)
+	if err != nil {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid amount: "+err.Error())
+		return
+	}
+	if amount.Amount <= 0 {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "amount should be positive")
+		return
+	}
+
+	tx, err := database.DB.BeginTx(c, nil)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	transaction := database.TransactionEntity{
+		TransactionId: uuid.New().String(),
+		SenderUid:     uid,
+		ReceiverUid:   body.TargetUserId,
+		CurrencyCode:  body.CurrencyCode,
+		Amount:        amount.Amount,
+		SentAt:        now,
+		SessionId:     body.SessionId,
+		Status:        platform.TransactionStatusDeclared,
+		Method:        body.Method,
+		Memo:          body.Memo,
+	}
+	if err := database_io.InsertTransactionTx(tx, body.SessionId, &transaction); err != nil {
+		log.Error(err)
+		_ = tx.Rollback()
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	audit := database.TransactionAuditEntity{
+		TransactionId: transaction.TransactionId,
+		UserId:        uid,
+		Action:        platform.TransactionAuditDeclared,
+		Memo:          body.Memo,
+		CreatedAt:     now,
+	}
+	if err := database_io.InsertTransactionAuditTx(tx, audit); err != nil {
+		log.Error(err)
+		_ = tx.Rollback()
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	notifySettlementParties(transaction)
+	socket.SocketManager.Multicast(body.SessionId, uid, socket.EventSettlementTransactionAdded,
+		newSettlementTransaction(transaction, []database.TransactionAuditEntity{audit}))
+	c.JSON(http.StatusOK, transaction.TransactionId)
 }
 
-func CompleteSettlement(c *gin.Context) {
+// ConfirmSettlement is called by the creditor who has received a declared payment
+func ConfirmSettlement(c *gin.Context) {
 	uid := c.GetString("uid")
 
-	var body SettlementCompleteRequestDto
+	var body SettlementConfirmRequestDto
 	if err := c.ShouldBindJSON(&body); err != nil {
 		log.Error(err)
 		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid request body: "+err.Error())
 		return
 	}
 
+	// a disputed payment can be confirmed later, e.g. when it turns out to be received
+	updateSettlementStatus(c, uid, body.TransactionId, nil,
+		[]string{platform.TransactionStatusDeclared, platform.TransactionStatusDisputed},
+		platform.TransactionStatusConfirmed, platform.TransactionAuditConfirmed)
+}
+
+// DisputeSettlement is called by the creditor who has not received a declared payment
+func DisputeSettlement(c *gin.Context) {
+	uid := c.GetString("uid")
+
+	var body SettlementDisputeRequestDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	updateSettlementStatus(c, uid, body.TransactionId, body.Memo,
+		[]string{platform.TransactionStatusDeclared},
+		platform.TransactionStatusDisputed, platform.TransactionAuditDisputed)
+}
+
+// updateSettlementStatus moves a transaction from one of fromStatuses into status, which only the receiver can do
+func updateSettlementStatus(c *gin.Context, uid string, transactionId string, memo *string,
+	fromStatuses []string, status string, action string) {
+	// get transaction
+	transaction, err := database_io.GetTransaction(transactionId)
+	if err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "transaction does not exist")
+		return
+	}
+	if transaction.VoidedAt != nil {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "transaction is voided")
+		return
+	}
+	if transaction.ReceiverUid != uid {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "user is not receiver of transaction")
+		return
+	}
+	allowed := false
+	for _, fromStatus := range fromStatuses {
+		allowed = allowed || transaction.Status == fromStatus
+	}
+	if !allowed {
+		util2.AbortWithStrJsonF(c, http.StatusBadRequest, "transaction is already %s", transaction.Status)
+		return
+	}
+
+	tx, err := database.DB.BeginTx(c, nil)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	var confirmedAt *time.Time
+	if status == platform.TransactionStatusConfirmed {
+		confirmedAt = &now
+	}
+	updated, err := database_io.UpdateTransactionStatusTx(tx, transaction.TransactionId, fromStatuses, status, confirmedAt)
+	if err != nil {
+		log.Error(err)
+		_ = tx.Rollback()
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if !updated {
+		_ = tx.Rollback()
+		util2.AbortWithStrJson(c, http.StatusConflict, "transaction has been changed, try again")
+		return
+	}
+
+	if err := database_io.InsertTransactionAuditTx(tx, database.TransactionAuditEntity{
+		TransactionId: transaction.TransactionId,
+		UserId:        uid,
+		Action:        action,
+		Memo:          memo,
+		CreatedAt:     now,
+	}); err != nil {
+		log.Error(err)
+		_ = tx.Rollback()
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	transaction.Status = status
+	transaction.ConfirmedAt = confirmedAt
+	notifySettlementParties(*transaction)
+	socket.SocketManager.Multicast(transaction.SessionId, uid, socket.EventSettlementTransactionSet,
+		newSettlementTransaction(*transaction, nil))
+	c.JSON(http.StatusOK, nil)
+}
+
+// notifySettlementParties lets both sender and receiver know their settlement is changed
+func notifySettlementParties(transaction database.TransactionEntity) {
+	socket.SocketManager.Unicast(transaction.SenderUid, socket.EventSettlementChanged, nil)
+	socket.SocketManager.Unicast(transaction.ReceiverUid, socket.EventSettlementChanged, nil)
+}
+
+func SettlementTransactions(c *gin.Context) {
+	uid := c.GetString("uid")
+
+	var query SettlementTransactionsGetRequestDto
+	if err := c.ShouldBindQuery(&query); err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid request query: "+err.Error())
+		return
+	}
+
+	// validate page
+	if query.Page == 0 {
+		query.Page = 1
+	}
+	if query.PageSize == 0 {
+		query.PageSize = 20
+	}
+	if query.Page < 0 || query.PageSize < 0 || query.PageSize > 100 {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid page: page size should be 1 ~ 100")
+		return
+	}
+
 	// check if session exists
-	_, err := database_io.GetSession(body.SessionId)
+	_, err := database_io.GetSession(query.SessionId)
 	if err != nil {
 		log.Error(err)
 		util2.AbortWithStrJson(c, http.StatusBadRequest, "session does not exist")
@@ -413,7 +619,7 @@ func CompleteSettlement(c *gin.Context) {
 	}
 
 	// check if user is in session
-	yes, err := platform.IsSessionMember(uid, body.SessionId)
+	yes, err := platform.IsSessionMember(uid, query.SessionId)
 	if err != nil {
 		log.Error(err)
 		c.AbortWithStatus(http.StatusInternalServerError)
@@ -424,6 +630,83 @@ func CompleteSettlement(c *gin.Context) {
 		return
 	}
 
+	totalCount, err := database_io.CountTransactionsBySessionId(query.SessionId)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	transactions, err := database_io.GetTransactionsPageBySessionId(query.SessionId,
+		query.PageSize, (query.Page-1)*query.PageSize)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	// audits of the page only
+	transactionIds := make([]string, len(transactions))
+	for i, transaction := range transactions {
+		transactionIds[i] = transaction.TransactionId
+	}
+	audits, err := database_io.GetTransactionAuditsByTransactionIds(transactionIds)
+	if err != nil {
+		log.Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	auditsByTransaction := make(map[string][]database.TransactionAuditEntity)
+	for _, audit := range audits {
+		auditsByTransaction[audit.TransactionId] = append(auditsByTransaction[audit.TransactionId], audit)
+	}
+
+	resp := SettlementTransactionsGetResponseDto{
+		Transactions: make([]SettlementTransaction, len(transactions)),
+		Page:         query.Page,
+		PageSize:     query.PageSize,
+		TotalCount:   totalCount,
+	}
+	for i, transaction := range transactions {
+		resp.Transactions[i] = newSettlementTransaction(transaction, auditsByTransaction[transaction.TransactionId])
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// VoidSettlementTransaction is called by either party to take back a payment, until the creditor confirms it
+func VoidSettlementTransaction(c *gin.Context) {
+	uid := c.GetString("uid")
+
+	var body SettlementTransactionVoidRequestDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	// get transaction
+	transaction, err := database_io.GetTransaction(body.TransactionId)
+	if err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "transaction does not exist")
+		return
+	}
+	if transaction.VoidedAt != nil {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "transaction is already voided")
+		return
+	}
+
+	// only parties of the transaction can void it
+	if transaction.SenderUid != uid && transaction.ReceiverUid != uid {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "user is not party of transaction")
+		return
+	}
+	// a confirmed payment is agreed by both parties, which is not undone by either of them
+	if transaction.Status == platform.TransactionStatusConfirmed {
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "confirmed transaction cannot be voided")
+		return
+	}
+
 	tx, err := database.DB.BeginTx(c, nil)
 	if err != nil {
 		log.Error(err)
@@ -431,14 +714,27 @@ func CompleteSettlement(c *gin.Context) {
 		return
 	}
 
-	// add transaction
-	if err := database_io.InsertTransactionTx(tx, body.SessionId, &database.TransactionEntity{
-		SenderUid:    body.TargetUserId,
-		ReceiverUid:  uid,
-		CurrencyCode: body.CurrencyCode,
-		Amount:       body.Amount,
-		SentAt:       time.Now(),
-		SessionId:    body.SessionId,
+	now := time.Now()
+	voided, err := database_io.VoidTransactionTx(tx, transaction.TransactionId,
+		[]string{platform.TransactionStatusDeclared, platform.TransactionStatusDisputed}, uid, now)
+	if err != nil {
+		log.Error(err)
+		_ = tx.Rollback()
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if !voided {
+		_ = tx.Rollback()
+		util2.AbortWithStrJson(c, http.StatusConflict, "transaction is voided or confirmed by others")
+		return
+	}
+
+	if err := database_io.InsertTransactionAuditTx(tx, database.TransactionAuditEntity{
+		TransactionId: transaction.TransactionId,
+		UserId:        uid,
+		Action:        platform.TransactionAuditVoided,
+		Memo:          body.Reason,
+		CreatedAt:     now,
 	}); err != nil {
 		log.Error(err)
 		_ = tx.Rollback()
@@ -446,19 +742,61 @@ func CompleteSettlement(c *gin.Context) {
 		return
 	}
 
-	// commit
 	if err := tx.Commit(); err != nil {
 		log.Error(err)
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
 
-	socket.SocketManager.Unicast(body.TargetUserId, socket.EventSettlementChanged, nil)
+	transaction.VoidedAt = &now
+	transaction.VoidedBy = &uid
+	socket.SocketManager.Multicast(transaction.SessionId, uid, socket.EventSettlementTransactionVoid,
+		newSettlementTransaction(*transaction, nil))
+	notifySettlementParties(*transaction)
 	c.JSON(http.StatusOK, nil)
 }
 
+func newSettlementTransaction(transaction database.TransactionEntity, audits []database.TransactionAuditEntity) SettlementTransaction {
+	item := SettlementTransaction{
+		TransactionId:  transaction.TransactionId,
+		SenderUserId:   transaction.SenderUid,
+		ReceiverUserId: transaction.ReceiverUid,
+		Amount:         transaction.AmountMoney().Decimal(),
+		CurrencyCode:   transaction.CurrencyCode,
+		SentAt:         transaction.SentAt.UnixMilli(),
+		Status:         transaction.Status,
+		Method:         transaction.Method,
+		Memo:           transaction.Memo,
+		Voided:         transaction.VoidedAt != nil,
+		VoidedBy:       transaction.VoidedBy,
+		Audits:         make([]SettlementTransactionAudit, len(audits)),
+	}
+	if transaction.ConfirmedAt != nil {
+		confirmedAt := transaction.ConfirmedAt.UnixMilli()
+		item.ConfirmedAt = &confirmedAt
+	}
+	if transaction.VoidedAt != nil {
+		voidedAt := transaction.VoidedAt.UnixMilli()
+		item.VoidedAt = &voidedAt
+	}
+	for i, audit := range audits {
+		item.Audits[i] = SettlementTransactionAudit{
+			UserId:    audit.UserId,
+			Action:    audit.Action,
+			Memo:      audit.Memo,
+			CreatedAt: audit.CreatedAt.UnixMilli(),
+		}
+	}
+	return item
+}
+
 func UseSettlementRouter(g *gin.RouterGroup) {
 	rg := g.Group("/settlement")
 	rg.GET("", SettlementInfo)
 	rg.POST("/complete", CompleteSettlement)
+	rg.POST("/declare", DeclareSettlement)
+	rg.POST("/confirm", ConfirmSettlement)
+	rg.POST("/dispute", DisputeSettlement)
+	rg.GET("/transactions", SettlementTransactions)
+	rg.POST("/transactions/void", VoidSettlementTransaction)
 }
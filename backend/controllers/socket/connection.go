@@ -2,6 +2,8 @@ package socket
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	socketio "github.com/googollee/go-socket.io"
@@ -24,6 +26,9 @@ var (
 	SocketManager = NewSocketManager()
 )
 
+// assistantTimeout limits how long an answer of the assistant is streamed
+const assistantTimeout = 3 * time.Minute
+
 func UseSocket(r *gin.Engine) {
 	io := socketio.NewServer(&engineio.Options{
 		Transports: []transport.Transport{
@@ -214,42 +219,15 @@ func userHandlers(io *socketio.Server) {
 		fetchCount := 8
 		messagesRaw, err := database.InMemoryDB.LRange(RoomGptKey(sessionId), int64(-fetchCount), -1)
 
-		// configure histories
-		histories := make([]text_completion.CompletionMessage, 0)
-		// push system message
-		histories = append(histories, text_completion.CompletionMessage{
-			Role:    text_completion.ROLE_SYSTEM,
-			Content: platform.GptBrainWashPrompt,
-			Name:    "System",
-		})
-		log.Debugf("Histories:")
-		for _, messageRaw := range messagesRaw {
-			chatMessage, err := ChatMessageFromStr(messageRaw)
-			if err != nil {
-				log.Error(err)
-				continue
-			}
-			var role string
-			if chatMessage.Type == TypeAssistantRequest {
-				role = text_completion.ROLE_USER
-			} else if chatMessage.Type == TypeAssistantResponse {
-				role = text_completion.ROLE_ASSISTANT
-			} else {
-				log.Warnf("Invalid message type %s", chatMessage.Type)
-				continue
-			}
-			histories = append(histories, text_completion.CompletionMessage{
-				Role:    role,
-				Content: chatMessage.Content,
-				Name:    "Traveler",
-			})
-			log.Debugf("%s: %s\n", chatMessage.SenderUsername, chatMessage.Content)
-		}
+		histories := assistantHistories(messagesRaw)
 
-		resp, err := text_completion.RequestCompletion(text_completion.MODEL_GPT_4, histories)
+		// the answer is streamed apart from the event, until it ends or times out
+		ctx, cancel := context.WithTimeout(context.Background(), assistantTimeout)
+		resp, err := text_completion.DefaultClient.Stream(ctx, histories)
 		if err != nil {
+			cancel()
 			log.Error(err)
-			s.Emit(EventSessionChatSendAssistantMessage, NewFailure(err.Error()))
+			s.Emit(EventSessionChatSendAssistantMessage, NewFailure(assistantErrorMessage(err)))
 			return
 		}
 
@@ -263,30 +241,22 @@ func userHandlers(io *socketio.Server) {
 		}))
 
 		go func() {
-			// create stream to store gpt response
-			// and send to client as segments (resp is *io.PipeReader)
-			scanner := bufio.NewScanner(resp)
-			scanner.Split(bufio.ScanRunes)
-			storedContent := ""
-
-			for scanner.Scan() {
-				runeText := scanner.Text()
-				storedContent += runeText
+			defer cancel()
+			defer resp.Close()
+
+			// send the response to clients as segments while storing it
+			storedContent, err := readAssistantStream(resp, func(runeText string) {
 				io.BroadcastToRoom("/", RoomKey(sessionId), EventSessionChatAssistantMessageStream, NewSuccess(GptResponseStreamEvent{
 					GptResponseId: gptMessageId,
 					Content:       runeText,
 				}))
-			}
-
-			if err := scanner.Err(); err != nil {
+			})
+			if err != nil {
 				log.Error(err)
-				if err != io2.EOF {
-					log.Error(err)
-					io.BroadcastToRoom("/", RoomKey(sessionId), EventSessionChatAssistantMessageError, NewSuccess(GptResponseErrorEvent{
-						GptResponseId: gptMessageId,
-						ErrorMessage:  err.Error(),
-					}))
-				}
+				io.BroadcastToRoom("/", RoomKey(sessionId), EventSessionChatAssistantMessageError, NewSuccess(GptResponseErrorEvent{
+					GptResponseId: gptMessageId,
+					ErrorMessage:  assistantErrorMessage(err),
+				}))
 			} else {
 				// first save response to memory db
 				gptResponse := ChatMessage{
@@ -327,3 +297,66 @@ func userHandlers(io *socketio.Server) {
 		}()
 	})
 }
+
+// assistantHistories are messages to the assistant from recent ones of the gpt room, after the system prompt
+func assistantHistories(messagesRaw []string) []text_completion.CompletionMessage {
+	histories := make([]text_completion.CompletionMessage, 0)
+	// push system message
+	histories = append(histories, text_completion.CompletionMessage{
+		Role:    text_completion.ROLE_SYSTEM,
+		Content: platform.GptBrainWashPrompt,
+		Name:    "System",
+	})
+	log.Debugf("Histories:")
+	for _, messageRaw := range messagesRaw {
+		chatMessage, err := ChatMessageFromStr(messageRaw)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		var role string
+		if chatMessage.Type == TypeAssistantRequest {
+			role = text_completion.ROLE_USER
+		} else if chatMessage.Type == TypeAssistantResponse {
+			role = text_completion.ROLE_ASSISTANT
+		} else {
+			log.Warnf("Invalid message type %s", chatMessage.Type)
+			continue
+		}
+		histories = append(histories, text_completion.CompletionMessage{
+			Role:    role,
+			Content: chatMessage.Content,
+			Name:    "Traveler",
+		})
+		log.Debugf("%s: %s\n", chatMessage.SenderUsername, chatMessage.Content)
+	}
+	return histories
+}
+
+// readAssistantStream reads the streamed answer by runes, passing each to onRune, and returns the whole answer
+func readAssistantStream(stream io2.Reader, onRune func(runeText string)) (string, error) {
+	scanner := bufio.NewScanner(stream)
+	scanner.Split(bufio.ScanRunes)
+	storedContent := ""
+	for scanner.Scan() {
+		runeText := scanner.Text()
+		storedContent += runeText
+		onRune(runeText)
+	}
+	return storedContent, scanner.Err()
+}
+
+// assistantErrorMessage tells users what went wrong with the assistant, without details of the api
+func assistantErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, text_completion.ErrRateLimit):
+		return "assistant is busy, please try again later"
+	case errors.Is(err, text_completion.ErrContextLength):
+		return "conversation is too long for assistant"
+	case errors.Is(err, text_completion.ErrAuth):
+		return "assistant is not available"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "assistant took too long to answer"
+	}
+	return err.Error()
+}
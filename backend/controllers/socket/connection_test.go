@@ -0,0 +1,123 @@
+package socket
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+	"travel-ai/third_party/open_ai/text_completion"
+	"travel-ai/third_party/open_ai/text_completion/fake"
+)
+
+func newAssistant(t *testing.T, replies ...fake.Reply) (*fake.Server, text_completion.LLMClient) {
+	server := fake.NewServer()
+	t.Cleanup(server.Close)
+	server.Enqueue(replies...)
+	return server, text_completion.NewClient(server.Config())
+}
+
+// askAssistant drives the assistant as the event does, returning runes streamed to clients and the error message if any
+func askAssistant(ctx context.Context, client text_completion.LLMClient, histories []text_completion.CompletionMessage) (string, []string, string) {
+	stream, err := client.Stream(ctx, histories)
+	if err != nil {
+		return "", nil, assistantErrorMessage(err)
+	}
+	defer stream.Close()
+
+	var runes []string
+	answer, err := readAssistantStream(stream, func(runeText string) {
+		runes = append(runes, runeText)
+	})
+	if err != nil {
+		return answer, runes, assistantErrorMessage(err)
+	}
+	return answer, runes, ""
+}
+
+func chatMessageStr(t *testing.T, content string, _type string) string {
+	raw, err := NewChatMessage("uid", "Traveler", nil, "sid", content, 0, _type).String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestAssistantHistories(t *testing.T) {
+	histories := assistantHistories([]string{
+		chatMessageStr(t, "Where to eat?", TypeAssistantRequest),
+		chatMessageStr(t, "Gwangjang Market", TypeAssistantResponse),
+		chatMessageStr(t, "hello", "unknown"),
+		"not a message",
+	})
+
+	expected := []string{text_completion.ROLE_SYSTEM, text_completion.ROLE_USER, text_completion.ROLE_ASSISTANT}
+	if len(histories) != len(expected) {
+		t.Fatalf("expected %d histories, got %+v", len(expected), histories)
+	}
+	for i, role := range expected {
+		if histories[i].Role != role {
+			t.Errorf("histories[%d] is of %s, expected %s", i, histories[i].Role, role)
+		}
+	}
+	if histories[2].Content != "Gwangjang Market" {
+		t.Errorf("unexpected content %q", histories[2].Content)
+	}
+}
+
+func TestAssistantStream(t *testing.T) {
+	server, client := newAssistant(t, fake.Answer("광장", "", " Market"))
+	histories := assistantHistories([]string{chatMessageStr(t, "Where to eat?", TypeAssistantRequest)})
+
+	answer, runes, errorMessage := askAssistant(context.Background(), client, histories)
+	if errorMessage != "" {
+		t.Fatal(errorMessage)
+	}
+	if answer != "광장 Market" {
+		t.Errorf("answer = %q", answer)
+	}
+	if len(runes) != 9 || runes[0] != "광" || runes[1] != "장" {
+		t.Errorf("unexpected runes %q", runes)
+	}
+	if request := server.Requests()[0]; !request.Stream || len(request.Messages) != 2 {
+		t.Errorf("unexpected request %+v", request.CompletionRequest)
+	}
+}
+
+func TestAssistantErrors(t *testing.T) {
+	midStream := fake.Fail(http.StatusOK, "rate_limit_exceeded", "Rate limit reached")
+	midStream.Chunks = []string{"Gwang"}
+
+	tests := []struct {
+		name     string
+		reply    fake.Reply
+		expected string
+	}{
+		{"rate limit", fake.Fail(http.StatusTooManyRequests, "rate_limit_exceeded", "Rate limit reached"),
+			"assistant is busy, please try again later"},
+		{"context length", fake.Fail(http.StatusBadRequest, "context_length_exceeded", "maximum context length is 8192 tokens"),
+			"conversation is too long for assistant"},
+		{"auth", fake.Fail(http.StatusUnauthorized, "invalid_api_key", "Incorrect API key provided"),
+			"assistant is not available"},
+		{"rate limit in stream", midStream, "assistant is busy, please try again later"},
+	}
+	for _, test := range tests {
+		_, client := newAssistant(t, test.reply)
+		if _, _, errorMessage := askAssistant(context.Background(), client, assistantHistories(nil)); errorMessage != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, errorMessage)
+		}
+	}
+}
+
+func TestAssistantTimeout(t *testing.T) {
+	_, client := newAssistant(t, fake.Reply{Chunks: []string{"Gwang"}, Hang: true})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	answer, _, errorMessage := askAssistant(ctx, client, assistantHistories(nil))
+	if errorMessage != "assistant took too long to answer" {
+		t.Errorf("unexpected error message %q", errorMessage)
+	}
+	if answer != "Gwang" {
+		t.Errorf("answer before the timeout = %q", answer)
+	}
+}
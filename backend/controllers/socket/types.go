@@ -22,8 +22,11 @@ const (
 	EventSessionChatAssistantMessageError  = "sessionChat/assistantMessageError"
 
 	EventBudgetCreated              = "budget/created"
+	EventBudgetThresholdCrossed     = "budget/thresholdCrossed"
 	EventExpenditureCreated         = "expenditure/created"
 	EventExpenditureDeleted         = "expenditure/deleted"
+	EventExpenditureUpdated         = "expenditure/updated"
+	EventKittyChanged               = "kitty/changed"
 	EventFriendRequestReceived      = "friend/requestReceived"
 	EventFriendConnected            = "friend/connected"
 	EventLocationCreated            = "location/created"
@@ -31,6 +34,9 @@ const (
 	EventScheduleCreated            = "schedule/created"
 	EventScheduleDeleted            = "schedule/deleted"
 	EventSettlementChanged          = "settlement/changed"
+	EventSettlementTransactionAdded = "settlement/transactionAdded"
+	EventSettlementTransactionSet   = "settlement/transactionUpdated"
+	EventSettlementTransactionVoid  = "settlement/transactionVoided"
 	EventSessionMemberJoined        = "session/memberJoined"
 	EventSessionMemberLeft          = "session/memberLeft"
 	EventSessionMemberInvited       = "session/memberInvited"
@@ -1,13 +1,16 @@
 package test
 
 import (
+	"bytes"
+	"encoding/base64"
+	"image/png"
 	"net/http"
 	"os"
 	"strconv"
 	util2 "travel-ai/controllers/util"
 	"travel-ai/log"
+	"travel-ai/service/receipt_ocr"
 	"travel-ai/third_party/opencv"
-	"travel-ai/third_party/taggun_receipt_ocr"
 	"travel-ai/util"
 
 	"github.com/gin-gonic/gin"
@@ -37,13 +40,47 @@ func ImagePreprocess(c *gin.Context) {
 		return
 	}
 
-	//processedImage, err := cloud_vision.PreprocessImage(image)
-	processedImage, err := opencv.CropReceiptSubImage(image)
+	// parameters of the pipeline can be tuned by form fields
+	params := opencv.DefaultReceiptPipelineParams()
+	if err := c.ShouldBind(&params); err != nil {
+		log.Error(err)
+		util2.AbortWithStrJson(c, http.StatusBadRequest, "invalid pipeline params: "+err.Error())
+		return
+	}
+
+	result, err := opencv.ProcessReceiptImage(image, params)
 	if err != nil {
 		log.Error(err)
 		util2.AbortWithErrJson(c, http.StatusInternalServerError, err)
 		return
 	}
+	processedImage := result.Image
+
+	// intermediate images are given instead of OCR in debug mode
+	if params.Debug {
+		steps := make([]imagePreprocessStepDto, 0, len(result.Steps)+1)
+		for _, step := range append(result.Steps, opencv.ReceiptPipelineStep{Name: "result", Image: processedImage}) {
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, step.Image); err != nil {
+				log.Error(err)
+				util2.AbortWithErrJson(c, http.StatusInternalServerError, err)
+				return
+			}
+			steps = append(steps, imagePreprocessStepDto{
+				Name:  step.Name,
+				Image: "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()),
+			})
+		}
+		if err := os.Remove(dest); err != nil {
+			log.Error(err)
+		}
+		c.JSON(http.StatusOK, imagePreprocessDebugResponseDto{
+			Corners:   result.Corners,
+			SkewAngle: result.SkewAngle,
+			Steps:     steps,
+		})
+		return
+	}
 
 	// overwrite file
 	if err := util.SaveImageFileAsPng(processedImage, dest, true); err != nil {
@@ -73,77 +110,24 @@ func ImagePreprocess(c *gin.Context) {
 		log.Debug("temp file deleted: " + dest)
 	}(f)
 
-	taggunResp, err := taggun_receipt_ocr.ParseReceipt(f)
+	receipt, err := receipt_ocr.DefaultParser.Parse(c, f, file.Filename)
 	if err != nil {
 		log.Error(err)
 		util2.AbortWithErrJson(c, http.StatusInternalServerError, err)
 		return
 	}
 
-	totalAmount := 0.0
-	totalAmountUnit := "" // KRW, USD, JPY, ...
-	totalAmountConfident := false
-	if taggunResp.TotalAmount.ConfidenceLevel >= 0.5 {
-		totalAmount = taggunResp.TotalAmount.Data
-		totalAmountUnit = taggunResp.TotalAmount.CurrencyCode
-		totalAmountConfident = true
-	} else {
-		log.Debugf("total amount confidence level is too low: %v", taggunResp.TotalAmount.ConfidenceLevel)
-	}
-
-	taxAmount := 0.0
-	taxAmountUnit := "" // KRW, USD, JPY, ...
-	taxAmountConfident := false
-	if taggunResp.TaxAmount.ConfidenceLevel >= 0.5 {
-		taxAmount = taggunResp.TaxAmount.Data
-		taxAmountUnit = taggunResp.TaxAmount.CurrencyCode
-		taxAmountConfident = true
-	} else {
-		log.Debugf("tax amount confidence level is too low: %v", taggunResp.TaxAmount.ConfidenceLevel)
-	}
-
-	type Item struct {
-		Name   string
-		Amount int
-		Price  float64
-	}
-	items := make(map[int]Item)
-	for _, amountRaw := range taggunResp.Amounts {
-		itemRaw, ok := items[amountRaw.Index]
-		if !ok {
-			itemRaw = Item{
-				Amount: 1,
-			}
-		}
-		itemRaw.Name = amountRaw.Text
-		itemRaw.Price = amountRaw.Data
-		items[amountRaw.Index] = itemRaw
-	}
-	for _, numberRaw := range taggunResp.Numbers {
-		itemRaw, ok := items[numberRaw.Index]
-		if !ok {
-			itemRaw = Item{}
+	log.Debugf("total amount: %v (%v)", receipt.Total.Value, receipt.Total.Confidence)
+	log.Debugf("total amount unit: %v (%v)", receipt.CurrencyCode.Value, receipt.CurrencyCode.Confidence)
+	log.Debugf("tax amount: %v (%v)", receipt.Tax.Value, receipt.Tax.Confidence)
+	if merged, err := receipt_ocr.Merge(*receipt); err == nil {
+		for _, item := range merged.Items {
+			log.Debugf("item: %s x%d %v", item.Label, item.Quantity, item.Price)
 		}
-		itemRaw.Amount = numberRaw.Data
-		items[numberRaw.Index] = itemRaw
-	}
-
-	if !totalAmountConfident {
-		totalAmount = 0.0
-		for _, item := range items {
-			totalAmount += item.Price
-		}
-	}
-
-	if !taxAmountConfident {
-		taxAmount = 0.0
+	} else {
+		log.Debug(err)
 	}
 
-	log.Debugf("total amount: %v", totalAmount)
-	log.Debugf("total amount unit: %v", totalAmountUnit)
-	log.Debugf("tax amount: %v", taxAmount)
-	log.Debugf("tax amount unit: %v", taxAmountUnit)
-
 	fileInfo, _ := f.Stat()
 	fileSize := fileInfo.Size()
 
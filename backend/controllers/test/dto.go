@@ -1,5 +1,18 @@
 package test
 
+import "image"
+
 type textCompletionRequestDto struct {
 	Prompt string `json:"prompt"`
 }
+
+type imagePreprocessStepDto struct {
+	Name  string `json:"name"`
+	Image string `json:"image"` // data url of png
+}
+
+type imagePreprocessDebugResponseDto struct {
+	Corners   []image.Point            `json:"corners"` // top-left, top-right, bottom-right, bottom-left
+	SkewAngle float64                  `json:"skew_angle"`
+	Steps     []imagePreprocessStepDto `json:"steps"`
+}
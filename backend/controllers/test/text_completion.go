@@ -16,7 +16,8 @@ func TextCompletionSync(c *gin.Context) {
 		return
 	}
 
-	resp, err := text_completion.RequestCompletionSync(text_completion.MODEL_GPT_4, text_completion.ROLE_USER, body.Prompt)
+	messages := []text_completion.CompletionMessage{{Role: text_completion.ROLE_USER, Content: body.Prompt, Name: "Traveler"}}
+	resp, err := text_completion.DefaultClient.Complete(c.Request.Context(), messages)
 	if err != nil {
 		util.AbortWithErrJson(c, http.StatusInternalServerError, err)
 		return
@@ -35,11 +36,13 @@ func TextCompletion(c *gin.Context) {
 	w.Header().Set("Content-Type", "application/octet-stream")
 	w.Header().Set("Transfer-Encoding", "chunked")
 
-	resp, err := text_completion.RequestCompletionEx(text_completion.MODEL_GPT_4, text_completion.ROLE_USER, body.Prompt)
+	messages := []text_completion.CompletionMessage{{Role: text_completion.ROLE_USER, Content: body.Prompt, Name: "Traveler"}}
+	resp, err := text_completion.DefaultClient.Stream(c.Request.Context(), messages)
 	if err != nil {
 		util.AbortWithErrJson(c, http.StatusInternalServerError, err)
 		return
 	}
+	defer resp.Close()
 
 	_, err = io.Copy(c.Writer, resp)
 	if err != nil {
@@ -11,10 +11,13 @@ import (
 	"travel-ai/libs/crypto"
 	"travel-ai/log"
 	"travel-ai/service/database"
+	"travel-ai/service/exchange_rate"
 	"travel-ai/service/platform"
+	"travel-ai/service/receipt_ocr"
 	"travel-ai/third_party/google_cloud/cloud_vision"
 	"travel-ai/third_party/google_cloud/places"
 	"travel-ai/third_party/open_ai"
+	"travel-ai/third_party/open_ai/text_completion"
 	"travel-ai/third_party/pexels"
 	"travel-ai/third_party/taggun_receipt_ocr"
 
@@ -95,6 +98,18 @@ func main() {
 	places.Initialize()
 	pexels.Initialize()
 	taggun_receipt_ocr.Initialize()
+	if err := text_completion.Initialize(); err != nil {
+		log.Error(err)
+		os.Exit(-2)
+	}
+	if err := exchange_rate.Initialize(); err != nil {
+		log.Error(err)
+		os.Exit(-2)
+	}
+	if err := receipt_ocr.Initialize(); err != nil {
+		log.Error(err)
+		os.Exit(-2)
+	}
 
 	// Preload
 	if err := platform.Preload(); err != nil {
@@ -0,0 +1,47 @@
+package money
+
+// defaultExponent is the number of minor unit digits of currencies which are not listed below
+const defaultExponent = 2
+
+// exponents is the number of minor unit digits (ISO 4217) which are not defaultExponent
+var exponents = map[string]int{
+	// no minor unit
+	"BIF": 0,
+	"CLP": 0,
+	"DJF": 0,
+	"GNF": 0,
+	"ISK": 0,
+	"JPY": 0,
+	"KMF": 0,
+	"KRW": 0,
+	"PYG": 0,
+	"RWF": 0,
+	"UGX": 0,
+	"UYI": 0,
+	"VND": 0,
+	"VUV": 0,
+	"XAF": 0,
+	"XOF": 0,
+	"XPF": 0,
+
+	// three digits of minor unit
+	"BHD": 3,
+	"IQD": 3,
+	"JOD": 3,
+	"KWD": 3,
+	"LYD": 3,
+	"OMR": 3,
+	"TND": 3,
+
+	// four digits of minor unit
+	"CLF": 4,
+	"UYW": 4,
+}
+
+// Exponent returns the number of minor unit digits of the currency (e.g. JPY 0, USD 2, KWD 3)
+func Exponent(currencyCode string) int {
+	if exponent, ok := exponents[currencyCode]; ok {
+		return exponent
+	}
+	return defaultExponent
+}
@@ -0,0 +1,81 @@
+package money
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"regexp"
+)
+
+// maxScale is the maximum number of fraction digits which Decimal keeps while parsing
+const maxScale = 18
+
+var decimalPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+
+// Decimal is an exact decimal number in major unit, which is used for amounts in request/response bodies.
+// It is (un)marshalled as a plain JSON number (a quoted string is also accepted), never through float64.
+type Decimal struct {
+	rat   *big.Rat
+	scale int // number of fraction digits when formatted
+}
+
+// NewDecimal makes a decimal which is formatted with scale fraction digits
+func NewDecimal(r *big.Rat, scale int) Decimal {
+	return Decimal{rat: new(big.Rat).Set(r), scale: scale}
+}
+
+// ParseDecimal parses decimal literal such as "1200", "-3.25" or "1.5e3"
+func ParseDecimal(s string) (Decimal, error) {
+	if !decimalPattern.MatchString(s) {
+		return Decimal{}, fmt.Errorf("invalid decimal: %q", s)
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return Decimal{}, fmt.Errorf("invalid decimal: %q", s)
+	}
+
+	// find the smallest scale which represents the value exactly
+	scale := 0
+	scaled := new(big.Rat).Set(r)
+	for !scaled.IsInt() {
+		if scale >= maxScale {
+			return Decimal{}, fmt.Errorf("too many fraction digits: %q", s)
+		}
+		scaled.Mul(scaled, big.NewRat(10, 1))
+		scale++
+	}
+	return Decimal{rat: r, scale: scale}, nil
+}
+
+// Rat returns a copy of the value
+func (d Decimal) Rat() *big.Rat {
+	if d.rat == nil {
+		return new(big.Rat)
+	}
+	return new(big.Rat).Set(d.rat)
+}
+
+func (d Decimal) Sign() int {
+	if d.rat == nil {
+		return 0
+	}
+	return d.rat.Sign()
+}
+
+func (d Decimal) String() string {
+	return d.Rat().FloatString(d.scale)
+}
+
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	data = bytes.Trim(data, `"`)
+	parsed, err := ParseDecimal(string(data))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
@@ -0,0 +1,123 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+)
+
+var (
+	ErrPrecision        = errors.New("amount has more fraction digits than currency allows")
+	ErrOverflow         = errors.New("amount is out of range")
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+)
+
+// Money is an exact amount of a currency, which is stored in minor unit (e.g. cents of USD)
+type Money struct {
+	Amount       int64  `json:"amount"`
+	CurrencyCode string `json:"currency_code"`
+}
+
+// New makes money from amount in minor unit
+func New(amount int64, currencyCode string) Money {
+	return Money{Amount: amount, CurrencyCode: currencyCode}
+}
+
+func Zero(currencyCode string) Money {
+	return New(0, currencyCode)
+}
+
+// FromDecimal makes money from amount in major unit. It fails if the amount can not be represented
+// in minor unit of the currency exactly (e.g. 1.5 KRW, 0.001 USD).
+func FromDecimal(d Decimal, currencyCode string) (Money, error) {
+	minor := d.Rat()
+	minor.Mul(minor, minorUnitsPerMajor(currencyCode))
+	if !minor.IsInt() {
+		return Money{}, fmt.Errorf("%w: %s %s", ErrPrecision, d, currencyCode)
+	}
+	if !minor.Num().IsInt64() {
+		return Money{}, fmt.Errorf("%w: %s %s", ErrOverflow, d, currencyCode)
+	}
+	return New(minor.Num().Int64(), currencyCode), nil
+}
+
+// FromRat makes money from amount in major unit, rounding half away from zero to minor unit
+func FromRat(r *big.Rat, currencyCode string) Money {
+	minor := new(big.Rat).Mul(r, minorUnitsPerMajor(currencyCode))
+	quo, rem := new(big.Int).QuoRem(minor.Num(), minor.Denom(), new(big.Int))
+
+	// |rem| * 2 >= denom means rounding away from zero
+	rem.Abs(rem)
+	rem.Lsh(rem, 1)
+	if rem.Cmp(minor.Denom()) >= 0 {
+		quo.Add(quo, big.NewInt(int64(minor.Sign())))
+	}
+	return New(quo.Int64(), currencyCode)
+}
+
+// FromFloat64 makes money from float amount in major unit (e.g. OCR result).
+// The float is read as its shortest decimal representation, so that 0.1 is exactly 1/10.
+func FromFloat64(f float64, currencyCode string) Money {
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(f, 'f', -1, 64))
+	if !ok {
+		return Zero(currencyCode)
+	}
+	return FromRat(r, currencyCode)
+}
+
+func minorUnitsPerMajor(currencyCode string) *big.Rat {
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(Exponent(currencyCode))), nil)
+	return new(big.Rat).SetInt(unit)
+}
+
+// Rat returns the amount in major unit
+func (m Money) Rat() *big.Rat {
+	return new(big.Rat).Quo(big.NewRat(m.Amount, 1), minorUnitsPerMajor(m.CurrencyCode))
+}
+
+// Decimal returns the amount in major unit, formatted with exponent of the currency
+func (m Money) Decimal() Decimal {
+	return NewDecimal(m.Rat(), Exponent(m.CurrencyCode))
+}
+
+// Float64 returns the nearest float of the amount in major unit, which is only for display or statistics
+func (m Money) Float64() float64 {
+	f, _ := m.Rat().Float64()
+	return f
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+func (m Money) Neg() Money {
+	return New(-m.Amount, m.CurrencyCode)
+}
+
+func (m Money) Add(o Money) (Money, error) {
+	if m.CurrencyCode != o.CurrencyCode {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.CurrencyCode, o.CurrencyCode)
+	}
+	return New(m.Amount+o.Amount, m.CurrencyCode), nil
+}
+
+func (m Money) Sub(o Money) (Money, error) {
+	return m.Add(o.Neg())
+}
+
+// Exchange converts money into another currency by rate (1 major unit of m = rate major units of target)
+func (m Money) Exchange(rate *big.Rat, currencyCode string) Money {
+	if m.CurrencyCode == currencyCode {
+		return m
+	}
+	return FromRat(new(big.Rat).Mul(m.Rat(), rate), currencyCode)
+}
+
+func (m Money) String() string {
+	return m.Decimal().String() + " " + m.CurrencyCode
+}
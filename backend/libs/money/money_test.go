@@ -0,0 +1,151 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestExponent(t *testing.T) {
+	cases := map[string]int{"USD": 2, "EUR": 2, "JPY": 0, "KRW": 0, "KWD": 3}
+	for currencyCode, expected := range cases {
+		if got := Exponent(currencyCode); got != expected {
+			t.Errorf("Exponent(%s) = %d, expected %d", currencyCode, got, expected)
+		}
+	}
+}
+
+func TestFromDecimal(t *testing.T) {
+	cases := []struct {
+		literal      string
+		currencyCode string
+		expected     int64
+		err          error
+	}{
+		{"12.34", "USD", 1234, nil},
+		{"0.1", "USD", 10, nil},
+		{"1200", "KRW", 1200, nil},
+		{"1.5e3", "JPY", 1500, nil},
+		{"1.234", "KWD", 1234, nil},
+		{"-3.5", "USD", -350, nil},
+		{"1.5", "KRW", 0, ErrPrecision},
+		{"0.001", "USD", 0, ErrPrecision},
+		{"100000000000000000000", "KRW", 0, ErrOverflow},
+	}
+	for _, c := range cases {
+		d, err := ParseDecimal(c.literal)
+		if err != nil {
+			t.Fatalf("ParseDecimal(%s): %v", c.literal, err)
+		}
+		m, err := FromDecimal(d, c.currencyCode)
+		if c.err != nil {
+			if !errors.Is(err, c.err) {
+				t.Errorf("FromDecimal(%s, %s) error = %v, expected %v", c.literal, c.currencyCode, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("FromDecimal(%s, %s): %v", c.literal, c.currencyCode, err)
+			continue
+		}
+		if m.Amount != c.expected || m.CurrencyCode != c.currencyCode {
+			t.Errorf("FromDecimal(%s, %s) = %v, expected %d", c.literal, c.currencyCode, m, c.expected)
+		}
+	}
+}
+
+func TestParseDecimalInvalid(t *testing.T) {
+	for _, literal := range []string{"", "abc", "1/3", "1.", ".5", "1,000", "0x10"} {
+		if _, err := ParseDecimal(literal); err == nil {
+			t.Errorf("ParseDecimal(%q) expected error", literal)
+		}
+	}
+}
+
+func TestFromRat(t *testing.T) {
+	cases := []struct {
+		rat          *big.Rat
+		currencyCode string
+		expected     int64
+	}{
+		{big.NewRat(1, 3), "USD", 33},
+		{big.NewRat(2, 3), "USD", 67},
+		{big.NewRat(1, 200), "USD", 1},
+		{big.NewRat(-1, 200), "USD", -1},
+		{big.NewRat(1001, 2), "KRW", 501},
+		{big.NewRat(-1001, 2), "KRW", -501},
+		{big.NewRat(10, 3), "KWD", 3333},
+	}
+	for _, c := range cases {
+		if got := FromRat(c.rat, c.currencyCode); got.Amount != c.expected {
+			t.Errorf("FromRat(%s, %s) = %d, expected %d", c.rat, c.currencyCode, got.Amount, c.expected)
+		}
+	}
+}
+
+func TestFromFloat64(t *testing.T) {
+	if got := FromFloat64(0.1+0.2, "USD"); got.Amount != 30 {
+		t.Errorf("FromFloat64(0.1+0.2) = %d, expected 30", got.Amount)
+	}
+	if got := FromFloat64(12000, "KRW"); got.Amount != 12000 {
+		t.Errorf("FromFloat64(12000) = %d, expected 12000", got.Amount)
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	sum, err := New(150, "USD").Add(New(275, "USD"))
+	if err != nil || sum.Amount != 425 {
+		t.Errorf("Add = %v, %v", sum, err)
+	}
+	diff, err := New(150, "USD").Sub(New(275, "USD"))
+	if err != nil || diff.Amount != -125 || !diff.IsNegative() {
+		t.Errorf("Sub = %v, %v", diff, err)
+	}
+	if _, err := New(150, "USD").Add(New(150, "KRW")); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Add with another currency error = %v", err)
+	}
+
+	exchanged := New(1234, "USD").Exchange(big.NewRat(1300, 1), "KRW")
+	if exchanged.Amount != 16042 || exchanged.CurrencyCode != "KRW" {
+		t.Errorf("Exchange = %v", exchanged)
+	}
+}
+
+func TestDecimalJSON(t *testing.T) {
+	var body struct {
+		Price    Decimal  `json:"price"`
+		Quoted   Decimal  `json:"quoted"`
+		Optional *Decimal `json:"optional"`
+	}
+	if err := json.Unmarshal([]byte(`{"price": 0.3, "quoted": "19.99"}`), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Price.Rat().Cmp(big.NewRat(3, 10)) != 0 {
+		t.Errorf("price = %s", body.Price)
+	}
+	if body.Quoted.Rat().Cmp(big.NewRat(1999, 100)) != 0 {
+		t.Errorf("quoted = %s", body.Quoted)
+	}
+	if body.Optional != nil {
+		t.Errorf("optional = %s, expected nil", body.Optional)
+	}
+	if err := json.Unmarshal([]byte(`{"price": "1/3"}`), &body); err == nil {
+		t.Error("expected error for fraction literal")
+	}
+
+	cases := map[string]Money{
+		`12.50`:  New(1250, "USD"),
+		`1200`:   New(1200, "KRW"),
+		`-0.005`: New(-5, "KWD"),
+	}
+	for expected, m := range cases {
+		data, err := json.Marshal(m.Decimal())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("marshal %v = %s, expected %s", m, data, expected)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package phash
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math/bits"
+	"strconv"
+)
+
+var ErrInvalidHash = errors.New("invalid image hash")
+
+// Hash is a 64-bit perceptual hash of an image, where similar images have close hashes
+type Hash uint64
+
+const (
+	hashWidth  = 9 // one more column than bits in a row, as each bit compares neighbors
+	hashHeight = 8
+	// sampled pixels in each cell at most, as averaging every pixel of a photo is slow
+	maxCellSamples = 64
+)
+
+// DifferenceHash is the dHash of the image, which compares brightness of neighbor cells in 9x8 grid.
+// It is kept through resizing, recompression and small changes of color, but not through cropping or rotation.
+func DifferenceHash(img image.Image) Hash {
+	var cells [hashHeight][hashWidth]float64
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return 0
+	}
+
+	for cy := 0; cy < hashHeight; cy++ {
+		y0 := bounds.Min.Y + cy*height/hashHeight
+		y1 := bounds.Min.Y + (cy+1)*height/hashHeight
+		for cx := 0; cx < hashWidth; cx++ {
+			x0 := bounds.Min.X + cx*width/hashWidth
+			x1 := bounds.Min.X + (cx+1)*width/hashWidth
+			cells[cy][cx] = averageLuminance(img, x0, y0, x1, y1)
+		}
+	}
+
+	var hash Hash
+	for cy := 0; cy < hashHeight; cy++ {
+		for cx := 0; cx < hashWidth-1; cx++ {
+			hash <<= 1
+			if cells[cy][cx] < cells[cy][cx+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// averageLuminance of the cell [x0, x1) x [y0, y1), which is at least a pixel
+func averageLuminance(img image.Image, x0, y0, x1, y1 int) float64 {
+	if x1 <= x0 {
+		x1 = x0 + 1
+	}
+	if y1 <= y0 {
+		y1 = y0 + 1
+	}
+	stepX := (x1-x0)/maxCellSamples + 1
+	stepY := (y1-y0)/maxCellSamples + 1
+
+	sum, count := 0.0, 0
+	for y := y0; y < y1; y += stepY {
+		for x := x0; x < x1; x += stepX {
+			r, g, b, _ := img.At(x, y).RGBA()
+			sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+			count++
+		}
+	}
+	return sum / float64(count)
+}
+
+// Distance is the number of different bits, which is zero for the same image
+func Distance(a, b Hash) int {
+	return bits.OnesCount64(uint64(a ^ b))
+}
+
+// String is 16 hex digits of the hash, which is how it is stored
+func (h Hash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
+
+func Parse(s string) (Hash, error) {
+	if len(s) != 16 {
+		return 0, ErrInvalidHash
+	}
+	value, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, ErrInvalidHash
+	}
+	return Hash(value), nil
+}
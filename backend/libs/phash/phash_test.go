@@ -0,0 +1,85 @@
+package phash
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const examplesDir = "../../../examples/OCR/receipts"
+
+func openExample(t *testing.T, name string) image.Image {
+	t.Helper()
+	f, err := os.Open(filepath.Join(examplesDir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+// halve shrinks the image by nearest neighbor, and compresses it again as a low quality jpeg
+func halve(t *testing.T, img image.Image) image.Image {
+	t.Helper()
+	bounds := img.Bounds()
+	resized := image.NewRGBA(image.Rect(0, 0, bounds.Dx()/2, bounds.Dy()/2))
+	for y := 0; y < resized.Rect.Dy(); y++ {
+		for x := 0; x < resized.Rect.Dx(); x++ {
+			resized.Set(x, y, img.At(bounds.Min.X+2*x, bounds.Min.Y+2*y))
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, resized, &jpeg.Options{Quality: 40}); err != nil {
+		t.Fatal(err)
+	}
+	compressed, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return compressed
+}
+
+func TestDifferenceHash(t *testing.T) {
+	names := []string{"29.jpg", "SSI_20191213151350.jpg", "images (2).jpg", "제목 없음.png"}
+	hashes := make([]Hash, len(names))
+	for i, name := range names {
+		img := openExample(t, name)
+		hashes[i] = DifferenceHash(img)
+
+		// the same receipt uploaded again in another size
+		if d := Distance(hashes[i], DifferenceHash(halve(t, img))); d > 8 {
+			t.Errorf("%s: expected close hash of the resized image, got distance %d", name, d)
+		}
+	}
+	for i := range names {
+		for j := i + 1; j < len(names); j++ {
+			if d := Distance(hashes[i], hashes[j]); d <= 10 {
+				t.Errorf("%s, %s: expected different hashes, got distance %d", names[i], names[j], d)
+			}
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	hash := Hash(0x00ff00ff12345678)
+	if s := hash.String(); s != "00ff00ff12345678" {
+		t.Errorf("unexpected string: %s", s)
+	}
+	parsed, err := Parse(hash.String())
+	if err != nil || parsed != hash {
+		t.Errorf("expected %v, got %v (%v)", hash, parsed, err)
+	}
+	for _, s := range []string{"", "ff", "00ff00ff1234567g"} {
+		if _, err := Parse(s); err != ErrInvalidHash {
+			t.Errorf("%q: expected invalid hash", s)
+		}
+	}
+}
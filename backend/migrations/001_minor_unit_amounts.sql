@@ -0,0 +1,77 @@
+-- Amounts were doubles in major unit, which are bigints in minor unit of each currency since.
+-- Transactions were kept without an id, which are keyed by tid since.
+-- Run once on a database of the previous scheme, before the server of this version starts:
+--   mysql -u <user> -p <database> < migrations/001_minor_unit_amounts.sql
+
+-- exponents of libs/money/currency.go, where currencies not listed have 2 digits of minor unit
+create temporary table currency_exponents
+(
+    currency_code varchar(5) not null
+        primary key,
+    exponent      int        not null
+);
+insert into currency_exponents(currency_code, exponent)
+VALUES ('BIF', 0),
+       ('CLP', 0),
+       ('DJF', 0),
+       ('GNF', 0),
+       ('ISK', 0),
+       ('JPY', 0),
+       ('KMF', 0),
+       ('KRW', 0),
+       ('PYG', 0),
+       ('RWF', 0),
+       ('UGX', 0),
+       ('UYI', 0),
+       ('VND', 0),
+       ('VUV', 0),
+       ('XAF', 0),
+       ('XOF', 0),
+       ('XPF', 0),
+       ('BHD', 3),
+       ('IQD', 3),
+       ('JOD', 3),
+       ('KWD', 3),
+       ('LYD', 3),
+       ('OMR', 3),
+       ('TND', 3),
+       ('CLF', 4),
+       ('UYW', 4);
+
+update budgets b
+    left join currency_exponents x on x.currency_code = b.currency_code
+set b.amount = round(b.amount * pow(10, coalesce(x.exponent, 2)));
+alter table budgets
+    modify amount bigint not null;
+
+-- items are in the currency of their expenditure
+update expenditure_items i
+    join expenditures e on e.eid = i.eid
+    left join currency_exponents x on x.currency_code = e.currency_code
+set i.price = round(i.price * pow(10, coalesce(x.exponent, 2)));
+alter table expenditure_items
+    modify price bigint not null;
+
+update expenditures e
+    left join currency_exponents x on x.currency_code = e.currency_code
+set e.total_price = round(e.total_price * pow(10, coalesce(x.exponent, 2)));
+alter table expenditures
+    modify total_price bigint not null;
+
+update transactions t
+    left join currency_exponents x on x.currency_code = t.currency_code
+set t.amount = round(t.amount * pow(10, coalesce(x.exponent, 2)));
+alter table transactions
+    modify amount bigint not null;
+
+-- each existing transaction gets its own id before the key is added
+alter table transactions
+    add tid varchar(255) null first;
+update transactions
+set tid = uuid()
+where tid is null;
+alter table transactions
+    modify tid varchar(255) not null,
+    add primary key (tid);
+
+drop temporary table currency_exponents;
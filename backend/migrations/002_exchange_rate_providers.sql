@@ -0,0 +1,9 @@
+-- Rates are kept with the live provider which gave them, where fallback rates of snapshots or triangulation are not kept.
+-- Rates kept before are left without a provider, as it is not known which one gave them.
+--   mysql -u <user> -p <database> < migrations/002_exchange_rate_providers.sql
+
+alter table exchange_rates
+    add provider varchar(64) null comment 'live provider which gave the rate';
+
+alter table exchange_rate_histories
+    add provider varchar(64) null comment 'live provider which gave the rate, as fallback rates are not kept';
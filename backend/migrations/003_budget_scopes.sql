@@ -0,0 +1,11 @@
+-- Budgets are scoped by category and day, where one of all categories keeps '' and one of the whole trip is keyed by day_scope.
+-- Nulls are distinct in a unique key of MySQL, so that neither of them can be null in the key.
+--   mysql -u <user> -p <database> < migrations/003_budget_scopes.sql
+
+alter table budgets
+    add category  varchar(20) not null default '' comment 'expenditures of the category only, empty for all',
+    add day       date        null comment 'expenditures paid on the day only, null for the whole trip',
+    add day_scope date as (coalesce(day, '1000-01-01')) stored comment 'day, which is not null to be unique',
+    drop index budgets_pk,
+    add constraint budgets_pk
+        unique (currency_code, uid, sid, category, day_scope);
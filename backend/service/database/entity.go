@@ -23,14 +23,16 @@ type FriendEntity struct {
 }
 
 type SessionEntity struct {
-	SessionId     string     `db:"sid" json:"session_id"`
-	SessionCode   string     `db:"session_code" json:"session_code"`
-	CreatorUserId string     `db:"creator_uid" json:"creator_user_id"`
-	Name          *string    `db:"name" json:"name"`
-	StartAt       *time.Time `db:"start_at" json:"start_at"`
-	EndAt         *time.Time `db:"end_at" json:"end_at"`
-	CreatedAt     time.Time  `db:"created_at" json:"created_at"` //timestamp
-	ThumbnailUrl  *string    `db:"thumbnail_url" json:"thumbnail_url"`
+	SessionId        string     `db:"sid" json:"session_id"`
+	SessionCode      string     `db:"session_code" json:"session_code"`
+	CreatorUserId    string     `db:"creator_uid" json:"creator_user_id"`
+	Name             *string    `db:"name" json:"name"`
+	StartAt          *time.Time `db:"start_at" json:"start_at"`
+	EndAt            *time.Time `db:"end_at" json:"end_at"`
+	CreatedAt        time.Time  `db:"created_at" json:"created_at"` //timestamp
+	ThumbnailUrl     *string    `db:"thumbnail_url" json:"thumbnail_url"`
+	ExchangeRateMode string     `db:"exchange_rate_mode" json:"exchange_rate_mode"` // payment, session_end, live
+	UseAcquiredRate  bool       `db:"use_acquired_rate" json:"use_acquired_rate"`
 }
 
 type UserSessionEntity struct {
@@ -86,11 +88,14 @@ type ScheduleEntity struct {
 type ExpenditureEntity struct {
 	ExpenditureId string    `db:"eid" json:"expenditure_id"`
 	Name          string    `db:"name" json:"name"`
-	TotalPrice    float64   `db:"total_price" json:"price"`
+	TotalPrice    int64     `db:"total_price" json:"price"` // in minor unit of CurrencyCode
 	CurrencyCode  string    `db:"currency_code" json:"currency_code"`
 	Category      string    `db:"category" json:"category"`
 	PayedAt       time.Time `db:"payed_at" json:"payed_at"`
 	SessionId     string    `db:"sid" json:"session_id"`
+	Version       int       `db:"version" json:"version"` // ETag of the expenditure, increased on every change
+	// RefundOf is the original expenditure of a refund, which has negative total price. A refund may stand alone.
+	RefundOf *string `db:"refund_of" json:"refund_of"`
 }
 
 type ExpenditurePayerEntity struct {
@@ -106,10 +111,10 @@ type ExpenditureDistributionEntity struct {
 }
 
 type ExpenditureItemEntity struct {
-	ExpenditureItemId string  `db:"eiid" json:"expenditure_item_id"`
-	Label             string  `db:"label" json:"label"`
-	Price             float64 `db:"price" json:"price"`
-	ExpenditureId     string  `db:"eid" json:"expenditure_id"`
+	ExpenditureItemId string `db:"eiid" json:"expenditure_item_id"`
+	Label             string `db:"label" json:"label"`
+	Price             int64  `db:"price" json:"price"` // in minor unit of expenditure currency
+	ExpenditureId     string `db:"eid" json:"expenditure_id"`
 }
 
 type ExpenditureItemAllocationEntity struct {
@@ -117,6 +122,39 @@ type ExpenditureItemAllocationEntity struct {
 	UserId            string `db:"uid" json:"user_id"`
 }
 
+type ExpenditureChargeEntity struct {
+	ExpenditureChargeId string  `db:"ecid" json:"expenditure_charge_id"`
+	ExpenditureId       string  `db:"eid" json:"expenditure_id"`
+	Kind                string  `db:"kind" json:"kind"` // tax, tip, service
+	Label               string  `db:"label" json:"label"`
+	Percent             *string `db:"percent" json:"percent"` // of items, or nil for a fixed amount
+	Amount              int64   `db:"amount" json:"amount"`   // in minor unit of expenditure currency
+}
+
+// ExpenditureRevisionEntity is a version of an expenditure, with what is changed from the previous one
+type ExpenditureRevisionEntity struct {
+	ExpenditureRevisionId string    `db:"erid" json:"expenditure_revision_id"`
+	ExpenditureId         string    `db:"eid" json:"expenditure_id"`
+	SessionId             string    `db:"sid" json:"session_id"`
+	Revision              int       `db:"revision" json:"revision"`
+	UserId                *string   `db:"uid" json:"user_id"`       // editor
+	Action                string    `db:"action" json:"action"`     // created, updated, deleted, restored
+	Snapshot              *string   `db:"snapshot" json:"snapshot"` // JSON of platform.ExpenditureSnapshot
+	Diff                  string    `db:"diff" json:"diff"`         // JSON of []platform.ExpenditureFieldChange
+	CreatedAt             time.Time `db:"created_at" json:"created_at"`
+}
+
+// ReceiptEntity is an uploaded receipt image, whose file is kept in receipt store
+type ReceiptEntity struct {
+	ReceiptId     string    `db:"rid" json:"receipt_id"`
+	UserId        string    `db:"uid" json:"user_id"`        // uploader
+	SessionId     *string   `db:"sid" json:"session_id"`     // session uploaded for, if given
+	ExpenditureId *string   `db:"eid" json:"expenditure_id"` // attached expenditure
+	ContentType   string    `db:"content_type" json:"content_type"`
+	ImageHash     *string   `db:"phash" json:"-"` // perceptual hash, nil if the image is not hashed
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`
+}
+
 type SessionThumbnailCacheEntity struct {
 	Keyword *string `db:"keyword" json:"keyword"`
 	Url     *string `db:"url" json:"url"`
@@ -135,11 +173,13 @@ type PlaceDetailCacheEntity struct {
 }
 
 type BudgetEntity struct {
-	BudgetId     string  `db:"bid" json:"budget_id"`
-	CurrencyCode string  `db:"currency_code" json:"currency_code"`
-	Amount       float64 `db:"amount" json:"amount"`
-	UserId       string  `db:"uid" json:"user_id"`
-	SessionId    string  `db:"sid" json:"session_id"`
+	BudgetId     string     `db:"bid" json:"budget_id"`
+	CurrencyCode string     `db:"currency_code" json:"currency_code"`
+	Amount       int64      `db:"amount" json:"amount"` // in minor unit of CurrencyCode
+	UserId       string     `db:"uid" json:"user_id"`
+	SessionId    string     `db:"sid" json:"session_id"`
+	Category     *string    `db:"category" json:"category"` // nil for all categories
+	Day          *time.Time `db:"day" json:"day"`           // nil for the whole trip
 }
 
 type ExchangeRateEntity struct {
@@ -147,13 +187,64 @@ type ExchangeRateEntity struct {
 	ToCurrencyCode   string    `db:"to_currency_code" json:"to_currency_code"`
 	Rate             float64   `db:"rate" json:"rate"`
 	UpdatedAt        time.Time `db:"updated_at" json:"updated_at"`
+	Provider         *string   `db:"provider" json:"provider"` // nil if kept before providers were recorded
+}
+
+// ExchangeRateHistoryEntity is the rate of a day, which never changes once the day has passed
+type ExchangeRateHistoryEntity struct {
+	FromCurrencyCode string    `db:"from_currency_code" json:"from_currency_code"`
+	ToCurrencyCode   string    `db:"to_currency_code" json:"to_currency_code"`
+	Date             time.Time `db:"date" json:"date"`
+	Rate             float64   `db:"rate" json:"rate"`
+	UpdatedAt        time.Time `db:"updated_at" json:"updated_at"`
+	Provider         *string   `db:"provider" json:"provider"` // nil if kept before providers were recorded
 }
 
 type TransactionEntity struct {
-	SenderUid    string    `db:"sender_uid" json:"sender_uid"`
-	ReceiverUid  string    `db:"receiver_uid" json:"receiver_uid"`
-	CurrencyCode string    `db:"currency_code" json:"currency_code"`
-	Amount       float64   `db:"amount" json:"amount"`
-	SentAt       time.Time `db:"sent_at" json:"sent_at"`
-	SessionId    string    `db:"sid" json:"session_id"`
+	TransactionId string     `db:"tid" json:"transaction_id"`
+	SenderUid     string     `db:"sender_uid" json:"sender_uid"`
+	ReceiverUid   string     `db:"receiver_uid" json:"receiver_uid"`
+	CurrencyCode  string     `db:"currency_code" json:"currency_code"`
+	Amount        int64      `db:"amount" json:"amount"` // in minor unit of CurrencyCode
+	SentAt        time.Time  `db:"sent_at" json:"sent_at"`
+	SessionId     string     `db:"sid" json:"session_id"`
+	Status        string     `db:"status" json:"status"` // declared, confirmed, disputed
+	Method        *string    `db:"method" json:"method"` // cash, bank_transfer, kakao_pay
+	Memo          *string    `db:"memo" json:"memo"`
+	ConfirmedAt   *time.Time `db:"confirmed_at" json:"confirmed_at"`
+	VoidedAt      *time.Time `db:"voided_at" json:"voided_at"` // voided transaction is kept, but not settled
+	VoidedBy      *string    `db:"voided_by" json:"voided_by"`
+}
+
+// TransactionAuditEntity records who did what on a transaction
+type TransactionAuditEntity struct {
+	TransactionId string    `db:"tid" json:"transaction_id"`
+	UserId        string    `db:"uid" json:"user_id"`
+	Action        string    `db:"action" json:"action"` // created, declared, confirmed, disputed, voided
+	Memo          *string   `db:"memo" json:"memo"`
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`
+}
+
+// CurrencyExchangeEntity is cash bought by a member, e.g. at an exchange booth
+type CurrencyExchangeEntity struct {
+	CurrencyExchangeId string    `db:"cxid" json:"currency_exchange_id"`
+	SessionId          string    `db:"sid" json:"session_id"`
+	UserId             string    `db:"uid" json:"user_id"`
+	FromCurrencyCode   string    `db:"from_currency_code" json:"from_currency_code"`
+	FromAmount         int64     `db:"from_amount" json:"from_amount"` // in minor unit of FromCurrencyCode
+	ToCurrencyCode     string    `db:"to_currency_code" json:"to_currency_code"`
+	ToAmount           int64     `db:"to_amount" json:"to_amount"` // in minor unit of ToCurrencyCode
+	Fee                int64     `db:"fee" json:"fee"`             // in minor unit of FromCurrencyCode
+	ExchangedAt        time.Time `db:"exchanged_at" json:"exchanged_at"`
+}
+
+// KittyContributionEntity is money a member puts into the common pot of the session
+type KittyContributionEntity struct {
+	KittyContributionId string    `db:"kcid" json:"kitty_contribution_id"`
+	SessionId           string    `db:"sid" json:"session_id"`
+	UserId              string    `db:"uid" json:"user_id"`
+	CurrencyCode        string    `db:"currency_code" json:"currency_code"`
+	Amount              int64     `db:"amount" json:"amount"` // in minor unit of CurrencyCode
+	Memo                *string   `db:"memo" json:"memo"`
+	ContributedAt       time.Time `db:"contributed_at" json:"contributed_at"`
 }
@@ -0,0 +1,31 @@
+package database
+
+import "travel-ai/libs/money"
+
+func (e ExpenditureEntity) TotalPriceMoney() money.Money {
+	return money.New(e.TotalPrice, e.CurrencyCode)
+}
+
+func (e BudgetEntity) AmountMoney() money.Money {
+	return money.New(e.Amount, e.CurrencyCode)
+}
+
+func (e TransactionEntity) AmountMoney() money.Money {
+	return money.New(e.Amount, e.CurrencyCode)
+}
+
+func (e CurrencyExchangeEntity) FromAmountMoney() money.Money {
+	return money.New(e.FromAmount, e.FromCurrencyCode)
+}
+
+func (e CurrencyExchangeEntity) ToAmountMoney() money.Money {
+	return money.New(e.ToAmount, e.ToCurrencyCode)
+}
+
+func (e CurrencyExchangeEntity) FeeMoney() money.Money {
+	return money.New(e.Fee, e.FromCurrencyCode)
+}
+
+func (e KittyContributionEntity) AmountMoney() money.Money {
+	return money.New(e.Amount, e.CurrencyCode)
+}
@@ -0,0 +1,38 @@
+package exchange_rate
+
+import (
+	"time"
+	"travel-ai/third_party/fawazahmed0_currency"
+)
+
+type cdnProvider struct{}
+
+// NewCdnProvider provides rates of fawazahmed0 currency api, which is served on jsdelivr cdn
+func NewCdnProvider() ExchangeRateProvider {
+	return cdnProvider{}
+}
+
+func (cdnProvider) Name() string {
+	return "cdn"
+}
+
+func (p cdnProvider) Rate(from string, to string, at time.Time) (float64, error) {
+	quote, err := p.Quote(from, to, at)
+	return quote.Rate, err
+}
+
+// Quote of the cdn is live, which is published for the date of the response if the latest one is asked
+func (p cdnProvider) Quote(from string, to string, at time.Time) (Quote, error) {
+	if at.IsZero() {
+		rate, date, err := fawazahmed0_currency.GetLatestExchangeRate(from, to)
+		if err != nil {
+			return Quote{}, err
+		}
+		return Quote{Rate: rate, Provider: p.Name(), Date: date}, nil
+	}
+	rate, err := fawazahmed0_currency.GetHistoricalExchangeRate(from, to, at)
+	if err != nil {
+		return Quote{}, err
+	}
+	return Quote{Rate: rate, Provider: p.Name(), Date: toDay(at)}, nil
+}
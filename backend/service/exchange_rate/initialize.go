@@ -0,0 +1,57 @@
+package exchange_rate
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"travel-ai/log"
+)
+
+const DefaultBaseCurrency = "USD"
+
+// DefaultProvider is used by platform to get rates, which is replaced by Initialize
+var DefaultProvider = Triangulate(NewCdnProvider(), DefaultBaseCurrency)
+
+// Initialize builds DefaultProvider from environments.
+//
+//	EXCHANGE_RATE_PROVIDERS: ordered provider names (cdn, snapshot), "cdn,snapshot" by default
+//	EXCHANGE_RATE_SNAPSHOT_PATH: JSON or CSV snapshot file for snapshot provider
+//	EXCHANGE_RATE_BASE_CURRENCY: currency to triangulate through, USD by default
+func Initialize() error {
+	names := os.Getenv("EXCHANGE_RATE_PROVIDERS")
+	if names == "" {
+		names = "cdn,snapshot"
+	}
+	base := os.Getenv("EXCHANGE_RATE_BASE_CURRENCY")
+	if base == "" {
+		base = DefaultBaseCurrency
+	}
+
+	providers := make([]ExchangeRateProvider, 0)
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "cdn":
+			providers = append(providers, NewCdnProvider())
+		case "snapshot":
+			path := os.Getenv("EXCHANGE_RATE_SNAPSHOT_PATH")
+			if path == "" {
+				log.Warn("snapshot exchange rate provider is skipped, as EXCHANGE_RATE_SNAPSHOT_PATH is not set")
+				continue
+			}
+			provider, err := NewSnapshotProvider(path)
+			if err != nil {
+				return err
+			}
+			providers = append(providers, provider)
+		default:
+			return fmt.Errorf("unknown exchange rate provider: %s", name)
+		}
+	}
+	if len(providers) == 0 {
+		return fmt.Errorf("no exchange rate provider in %s", names)
+	}
+
+	DefaultProvider = Triangulate(Chain(providers...), base)
+	log.Infof("exchange rate provider: %s", DefaultProvider.Name())
+	return nil
+}
@@ -0,0 +1,149 @@
+package exchange_rate
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"travel-ai/log"
+)
+
+var ErrRateNotFound = errors.New("exchange rate not found")
+
+// ExchangeRateProvider gives the rate which converts 1 of from currency into to currency.
+// Zero time means the latest rate, otherwise the rate of the day (UTC) of at.
+type ExchangeRateProvider interface {
+	Name() string
+	Rate(from string, to string, at time.Time) (float64, error)
+}
+
+// Quote is a rate with where it comes from
+type Quote struct {
+	Rate     float64
+	Provider string    // name of the provider which gave the rate
+	Date     time.Time // day (UTC) which the rate is published for, zero if unknown
+	// Fallback is true if the rate is not of a live source, such as an old snapshot or a triangulation,
+	// which should not be kept as the rate of the day
+	Fallback bool
+}
+
+// QuoteProvider is a provider which tells where its rates come from
+type QuoteProvider interface {
+	ExchangeRateProvider
+	Quote(from string, to string, at time.Time) (Quote, error)
+}
+
+// GetQuote asks the provider for the rate with its source.
+// A rate of the provider which does not tell is taken as a live one for the day of at.
+func GetQuote(provider ExchangeRateProvider, from string, to string, at time.Time) (Quote, error) {
+	if quoteProvider, ok := provider.(QuoteProvider); ok {
+		return quoteProvider.Quote(from, to, at)
+	}
+	rate, err := provider.Rate(from, to, at)
+	if err != nil {
+		return Quote{}, err
+	}
+	return Quote{Rate: rate, Provider: provider.Name(), Date: toDay(at)}, nil
+}
+
+type chainProvider struct {
+	providers []ExchangeRateProvider
+}
+
+// Chain asks providers in order and returns the first rate found
+func Chain(providers ...ExchangeRateProvider) ExchangeRateProvider {
+	return &chainProvider{providers: providers}
+}
+
+func (p *chainProvider) Name() string {
+	names := make([]string, len(p.providers))
+	for i, provider := range p.providers {
+		names[i] = provider.Name()
+	}
+	return "chain(" + strings.Join(names, ", ") + ")"
+}
+
+func (p *chainProvider) Rate(from string, to string, at time.Time) (float64, error) {
+	quote, err := p.Quote(from, to, at)
+	return quote.Rate, err
+}
+
+func (p *chainProvider) Quote(from string, to string, at time.Time) (Quote, error) {
+	messages := make([]string, 0)
+	for _, provider := range p.providers {
+		quote, err := GetQuote(provider, from, to, at)
+		if err == nil {
+			err = validateRate(quote.Rate)
+		}
+		if err == nil {
+			return quote, nil
+		}
+		log.Warnf("%s failed to provide exchange rate from %s to %s: %v", provider.Name(), from, to, err)
+		messages = append(messages, fmt.Sprintf("%s: %v", provider.Name(), err))
+	}
+	return Quote{}, fmt.Errorf("%w: %s to %s (%s)", ErrRateNotFound, from, to, strings.Join(messages, "; "))
+}
+
+type triangulatedProvider struct {
+	provider ExchangeRateProvider
+	base     string
+}
+
+// Triangulate makes provider to find the rate through base currency when a direct pair is missing,
+// (e.g. KRW -> JPY = KRW -> USD -> JPY)
+func Triangulate(provider ExchangeRateProvider, base string) ExchangeRateProvider {
+	return &triangulatedProvider{provider: provider, base: base}
+}
+
+func (p *triangulatedProvider) Name() string {
+	return fmt.Sprintf("triangulate(%s, %s)", p.provider.Name(), p.base)
+}
+
+func (p *triangulatedProvider) Rate(from string, to string, at time.Time) (float64, error) {
+	quote, err := p.Quote(from, to, at)
+	return quote.Rate, err
+}
+
+// Quote of a triangulated rate is a fallback, as it is not what any source publishes for the pair
+func (p *triangulatedProvider) Quote(from string, to string, at time.Time) (Quote, error) {
+	if from == to {
+		return Quote{Rate: 1, Provider: p.Name(), Date: toDay(at)}, nil
+	}
+	quote, err := GetQuote(p.provider, from, to, at)
+	if err == nil {
+		return quote, nil
+	}
+	if from == p.base || to == p.base {
+		return Quote{}, err
+	}
+
+	fromBase, baseErr := GetQuote(p.provider, from, p.base, at)
+	if baseErr != nil {
+		return Quote{}, err
+	}
+	baseTo, baseErr := GetQuote(p.provider, p.base, to, at)
+	if baseErr != nil {
+		return Quote{}, err
+	}
+	quote = Quote{Rate: fromBase.Rate * baseTo.Rate, Provider: p.Name(), Fallback: true}
+	if fromBase.Date.Equal(baseTo.Date) {
+		quote.Date = fromBase.Date
+	}
+	return quote, nil
+}
+
+// toDay truncates time into the day in UTC, where zero time is kept as it is
+func toDay(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+func validateRate(rate float64) error {
+	if math.IsNaN(rate) || math.IsInf(rate, 0) || rate <= 0 {
+		return fmt.Errorf("invalid rate: %v", rate)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package exchange_rate
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+type testProvider struct {
+	name  string
+	rates map[string]float64 // "FROM/TO"
+	calls int
+}
+
+func (p *testProvider) Name() string {
+	return p.name
+}
+
+func (p *testProvider) Rate(from string, to string, at time.Time) (float64, error) {
+	p.calls++
+	rate, ok := p.rates[from+"/"+to]
+	if !ok {
+		return 0, ErrRateNotFound
+	}
+	return rate, nil
+}
+
+func TestChain(t *testing.T) {
+	first := &testProvider{name: "first", rates: map[string]float64{"USD/KRW": 1300}}
+	second := &testProvider{name: "second", rates: map[string]float64{"USD/KRW": 1200, "USD/JPY": 140}}
+	provider := Chain(first, second)
+
+	if rate, err := provider.Rate("USD", "KRW", time.Time{}); err != nil || rate != 1300 {
+		t.Errorf("USD/KRW: expected 1300 of first provider, got %v, %v", rate, err)
+	}
+	if second.calls != 0 {
+		t.Errorf("second provider should not be asked when first one has the rate")
+	}
+	if rate, err := provider.Rate("USD", "JPY", time.Time{}); err != nil || rate != 140 {
+		t.Errorf("USD/JPY: expected 140 of second provider, got %v, %v", rate, err)
+	}
+	if _, err := provider.Rate("USD", "EUR", time.Time{}); !errors.Is(err, ErrRateNotFound) {
+		t.Errorf("USD/EUR: expected ErrRateNotFound, got %v", err)
+	}
+}
+
+func TestChainSkipsInvalidRate(t *testing.T) {
+	broken := &testProvider{name: "broken", rates: map[string]float64{"USD/KRW": 0, "USD/JPY": math.NaN()}}
+	fallback := &testProvider{name: "fallback", rates: map[string]float64{"USD/KRW": 1300, "USD/JPY": 140}}
+	provider := Chain(broken, fallback)
+
+	if rate, err := provider.Rate("USD", "KRW", time.Time{}); err != nil || rate != 1300 {
+		t.Errorf("USD/KRW: expected 1300, got %v, %v", rate, err)
+	}
+	if rate, err := provider.Rate("USD", "JPY", time.Time{}); err != nil || rate != 140 {
+		t.Errorf("USD/JPY: expected 140, got %v, %v", rate, err)
+	}
+}
+
+func TestTriangulate(t *testing.T) {
+	base := &testProvider{name: "base", rates: map[string]float64{"KRW/USD": 0.001, "USD/JPY": 100, "USD/KRW": 1000}}
+	provider := Triangulate(base, "USD")
+
+	if rate, err := provider.Rate("KRW", "JPY", time.Time{}); err != nil || math.Abs(rate-0.1) > 1e-12 {
+		t.Errorf("KRW/JPY: expected 0.1, got %v, %v", rate, err)
+	}
+	if rate, err := provider.Rate("KRW", "KRW", time.Time{}); err != nil || rate != 1 {
+		t.Errorf("KRW/KRW: expected 1, got %v, %v", rate, err)
+	}
+	if _, err := provider.Rate("JPY", "KRW", time.Time{}); !errors.Is(err, ErrRateNotFound) {
+		t.Errorf("JPY/KRW: expected ErrRateNotFound as JPY/USD is missing, got %v", err)
+	}
+	if _, err := provider.Rate("USD", "EUR", time.Time{}); !errors.Is(err, ErrRateNotFound) {
+		t.Errorf("USD/EUR: expected ErrRateNotFound, got %v", err)
+	}
+}
+
+func TestQuote(t *testing.T) {
+	snapshot, err := NewSnapshotProvider("testdata/rates.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	live := &testProvider{name: "live", rates: map[string]float64{"USD/KRW": 1300, "KRW/USD": 0.001, "USD/JPY": 140}}
+	provider := Triangulate(Chain(live, snapshot), "USD")
+	at := testDay("2023-08-01")
+
+	quote, err := GetQuote(provider, "USD", "KRW", at)
+	if err != nil || quote.Fallback || quote.Provider != "live" || !quote.Date.Equal(toDay(at)) {
+		t.Errorf("USD/KRW: expected live quote of the day, got %+v, %v", quote, err)
+	}
+
+	// pair of the snapshot only, whose day is the last one before
+	quote, err = GetQuote(provider, "EUR", "USD", at)
+	if err != nil || !quote.Fallback || quote.Provider != snapshot.Name() || quote.Date.Format("2006-01-02") != "2023-07-03" {
+		t.Errorf("EUR/USD: expected fallback quote of the snapshot, got %+v, %v", quote, err)
+	}
+
+	// triangulated of live rates is still a fallback
+	quote, err = GetQuote(provider, "KRW", "JPY", at)
+	if err != nil || !quote.Fallback || math.Abs(quote.Rate-0.14) > 1e-12 || !quote.Date.Equal(toDay(at)) {
+		t.Errorf("KRW/JPY: expected triangulated fallback quote, got %+v, %v", quote, err)
+	}
+}
@@ -0,0 +1,172 @@
+package exchange_rate
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SnapshotDay is rates of a day in JSON snapshot, which converts 1 of Base into each currency of Rates
+type SnapshotDay struct {
+	Date  string             `json:"date"` // 2006-01-02
+	Base  string             `json:"base"`
+	Rates map[string]float64 `json:"rates"`
+}
+
+type snapshotPair struct {
+	From string
+	To   string
+}
+
+type snapshotProvider struct {
+	path  string
+	days  []string // ascending
+	rates map[string]map[snapshotPair]float64
+}
+
+// NewSnapshotProvider reads rates from a local snapshot file, which is either JSON or CSV (by extension).
+//
+// JSON is a list of SnapshotDay (a single object is also allowed):
+//
+//	[{"date": "2023-07-01", "base": "USD", "rates": {"KRW": 1290.1, "JPY": 144.3}}]
+//
+// CSV has a header and a rate for each row:
+//
+//	date,from,to,rate
+//	2023-07-01,USD,KRW,1290.1
+//
+// For the latest rate (zero time), the last day of snapshot is used. Otherwise, the last day on or before
+// the requested day is used, so that a snapshot keeps working offline after it was taken.
+func NewSnapshotProvider(path string) (ExchangeRateProvider, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	provider := &snapshotProvider{path: path, rates: make(map[string]map[snapshotPair]float64)}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = provider.readJson(file)
+	case ".csv":
+		err = provider.readCsv(file)
+	default:
+		err = fmt.Errorf("unsupported snapshot file: %s", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for day := range provider.rates {
+		provider.days = append(provider.days, day)
+	}
+	sort.Strings(provider.days)
+	return provider, nil
+}
+
+func (p *snapshotProvider) readJson(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	var days []SnapshotDay
+	if err := json.Unmarshal(data, &days); err != nil {
+		var day SnapshotDay
+		if err := json.Unmarshal(data, &day); err != nil {
+			return err
+		}
+		days = []SnapshotDay{day}
+	}
+
+	for _, day := range days {
+		for to, rate := range day.Rates {
+			if err := p.add(day.Date, day.Base, to, rate); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *snapshotProvider) readCsv(r io.Reader) error {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return err
+	}
+	for i, record := range records {
+		if i == 0 && strings.EqualFold(record[0], "date") {
+			continue // header
+		}
+		if len(record) != 4 {
+			return fmt.Errorf("line %d: expected 4 fields but %d", i+1, len(record))
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(record[3]), 64)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", i+1, err)
+		}
+		if err := p.add(record[0], record[1], record[2], rate); err != nil {
+			return fmt.Errorf("line %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (p *snapshotProvider) add(date string, from string, to string, rate float64) error {
+	date = strings.TrimSpace(date)
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return err
+	}
+	if err := validateRate(rate); err != nil {
+		return err
+	}
+	if _, ok := p.rates[date]; !ok {
+		p.rates[date] = make(map[snapshotPair]float64)
+	}
+	pair := snapshotPair{From: strings.ToUpper(strings.TrimSpace(from)), To: strings.ToUpper(strings.TrimSpace(to))}
+	p.rates[date][pair] = rate
+	return nil
+}
+
+func (p *snapshotProvider) Name() string {
+	return "snapshot(" + filepath.Base(p.path) + ")"
+}
+
+func (p *snapshotProvider) Rate(from string, to string, at time.Time) (float64, error) {
+	quote, err := p.Quote(from, to, at)
+	return quote.Rate, err
+}
+
+// Quote of the snapshot is a fallback of the last day on or before at, which may be long ago
+func (p *snapshotProvider) Quote(from string, to string, at time.Time) (Quote, error) {
+	if len(p.days) == 0 {
+		return Quote{}, ErrRateNotFound
+	}
+
+	day := p.days[len(p.days)-1]
+	if !at.IsZero() {
+		requested := at.UTC().Format("2006-01-02")
+		// the first day after requested day
+		index := sort.Search(len(p.days), func(i int) bool { return p.days[i] > requested })
+		if index == 0 {
+			return Quote{}, fmt.Errorf("%w: no snapshot on or before %s", ErrRateNotFound, requested)
+		}
+		day = p.days[index-1]
+	}
+
+	date, _ := time.Parse("2006-01-02", day)
+	rates := p.rates[day]
+	if rate, ok := rates[snapshotPair{From: from, To: to}]; ok {
+		return Quote{Rate: rate, Provider: p.Name(), Date: date, Fallback: true}, nil
+	}
+	if rate, ok := rates[snapshotPair{From: to, To: from}]; ok {
+		return Quote{Rate: 1 / rate, Provider: p.Name(), Date: date, Fallback: true}, nil
+	}
+	return Quote{}, fmt.Errorf("%w: %s to %s on %s", ErrRateNotFound, from, to, day)
+}
@@ -0,0 +1,65 @@
+package exchange_rate
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func testDay(date string) time.Time {
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		panic(err)
+	}
+	return day.Add(15 * time.Hour)
+}
+
+func TestSnapshotProvider(t *testing.T) {
+	for _, path := range []string{"testdata/rates.json", "testdata/rates.csv"} {
+		provider, err := NewSnapshotProvider(path)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+
+		tests := []struct {
+			from, to string
+			at       time.Time
+			expected float64
+		}{
+			{"USD", "KRW", time.Time{}, 1310},
+			{"USD", "KRW", testDay("2023-07-01"), 1300},
+			{"USD", "KRW", testDay("2023-07-02"), 1300},
+			{"USD", "KRW", testDay("2023-08-01"), 1310},
+			{"JPY", "USD", testDay("2023-07-01"), 1.0 / 144},
+		}
+		for _, test := range tests {
+			rate, err := provider.Rate(test.from, test.to, test.at)
+			if err != nil || math.Abs(rate-test.expected) > 1e-12 {
+				t.Errorf("%s: %s/%s at %v: expected %v, got %v, %v", path, test.from, test.to, test.at, test.expected, rate, err)
+			}
+		}
+
+		if _, err := provider.Rate("USD", "KRW", testDay("2023-06-30")); !errors.Is(err, ErrRateNotFound) {
+			t.Errorf("%s: expected ErrRateNotFound before the first day, got %v", path, err)
+		}
+		if _, err := provider.Rate("USD", "CNY", time.Time{}); !errors.Is(err, ErrRateNotFound) {
+			t.Errorf("%s: expected ErrRateNotFound of missing currency, got %v", path, err)
+		}
+	}
+}
+
+func TestSnapshotProviderOffline(t *testing.T) {
+	snapshot, err := NewSnapshotProvider("testdata/rates.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	offline := &testProvider{name: "offline"}
+	provider := Triangulate(Chain(offline, snapshot), "USD")
+
+	// EUR -> USD -> KRW of 2023-07-03
+	rate, err := provider.Rate("EUR", "KRW", time.Time{})
+	if err != nil || math.Abs(rate-1.1*1310) > 1e-9 {
+		t.Errorf("EUR/KRW: expected %v, got %v, %v", 1.1*1310, rate, err)
+	}
+}
@@ -0,0 +1,89 @@
+package platform
+
+import (
+	"math/big"
+	"time"
+	"travel-ai/service/database"
+	"travel-ai/service/platform/database_io"
+)
+
+// BudgetThresholds are percents of a budget, which its owner is alerted of when spending crosses them
+var BudgetThresholds = []int64{80, 100}
+
+// IsWholeBudget tells if the budget is for every expenditure of the trip, which is summed into the total budget.
+// Budgets of a category or a day are parts of it, which would be counted twice.
+func IsWholeBudget(budget database.BudgetEntity) bool {
+	return budget.Category == nil && budget.Day == nil
+}
+
+// BudgetCovers tells if an expenditure of the category paid at the time is spent from the budget
+func BudgetCovers(budget database.BudgetEntity, category string, payedAt time.Time) bool {
+	if budget.Category != nil && *budget.Category != category {
+		return false
+	}
+	if budget.Day != nil && ToDayString(*budget.Day) != ToDayString(payedAt) {
+		return false
+	}
+	return true
+}
+
+// BudgetSpent sums shares covered by each budget in its currency, keyed by budget id.
+// Shares of another currency are not spent from a budget, unless no covering budget is of that currency
+// and the currency is bought with the budget currency, which is converted with acquiredRates if not nil.
+func BudgetSpent(budgets []database.BudgetEntity, dists []database_io.UserExpenditureDistributionEntity,
+	acquiredRates AcquiredRates) map[string]*big.Rat {
+	spent := make(map[string]*big.Rat)
+	for _, budget := range budgets {
+		spent[budget.BudgetId] = new(big.Rat)
+	}
+
+	for _, dist := range dists {
+		share := big.NewRat(dist.Numerator, dist.Denominator)
+		covering := make([]database.BudgetEntity, 0)
+		sameCurrency := false
+		for _, budget := range budgets {
+			if BudgetCovers(budget, dist.Category, dist.PayedAt) {
+				covering = append(covering, budget)
+				sameCurrency = sameCurrency || budget.CurrencyCode == dist.CurrencyCode
+			}
+		}
+
+		// spent from the first budget of the currency which it is bought with
+		var convertTo string
+		var rate *big.Rat
+		if !sameCurrency && acquiredRates != nil {
+			for _, budget := range covering {
+				if r, ok := acquiredRates.Rate(dist.CurrencyCode, budget.CurrencyCode); ok {
+					convertTo, rate = budget.CurrencyCode, r
+					break
+				}
+			}
+		}
+
+		for _, budget := range covering {
+			switch budget.CurrencyCode {
+			case dist.CurrencyCode:
+				spent[budget.BudgetId].Add(spent[budget.BudgetId], share)
+			case convertTo:
+				spent[budget.BudgetId].Add(spent[budget.BudgetId], new(big.Rat).Mul(share, rate))
+			}
+		}
+	}
+	return spent
+}
+
+// CrossedBudgetThresholds returns BudgetThresholds which spending reaches from before to after,
+// where amount and spending are in major unit of the budget currency
+func CrossedBudgetThresholds(amount *big.Rat, before *big.Rat, after *big.Rat) []int64 {
+	crossed := make([]int64, 0)
+	if amount.Sign() <= 0 {
+		return crossed
+	}
+	for _, threshold := range BudgetThresholds {
+		limit := new(big.Rat).Mul(amount, big.NewRat(threshold, 100))
+		if before.Cmp(limit) < 0 && after.Cmp(limit) >= 0 {
+			crossed = append(crossed, threshold)
+		}
+	}
+	return crossed
+}
@@ -0,0 +1,87 @@
+package platform
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+	"travel-ai/service/database"
+	"travel-ai/service/platform/database_io"
+)
+
+func testDistribution(expenditureId string, currencyCode string, category string, payedAt time.Time,
+	amount int64) database_io.UserExpenditureDistributionEntity {
+	return database_io.UserExpenditureDistributionEntity{
+		ExpenditureDistributionEntity: database.ExpenditureDistributionEntity{
+			ExpenditureId: expenditureId,
+			UserId:        "a",
+			Numerator:     amount,
+			Denominator:   1,
+		},
+		CurrencyCode: currencyCode,
+		Category:     category,
+		PayedAt:      payedAt,
+	}
+}
+
+func TestBudgetSpent(t *testing.T) {
+	meal := CategoryMeal
+	day1 := time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)
+	budgets := []database.BudgetEntity{
+		{BudgetId: "whole", CurrencyCode: "KRW", Amount: 500000},
+		{BudgetId: "meal", CurrencyCode: "KRW", Amount: 100000, Category: &meal},
+		{BudgetId: "day1", CurrencyCode: "KRW", Amount: 80000, Day: &day1},
+		{BudgetId: "meal-day1", CurrencyCode: "KRW", Amount: 30000, Category: &meal, Day: &day1},
+	}
+	dists := []database_io.UserExpenditureDistributionEntity{
+		testDistribution("e1", "KRW", CategoryMeal, day1.Add(19*time.Hour), 20000),
+		testDistribution("e2", "KRW", CategoryTransport, day1.Add(9*time.Hour), 15000),
+		testDistribution("e3", "KRW", CategoryMeal, day1.Add(36*time.Hour), 12000),
+		// yen is not spent from won budgets, unless it is bought with won
+		testDistribution("e4", "JPY", CategoryMeal, day1.Add(12*time.Hour), 1000),
+	}
+
+	expected := map[string]int64{"whole": 47000, "meal": 32000, "day1": 35000, "meal-day1": 20000}
+	spent := BudgetSpent(budgets, dists, nil)
+	for budgetId, amount := range expected {
+		if spent[budgetId].Cmp(big.NewRat(amount, 1)) != 0 {
+			t.Errorf("%s: expected %d, got %s", budgetId, amount, spent[budgetId].RatString())
+		}
+	}
+
+	// 1000 yen bought with 10000 won
+	acquiredRates := NewAcquiredRates([]database.CurrencyExchangeEntity{
+		{FromCurrencyCode: "KRW", FromAmount: 10000, ToCurrencyCode: "JPY", ToAmount: 1000},
+	})
+	expected = map[string]int64{"whole": 57000, "meal": 42000, "day1": 45000, "meal-day1": 30000}
+	spent = BudgetSpent(budgets, dists, acquiredRates)
+	for budgetId, amount := range expected {
+		if spent[budgetId].Cmp(big.NewRat(amount, 1)) != 0 {
+			t.Errorf("%s: expected %d with acquired rate, got %s", budgetId, amount, spent[budgetId].RatString())
+		}
+	}
+}
+
+func TestCrossedBudgetThresholds(t *testing.T) {
+	tests := []struct {
+		before, after int64
+		expected      []int64
+	}{
+		{0, 50, []int64{}},
+		{50, 80, []int64{80}},
+		{79, 99, []int64{80}},
+		{80, 99, []int64{}},
+		{90, 100, []int64{100}},
+		{50, 120, []int64{80, 100}},
+		{100, 150, []int64{}},
+	}
+	for _, test := range tests {
+		crossed := CrossedBudgetThresholds(big.NewRat(100, 1), big.NewRat(test.before, 1), big.NewRat(test.after, 1))
+		if !reflect.DeepEqual(crossed, test.expected) {
+			t.Errorf("%d -> %d: expected %v, got %v", test.before, test.after, test.expected, crossed)
+		}
+	}
+	if crossed := CrossedBudgetThresholds(new(big.Rat), new(big.Rat), big.NewRat(1, 1)); len(crossed) != 0 {
+		t.Errorf("expected no threshold of zero budget, got %v", crossed)
+	}
+}
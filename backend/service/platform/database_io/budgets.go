@@ -2,23 +2,31 @@ package database_io
 
 import (
 	"database/sql"
+	"github.com/jmoiron/sqlx"
 	"travel-ai/service/database"
 )
 
+// budgetColumns reads budgets into database.BudgetEntity, where '' of category is nil (all categories).
+// Category is kept as '' instead of null, and day of the whole trip is keyed by day_scope, so that the unique key works.
+const budgetColumns = "bid, currency_code, amount, uid, sid, NULLIF(category, '') AS category, day"
+
 func GetBudgetsBySessionId(sessionId string) ([]database.BudgetEntity, error) {
 	var budgets []database.BudgetEntity
 	if err := database.DB.Select(&budgets,
-		"SELECT * FROM budgets WHERE sid = ?;", sessionId); err != nil {
+		"SELECT "+budgetColumns+" FROM budgets WHERE sid = ?;", sessionId); err != nil {
 		return nil, err
 	}
 	return budgets, nil
 }
 
 func GetBudgetsBySessionIdAndUserId(sessionId string, userId string) ([]database.BudgetEntity, error) {
+	return GetBudgetsBySessionIdAndUserIdTx(nil, sessionId, userId)
+}
+
+func GetBudgetsBySessionIdAndUserIdTx(tx *sql.Tx, sessionId string, userId string) ([]database.BudgetEntity, error) {
 	var budgets []database.BudgetEntity
-	if err := database.DB.Select(&budgets,
-		`SELECT budgets.* FROM budgets
-		WHERE budgets.sid = ? AND uid = ?;`, sessionId, userId); err != nil {
+	if err := sqlx.Select(queryer(tx), &budgets,
+		"SELECT "+budgetColumns+" FROM budgets WHERE sid = ? AND uid = ?;", sessionId, userId); err != nil {
 		return nil, err
 	}
 	return budgets, nil
@@ -27,13 +35,14 @@ func GetBudgetsBySessionIdAndUserId(sessionId string, userId string) ([]database
 func GetBudget(budgetId string) (*database.BudgetEntity, error) {
 	var budget database.BudgetEntity
 	if err := database.DB.Get(&budget,
-		"SELECT * FROM budgets WHERE bid = ?;", budgetId); err != nil {
+		"SELECT "+budgetColumns+" FROM budgets WHERE bid = ?;", budgetId); err != nil {
 		return nil, err
 	}
 	return &budget, nil
 }
 
-func UpdateBudgetTx(tx *sql.Tx, budgetId string, amount float64) error {
+// UpdateBudgetTx updates amount of budget, which is in minor unit of budget currency
+func UpdateBudgetTx(tx *sql.Tx, budgetId string, amount int64) error {
 	if _, err := tx.Exec(`
 		UPDATE budgets SET amount = ?
 		WHERE bid = ?;`,
@@ -46,10 +55,10 @@ func UpdateBudgetTx(tx *sql.Tx, budgetId string, amount float64) error {
 
 func InsertBudgetTx(tx *sql.Tx, budget database.BudgetEntity) error {
 	if _, err := tx.Exec(`
-		INSERT INTO budgets(bid, currency_code, amount, uid, sid) 
-		VALUES (?, ?, ?, ?, ?);`,
+		INSERT INTO budgets(bid, currency_code, amount, uid, sid, category, day) 
+		VALUES (?, ?, ?, ?, ?, COALESCE(?, ''), ?);`,
 		budget.BudgetId, budget.CurrencyCode, budget.Amount,
-		budget.UserId, budget.SessionId,
+		budget.UserId, budget.SessionId, budget.Category, budget.Day,
 	); err != nil {
 		return err
 	}
@@ -0,0 +1,48 @@
+package database_io
+
+import (
+	"database/sql"
+	"travel-ai/service/database"
+)
+
+func GetCurrencyExchangesBySessionId(sessionId string) ([]database.CurrencyExchangeEntity, error) {
+	var exchanges []database.CurrencyExchangeEntity
+	if err := database.DB.Select(&exchanges,
+		"SELECT * FROM currency_exchanges WHERE sid = ? ORDER BY exchanged_at;", sessionId); err != nil {
+		return nil, err
+	}
+	return exchanges, nil
+}
+
+func GetCurrencyExchange(currencyExchangeId string) (*database.CurrencyExchangeEntity, error) {
+	var exchange database.CurrencyExchangeEntity
+	if err := database.DB.Get(&exchange,
+		"SELECT * FROM currency_exchanges WHERE cxid = ?;", currencyExchangeId); err != nil {
+		return nil, err
+	}
+	return &exchange, nil
+}
+
+func InsertCurrencyExchangeTx(tx *sql.Tx, exchange database.CurrencyExchangeEntity) error {
+	if _, err := tx.Exec(`
+		INSERT INTO currency_exchanges(cxid, sid, uid, from_currency_code, from_amount,
+									   to_currency_code, to_amount, fee, exchanged_at) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		exchange.CurrencyExchangeId, exchange.SessionId, exchange.UserId,
+		exchange.FromCurrencyCode, exchange.FromAmount,
+		exchange.ToCurrencyCode, exchange.ToAmount, exchange.Fee, exchange.ExchangedAt,
+	); err != nil {
+		return err
+	}
+	return nil
+}
+
+func DeleteCurrencyExchangeTx(tx *sql.Tx, currencyExchangeId string) error {
+	if _, err := tx.Exec(`
+		DELETE FROM currency_exchanges WHERE cxid = ?;`,
+		currencyExchangeId,
+	); err != nil {
+		return err
+	}
+	return nil
+}
@@ -15,14 +15,38 @@ func GetExchangeRate(from string, to string) (*database.ExchangeRateEntity, erro
 	return &exchangeRate, nil
 }
 
-func UpsertExchangeRate(from string, to string, rate float64) error {
+func UpsertExchangeRate(from string, to string, rate float64, provider string) error {
 	now := time.Now()
 	if _, err := database.DB.Exec(`
-		INSERT INTO exchange_rates(from_currency_code, to_currency_code, rate, updated_at) 
-		VALUES (?, ?, ?, ?)
-		ON DUPLICATE KEY UPDATE rate = ?, updated_at = ?;`,
-		from, to, rate, now,
-		rate, now,
+		INSERT INTO exchange_rates(from_currency_code, to_currency_code, rate, updated_at, provider) 
+		VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE rate = ?, updated_at = ?, provider = ?;`,
+		from, to, rate, now, provider,
+		rate, now, provider,
+	); err != nil {
+		return err
+	}
+	return nil
+}
+
+func GetExchangeRateHistory(from string, to string, date time.Time) (*database.ExchangeRateHistoryEntity, error) {
+	var history database.ExchangeRateHistoryEntity
+	if err := database.DB.Get(&history,
+		"SELECT * FROM exchange_rate_histories WHERE from_currency_code = ? AND to_currency_code = ? AND date = ?;",
+		from, to, date.Format("2006-01-02")); err != nil {
+		return nil, err
+	}
+	return &history, nil
+}
+
+func UpsertExchangeRateHistory(from string, to string, date time.Time, rate float64, provider string) error {
+	now := time.Now()
+	if _, err := database.DB.Exec(`
+		INSERT INTO exchange_rate_histories(from_currency_code, to_currency_code, date, rate, updated_at, provider) 
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE rate = ?, updated_at = ?, provider = ?;`,
+		from, to, date.Format("2006-01-02"), rate, now, provider,
+		rate, now, provider,
 	); err != nil {
 		return err
 	}
@@ -0,0 +1,202 @@
+package database_io
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+	"travel-ai/service/database"
+)
+
+const (
+	ExpenditureSortPayedAt    = "payed_at"
+	ExpenditureSortTotalPrice = "total_price"
+	ExpenditureSortName       = "name"
+)
+
+var ErrInvalidExpenditureCursor = errors.New("invalid expenditure cursor")
+
+// ExpenditureQuery filters expenditures of a session, where zero values are not filtered
+type ExpenditureQuery struct {
+	SessionId      string
+	Categories     []string
+	PayerIds       []string // paid by any of them
+	ParticipantIds []string // distributed to any of them
+	CurrencyCodes  []string
+	PayedFrom      *time.Time // inclusive
+	PayedTo        *time.Time // exclusive
+	// AmountRanges are matched if any of them is, as total price is compared in minor unit of each currency
+	AmountRanges []ExpenditureAmountRange
+	Name         string // contained in name
+
+	Sort       string // payed_at (default), total_price, name
+	Descending bool
+	After      *ExpenditureCursor // the last expenditure of the previous page
+	Limit      int                // zero for all
+}
+
+// ExpenditureAmountRange is a range of total price in minor unit of CurrencyCode, where nil is unbounded
+type ExpenditureAmountRange struct {
+	CurrencyCode string
+	Min          *int64
+	Max          *int64
+}
+
+// ExpenditureCursor is the position of an expenditure in a sorted list, which is passed to clients as a string
+type ExpenditureCursor struct {
+	Sort          string `json:"s"`
+	Descending    bool   `json:"d,omitempty"`
+	Value         string `json:"v"`
+	ExpenditureId string `json:"id"`
+}
+
+func IsValidExpenditureSort(sort string) bool {
+	return sort == ExpenditureSortPayedAt || sort == ExpenditureSortTotalPrice || sort == ExpenditureSortName
+}
+
+// NewExpenditureCursor makes the cursor right after the expenditure in the order
+func NewExpenditureCursor(sort string, descending bool, expenditure database.ExpenditureEntity) ExpenditureCursor {
+	cursor := ExpenditureCursor{Sort: sort, Descending: descending, ExpenditureId: expenditure.ExpenditureId}
+	switch sort {
+	case ExpenditureSortTotalPrice:
+		cursor.Value = strconv.FormatInt(expenditure.TotalPrice, 10)
+	case ExpenditureSortName:
+		cursor.Value = expenditure.Name
+	default:
+		cursor.Value = expenditure.PayedAt.UTC().Format(time.RFC3339Nano)
+	}
+	return cursor
+}
+
+func (c ExpenditureCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeExpenditureCursor(encoded string) (*ExpenditureCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidExpenditureCursor
+	}
+	var cursor ExpenditureCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, ErrInvalidExpenditureCursor
+	}
+	if !IsValidExpenditureSort(cursor.Sort) || cursor.ExpenditureId == "" {
+		return nil, ErrInvalidExpenditureCursor
+	}
+	if _, err := cursor.value(); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+func (c ExpenditureCursor) value() (interface{}, error) {
+	switch c.Sort {
+	case ExpenditureSortTotalPrice:
+		value, err := strconv.ParseInt(c.Value, 10, 64)
+		if err != nil {
+			return nil, ErrInvalidExpenditureCursor
+		}
+		return value, nil
+	case ExpenditureSortName:
+		return c.Value, nil
+	default:
+		value, err := time.Parse(time.RFC3339Nano, c.Value)
+		if err != nil {
+			return nil, ErrInvalidExpenditureCursor
+		}
+		return value, nil
+	}
+}
+
+func buildExpenditureQuery(q ExpenditureQuery) (string, []interface{}, error) {
+	query := newSelectQuery("expenditures").
+		Columns("expenditures.*",
+			// expenditure with items is made from receipt
+			"EXISTS(SELECT 1 FROM expenditure_items WHERE expenditure_items.eid = expenditures.eid) AS has_receipt").
+		Where("expenditures.sid = ?", q.SessionId).
+		WhereIn("expenditures.category", q.Categories).
+		WhereIn("expenditures.currency_code", q.CurrencyCodes)
+
+	if len(q.PayerIds) > 0 {
+		query.Where(`EXISTS(SELECT 1 FROM expenditure_payers
+			WHERE expenditure_payers.eid = expenditures.eid AND expenditure_payers.uid IN (`+placeholders(len(q.PayerIds))+`))`,
+			stringArgs(q.PayerIds)...)
+	}
+	if len(q.ParticipantIds) > 0 {
+		query.Where(`EXISTS(SELECT 1 FROM expenditure_distribution
+			WHERE expenditure_distribution.eid = expenditures.eid AND expenditure_distribution.uid IN (`+placeholders(len(q.ParticipantIds))+`))`,
+			stringArgs(q.ParticipantIds)...)
+	}
+	if q.PayedFrom != nil {
+		query.Where("expenditures.payed_at >= ?", *q.PayedFrom)
+	}
+	if q.PayedTo != nil {
+		query.Where("expenditures.payed_at < ?", *q.PayedTo)
+	}
+
+	amountConditions := make([]string, 0)
+	amountArgs := make([]interface{}, 0)
+	for _, amountRange := range q.AmountRanges {
+		condition := "(expenditures.currency_code = ?"
+		amountArgs = append(amountArgs, amountRange.CurrencyCode)
+		if amountRange.Min != nil {
+			condition += " AND expenditures.total_price >= ?"
+			amountArgs = append(amountArgs, *amountRange.Min)
+		}
+		if amountRange.Max != nil {
+			condition += " AND expenditures.total_price <= ?"
+			amountArgs = append(amountArgs, *amountRange.Max)
+		}
+		amountConditions = append(amountConditions, condition+")")
+	}
+	query.WhereAny(amountConditions, amountArgs...)
+
+	if q.Name != "" {
+		query.Where("expenditures.name LIKE ?", "%"+escapeLike(q.Name)+"%")
+	}
+
+	// keyset pagination, where expenditure id breaks ties
+	sort := q.Sort
+	if sort == "" {
+		sort = ExpenditureSortPayedAt
+	}
+	if !IsValidExpenditureSort(sort) {
+		return "", nil, errors.New("invalid expenditure sort: " + sort)
+	}
+	column := "expenditures." + sort
+	order, compare := "ASC", ">"
+	if q.Descending {
+		order, compare = "DESC", "<"
+	}
+	if q.After != nil {
+		if q.After.Sort != sort || q.After.Descending != q.Descending {
+			return "", nil, ErrInvalidExpenditureCursor
+		}
+		value, err := q.After.value()
+		if err != nil {
+			return "", nil, err
+		}
+		query.Where("("+column+" "+compare+" ? OR ("+column+" = ? AND expenditures.eid "+compare+" ?))",
+			value, value, q.After.ExpenditureId)
+	}
+	query.OrderBy(column+" "+order, "expenditures.eid "+order).Limit(q.Limit)
+
+	statement, args := query.Build()
+	return statement, args, nil
+}
+
+// SelectExpenditures returns expenditures matched by the query
+func SelectExpenditures(q ExpenditureQuery) ([]ExpenditureHasReceiptEntity, error) {
+	query, args, err := buildExpenditureQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	expenditures := make([]ExpenditureHasReceiptEntity, 0)
+	if err := database.DB.Select(&expenditures, query, args...); err != nil {
+		return nil, err
+	}
+	return expenditures, nil
+}
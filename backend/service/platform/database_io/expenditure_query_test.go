@@ -0,0 +1,82 @@
+package database_io
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"travel-ai/service/database"
+)
+
+func TestBuildExpenditureQuery(t *testing.T) {
+	from := time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)
+	min, max := int64(10000), int64(50000)
+	cursor := NewExpenditureCursor(ExpenditureSortTotalPrice, true, database.ExpenditureEntity{
+		ExpenditureId: "e1",
+		TotalPrice:    30000,
+	})
+
+	query, args, err := buildExpenditureQuery(ExpenditureQuery{
+		SessionId:     "s1",
+		Categories:    []string{"meal", "etc"},
+		PayerIds:      []string{"a"},
+		CurrencyCodes: []string{"KRW"},
+		PayedFrom:     &from,
+		AmountRanges:  []ExpenditureAmountRange{{CurrencyCode: "KRW", Min: &min, Max: &max}},
+		Name:          "50%_off",
+		Sort:          ExpenditureSortTotalPrice,
+		Descending:    true,
+		After:         &cursor,
+		Limit:         21,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, part := range []string{
+		"WHERE expenditures.sid = ? AND expenditures.category IN (?, ?) AND expenditures.currency_code IN (?)",
+		"expenditure_payers.uid IN (?)",
+		"expenditures.payed_at >= ?",
+		"((expenditures.currency_code = ? AND expenditures.total_price >= ? AND expenditures.total_price <= ?))",
+		"expenditures.name LIKE ?",
+		"(expenditures.total_price < ? OR (expenditures.total_price = ? AND expenditures.eid < ?))",
+		"ORDER BY expenditures.total_price DESC, expenditures.eid DESC LIMIT 21;",
+	} {
+		if !strings.Contains(query, part) {
+			t.Errorf("query does not contain %q: %s", part, query)
+		}
+	}
+
+	wantArgs := []interface{}{
+		"s1", "meal", "etc", "KRW", "a", from, "KRW", min, max, `%50\%\_off%`, int64(30000), int64(30000), "e1",
+	}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("args = %v, want %v", args, wantArgs)
+	}
+}
+
+func TestExpenditureCursor(t *testing.T) {
+	payedAt := time.Date(2023, 7, 1, 12, 30, 0, 0, time.UTC)
+	cursor := NewExpenditureCursor(ExpenditureSortPayedAt, false, database.ExpenditureEntity{ExpenditureId: "e1", PayedAt: payedAt})
+
+	decoded, err := DecodeExpenditureCursor(cursor.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *decoded != cursor {
+		t.Errorf("decoded = %+v, want %+v", decoded, cursor)
+	}
+
+	// cursor of another sort
+	if _, _, err := buildExpenditureQuery(ExpenditureQuery{Sort: ExpenditureSortName, After: decoded}); !errors.Is(err, ErrInvalidExpenditureCursor) {
+		t.Errorf("err = %v, want %v", err, ErrInvalidExpenditureCursor)
+	}
+	// cursor of the other order
+	if _, _, err := buildExpenditureQuery(ExpenditureQuery{Sort: ExpenditureSortPayedAt, Descending: true, After: decoded}); !errors.Is(err, ErrInvalidExpenditureCursor) {
+		t.Errorf("err = %v, want %v", err, ErrInvalidExpenditureCursor)
+	}
+	if _, err := DecodeExpenditureCursor("not a cursor"); !errors.Is(err, ErrInvalidExpenditureCursor) {
+		t.Errorf("err = %v, want %v", err, ErrInvalidExpenditureCursor)
+	}
+}
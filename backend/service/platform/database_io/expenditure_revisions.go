@@ -0,0 +1,53 @@
+package database_io
+
+import (
+	"database/sql"
+	"travel-ai/service/database"
+)
+
+// GetExpenditureRevisions returns revisions of an expenditure, the oldest first
+func GetExpenditureRevisions(expenditureId string) ([]database.ExpenditureRevisionEntity, error) {
+	var revisions []database.ExpenditureRevisionEntity
+	if err := database.DB.Select(&revisions,
+		"SELECT * FROM expenditure_revisions WHERE eid = ? ORDER BY revision;", expenditureId); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+func GetExpenditureRevision(expenditureRevisionId string) (*database.ExpenditureRevisionEntity, error) {
+	var revision database.ExpenditureRevisionEntity
+	if err := database.DB.Get(&revision,
+		"SELECT * FROM expenditure_revisions WHERE erid = ?;", expenditureRevisionId); err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
+
+func CountExpenditureRevisionsTx(tx *sql.Tx, expenditureId string) (int, error) {
+	var count int
+	if err := tx.QueryRow(
+		"SELECT COUNT(*) FROM expenditure_revisions WHERE eid = ?;", expenditureId).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// InsertExpenditureRevisionTx inserts the revision numbered next to the last one, and sets it to Revision
+func InsertExpenditureRevisionTx(tx *sql.Tx, revision *database.ExpenditureRevisionEntity) error {
+	if _, err := tx.Exec(`
+		INSERT INTO expenditure_revisions(erid, eid, sid, revision, uid, action, snapshot, diff, created_at)
+		SELECT ?, ?, ?, COALESCE(MAX(revision), 0) + 1, ?, ?, ?, ?, ?
+		FROM expenditure_revisions WHERE eid = ?;`,
+		revision.ExpenditureRevisionId, revision.ExpenditureId, revision.SessionId, revision.UserId,
+		revision.Action, revision.Snapshot, revision.Diff, revision.CreatedAt, revision.ExpenditureId,
+	); err != nil {
+		return err
+	}
+	if err := tx.QueryRow(
+		"SELECT revision FROM expenditure_revisions WHERE erid = ?;",
+		revision.ExpenditureRevisionId).Scan(&revision.Revision); err != nil {
+		return err
+	}
+	return nil
+}
@@ -2,32 +2,32 @@ package database_io
 
 import (
 	"database/sql"
+	"github.com/jmoiron/sqlx"
 	"time"
 	"travel-ai/service/database"
 )
 
+// queryer reads in tx if given, where rows locked by tx are read as they are, or out of transaction if nil
+func queryer(tx *sql.Tx) sqlx.Queryer {
+	if tx == nil {
+		return database.DB
+	}
+	return &sqlx.Tx{Tx: tx, Mapper: database.DB.Mapper}
+}
+
 type ExpenditureHasReceiptEntity struct {
 	database.ExpenditureEntity
 	HasReceipt bool `db:"has_receipt" json:"has_receipt"`
 }
 
-func GetExpendituresBySessionId(sessionId string) ([]ExpenditureHasReceiptEntity, error) {
-	var expenditures []ExpenditureHasReceiptEntity
-	// if expenditure item exists, then has receipt
-	if err := database.DB.Select(&expenditures,
-		`SELECT expenditures.*, IF(expenditure_items.eid IS NULL, FALSE, TRUE) AS has_receipt
-		FROM expenditures
-		LEFT JOIN expenditure_items ON expenditures.eid = expenditure_items.eid
-		WHERE expenditures.sid = ?
-		GROUP BY expenditures.eid;`, sessionId); err != nil {
-		return nil, err
-	}
-	return expenditures, nil
+func GetExpenditure(expenditureId string) (*database.ExpenditureEntity, error) {
+	return GetExpenditureTx(nil, expenditureId)
 }
 
-func GetExpenditure(expenditureId string) (*database.ExpenditureEntity, error) {
+// GetExpenditureTx reads the expenditure in tx, as it is after being locked by LockExpenditureVersionTx
+func GetExpenditureTx(tx *sql.Tx, expenditureId string) (*database.ExpenditureEntity, error) {
 	var expenditure database.ExpenditureEntity
-	if err := database.DB.Get(&expenditure,
+	if err := sqlx.Get(queryer(tx), &expenditure,
 		"SELECT * FROM expenditures WHERE eid = ?;", expenditureId); err != nil {
 		return nil, err
 	}
@@ -36,10 +36,67 @@ func GetExpenditure(expenditureId string) (*database.ExpenditureEntity, error) {
 
 func InsertExpenditureTx(tx *sql.Tx, expenditure database.ExpenditureEntity) error {
 	if _, err := tx.Exec(`
-		INSERT INTO expenditures(eid, name, total_price, currency_code, category, sid, payed_at) 
-		VALUES (?, ?, ?, ?, ?, ?, ?);`,
+		INSERT INTO expenditures(eid, name, total_price, currency_code, category, sid, payed_at, refund_of) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?);`,
 		expenditure.ExpenditureId, expenditure.Name, expenditure.TotalPrice, expenditure.CurrencyCode,
-		expenditure.Category, expenditure.SessionId, expenditure.PayedAt,
+		expenditure.Category, expenditure.SessionId, expenditure.PayedAt, expenditure.RefundOf,
+	); err != nil {
+		return err
+	}
+	return nil
+}
+
+// LockExpenditureVersionTx locks the expenditure until tx ends, and returns its current version
+func LockExpenditureVersionTx(tx *sql.Tx, expenditureId string) (int, error) {
+	var version int
+	if err := tx.QueryRow(
+		"SELECT version FROM expenditures WHERE eid = ? FOR UPDATE;", expenditureId).Scan(&version); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+func UpdateExpenditureTx(tx *sql.Tx, expenditure database.ExpenditureEntity) error {
+	if _, err := tx.Exec(`
+		UPDATE expenditures SET name = ?, total_price = ?, currency_code = ?, category = ?, payed_at = ?, refund_of = ?
+		WHERE eid = ?;`,
+		expenditure.Name, expenditure.TotalPrice, expenditure.CurrencyCode, expenditure.Category,
+		expenditure.PayedAt, expenditure.RefundOf, expenditure.ExpenditureId,
+	); err != nil {
+		return err
+	}
+	return nil
+}
+
+func UpdateExpenditureVersionTx(tx *sql.Tx, expenditureId string, version int) error {
+	if _, err := tx.Exec(`
+		UPDATE expenditures SET version = ? WHERE eid = ?;`,
+		version, expenditureId,
+	); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetRefundsOf returns refunds linked to the original expenditure
+func GetRefundsOf(expenditureId string) ([]database.ExpenditureEntity, error) {
+	return GetRefundsOfTx(nil, expenditureId)
+}
+
+func GetRefundsOfTx(tx *sql.Tx, expenditureId string) ([]database.ExpenditureEntity, error) {
+	var refunds []database.ExpenditureEntity
+	if err := sqlx.Select(queryer(tx), &refunds,
+		"SELECT * FROM expenditures WHERE refund_of = ? ORDER BY payed_at;", expenditureId); err != nil {
+		return nil, err
+	}
+	return refunds, nil
+}
+
+// RelinkRefundsTx links refunds of an expenditure to another, except the other itself
+func RelinkRefundsTx(tx *sql.Tx, fromExpenditureId string, toExpenditureId string) error {
+	if _, err := tx.Exec(`
+		UPDATE expenditures SET refund_of = ? WHERE refund_of = ? AND eid <> ?;`,
+		toExpenditureId, fromExpenditureId, toExpenditureId,
 	); err != nil {
 		return err
 	}
@@ -57,8 +114,12 @@ func DeleteExpenditureTx(tx *sql.Tx, expenditureId string) error {
 }
 
 func GetExpenditurePayers(expenditureId string) ([]database.ExpenditurePayerEntity, error) {
+	return GetExpenditurePayersTx(nil, expenditureId)
+}
+
+func GetExpenditurePayersTx(tx *sql.Tx, expenditureId string) ([]database.ExpenditurePayerEntity, error) {
 	var payers []database.ExpenditurePayerEntity
-	if err := database.DB.Select(&payers,
+	if err := sqlx.Select(queryer(tx), &payers,
 		"SELECT * FROM expenditure_payers WHERE eid = ?;", expenditureId); err != nil {
 		return nil, err
 	}
@@ -76,6 +137,16 @@ func InsertExpenditurePayerTx(tx *sql.Tx, expenditurePayer database.ExpenditureP
 	return nil
 }
 
+func DeleteExpenditurePayerTx(tx *sql.Tx, expenditureId string, userId string) error {
+	if _, err := tx.Exec(`
+		DELETE FROM expenditure_payers WHERE eid = ? AND uid = ?;`,
+		expenditureId, userId,
+	); err != nil {
+		return err
+	}
+	return nil
+}
+
 func InsertExpenditureDistributionTx(tx *sql.Tx, expenditureDistribution database.ExpenditureDistributionEntity) error {
 	if _, err := tx.Exec(`
 		INSERT INTO expenditure_distribution(eid, uid, num, denom) 
@@ -88,9 +159,34 @@ func InsertExpenditureDistributionTx(tx *sql.Tx, expenditureDistribution databas
 	return nil
 }
 
+func UpdateExpenditureDistributionTx(tx *sql.Tx, expenditureDistribution database.ExpenditureDistributionEntity) error {
+	if _, err := tx.Exec(`
+		UPDATE expenditure_distribution SET num = ?, denom = ? WHERE eid = ? AND uid = ?;`,
+		expenditureDistribution.Numerator, expenditureDistribution.Denominator,
+		expenditureDistribution.ExpenditureId, expenditureDistribution.UserId,
+	); err != nil {
+		return err
+	}
+	return nil
+}
+
+func DeleteExpenditureDistributionTx(tx *sql.Tx, expenditureId string, userId string) error {
+	if _, err := tx.Exec(`
+		DELETE FROM expenditure_distribution WHERE eid = ? AND uid = ?;`,
+		expenditureId, userId,
+	); err != nil {
+		return err
+	}
+	return nil
+}
+
 func GetExpenditureItems(expenditureId string) ([]database.ExpenditureItemEntity, error) {
+	return GetExpenditureItemsTx(nil, expenditureId)
+}
+
+func GetExpenditureItemsTx(tx *sql.Tx, expenditureId string) ([]database.ExpenditureItemEntity, error) {
 	var items []database.ExpenditureItemEntity
-	if err := database.DB.Select(&items,
+	if err := sqlx.Select(queryer(tx), &items,
 		"SELECT * FROM expenditure_items WHERE eid = ?;", expenditureId); err != nil {
 		return nil, err
 	}
@@ -108,9 +204,33 @@ func InsertExpenditureItemTx(tx *sql.Tx, expenditureItem database.ExpenditureIte
 	return nil
 }
 
+func UpdateExpenditureItemTx(tx *sql.Tx, expenditureItem database.ExpenditureItemEntity) error {
+	if _, err := tx.Exec(`
+		UPDATE expenditure_items SET label = ?, price = ? WHERE eiid = ? AND eid = ?;`,
+		expenditureItem.Label, expenditureItem.Price, expenditureItem.ExpenditureItemId, expenditureItem.ExpenditureId,
+	); err != nil {
+		return err
+	}
+	return nil
+}
+
+func DeleteExpenditureItemTx(tx *sql.Tx, expenditureItemId string) error {
+	if _, err := tx.Exec(`
+		DELETE FROM expenditure_items WHERE eiid = ?;`,
+		expenditureItemId,
+	); err != nil {
+		return err
+	}
+	return nil
+}
+
 func GetExpenditureItemAllocations(expenditureItemId string) ([]database.ExpenditureItemAllocationEntity, error) {
+	return GetExpenditureItemAllocationsTx(nil, expenditureItemId)
+}
+
+func GetExpenditureItemAllocationsTx(tx *sql.Tx, expenditureItemId string) ([]database.ExpenditureItemAllocationEntity, error) {
 	var allocations []database.ExpenditureItemAllocationEntity
-	if err := database.DB.Select(&allocations,
+	if err := sqlx.Select(queryer(tx), &allocations,
 		"SELECT * FROM expenditure_item_allocations WHERE eiid = ?;", expenditureItemId); err != nil {
 		return nil, err
 	}
@@ -128,9 +248,23 @@ func InsertExpenditureItemAllocationTx(tx *sql.Tx, expenditureItemAllocation dat
 	return nil
 }
 
+func DeleteExpenditureItemAllocationTx(tx *sql.Tx, expenditureItemId string, userId string) error {
+	if _, err := tx.Exec(`
+		DELETE FROM expenditure_item_allocations WHERE eiid = ? AND uid = ?;`,
+		expenditureItemId, userId,
+	); err != nil {
+		return err
+	}
+	return nil
+}
+
 func GetExpenditureDistributions(expenditureId string) ([]database.ExpenditureDistributionEntity, error) {
+	return GetExpenditureDistributionsTx(nil, expenditureId)
+}
+
+func GetExpenditureDistributionsTx(tx *sql.Tx, expenditureId string) ([]database.ExpenditureDistributionEntity, error) {
 	var distributions []database.ExpenditureDistributionEntity
-	if err := database.DB.Select(&distributions,
+	if err := sqlx.Select(queryer(tx), &distributions,
 		"SELECT * FROM expenditure_distribution WHERE eid = ?;", expenditureId); err != nil {
 		return nil, err
 	}
@@ -140,13 +274,14 @@ func GetExpenditureDistributions(expenditureId string) ([]database.ExpenditureDi
 type UserExpenditureDistributionEntity struct {
 	database.ExpenditureDistributionEntity
 	CurrencyCode string    `db:"currency_code" json:"currency_code"`
+	Category     string    `db:"category" json:"category"`
 	PayedAt      time.Time `db:"payed_at" json:"payed_at"`
 }
 
 func GetExpenditureDistributionsBySessionIdAndUserId(sessionId string, userId string) ([]UserExpenditureDistributionEntity, error) {
 	var distributions []UserExpenditureDistributionEntity
 	if err := database.DB.Select(&distributions,
-		`SELECT ed.*, expenditures.currency_code, expenditures.payed_at
+		`SELECT ed.*, expenditures.currency_code, expenditures.category, expenditures.payed_at
 		FROM expenditure_distribution ed
 		INNER JOIN expenditures ON ed.eid = expenditures.eid
 		WHERE expenditures.sid = ? AND ed.uid = ?;`, sessionId, userId); err != nil {
@@ -158,7 +293,7 @@ func GetExpenditureDistributionsBySessionIdAndUserId(sessionId string, userId st
 func GetExpenditureDistributionsBySessionId(sessionId string) ([]UserExpenditureDistributionEntity, error) {
 	var distributions []UserExpenditureDistributionEntity
 	if err := database.DB.Select(&distributions,
-		`SELECT ed.*, expenditures.currency_code, expenditures.payed_at
+		`SELECT ed.*, expenditures.currency_code, expenditures.category, expenditures.payed_at
 		FROM expenditure_distribution ed
 		INNER JOIN expenditures ON ed.eid = expenditures.eid
 		WHERE expenditures.sid = ?;`, sessionId); err != nil {
@@ -199,10 +334,9 @@ func GetExpenditureDistributionWithPayersBySessionId(sessionId string) ([]*Expen
 	}
 
 	if err := database.DB.Select(&payers,
-		`SELECT expenditures.*, users.uid
+		`SELECT expenditures.*, ep.uid
 		FROM expenditure_payers ep
 		INNER JOIN expenditures ON ep.eid = expenditures.eid
-		INNER JOIN users ON ep.uid = users.uid
 		WHERE expenditures.sid = ?;`, sessionId); err != nil {
 		return nil, err
 	}
@@ -244,3 +378,38 @@ func GetExpenditureDistributionWithPayersBySessionId(sessionId string) ([]*Expen
 
 	return result, nil
 }
+
+func GetExpenditureCharges(expenditureId string) ([]database.ExpenditureChargeEntity, error) {
+	return GetExpenditureChargesTx(nil, expenditureId)
+}
+
+func GetExpenditureChargesTx(tx *sql.Tx, expenditureId string) ([]database.ExpenditureChargeEntity, error) {
+	var charges []database.ExpenditureChargeEntity
+	if err := sqlx.Select(queryer(tx), &charges,
+		"SELECT * FROM expenditure_charges WHERE eid = ?;", expenditureId); err != nil {
+		return nil, err
+	}
+	return charges, nil
+}
+
+func InsertExpenditureChargeTx(tx *sql.Tx, expenditureCharge database.ExpenditureChargeEntity) error {
+	if _, err := tx.Exec(`
+		INSERT INTO expenditure_charges(ecid, eid, kind, label, percent, amount) 
+		VALUES (?, ?, ?, ?, ?, ?);`,
+		expenditureCharge.ExpenditureChargeId, expenditureCharge.ExpenditureId, expenditureCharge.Kind,
+		expenditureCharge.Label, expenditureCharge.Percent, expenditureCharge.Amount,
+	); err != nil {
+		return err
+	}
+	return nil
+}
+
+func DeleteExpenditureChargesTx(tx *sql.Tx, expenditureId string) error {
+	if _, err := tx.Exec(`
+		DELETE FROM expenditure_charges WHERE eid = ?;`,
+		expenditureId,
+	); err != nil {
+		return err
+	}
+	return nil
+}
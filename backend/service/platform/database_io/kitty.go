@@ -0,0 +1,76 @@
+package database_io
+
+import (
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"travel-ai/service/database"
+)
+
+// KittySpentEntity is the sum of expenditures paid from the kitty in a currency
+type KittySpentEntity struct {
+	CurrencyCode string `db:"currency_code"`
+	Spent        int64  `db:"spent"` // in minor unit of CurrencyCode
+}
+
+func GetKittyContributionsBySessionId(sessionId string) ([]database.KittyContributionEntity, error) {
+	return GetKittyContributionsBySessionIdTx(nil, sessionId)
+}
+
+func GetKittyContributionsBySessionIdTx(tx *sql.Tx, sessionId string) ([]database.KittyContributionEntity, error) {
+	var contributions []database.KittyContributionEntity
+	if err := sqlx.Select(queryer(tx), &contributions,
+		"SELECT * FROM kitty_contributions WHERE sid = ? ORDER BY contributed_at;", sessionId); err != nil {
+		return nil, err
+	}
+	return contributions, nil
+}
+
+func GetKittyContribution(kittyContributionId string) (*database.KittyContributionEntity, error) {
+	var contribution database.KittyContributionEntity
+	if err := database.DB.Get(&contribution,
+		"SELECT * FROM kitty_contributions WHERE kcid = ?;", kittyContributionId); err != nil {
+		return nil, err
+	}
+	return &contribution, nil
+}
+
+func InsertKittyContributionTx(tx *sql.Tx, contribution database.KittyContributionEntity) error {
+	if _, err := tx.Exec(`
+		INSERT INTO kitty_contributions(kcid, sid, uid, currency_code, amount, memo, contributed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?);`,
+		contribution.KittyContributionId, contribution.SessionId, contribution.UserId,
+		contribution.CurrencyCode, contribution.Amount, contribution.Memo, contribution.ContributedAt,
+	); err != nil {
+		return err
+	}
+	return nil
+}
+
+func DeleteKittyContributionTx(tx *sql.Tx, kittyContributionId string) error {
+	if _, err := tx.Exec(`
+		DELETE FROM kitty_contributions WHERE kcid = ?;`,
+		kittyContributionId,
+	); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetKittySpentBySessionId sums expenditures paid by kittyPayerId by currency, except the expenditure if not empty
+func GetKittySpentBySessionId(sessionId string, kittyPayerId string, exceptExpenditureId string) ([]KittySpentEntity, error) {
+	return GetKittySpentBySessionIdTx(nil, sessionId, kittyPayerId, exceptExpenditureId)
+}
+
+func GetKittySpentBySessionIdTx(tx *sql.Tx, sessionId string, kittyPayerId string, exceptExpenditureId string) ([]KittySpentEntity, error) {
+	var spent []KittySpentEntity
+	if err := sqlx.Select(queryer(tx), &spent, `
+		SELECT e.currency_code, SUM(e.total_price) AS spent
+		FROM expenditures e
+		JOIN expenditure_payers ep ON ep.eid = e.eid
+		WHERE e.sid = ? AND ep.uid = ? AND e.eid <> ?
+		GROUP BY e.currency_code;`,
+		sessionId, kittyPayerId, exceptExpenditureId); err != nil {
+		return nil, err
+	}
+	return spent, nil
+}
@@ -0,0 +1,110 @@
+package database_io
+
+import (
+	"strconv"
+	"strings"
+)
+
+// selectQuery builds a SELECT statement with placeholders, so that filters are not concatenated by hand.
+//
+//	query, args := newSelectQuery("expenditures").
+//		Columns("expenditures.*").
+//		Where("expenditures.sid = ?", sessionId).
+//		WhereIn("expenditures.category", categories).
+//		OrderBy("expenditures.payed_at DESC").
+//		Limit(20).
+//		Build()
+type selectQuery struct {
+	table   string
+	columns []string
+	wheres  []string
+	args    []interface{}
+	orderBy []string
+	limit   int
+}
+
+func newSelectQuery(table string) *selectQuery {
+	return &selectQuery{table: table}
+}
+
+func (q *selectQuery) Columns(columns ...string) *selectQuery {
+	q.columns = append(q.columns, columns...)
+	return q
+}
+
+// Where adds a condition, which is joined with AND
+func (q *selectQuery) Where(condition string, args ...interface{}) *selectQuery {
+	q.wheres = append(q.wheres, condition)
+	q.args = append(q.args, args...)
+	return q
+}
+
+// WhereIn adds `column IN (...)`, or nothing if values are empty
+func (q *selectQuery) WhereIn(column string, values []string) *selectQuery {
+	if len(values) == 0 {
+		return q
+	}
+	return q.Where(column+" IN ("+placeholders(len(values))+")", stringArgs(values)...)
+}
+
+// WhereAny adds conditions joined with OR as a single condition, or nothing if conditions are empty
+func (q *selectQuery) WhereAny(conditions []string, args ...interface{}) *selectQuery {
+	if len(conditions) == 0 {
+		return q
+	}
+	return q.Where("("+strings.Join(conditions, " OR ")+")", args...)
+}
+
+func (q *selectQuery) OrderBy(orders ...string) *selectQuery {
+	q.orderBy = append(q.orderBy, orders...)
+	return q
+}
+
+// Limit sets the maximum number of rows, where zero means no limit
+func (q *selectQuery) Limit(limit int) *selectQuery {
+	q.limit = limit
+	return q
+}
+
+func (q *selectQuery) Build() (string, []interface{}) {
+	var sb strings.Builder
+	sb.WriteString("SELECT ")
+	if len(q.columns) == 0 {
+		sb.WriteString("*")
+	} else {
+		sb.WriteString(strings.Join(q.columns, ", "))
+	}
+	sb.WriteString(" FROM ")
+	sb.WriteString(q.table)
+	if len(q.wheres) > 0 {
+		sb.WriteString(" WHERE ")
+		sb.WriteString(strings.Join(q.wheres, " AND "))
+	}
+	if len(q.orderBy) > 0 {
+		sb.WriteString(" ORDER BY ")
+		sb.WriteString(strings.Join(q.orderBy, ", "))
+	}
+	if q.limit > 0 {
+		sb.WriteString(" LIMIT ")
+		sb.WriteString(strconv.Itoa(q.limit))
+	}
+	sb.WriteString(";")
+	return sb.String(), q.args
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// escapeLike escapes wildcards of LIKE pattern, so that the text is matched as it is
+func escapeLike(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(text)
+}
+
+func stringArgs(values []string) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	return args
+}
@@ -0,0 +1,71 @@
+package database_io
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+	"travel-ai/service/database"
+)
+
+func GetReceipt(receiptId string) (*database.ReceiptEntity, error) {
+	var receipt database.ReceiptEntity
+	if err := database.DB.Get(&receipt,
+		"SELECT * FROM receipts WHERE rid = ?;", receiptId); err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
+
+func GetReceiptsByExpenditureId(expenditureId string) ([]database.ReceiptEntity, error) {
+	var receipts []database.ReceiptEntity
+	if err := database.DB.Select(&receipts,
+		"SELECT * FROM receipts WHERE eid = ? ORDER BY created_at;", expenditureId); err != nil {
+		return nil, err
+	}
+	return receipts, nil
+}
+
+// GetHashedReceipts returns hashed receipts uploaded by the user, or for the session if given, since the time
+func GetHashedReceipts(uid string, sessionId *string, since time.Time) ([]database.ReceiptEntity, error) {
+	receipts := make([]database.ReceiptEntity, 0)
+	if err := database.DB.Select(&receipts,
+		"SELECT * FROM receipts WHERE phash IS NOT NULL AND created_at >= ? AND (uid = ? OR sid = ?) ORDER BY created_at;",
+		since, uid, sessionId); err != nil {
+		return nil, err
+	}
+	return receipts, nil
+}
+
+func InsertReceiptTx(tx *sql.Tx, receipt database.ReceiptEntity) error {
+	if _, err := tx.Exec(`
+		INSERT INTO receipts(rid, uid, sid, eid, content_type, phash, created_at) 
+		VALUES (?, ?, ?, ?, ?, ?, ?);`,
+		receipt.ReceiptId, receipt.UserId, receipt.SessionId, receipt.ExpenditureId,
+		receipt.ContentType, receipt.ImageHash, receipt.CreatedAt,
+	); err != nil {
+		return err
+	}
+	return nil
+}
+
+var ErrReceiptOfAnotherSession = errors.New("receipt belongs to another session")
+
+// AttachReceiptTx attaches the receipt to the expenditure of the session, or detaches it if expenditureId is nil.
+// A receipt which already belongs to another session is left as it is, with ErrReceiptOfAnotherSession.
+func AttachReceiptTx(tx *sql.Tx, receiptId string, sessionId string, expenditureId *string) error {
+	var receiptSessionId sql.NullString
+	if err := tx.QueryRow(
+		"SELECT sid FROM receipts WHERE rid = ? FOR UPDATE;", receiptId).Scan(&receiptSessionId); err != nil {
+		return err
+	}
+	if receiptSessionId.Valid && receiptSessionId.String != sessionId {
+		return ErrReceiptOfAnotherSession
+	}
+	if _, err := tx.Exec(`
+		UPDATE receipts SET sid = ?, eid = ? WHERE rid = ?;`,
+		sessionId, expenditureId, receiptId,
+	); err != nil {
+		return err
+	}
+	return nil
+}
@@ -11,17 +11,28 @@ func InsertSessionTx(tx *sql.Tx, session database.SessionEntity) error {
 	if _, err := tx.Exec(`
 		INSERT INTO sessions(sid, session_code, creator_uid,
 							 name, start_at, end_at, 
-							 created_at, thumbnail_url) 
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?);`,
+							 created_at, thumbnail_url, exchange_rate_mode,
+							 use_acquired_rate) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
 		session.SessionId, session.SessionCode, session.CreatorUserId,
 		session.Name, session.StartAt, session.EndAt,
-		session.CreatedAt, session.ThumbnailUrl,
+		session.CreatedAt, session.ThumbnailUrl, session.ExchangeRateMode,
+		session.UseAcquiredRate,
 	); err != nil {
 		return err
 	}
 	return nil
 }
 
+func UpdateSessionExchangeRateModeTx(tx *sql.Tx, sessionId string, mode string, useAcquiredRate bool) error {
+	if _, err := tx.Exec(
+		"UPDATE sessions SET exchange_rate_mode = ?, use_acquired_rate = ? WHERE sid = ?;",
+		mode, useAcquiredRate, sessionId); err != nil {
+		return err
+	}
+	return nil
+}
+
 func GetSession(sessionId string) (*database.SessionEntity, error) {
 	// get session
 	var session database.SessionEntity
@@ -31,6 +42,12 @@ func GetSession(sessionId string) (*database.SessionEntity, error) {
 	return &session, nil
 }
 
+// LockSessionTx locks the session until tx ends, so that writes checked against other rows of the session are serialized
+func LockSessionTx(tx *sql.Tx, sessionId string) error {
+	var sid string
+	return tx.QueryRow("SELECT sid FROM sessions WHERE sid = ? FOR UPDATE;", sessionId).Scan(&sid)
+}
+
 func GetSessionByCode(sessionCode string) (*database.SessionEntity, error) {
 	// get session
 	var session database.SessionEntity
@@ -2,28 +2,129 @@ package database_io
 
 import (
 	"database/sql"
+	"time"
 	"travel-ai/service/database"
 )
 
+// GetTransactionsBySessionId returns transactions to settle, which are not voided
 func GetTransactionsBySessionId(sessionId string) ([]database.TransactionEntity, error) {
 	var transactions []database.TransactionEntity
 	if err := database.DB.Select(&transactions,
-		"SELECT * FROM transactions WHERE sid = ?;", sessionId); err != nil {
+		"SELECT * FROM transactions WHERE sid = ? AND voided_at IS NULL;", sessionId); err != nil {
 		return nil, err
 	}
 	return transactions, nil
 }
 
+// GetTransactionsPageBySessionId returns a page of all transactions including voided ones, the latest first
+func GetTransactionsPageBySessionId(sessionId string, limit int, offset int) ([]database.TransactionEntity, error) {
+	var transactions []database.TransactionEntity
+	if err := database.DB.Select(&transactions,
+		`SELECT * FROM transactions WHERE sid = ?
+		ORDER BY sent_at DESC, tid
+		LIMIT ? OFFSET ?;`, sessionId, limit, offset); err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+func CountTransactionsBySessionId(sessionId string) (int, error) {
+	var count int
+	if err := database.DB.Get(&count,
+		"SELECT COUNT(*) FROM transactions WHERE sid = ?;", sessionId); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func GetTransaction(transactionId string) (*database.TransactionEntity, error) {
+	var transaction database.TransactionEntity
+	if err := database.DB.Get(&transaction,
+		"SELECT * FROM transactions WHERE tid = ?;", transactionId); err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
+
 func InsertTransactionTx(tx *sql.Tx, sessionId string, transaction *database.TransactionEntity) error {
 	if _, err := tx.Exec(`
-		INSERT INTO transactions (sender_uid, receiver_uid, currency_code, amount, sent_at, sid) 
-		VALUES (?, ?, ?, ?, ?, ?);`,
+		INSERT INTO transactions (tid, sender_uid, receiver_uid, currency_code, amount, sent_at, sid,
+		                          status, method, memo, confirmed_at) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		transaction.TransactionId,
 		transaction.SenderUid,
 		transaction.ReceiverUid,
 		transaction.CurrencyCode,
 		transaction.Amount,
 		transaction.SentAt,
-		sessionId); err != nil {
+		sessionId,
+		transaction.Status,
+		transaction.Method,
+		transaction.Memo,
+		transaction.ConfirmedAt); err != nil {
+		return err
+	}
+	return nil
+}
+
+// UpdateTransactionStatusTx moves the transaction into status only if it is in one of fromStatuses and not voided.
+// It tells false if the transaction has been changed since it was read.
+func UpdateTransactionStatusTx(tx *sql.Tx, transactionId string, fromStatuses []string, status string,
+	confirmedAt *time.Time) (bool, error) {
+	args := append([]interface{}{status, confirmedAt, transactionId}, stringArgs(fromStatuses)...)
+	result, err := tx.Exec(`
+		UPDATE transactions SET status = ?, confirmed_at = ?
+		WHERE tid = ? AND status IN (`+placeholders(len(fromStatuses))+`) AND voided_at IS NULL;`,
+		args...)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// VoidTransactionTx voids the transaction only if it is in one of fromStatuses.
+// It tells false if it has been voided already or moved into another status.
+func VoidTransactionTx(tx *sql.Tx, transactionId string, fromStatuses []string, userId string,
+	voidedAt time.Time) (bool, error) {
+	args := append([]interface{}{voidedAt, userId, transactionId}, stringArgs(fromStatuses)...)
+	result, err := tx.Exec(`
+		UPDATE transactions SET voided_at = ?, voided_by = ?
+		WHERE tid = ? AND status IN (`+placeholders(len(fromStatuses))+`) AND voided_at IS NULL;`,
+		args...)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// GetTransactionAuditsByTransactionIds returns audits of the transactions, e.g. of a page, the oldest first
+func GetTransactionAuditsByTransactionIds(transactionIds []string) ([]database.TransactionAuditEntity, error) {
+	if len(transactionIds) == 0 {
+		return nil, nil
+	}
+	var audits []database.TransactionAuditEntity
+	if err := database.DB.Select(&audits,
+		`SELECT * FROM transaction_audits
+		WHERE tid IN (`+placeholders(len(transactionIds))+`)
+		ORDER BY created_at;`, stringArgs(transactionIds)...); err != nil {
+		return nil, err
+	}
+	return audits, nil
+}
+
+func InsertTransactionAuditTx(tx *sql.Tx, audit database.TransactionAuditEntity) error {
+	if _, err := tx.Exec(`
+		INSERT INTO transaction_audits (tid, uid, action, memo, created_at) 
+		VALUES (?, ?, ?, ?, ?);`,
+		audit.TransactionId, audit.UserId, audit.Action, audit.Memo, audit.CreatedAt); err != nil {
 		return err
 	}
 	return nil
@@ -0,0 +1,169 @@
+package platform
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"travel-ai/libs/money"
+	"travel-ai/libs/phash"
+	"travel-ai/service/database"
+	"travel-ai/service/platform/database_io"
+	"unicode"
+)
+
+const (
+	// DuplicateReceiptMaxDistance is the hash distance up to which receipt images are the same,
+	// where different receipts are usually apart more than 12 bits
+	DuplicateReceiptMaxDistance = 10
+	// DuplicateReceiptPeriod is how long ago the same receipt is looked for
+	DuplicateReceiptPeriod = 90 * 24 * time.Hour
+
+	// DuplicateExpenditureWindow is how far apart the same payment can be recorded
+	DuplicateExpenditureWindow = 6 * time.Hour
+	// DuplicateExpenditureAmountTolerance is the relative difference of amounts, which covers tips and rounding
+	DuplicateExpenditureAmountTolerance = 0.05
+	// DuplicateExpenditureMinScore is the score from which expenditures are likely the same
+	DuplicateExpenditureMinScore = 0.7
+)
+
+type DuplicateReceipt struct {
+	Receipt  database.ReceiptEntity
+	Distance int
+}
+
+type DuplicateExpenditure struct {
+	Expenditure database.ExpenditureEntity
+	Score       float64 // in [DuplicateExpenditureMinScore, 1]
+}
+
+// FindDuplicateReceipts finds receipts of the same image, which the user uploaded or were uploaded for the session.
+// Closer ones come first.
+func FindDuplicateReceipts(uid string, sessionId *string, hash phash.Hash) ([]DuplicateReceipt, error) {
+	receipts, err := database_io.GetHashedReceipts(uid, sessionId, time.Now().Add(-DuplicateReceiptPeriod))
+	if err != nil {
+		return nil, err
+	}
+	duplicates := make([]DuplicateReceipt, 0)
+	for _, receipt := range receipts {
+		other, err := phash.Parse(*receipt.ImageHash)
+		if err != nil {
+			continue
+		}
+		if distance := phash.Distance(hash, other); distance <= DuplicateReceiptMaxDistance {
+			duplicates = append(duplicates, DuplicateReceipt{Receipt: receipt, Distance: distance})
+		}
+	}
+	sort.SliceStable(duplicates, func(i, j int) bool {
+		return duplicates[i].Distance < duplicates[j].Distance
+	})
+	return duplicates, nil
+}
+
+// FindDuplicateExpenditures finds expenditures of the session which are likely the same payment, except expenditureId.
+// More likely ones come first.
+func FindDuplicateExpenditures(sessionId string, expenditureId string, name string, totalPrice money.Money,
+	payedAt time.Time) ([]DuplicateExpenditure, error) {
+	payedFrom := payedAt.Add(-DuplicateExpenditureWindow)
+	payedTo := payedAt.Add(DuplicateExpenditureWindow)
+	expenditures, err := database_io.SelectExpenditures(database_io.ExpenditureQuery{
+		SessionId:     sessionId,
+		CurrencyCodes: []string{totalPrice.CurrencyCode},
+		PayedFrom:     &payedFrom,
+		PayedTo:       &payedTo,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	duplicates := make([]DuplicateExpenditure, 0)
+	for _, expenditure := range expenditures {
+		if expenditure.ExpenditureId == expenditureId {
+			continue
+		}
+		score := ScoreDuplicateExpenditure(name, totalPrice, payedAt, expenditure.ExpenditureEntity)
+		if score >= DuplicateExpenditureMinScore {
+			duplicates = append(duplicates, DuplicateExpenditure{Expenditure: expenditure.ExpenditureEntity, Score: score})
+		}
+	}
+	sort.SliceStable(duplicates, func(i, j int) bool {
+		return duplicates[i].Score > duplicates[j].Score
+	})
+	return duplicates, nil
+}
+
+// ScoreDuplicateExpenditure tells how likely the other is the same payment in [0, 1].
+// Amount weighs the most, then payment time and name, where payments of different currencies
+// or out of DuplicateExpenditureWindow are never the same.
+func ScoreDuplicateExpenditure(name string, totalPrice money.Money, payedAt time.Time,
+	other database.ExpenditureEntity) float64 {
+	gap := payedAt.Sub(other.PayedAt)
+	if totalPrice.CurrencyCode != other.CurrencyCode || gap >= DuplicateExpenditureWindow || gap <= -DuplicateExpenditureWindow {
+		return 0
+	}
+
+	// amounts of the same sign within tolerance
+	amountScore := 0.0
+	a, b := float64(totalPrice.Amount), float64(other.TotalPrice)
+	if a == b {
+		amountScore = 1
+	} else if a*b > 0 {
+		difference := math.Abs(a-b) / math.Max(math.Abs(a), math.Abs(b))
+		amountScore = math.Max(0, 1-difference/DuplicateExpenditureAmountTolerance)
+	}
+
+	timeScore := 1 - math.Abs(float64(gap))/float64(DuplicateExpenditureWindow)
+
+	return 0.5*amountScore + 0.3*timeScore + 0.2*nameSimilarity(name, other.Name)
+}
+
+// nameSimilarity is one minus the edit distance over the longer name in [0, 1],
+// which ignores case, spaces and punctuation. Unnamed one is half similar to anything.
+func nameSimilarity(a, b string) float64 {
+	ra, rb := normalizeName(a), normalizeName(b)
+	if len(ra) == 0 || len(rb) == 0 {
+		return 0.5
+	}
+	longer := len(ra)
+	if len(rb) > longer {
+		longer = len(rb)
+	}
+	return 1 - float64(editDistance(ra, rb))/float64(longer)
+}
+
+func normalizeName(name string) []rune {
+	runes := make([]rune, 0, len(name))
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			runes = append(runes, r)
+		}
+	}
+	return runes
+}
+
+// editDistance is the levenshtein distance of runes
+func editDistance(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = previous[j-1] + cost
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,62 @@
+package platform
+
+import (
+	"testing"
+	"time"
+	"travel-ai/libs/money"
+	"travel-ai/service/database"
+)
+
+func TestScoreDuplicateExpenditure(t *testing.T) {
+	payedAt := time.Date(2023, 7, 1, 19, 0, 0, 0, time.UTC)
+	other := database.ExpenditureEntity{
+		Name:         "Dinner at Myeongdong Kyoja",
+		TotalPrice:   36000,
+		CurrencyCode: "KRW",
+		PayedAt:      payedAt,
+	}
+
+	tests := []struct {
+		name       string
+		expName    string
+		totalPrice money.Money
+		payedAt    time.Time
+		duplicate  bool
+	}{
+		{"same payment", "Dinner at Myeongdong Kyoja", money.New(36000, "KRW"), payedAt, true},
+		{"recorded later by another member", "dinner, myeongdong kyoja", money.New(36000, "KRW"), payedAt.Add(2 * time.Hour), true},
+		{"named differently at the same time", "명동교자", money.New(36000, "KRW"), payedAt, true},
+		{"tip added", "Dinner at Myeongdong Kyoja", money.New(37000, "KRW"), payedAt.Add(30 * time.Minute), true},
+		{"another currency", "Dinner at Myeongdong Kyoja", money.New(3600, "USD"), payedAt, false},
+		{"different amount", "Dinner at Myeongdong Kyoja", money.New(18000, "KRW"), payedAt, false},
+		{"same amount on another day", "Dinner at Myeongdong Kyoja", money.New(36000, "KRW"), payedAt.Add(24 * time.Hour), false},
+		{"same amount of another place later", "Taxi", money.New(36000, "KRW"), payedAt.Add(3 * time.Hour), false},
+		{"refund of the same amount", "Dinner at Myeongdong Kyoja", money.New(-36000, "KRW"), payedAt, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			score := ScoreDuplicateExpenditure(test.expName, test.totalPrice, test.payedAt, other)
+			if (score >= DuplicateExpenditureMinScore) != test.duplicate {
+				t.Errorf("expected duplicate %v, got score %v", test.duplicate, score)
+			}
+		})
+	}
+}
+
+func TestNameSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected float64
+	}{
+		{"Starbucks", "STARBUCKS!", 1},
+		{"스타벅스 강남점", "스타벅스강남점", 1},
+		{"kitten", "sitting", 1 - 3.0/7},
+		{"", "anything", 0.5},
+		{"abc", "xyz", 0},
+	}
+	for _, test := range tests {
+		if similarity := nameSimilarity(test.a, test.b); similarity != test.expected {
+			t.Errorf("%q, %q: expected %v, got %v", test.a, test.b, test.expected, similarity)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package platform
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+	"travel-ai/libs/money"
+	"travel-ai/log"
+	"travel-ai/service/database"
+	"travel-ai/service/exchange_rate"
+	"travel-ai/service/platform/database_io"
+)
+
+// GetUpdatedExchangeRate returns the latest rate, which is refreshed once a day.
+// Only live rates are kept, also as the rate of the day they are published for.
+// Without a live rate, the kept one is returned however old it is, and a fallback rate is returned only if none is kept.
+func GetUpdatedExchangeRate(from string, to string) (float64, error) {
+	ex, err := database_io.GetExchangeRate(from, to)
+	needUpdate := err != nil || ex.UpdatedAt.Unix() < time.Now().Unix()-86400
+	if err != nil {
+		log.Debug(err)
+		log.Debugf("needUpdate: %v", needUpdate)
+	}
+
+	// rate is updated once 1 day has passed
+	if !needUpdate {
+		return ex.Rate, nil
+	}
+
+	quote, err := exchange_rate.GetQuote(exchange_rate.DefaultProvider, from, to, time.Time{})
+	if err == nil && !quote.Fallback {
+		if err := database_io.UpsertExchangeRate(from, to, quote.Rate, quote.Provider); err != nil {
+			log.Error(err)
+		}
+		if !quote.Date.IsZero() {
+			if err := database_io.UpsertExchangeRateHistory(from, to, quote.Date, quote.Rate, quote.Provider); err != nil {
+				log.Error(err)
+			}
+		}
+		return quote.Rate, nil
+	}
+
+	if ex != nil {
+		if err != nil {
+			log.Error(err)
+		}
+		log.Warnf("no live exchange rate from %s to %s, so the rate updated at %s is used", from, to, ex.UpdatedAt)
+		return ex.Rate, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	log.Warnf("fallback exchange rate from %s to %s of %s is used without being kept", from, to, quote.Provider)
+	return quote.Rate, nil
+}
+
+// GetExchangeRateAt returns the rate of the day (UTC) of at.
+// Live rates of past days are kept in history once fetched, so they never change afterwards.
+// Fallback rates are returned without being kept, so that a live one replaces them later.
+// For today or later, the latest rate is returned.
+func GetExchangeRateAt(from string, to string, at time.Time) (float64, error) {
+	day := toDay(at)
+	if !day.Before(toDay(time.Now())) {
+		return GetUpdatedExchangeRate(from, to)
+	}
+
+	history, err := database_io.GetExchangeRateHistory(from, to, day)
+	if err == nil {
+		return history.Rate, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		log.Error(err)
+	}
+
+	quote, err := exchange_rate.GetQuote(exchange_rate.DefaultProvider, from, to, day)
+	if err != nil {
+		return 0, err
+	}
+	if quote.Fallback || !quote.Date.Equal(day) {
+		log.Warnf("fallback exchange rate from %s to %s of %s is used for %s without being kept",
+			from, to, quote.Provider, ToDayString(day))
+		return quote.Rate, nil
+	}
+	if err := database_io.UpsertExchangeRateHistory(from, to, day, quote.Rate, quote.Provider); err != nil {
+		log.Error(err)
+	}
+	return quote.Rate, nil
+}
+
+// ExchangeRate returns the latest rate as an exact rational, so that amounts are exchanged without float arithmetic
+func ExchangeRate(from string, to string) (*big.Rat, error) {
+	if from == to {
+		return big.NewRat(1, 1), nil
+	}
+	rate, err := GetUpdatedExchangeRate(from, to)
+	if err != nil {
+		return nil, err
+	}
+	return rateToRat(from, to, rate)
+}
+
+// ExchangeRateAt returns the rate of the day of at as an exact rational. Zero time means the latest rate.
+func ExchangeRateAt(from string, to string, at time.Time) (*big.Rat, error) {
+	if at.IsZero() {
+		return ExchangeRate(from, to)
+	}
+	if from == to {
+		return big.NewRat(1, 1), nil
+	}
+	rate, err := GetExchangeRateAt(from, to, at)
+	if err != nil {
+		return nil, err
+	}
+	return rateToRat(from, to, rate)
+}
+
+// rateToRat reads the rate as its shortest decimal representation
+func rateToRat(from string, to string, rate float64) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(rate, 'f', -1, 64))
+	if !ok {
+		return nil, fmt.Errorf("invalid exchange rate from %s to %s: %v", from, to, rate)
+	}
+	return r, nil
+}
+
+// Exchange converts money into another currency with the latest rate, rounding to minor unit of the currency
+func Exchange(m money.Money, to string) (money.Money, error) {
+	rate, err := ExchangeRate(m.CurrencyCode, to)
+	if err != nil {
+		return money.Money{}, err
+	}
+	return m.Exchange(rate, to), nil
+}
+
+// AcquiredRates are weighted-average rates of currency exchanges made by members, keyed by [from, to]
+type AcquiredRates map[[2]string]*big.Rat
+
+// NewAcquiredRates sums up exchanges of each currency pair, so that the rate is total received per total spent.
+// Fee is counted as spent, as it is paid to acquire the currency.
+func NewAcquiredRates(exchanges []database.CurrencyExchangeEntity) AcquiredRates {
+	spent := make(map[[2]string]*big.Rat)
+	received := make(map[[2]string]*big.Rat)
+	for _, exchange := range exchanges {
+		pair := [2]string{exchange.FromCurrencyCode, exchange.ToCurrencyCode}
+		if _, ok := spent[pair]; !ok {
+			spent[pair], received[pair] = new(big.Rat), new(big.Rat)
+		}
+		spent[pair].Add(spent[pair], exchange.FromAmountMoney().Rat())
+		spent[pair].Add(spent[pair], exchange.FeeMoney().Rat())
+		received[pair].Add(received[pair], exchange.ToAmountMoney().Rat())
+	}
+
+	rates := make(AcquiredRates)
+	for pair := range spent {
+		if spent[pair].Sign() <= 0 || received[pair].Sign() <= 0 {
+			continue
+		}
+		rates[pair] = new(big.Rat).Quo(received[pair], spent[pair])
+	}
+	return rates
+}
+
+// Rate returns the acquired rate of the pair. If only the other direction was exchanged, its inverse is used.
+func (r AcquiredRates) Rate(from string, to string) (*big.Rat, bool) {
+	if rate, ok := r[[2]string{from, to}]; ok {
+		return rate, true
+	}
+	if rate, ok := r[[2]string{to, from}]; ok {
+		return new(big.Rat).Inv(rate), true
+	}
+	return nil, false
+}
+
+// SessionAcquiredRates returns acquired rates of the session
+func SessionAcquiredRates(sessionId string) (AcquiredRates, error) {
+	exchanges, err := database_io.GetCurrencyExchangesBySessionId(sessionId)
+	if err != nil {
+		return nil, err
+	}
+	return NewAcquiredRates(exchanges), nil
+}
+
+// SessionExchanger returns rates of the moment, following exchange rate mode of the session.
+// If the session uses acquired rates, a pair exchanged by members is exchanged with its acquired rate regardless of the moment.
+// Zero time means now. Rates are cached in the returned function, so make one for each request.
+func SessionExchanger(session *database.SessionEntity) func(from string, to string, at time.Time) (*big.Rat, error) {
+	rates := make(map[string]*big.Rat)
+	var acquiredRates AcquiredRates
+	return func(from string, to string, at time.Time) (*big.Rat, error) {
+		if session.UseAcquiredRate && from != to {
+			if acquiredRates == nil {
+				var err error
+				if acquiredRates, err = SessionAcquiredRates(session.SessionId); err != nil {
+					return nil, err
+				}
+			}
+			if rate, ok := acquiredRates.Rate(from, to); ok {
+				return rate, nil
+			}
+		}
+
+		switch session.ExchangeRateMode {
+		case ExchangeRateModeLive:
+			at = time.Time{}
+		case ExchangeRateModeSessionEnd:
+			at = sessionEndDay(session)
+		}
+
+		key := fmt.Sprintf("%s/%s/", from, to)
+		if !at.IsZero() {
+			key += ToDayString(toDay(at))
+		}
+		if rate, ok := rates[key]; ok {
+			return rate, nil
+		}
+		rate, err := ExchangeRateAt(from, to, at)
+		if err != nil {
+			return nil, err
+		}
+		rates[key] = rate
+		return rate, nil
+	}
+}
+
+// SessionSettledAt returns the moment when budgets and debts of the session are exchanged.
+// It is the end of session once the session is over, otherwise zero time (now).
+func SessionSettledAt(session *database.SessionEntity) time.Time {
+	end := sessionEndDay(session)
+	if !end.IsZero() && end.Before(toDay(time.Now())) {
+		return end
+	}
+	return time.Time{}
+}
+
+// sessionEndDay returns the end date of session as a day in UTC, or zero time if it is not set
+func sessionEndDay(session *database.SessionEntity) time.Time {
+	if session.EndAt == nil {
+		return time.Time{}
+	}
+	// end_at is a date column, so take the date as it is regardless of location
+	y, m, d := session.EndAt.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// toDay truncates time into the day in UTC
+func toDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
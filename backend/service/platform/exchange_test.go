@@ -0,0 +1,33 @@
+package platform
+
+import (
+	"math/big"
+	"testing"
+	"travel-ai/service/database"
+)
+
+func TestNewAcquiredRates(t *testing.T) {
+	exchanges := []database.CurrencyExchangeEntity{
+		// 500,000 KRW (+ 5,000 fee) -> 50,500 JPY
+		{FromCurrencyCode: "KRW", FromAmount: 500000, ToCurrencyCode: "JPY", ToAmount: 50500, Fee: 5000},
+		// 300,000 KRW -> 29,500 JPY
+		{FromCurrencyCode: "KRW", FromAmount: 300000, ToCurrencyCode: "JPY", ToAmount: 29500},
+		// 100 USD -> 130,000 KRW
+		{FromCurrencyCode: "USD", FromAmount: 10000, ToCurrencyCode: "KRW", ToAmount: 130000},
+	}
+	rates := NewAcquiredRates(exchanges)
+
+	// (50,500 + 29,500) / (500,000 + 5,000 + 300,000)
+	if rate, ok := rates.Rate("KRW", "JPY"); !ok || rate.Cmp(big.NewRat(80000, 805000)) != 0 {
+		t.Errorf("KRW/JPY: expected 80000/805000, got %v", rate)
+	}
+	if rate, ok := rates.Rate("JPY", "KRW"); !ok || rate.Cmp(big.NewRat(805000, 80000)) != 0 {
+		t.Errorf("JPY/KRW: expected inverse 805000/80000, got %v", rate)
+	}
+	if rate, ok := rates.Rate("USD", "KRW"); !ok || rate.Cmp(big.NewRat(1300, 1)) != 0 {
+		t.Errorf("USD/KRW: expected 1300, got %v", rate)
+	}
+	if _, ok := rates.Rate("USD", "JPY"); ok {
+		t.Errorf("USD/JPY: expected no acquired rate")
+	}
+}
@@ -0,0 +1,552 @@
+package platform
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"github.com/google/uuid"
+	"sort"
+	"strings"
+	"time"
+	"travel-ai/libs/money"
+	"travel-ai/service/database"
+	"travel-ai/service/platform/database_io"
+)
+
+const (
+	ExpenditureRevisionCreated  = "created"
+	ExpenditureRevisionUpdated  = "updated"
+	ExpenditureRevisionDeleted  = "deleted"
+	ExpenditureRevisionRestored = "restored"
+	// ExpenditureRevisionMerged deletes the expenditure merged into its duplicate, which can be restored as deleted one
+	ExpenditureRevisionMerged = "merged"
+)
+
+// ExpenditureSnapshot is the whole state of an expenditure, which is kept for each revision
+type ExpenditureSnapshot struct {
+	Name         string                            `json:"name"`
+	TotalPrice   money.Decimal                     `json:"total_price"`
+	CurrencyCode string                            `json:"currency_code"`
+	Category     string                            `json:"category"`
+	PayedAt      time.Time                         `json:"payed_at"`
+	PayersId     []string                          `json:"payers_id"`
+	Distribution []ExpenditureSnapshotDistribution `json:"distribution"`
+	Items        []ExpenditureSnapshotItem         `json:"items"`
+	Charges      []ExpenditureSnapshotCharge       `json:"charges"`
+	RefundOf     *string                           `json:"refund_of"` // original expenditure of a refund
+}
+
+type ExpenditureSnapshotDistribution struct {
+	UserId      string `json:"user_id"`
+	Numerator   int64  `json:"num"`
+	Denominator int64  `json:"denom"`
+}
+
+type ExpenditureSnapshotItem struct {
+	ExpenditureItemId string        `json:"-"` // not a part of history, as items are inserted again on restore
+	Label             string        `json:"label"`
+	Price             money.Decimal `json:"price"`
+	Allocations       []string      `json:"allocations"`
+}
+
+type ExpenditureSnapshotCharge struct {
+	Kind    string         `json:"kind"`
+	Label   string         `json:"label"`
+	Percent *money.Decimal `json:"percent"`
+	Amount  money.Decimal  `json:"amount"`
+}
+
+// ExpenditureFieldChange is a changed field of an expenditure, where Before or After is nil if none
+type ExpenditureFieldChange struct {
+	Field  string          `json:"field"`
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+func (s *ExpenditureSnapshot) TotalPriceMoney() money.Money {
+	return money.FromRat(s.TotalPrice.Rat(), s.CurrencyCode)
+}
+
+// normalize sorts lists by their whole content and keeps time in UTC as it is read from the database,
+// so that the same expenditure always has the same snapshot
+func (s *ExpenditureSnapshot) normalize() {
+	s.PayedAt = s.PayedAt.UTC()
+	sort.Strings(s.PayersId)
+	sort.Slice(s.Distribution, func(i, j int) bool {
+		return s.Distribution[i].UserId < s.Distribution[j].UserId
+	})
+	for _, item := range s.Items {
+		sort.Strings(item.Allocations)
+	}
+	sort.SliceStable(s.Items, func(i, j int) bool {
+		a, b := s.Items[i], s.Items[j]
+		if a.Label != b.Label {
+			return a.Label < b.Label
+		}
+		if c := a.Price.Rat().Cmp(b.Price.Rat()); c != 0 {
+			return c < 0
+		}
+		return strings.Join(a.Allocations, ",") < strings.Join(b.Allocations, ",")
+	})
+	sort.SliceStable(s.Charges, func(i, j int) bool {
+		a, b := s.Charges[i], s.Charges[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Label != b.Label {
+			return a.Label < b.Label
+		}
+		return a.Amount.Rat().Cmp(b.Amount.Rat()) < 0
+	})
+}
+
+func (s *ExpenditureSnapshot) fields() (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// LoadExpenditureSnapshot reads the current state of an expenditure
+func LoadExpenditureSnapshot(expenditure database.ExpenditureEntity) (*ExpenditureSnapshot, error) {
+	return loadExpenditureSnapshot(nil, expenditure)
+}
+
+// LoadExpenditureSnapshotTx reads the state of an expenditure in tx, which should be read after it is locked
+// so that it is not changed by others until tx ends
+func LoadExpenditureSnapshotTx(tx *sql.Tx, expenditure database.ExpenditureEntity) (*ExpenditureSnapshot, error) {
+	return loadExpenditureSnapshot(tx, expenditure)
+}
+
+func loadExpenditureSnapshot(tx *sql.Tx, expenditure database.ExpenditureEntity) (*ExpenditureSnapshot, error) {
+	snapshot := &ExpenditureSnapshot{
+		Name:         expenditure.Name,
+		TotalPrice:   expenditure.TotalPriceMoney().Decimal(),
+		CurrencyCode: expenditure.CurrencyCode,
+		Category:     expenditure.Category,
+		PayedAt:      expenditure.PayedAt,
+		RefundOf:     expenditure.RefundOf,
+		PayersId:     make([]string, 0),
+		Distribution: make([]ExpenditureSnapshotDistribution, 0),
+		Items:        make([]ExpenditureSnapshotItem, 0),
+		Charges:      make([]ExpenditureSnapshotCharge, 0),
+	}
+
+	payers, err := database_io.GetExpenditurePayersTx(tx, expenditure.ExpenditureId)
+	if err != nil {
+		return nil, err
+	}
+	for _, payer := range payers {
+		snapshot.PayersId = append(snapshot.PayersId, payer.UserId)
+	}
+
+	distributions, err := database_io.GetExpenditureDistributionsTx(tx, expenditure.ExpenditureId)
+	if err != nil {
+		return nil, err
+	}
+	for _, dist := range distributions {
+		snapshot.Distribution = append(snapshot.Distribution, ExpenditureSnapshotDistribution{
+			UserId:      dist.UserId,
+			Numerator:   dist.Numerator,
+			Denominator: dist.Denominator,
+		})
+	}
+
+	items, err := database_io.GetExpenditureItemsTx(tx, expenditure.ExpenditureId)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		allocations, err := database_io.GetExpenditureItemAllocationsTx(tx, item.ExpenditureItemId)
+		if err != nil {
+			return nil, err
+		}
+		allocatedUsers := make([]string, 0)
+		for _, allocation := range allocations {
+			allocatedUsers = append(allocatedUsers, allocation.UserId)
+		}
+		snapshot.Items = append(snapshot.Items, ExpenditureSnapshotItem{
+			ExpenditureItemId: item.ExpenditureItemId,
+			Label:             item.Label,
+			Price:             money.New(item.Price, expenditure.CurrencyCode).Decimal(),
+			Allocations:       allocatedUsers,
+		})
+	}
+
+	charges, err := database_io.GetExpenditureChargesTx(tx, expenditure.ExpenditureId)
+	if err != nil {
+		return nil, err
+	}
+	for _, charge := range charges {
+		snapshotCharge := ExpenditureSnapshotCharge{
+			Kind:   charge.Kind,
+			Label:  charge.Label,
+			Amount: money.New(charge.Amount, expenditure.CurrencyCode).Decimal(),
+		}
+		if charge.Percent != nil {
+			percent, err := money.ParseDecimal(*charge.Percent)
+			if err != nil {
+				return nil, err
+			}
+			snapshotCharge.Percent = &percent
+		}
+		snapshot.Charges = append(snapshot.Charges, snapshotCharge)
+	}
+
+	snapshot.normalize()
+	return snapshot, nil
+}
+
+// InsertExpenditureSnapshotTx inserts an expenditure with its payers, distribution, items and charges
+func InsertExpenditureSnapshotTx(tx *sql.Tx, expenditureId string, sessionId string, snapshot *ExpenditureSnapshot) error {
+	totalPrice, err := money.FromDecimal(snapshot.TotalPrice, snapshot.CurrencyCode)
+	if err != nil {
+		return err
+	}
+	if err := database_io.InsertExpenditureTx(tx, database.ExpenditureEntity{
+		ExpenditureId: expenditureId,
+		Name:          snapshot.Name,
+		TotalPrice:    totalPrice.Amount,
+		CurrencyCode:  snapshot.CurrencyCode,
+		Category:      snapshot.Category,
+		SessionId:     sessionId,
+		PayedAt:       snapshot.PayedAt,
+		RefundOf:      snapshot.RefundOf,
+	}); err != nil {
+		return err
+	}
+
+	for _, payerId := range snapshot.PayersId {
+		if err := database_io.InsertExpenditurePayerTx(tx, database.ExpenditurePayerEntity{
+			ExpenditureId: expenditureId,
+			UserId:        payerId,
+		}); err != nil {
+			return err
+		}
+	}
+
+	for _, dist := range snapshot.Distribution {
+		if err := database_io.InsertExpenditureDistributionTx(tx, dist.entity(expenditureId)); err != nil {
+			return err
+		}
+	}
+
+	for _, item := range snapshot.Items {
+		if err := insertExpenditureItemTx(tx, expenditureId, snapshot.CurrencyCode, item); err != nil {
+			return err
+		}
+	}
+
+	return insertExpenditureChargesTx(tx, expenditureId, snapshot)
+}
+
+// ApplyExpenditureSnapshotTx updates an expenditure from before to after, touching only what is changed.
+// Items of after are matched to those of before by ExpenditureItemId, and the others are inserted as new ones.
+func ApplyExpenditureSnapshotTx(tx *sql.Tx, expenditureId string, before *ExpenditureSnapshot, after *ExpenditureSnapshot) error {
+	totalPrice, err := money.FromDecimal(after.TotalPrice, after.CurrencyCode)
+	if err != nil {
+		return err
+	}
+	if err := database_io.UpdateExpenditureTx(tx, database.ExpenditureEntity{
+		ExpenditureId: expenditureId,
+		Name:          after.Name,
+		TotalPrice:    totalPrice.Amount,
+		CurrencyCode:  after.CurrencyCode,
+		Category:      after.Category,
+		PayedAt:       after.PayedAt,
+		RefundOf:      after.RefundOf,
+	}); err != nil {
+		return err
+	}
+	currencyChanged := before.CurrencyCode != after.CurrencyCode
+
+	// payers
+	removedPayers := make(map[string]bool)
+	for _, payerId := range before.PayersId {
+		removedPayers[payerId] = true
+	}
+	for _, payerId := range after.PayersId {
+		if removedPayers[payerId] {
+			delete(removedPayers, payerId)
+			continue
+		}
+		if err := database_io.InsertExpenditurePayerTx(tx, database.ExpenditurePayerEntity{
+			ExpenditureId: expenditureId,
+			UserId:        payerId,
+		}); err != nil {
+			return err
+		}
+	}
+	for payerId := range removedPayers {
+		if err := database_io.DeleteExpenditurePayerTx(tx, expenditureId, payerId); err != nil {
+			return err
+		}
+	}
+
+	// distribution
+	removedDistributions := make(map[string]ExpenditureSnapshotDistribution)
+	for _, dist := range before.Distribution {
+		removedDistributions[dist.UserId] = dist
+	}
+	for _, dist := range after.Distribution {
+		old, ok := removedDistributions[dist.UserId]
+		if !ok {
+			if err := database_io.InsertExpenditureDistributionTx(tx, dist.entity(expenditureId)); err != nil {
+				return err
+			}
+			continue
+		}
+		delete(removedDistributions, dist.UserId)
+		if old != dist {
+			if err := database_io.UpdateExpenditureDistributionTx(tx, dist.entity(expenditureId)); err != nil {
+				return err
+			}
+		}
+	}
+	for userId := range removedDistributions {
+		if err := database_io.DeleteExpenditureDistributionTx(tx, expenditureId, userId); err != nil {
+			return err
+		}
+	}
+
+	// items
+	removedItems := make(map[string]ExpenditureSnapshotItem)
+	for _, item := range before.Items {
+		removedItems[item.ExpenditureItemId] = item
+	}
+	for _, item := range after.Items {
+		old, ok := removedItems[item.ExpenditureItemId]
+		if !ok || item.ExpenditureItemId == "" {
+			if err := insertExpenditureItemTx(tx, expenditureId, after.CurrencyCode, item); err != nil {
+				return err
+			}
+			continue
+		}
+		delete(removedItems, item.ExpenditureItemId)
+
+		if currencyChanged || old.Label != item.Label || old.Price.Rat().Cmp(item.Price.Rat()) != 0 {
+			price, err := money.FromDecimal(item.Price, after.CurrencyCode)
+			if err != nil {
+				return err
+			}
+			if err := database_io.UpdateExpenditureItemTx(tx, database.ExpenditureItemEntity{
+				ExpenditureItemId: item.ExpenditureItemId,
+				Label:             item.Label,
+				Price:             price.Amount,
+				ExpenditureId:     expenditureId,
+			}); err != nil {
+				return err
+			}
+		}
+
+		removedAllocations := make(map[string]bool)
+		for _, userId := range old.Allocations {
+			removedAllocations[userId] = true
+		}
+		for _, userId := range item.Allocations {
+			if removedAllocations[userId] {
+				delete(removedAllocations, userId)
+				continue
+			}
+			if err := database_io.InsertExpenditureItemAllocationTx(tx, database.ExpenditureItemAllocationEntity{
+				ExpenditureItemId: item.ExpenditureItemId,
+				UserId:            userId,
+			}); err != nil {
+				return err
+			}
+		}
+		for userId := range removedAllocations {
+			if err := database_io.DeleteExpenditureItemAllocationTx(tx, item.ExpenditureItemId, userId); err != nil {
+				return err
+			}
+		}
+	}
+	for itemId := range removedItems {
+		if err := database_io.DeleteExpenditureItemTx(tx, itemId); err != nil {
+			return err
+		}
+	}
+
+	// charges have no identity, so they are replaced only if changed
+	beforeCharges, err := json.Marshal(before.Charges)
+	if err != nil {
+		return err
+	}
+	afterCharges, err := json.Marshal(after.Charges)
+	if err != nil {
+		return err
+	}
+	if currencyChanged || !bytes.Equal(beforeCharges, afterCharges) {
+		if err := database_io.DeleteExpenditureChargesTx(tx, expenditureId); err != nil {
+			return err
+		}
+		if err := insertExpenditureChargesTx(tx, expenditureId, after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d ExpenditureSnapshotDistribution) entity(expenditureId string) database.ExpenditureDistributionEntity {
+	return database.ExpenditureDistributionEntity{
+		ExpenditureId: expenditureId,
+		UserId:        d.UserId,
+		Numerator:     d.Numerator,
+		Denominator:   d.Denominator,
+	}
+}
+
+func insertExpenditureItemTx(tx *sql.Tx, expenditureId string, currencyCode string, item ExpenditureSnapshotItem) error {
+	price, err := money.FromDecimal(item.Price, currencyCode)
+	if err != nil {
+		return err
+	}
+	itemId := uuid.New().String()
+	if err := database_io.InsertExpenditureItemTx(tx, database.ExpenditureItemEntity{
+		ExpenditureItemId: itemId,
+		Label:             item.Label,
+		Price:             price.Amount,
+		ExpenditureId:     expenditureId,
+	}); err != nil {
+		return err
+	}
+
+	for _, allocatedUid := range item.Allocations {
+		if err := database_io.InsertExpenditureItemAllocationTx(tx, database.ExpenditureItemAllocationEntity{
+			ExpenditureItemId: itemId,
+			UserId:            allocatedUid,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertExpenditureChargesTx(tx *sql.Tx, expenditureId string, snapshot *ExpenditureSnapshot) error {
+	for _, charge := range snapshot.Charges {
+		amount, err := money.FromDecimal(charge.Amount, snapshot.CurrencyCode)
+		if err != nil {
+			return err
+		}
+		var percent *string
+		if charge.Percent != nil {
+			p := charge.Percent.String()
+			percent = &p
+		}
+		if err := database_io.InsertExpenditureChargeTx(tx, database.ExpenditureChargeEntity{
+			ExpenditureChargeId: uuid.New().String(),
+			ExpenditureId:       expenditureId,
+			Kind:                charge.Kind,
+			Label:               charge.Label,
+			Percent:             percent,
+			Amount:              amount.Amount,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DiffExpenditureSnapshots returns changed fields in order of ExpenditureSnapshot.
+// A nil snapshot is an expenditure which does not exist, e.g. before created or after deleted.
+func DiffExpenditureSnapshots(before *ExpenditureSnapshot, after *ExpenditureSnapshot) ([]ExpenditureFieldChange, error) {
+	beforeFields := make(map[string]json.RawMessage)
+	afterFields := make(map[string]json.RawMessage)
+	var err error
+	if before != nil {
+		before.normalize()
+		if beforeFields, err = before.fields(); err != nil {
+			return nil, err
+		}
+	}
+	if after != nil {
+		after.normalize()
+		if afterFields, err = after.fields(); err != nil {
+			return nil, err
+		}
+	}
+
+	changes := make([]ExpenditureFieldChange, 0)
+	for _, field := range expenditureSnapshotFields {
+		beforeField, afterField := beforeFields[field], afterFields[field]
+		if bytes.Equal(beforeField, afterField) {
+			continue
+		}
+		changes = append(changes, ExpenditureFieldChange{Field: field, Before: beforeField, After: afterField})
+	}
+	return changes, nil
+}
+
+var expenditureSnapshotFields = []string{
+	"name", "total_price", "currency_code", "category", "payed_at", "payers_id", "distribution", "items", "charges",
+	"refund_of",
+}
+
+// RecordExpenditureRevisionTx records a revision by the editor, and returns what is changed and the revision.
+// The version of the expenditure becomes the revision, so that it always increases even after restored.
+// If the expenditure has no history yet (made before history was kept), its state before is recorded first.
+func RecordExpenditureRevisionTx(tx *sql.Tx, expenditureId string, sessionId string, editorId string, action string,
+	before *ExpenditureSnapshot, after *ExpenditureSnapshot) ([]ExpenditureFieldChange, int, error) {
+	if before != nil {
+		count, err := database_io.CountExpenditureRevisionsTx(tx, expenditureId)
+		if err != nil {
+			return nil, 0, err
+		}
+		if count == 0 {
+			if _, _, err := insertExpenditureRevisionTx(tx, expenditureId, sessionId, nil,
+				ExpenditureRevisionCreated, nil, before); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+
+	changes, revision, err := insertExpenditureRevisionTx(tx, expenditureId, sessionId, &editorId, action, before, after)
+	if err != nil {
+		return nil, 0, err
+	}
+	if after != nil {
+		if err := database_io.UpdateExpenditureVersionTx(tx, expenditureId, revision); err != nil {
+			return nil, 0, err
+		}
+	}
+	return changes, revision, nil
+}
+
+func insertExpenditureRevisionTx(tx *sql.Tx, expenditureId string, sessionId string, editorId *string, action string,
+	before *ExpenditureSnapshot, after *ExpenditureSnapshot) ([]ExpenditureFieldChange, int, error) {
+	changes, err := DiffExpenditureSnapshots(before, after)
+	if err != nil {
+		return nil, 0, err
+	}
+	diff, err := json.Marshal(changes)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	revision := database.ExpenditureRevisionEntity{
+		ExpenditureRevisionId: uuid.New().String(),
+		ExpenditureId:         expenditureId,
+		SessionId:             sessionId,
+		UserId:                editorId,
+		Action:                action,
+		Diff:                  string(diff),
+		CreatedAt:             time.Now(),
+	}
+	if after != nil {
+		data, err := json.Marshal(after)
+		if err != nil {
+			return nil, 0, err
+		}
+		snapshot := string(data)
+		revision.Snapshot = &snapshot
+	}
+	if err := database_io.InsertExpenditureRevisionTx(tx, &revision); err != nil {
+		return nil, 0, err
+	}
+	return changes, revision.Revision, nil
+}
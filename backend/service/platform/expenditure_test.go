@@ -0,0 +1,96 @@
+package platform
+
+import (
+	"math/big"
+	"testing"
+	"time"
+	"travel-ai/libs/money"
+)
+
+func testSnapshot() *ExpenditureSnapshot {
+	return &ExpenditureSnapshot{
+		Name:         "dinner",
+		TotalPrice:   money.New(30000, "KRW").Decimal(),
+		CurrencyCode: "KRW",
+		Category:     CategoryMeal,
+		PayedAt:      time.Date(2023, 7, 1, 19, 0, 0, 0, time.UTC),
+		PayersId:     []string{"a"},
+		Distribution: []ExpenditureSnapshotDistribution{
+			{UserId: "a", Numerator: 15000, Denominator: 1},
+			{UserId: "b", Numerator: 15000, Denominator: 1},
+		},
+		Items:   []ExpenditureSnapshotItem{},
+		Charges: []ExpenditureSnapshotCharge{},
+	}
+}
+
+func TestDiffExpenditureSnapshots(t *testing.T) {
+	before := testSnapshot()
+	after := testSnapshot()
+	after.TotalPrice = money.NewDecimal(big.NewRat(36000, 1), 0)
+	after.Distribution = []ExpenditureSnapshotDistribution{
+		// order does not matter
+		{UserId: "b", Numerator: 18000, Denominator: 1},
+		{UserId: "a", Numerator: 18000, Denominator: 1},
+	}
+	after.PayersId = []string{"a"}
+
+	changes, err := DiffExpenditureSnapshots(before, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || changes[0].Field != "total_price" || changes[1].Field != "distribution" {
+		t.Fatalf("unexpected changes: %+v", changes)
+	}
+	if string(changes[0].Before) != "30000" || string(changes[0].After) != "36000" {
+		t.Errorf("total price: expected 30000 -> 36000, got %s -> %s", changes[0].Before, changes[0].After)
+	}
+
+	changes, err = DiffExpenditureSnapshots(testSnapshot(), testSnapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("expected no change, got %+v", changes)
+	}
+}
+
+func TestDiffExpenditureSnapshotsNormalized(t *testing.T) {
+	before := testSnapshot()
+	before.Items = []ExpenditureSnapshotItem{
+		{Label: "beer", Price: money.New(5000, "KRW").Decimal(), Allocations: []string{"a"}},
+		{Label: "beer", Price: money.New(5000, "KRW").Decimal(), Allocations: []string{"b"}},
+		{Label: "beer", Price: money.New(4000, "KRW").Decimal(), Allocations: []string{"a", "b"}},
+	}
+	after := testSnapshot()
+	// payed at the same moment, as given by the request in local time
+	after.PayedAt = before.PayedAt.In(time.FixedZone("KST", 9*60*60))
+	after.Items = []ExpenditureSnapshotItem{
+		{Label: "beer", Price: money.New(5000, "KRW").Decimal(), Allocations: []string{"b"}},
+		{Label: "beer", Price: money.New(4000, "KRW").Decimal(), Allocations: []string{"b", "a"}},
+		{Label: "beer", Price: money.New(5000, "KRW").Decimal(), Allocations: []string{"a"}},
+	}
+
+	changes, err := DiffExpenditureSnapshots(before, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("expected no change, got %+v", changes)
+	}
+}
+
+func TestDiffExpenditureSnapshotsDeleted(t *testing.T) {
+	changes, err := DiffExpenditureSnapshots(testSnapshot(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != len(expenditureSnapshotFields) {
+		t.Fatalf("expected every field to be changed, got %+v", changes)
+	}
+	for _, change := range changes {
+		if change.Before == nil || change.After != nil {
+			t.Errorf("%s: expected only before, got %s -> %s", change.Field, change.Before, change.After)
+		}
+	}
+}
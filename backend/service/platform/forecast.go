@@ -0,0 +1,155 @@
+package platform
+
+import (
+	"math/big"
+	"sort"
+	"time"
+	"travel-ai/service/database"
+)
+
+const (
+	// UnusualDayRatio is how many times the median a day should spend to be unusually expensive
+	UnusualDayRatio = 2
+	// UnusualDayMinDays is how many days of spending are needed to tell an unusual day
+	UnusualDayMinDays = 3
+)
+
+// BudgetForecast projects spending to the end of the trip, where amounts are in major unit.
+// Days so far include today, and remaining days are the ones after today.
+type BudgetForecast struct {
+	TripDays      int
+	ElapsedDays   int
+	RemainingDays int
+
+	Budget    *big.Rat
+	Spent     *big.Rat // including spending out of the trip, such as flights booked before
+	Remaining *big.Rat // budget left, negative if it is over
+	// DailyAverage is the burn rate of the trip so far, which is zero before the trip
+	DailyAverage *big.Rat
+	// ProjectedTotal is spent so far and the daily average for the remaining days
+	ProjectedTotal *big.Rat
+	// DailyAllowance splits the remaining budget into the remaining days, which is nil if none is left
+	DailyAllowance *big.Rat
+	UnusualDays    []UnusualDay
+}
+
+// UnusualDay spent more than UnusualDayRatio times the median of the days with spending
+type UnusualDay struct {
+	Day   string // 2006-01-02
+	Spent *big.Rat
+	Ratio float64 // to the median
+}
+
+// SessionTripDays returns the first and last day of the trip, where missing start is the first day of spending,
+// and missing end is today, as it cannot be projected.
+func SessionTripDays(session *database.SessionEntity, spentByDay map[string]*big.Rat, today time.Time) (time.Time, time.Time) {
+	today = toDay(today)
+	start, end := today, today
+	if session.StartAt != nil {
+		y, m, d := session.StartAt.Date()
+		start = time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	} else {
+		for day := range spentByDay {
+			if parsed, err := time.Parse("2006-01-02", day); err == nil && parsed.Before(start) {
+				start = parsed
+			}
+		}
+	}
+	if sessionEnd := sessionEndDay(session); !sessionEnd.IsZero() {
+		end = sessionEnd
+	}
+	if end.Before(start) {
+		end = start
+	}
+	return start, end
+}
+
+// ForecastBudget projects spending of the trip from start to end day by the daily average so far.
+func ForecastBudget(budget *big.Rat, spentByDay map[string]*big.Rat, start time.Time, end time.Time,
+	today time.Time) BudgetForecast {
+	start, end, today = toDay(start), toDay(end), toDay(today)
+	forecast := BudgetForecast{
+		TripDays:     daysBetween(start, end) + 1,
+		Budget:       new(big.Rat).Set(budget),
+		Spent:        new(big.Rat),
+		DailyAverage: new(big.Rat),
+		UnusualDays:  make([]UnusualDay, 0),
+	}
+	switch {
+	case today.Before(start):
+		forecast.RemainingDays = forecast.TripDays
+	case today.After(end):
+		forecast.ElapsedDays = forecast.TripDays
+	default:
+		forecast.ElapsedDays = daysBetween(start, today) + 1
+		forecast.RemainingDays = daysBetween(today, end)
+	}
+
+	// only days of the trip so far make the burn rate
+	elapsedSpent := new(big.Rat)
+	tripDays := make([]string, 0)
+	for day, spent := range spentByDay {
+		forecast.Spent.Add(forecast.Spent, spent)
+		parsed, err := time.Parse("2006-01-02", day)
+		if err != nil || parsed.Before(start) || parsed.After(end) || parsed.After(today) {
+			continue
+		}
+		elapsedSpent.Add(elapsedSpent, spent)
+		if spent.Sign() > 0 {
+			tripDays = append(tripDays, day)
+		}
+	}
+	if forecast.ElapsedDays > 0 {
+		forecast.DailyAverage.Quo(elapsedSpent, big.NewRat(int64(forecast.ElapsedDays), 1))
+	}
+
+	forecast.Remaining = new(big.Rat).Sub(budget, forecast.Spent)
+	forecast.ProjectedTotal = new(big.Rat).Mul(forecast.DailyAverage, big.NewRat(int64(forecast.RemainingDays), 1))
+	forecast.ProjectedTotal.Add(forecast.ProjectedTotal, forecast.Spent)
+	if forecast.RemainingDays > 0 {
+		forecast.DailyAllowance = new(big.Rat).Quo(forecast.Remaining, big.NewRat(int64(forecast.RemainingDays), 1))
+		if forecast.DailyAllowance.Sign() < 0 {
+			forecast.DailyAllowance.SetInt64(0)
+		}
+	}
+
+	forecast.UnusualDays = unusualDays(spentByDay, tripDays)
+	return forecast
+}
+
+// unusualDays compares spending of the days with their median, in the order of days
+func unusualDays(spentByDay map[string]*big.Rat, days []string) []UnusualDay {
+	unusual := make([]UnusualDay, 0)
+	if len(days) < UnusualDayMinDays {
+		return unusual
+	}
+	sort.Strings(days)
+	sorted := make([]*big.Rat, len(days))
+	for i, day := range days {
+		sorted[i] = spentByDay[day]
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Cmp(sorted[j]) < 0
+	})
+	median := new(big.Rat).Set(sorted[len(sorted)/2])
+	if len(sorted)%2 == 0 {
+		median.Add(median, sorted[len(sorted)/2-1])
+		median.Quo(median, big.NewRat(2, 1))
+	}
+
+	limit := new(big.Rat).Mul(median, big.NewRat(UnusualDayRatio, 1))
+	for _, day := range days {
+		spent := spentByDay[day]
+		if spent.Cmp(limit) <= 0 {
+			continue
+		}
+		ratio, _ := new(big.Rat).Quo(spent, median).Float64()
+		unusual = append(unusual, UnusualDay{Day: day, Spent: spent, Ratio: ratio})
+	}
+	return unusual
+}
+
+// daysBetween counts days from a to b, which are days in UTC
+func daysBetween(a time.Time, b time.Time) int {
+	return int(b.Sub(a).Hours() / 24)
+}
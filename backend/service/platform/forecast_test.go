@@ -0,0 +1,93 @@
+package platform
+
+import (
+	"math/big"
+	"testing"
+	"time"
+	"travel-ai/service/database"
+)
+
+func TestForecastBudget(t *testing.T) {
+	start := time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2023, 7, 10, 0, 0, 0, 0, time.UTC)
+	today := time.Date(2023, 7, 4, 15, 30, 0, 0, time.UTC)
+	spentByDay := map[string]*big.Rat{
+		"2023-06-20": big.NewRat(300, 1), // flights booked before the trip
+		"2023-07-01": big.NewRat(100, 1),
+		"2023-07-02": big.NewRat(80, 1),
+		"2023-07-03": big.NewRat(420, 1),
+		"2023-07-04": big.NewRat(0, 1),
+	}
+
+	forecast := ForecastBudget(big.NewRat(1500, 1), spentByDay, start, end, today)
+	if forecast.TripDays != 10 || forecast.ElapsedDays != 4 || forecast.RemainingDays != 6 {
+		t.Fatalf("expected 10, 4 and 6 days, got %d, %d and %d",
+			forecast.TripDays, forecast.ElapsedDays, forecast.RemainingDays)
+	}
+	expectRat(t, "spent", forecast.Spent, big.NewRat(900, 1))
+	expectRat(t, "remaining", forecast.Remaining, big.NewRat(600, 1))
+	expectRat(t, "daily average", forecast.DailyAverage, big.NewRat(150, 1))
+	expectRat(t, "projected total", forecast.ProjectedTotal, big.NewRat(1800, 1))
+	expectRat(t, "daily allowance", forecast.DailyAllowance, big.NewRat(100, 1))
+
+	if len(forecast.UnusualDays) != 1 || forecast.UnusualDays[0].Day != "2023-07-03" {
+		t.Fatalf("expected 2023-07-03 to be unusual, got %+v", forecast.UnusualDays)
+	}
+	if forecast.UnusualDays[0].Ratio != 4.2 {
+		t.Errorf("expected ratio 4.2, got %v", forecast.UnusualDays[0].Ratio)
+	}
+}
+
+func TestForecastBudgetOutOfTrip(t *testing.T) {
+	start := time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2023, 7, 3, 0, 0, 0, 0, time.UTC)
+	spentByDay := map[string]*big.Rat{
+		"2023-06-20": big.NewRat(300, 1),
+	}
+
+	before := ForecastBudget(big.NewRat(200, 1), spentByDay, start, end, start.AddDate(0, 0, -5))
+	if before.ElapsedDays != 0 || before.RemainingDays != 3 {
+		t.Errorf("expected 0 and 3 days before the trip, got %d and %d", before.ElapsedDays, before.RemainingDays)
+	}
+	expectRat(t, "daily average before", before.DailyAverage, new(big.Rat))
+	expectRat(t, "projected total before", before.ProjectedTotal, big.NewRat(300, 1))
+	expectRat(t, "daily allowance over budget", before.DailyAllowance, new(big.Rat))
+
+	after := ForecastBudget(big.NewRat(200, 1), spentByDay, start, end, end.AddDate(0, 0, 1))
+	if after.ElapsedDays != 3 || after.RemainingDays != 0 || after.DailyAllowance != nil {
+		t.Errorf("expected 3 elapsed days and no allowance after the trip, got %+v", after)
+	}
+}
+
+func TestSessionTripDays(t *testing.T) {
+	today := time.Date(2023, 7, 4, 15, 30, 0, 0, time.UTC)
+	startAt := time.Date(2023, 7, 1, 0, 0, 0, 0, time.Local)
+	endAt := time.Date(2023, 7, 10, 0, 0, 0, 0, time.Local)
+	spentByDay := map[string]*big.Rat{"2023-06-28": big.NewRat(1, 1)}
+
+	tests := []struct {
+		name       string
+		session    database.SessionEntity
+		start, end string
+	}{
+		{"scheduled", database.SessionEntity{StartAt: &startAt, EndAt: &endAt}, "2023-07-01", "2023-07-10"},
+		{"from first spending", database.SessionEntity{EndAt: &endAt}, "2023-06-28", "2023-07-10"},
+		{"until today", database.SessionEntity{StartAt: &startAt}, "2023-07-01", "2023-07-04"},
+		{"ended before start", database.SessionEntity{StartAt: &endAt, EndAt: &startAt}, "2023-07-10", "2023-07-10"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start, end := SessionTripDays(&test.session, spentByDay, today)
+			if ToDayString(start) != test.start || ToDayString(end) != test.end {
+				t.Errorf("expected %s to %s, got %s to %s", test.start, test.end, ToDayString(start), ToDayString(end))
+			}
+		})
+	}
+}
+
+func expectRat(t *testing.T, name string, actual *big.Rat, expected *big.Rat) {
+	t.Helper()
+	if actual == nil || actual.Cmp(expected) != 0 {
+		t.Errorf("expected %s %v, got %v", name, expected.RatString(), actual)
+	}
+}
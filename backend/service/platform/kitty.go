@@ -0,0 +1,83 @@
+package platform
+
+import (
+	"database/sql"
+	"sort"
+	"travel-ai/libs/money"
+	"travel-ai/service/database"
+	"travel-ai/service/platform/database_io"
+)
+
+// KittyPayerId is the payer of expenditures paid from the kitty of the session, which is the only payer of them.
+// Kitty payments are shared by contributors in proportion to their contributions in the currency.
+const KittyPayerId = "kitty"
+
+// KittyBalance is what the kitty has in a currency
+type KittyBalance struct {
+	CurrencyCode string
+	Contributed  money.Money
+	Spent        money.Money
+}
+
+// Balance is left in the kitty, which is refunded to contributors on settlement
+func (b KittyBalance) Balance() money.Money {
+	return money.New(b.Contributed.Amount-b.Spent.Amount, b.CurrencyCode)
+}
+
+// SessionKittyBalances returns balances of the kitty in order of currency code.
+// Spending of exceptExpenditureId is left out, which is being edited.
+func SessionKittyBalances(sessionId string, exceptExpenditureId string) ([]KittyBalance, error) {
+	return SessionKittyBalancesTx(nil, sessionId, exceptExpenditureId)
+}
+
+// SessionKittyBalancesTx reads balances in tx, which are kept while tx holds the lock of the session
+func SessionKittyBalancesTx(tx *sql.Tx, sessionId string, exceptExpenditureId string) ([]KittyBalance, error) {
+	contributions, err := database_io.GetKittyContributionsBySessionIdTx(tx, sessionId)
+	if err != nil {
+		return nil, err
+	}
+	spent, err := database_io.GetKittySpentBySessionIdTx(tx, sessionId, KittyPayerId, exceptExpenditureId)
+	if err != nil {
+		return nil, err
+	}
+	return newKittyBalances(contributions, spent), nil
+}
+
+// KittyBalanceOf returns the balance in the currency, which is zero if the kitty has never had it
+func KittyBalanceOf(balances []KittyBalance, currencyCode string) KittyBalance {
+	for _, balance := range balances {
+		if balance.CurrencyCode == currencyCode {
+			return balance
+		}
+	}
+	return KittyBalance{CurrencyCode: currencyCode, Contributed: money.Zero(currencyCode), Spent: money.Zero(currencyCode)}
+}
+
+func newKittyBalances(contributions []database.KittyContributionEntity,
+	spent []database_io.KittySpentEntity) []KittyBalance {
+	balances := make(map[string]*KittyBalance)
+	balanceOf := func(currencyCode string) *KittyBalance {
+		if _, ok := balances[currencyCode]; !ok {
+			balance := KittyBalanceOf(nil, currencyCode)
+			balances[currencyCode] = &balance
+		}
+		return balances[currencyCode]
+	}
+	for _, contribution := range contributions {
+		balance := balanceOf(contribution.CurrencyCode)
+		balance.Contributed.Amount += contribution.Amount
+	}
+	for _, s := range spent {
+		balance := balanceOf(s.CurrencyCode)
+		balance.Spent.Amount += s.Spent
+	}
+
+	result := make([]KittyBalance, 0, len(balances))
+	for _, balance := range balances {
+		result = append(result, *balance)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CurrencyCode < result[j].CurrencyCode
+	})
+	return result
+}
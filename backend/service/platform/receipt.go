@@ -0,0 +1,75 @@
+package platform
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"travel-ai/service/database"
+	"travel-ai/util"
+)
+
+// ReceiptFilePath is where the original image of the receipt is kept in receipt store
+func ReceiptFilePath(receiptId string) string {
+	return filepath.Join(util.GetRootDirectory(), "files", "receipts", receiptId)
+}
+
+// receiptContentTypes are images which can be served inline.
+// The type is sniffed from the file, as the one told by the client may be html or svg of scripts.
+var receiptContentTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+var ErrUnsupportedReceiptType = errors.New("receipt should be a jpeg, png, gif or webp image")
+
+// IsReceiptContentType tells if the type can be served inline
+func IsReceiptContentType(contentType string) bool {
+	return receiptContentTypes[contentType]
+}
+
+// ReceiptContentType sniffs the type of the receipt from the head of its content
+func ReceiptContentType(head []byte) (string, error) {
+	contentType := http.DetectContentType(head)
+	if !IsReceiptContentType(contentType) {
+		return "", ErrUnsupportedReceiptType
+	}
+	return contentType, nil
+}
+
+// ReceiptFileContentType sniffs the type of the receipt file
+func ReceiptFileContentType(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// DetectContentType considers at most 512 bytes
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	return ReceiptContentType(head[:n])
+}
+
+// ReceiptUrl is the asset url of the receipt, which needs authorization
+func ReceiptUrl(receiptId string) string {
+	return fmt.Sprintf("http://%s:%s/asset/receipt?receipt_id=%s", AppServerHost, AppServerPort, receiptId)
+}
+
+// CanAccessReceipt tells if the user uploaded the receipt or is a member of the session it belongs to
+func CanAccessReceipt(uid string, receipt database.ReceiptEntity) (bool, error) {
+	if receipt.UserId == uid {
+		return true, nil
+	}
+	if receipt.SessionId == nil {
+		return false, nil
+	}
+	return IsSessionMember(uid, *receipt.SessionId)
+}
@@ -0,0 +1,36 @@
+package platform
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReceiptContentType(t *testing.T) {
+	tests := []struct {
+		name     string
+		head     string
+		expected string
+	}{
+		{"jpeg", "\xff\xd8\xff\xe0\x00\x10JFIF\x00", "image/jpeg"},
+		{"png", "\x89PNG\x0d\x0a\x1a\x0a\x00\x00\x00\x0dIHDR", "image/png"},
+		{"gif", "GIF89a\x01\x00\x01\x00", "image/gif"},
+		{"webp", "RIFF\x24\x00\x00\x00WEBPVP8 ", "image/webp"},
+	}
+	for _, test := range tests {
+		contentType, err := ReceiptContentType([]byte(test.head))
+		if err != nil || contentType != test.expected {
+			t.Errorf("%s: expected %s, got %q (%v)", test.name, test.expected, contentType, err)
+		}
+	}
+
+	// scripts are not served inline, whatever the client tells
+	for _, head := range []string{
+		"<html><script>alert(1)</script></html>",
+		`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`,
+		"",
+	} {
+		if _, err := ReceiptContentType([]byte(head)); !errors.Is(err, ErrUnsupportedReceiptType) {
+			t.Errorf("%q: expected ErrUnsupportedReceiptType, got %v", head, err)
+		}
+	}
+}
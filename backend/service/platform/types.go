@@ -10,6 +10,38 @@ const (
 	CategoryUnknown   = "unknown"
 )
 
+const (
+	// ExchangeRateModePayment exchanges each amount with the rate of the day when it is paid or sent
+	ExchangeRateModePayment = "payment"
+	// ExchangeRateModeSessionEnd exchanges every amount with the rate of the last day of session
+	ExchangeRateModeSessionEnd = "session_end"
+	// ExchangeRateModeLive exchanges every amount with the latest rate
+	ExchangeRateModeLive = "live"
+)
+
+const (
+	// TransactionStatusDeclared is a payment declared by the debtor, waiting for the creditor
+	TransactionStatusDeclared = "declared"
+	// TransactionStatusConfirmed is a payment confirmed by the creditor, which is the only one to be settled
+	TransactionStatusConfirmed = "confirmed"
+	// TransactionStatusDisputed is a payment which the creditor says is not received
+	TransactionStatusDisputed = "disputed"
+)
+
+const (
+	PaymentMethodCash         = "cash"
+	PaymentMethodBankTransfer = "bank_transfer"
+	PaymentMethodKakaoPay     = "kakao_pay"
+)
+
+const (
+	TransactionAuditCreated   = "created"
+	TransactionAuditDeclared  = "declared"
+	TransactionAuditConfirmed = "confirmed"
+	TransactionAuditDisputed  = "disputed"
+	TransactionAuditVoided    = "voided"
+)
+
 var (
 	ExpenditureCategories = map[string]string{
 		CategoryMeal:      "meal",
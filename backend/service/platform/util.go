@@ -2,7 +2,6 @@ package platform
 
 import (
 	"fmt"
-	"math/big"
 	"math/rand"
 	"os"
 	"regexp"
@@ -11,7 +10,6 @@ import (
 	"travel-ai/log"
 	"travel-ai/service/database"
 	"travel-ai/service/platform/database_io"
-	"travel-ai/third_party/fawazahmed0_currency"
 )
 
 func IsDebugMode() bool {
@@ -65,15 +63,6 @@ func ConvertDateInt64(dateInt64 int64) (time.Time, error) {
 	return date, nil
 }
 
-func Float64ToRat(f float64) *big.Rat {
-	// to string
-	s := fmt.Sprintf("%f", f)
-	// to big.Rat
-	r := new(big.Rat)
-	r.SetString(s)
-	return r
-}
-
 func FindSessionIdByLocationId(locationId string) (string, error) {
 	var sessionId string
 	err := database.DB.QueryRow("SELECT sid FROM locations WHERE lid = ?;", locationId).Scan(&sessionId)
@@ -227,36 +216,10 @@ func IsValidExpenditureCategory(category string) bool {
 	return ok
 }
 
-func GetUpdatedExchangeRate(from string, to string) (float64, error) {
-	ex, err := database_io.GetExchangeRate(from, to)
-	needUpdate := err != nil || ex.UpdatedAt.Unix() < time.Now().Unix()-86400
-	if err != nil {
-		log.Debug(err)
-		log.Debugf("needUpdate: %v", needUpdate)
-	}
-
-	// if rate update is needed (1 day has passed)
-	if needUpdate {
-		rate, err := fawazahmed0_currency.GetExchangeRate(from, to)
-		if err != nil {
-			return 0, err
-		}
-		if err := database_io.UpsertExchangeRate(from, to, rate); err != nil {
-			log.Error(err)
-		}
-		return rate, nil
-	}
-
-	return ex.Rate, nil
+func IsValidExchangeRateMode(mode string) bool {
+	return mode == ExchangeRateModePayment || mode == ExchangeRateModeSessionEnd || mode == ExchangeRateModeLive
 }
 
-func Exchange(from string, to string, amount float64) (float64, error) {
-	if from == to {
-		return amount, nil
-	}
-	rate, err := GetUpdatedExchangeRate(from, to)
-	if err != nil {
-		return 0, err
-	}
-	return rate * amount, nil
+func IsValidPaymentMethod(method string) bool {
+	return method == PaymentMethodCash || method == PaymentMethodBankTransfer || method == PaymentMethodKakaoPay
 }
@@ -0,0 +1,167 @@
+package receipt_ocr
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"travel-ai/service/platform"
+	"travel-ai/third_party/open_ai/text_completion"
+)
+
+const (
+	CategorySourceRule = "rule"
+	CategorySourceLLM  = "llm"
+)
+
+// CategoryClassifier suggests a category of the receipt which keyword rules do not know
+type CategoryClassifier interface {
+	Name() string
+	// Classify answers one of categories, or empty if it is not sure
+	Classify(ctx context.Context, receipt *Receipt, categories []string) (string, error)
+}
+
+// DefaultCategoryClassifier is the fallback of keyword rules, which is nil to use the rules only
+var DefaultCategoryClassifier CategoryClassifier
+
+type CategorySuggestion struct {
+	Category string `json:"category"` // one of platform.SupportedCategories
+	Source   string `json:"source"`   // rule or llm
+}
+
+// categoryKeywords are matched against merchant, items and text without spaces in lower case.
+// Short latin words are avoided, as they are contained in other words (e.g. "inn" of "dinner"),
+// and so are goods sold anywhere (e.g. "치킨" of a mart).
+var categoryKeywords = map[string][]string{
+	platform.CategoryMeal: {
+		"restaurant", "cafe", "coffee", "bakery", "bistro", "burger", "pizza", "starbucks", "mcdonald", "ravintola",
+		"식당", "카페", "커피", "음식", "레스토랑", "베이커리", "국밥", "반점", "분식", "스타벅스", "맥도날드", "호프",
+		"食堂", "レストラン", "カフェ", "コーヒー", "喫茶", "居酒屋", "ラーメン", "寿司", "弁当",
+	},
+	platform.CategoryLodgment: {
+		"hotel", "motel", "hostel", "guesthouse", "resort", "airbnb", "accommodation",
+		"호텔", "모텔", "호스텔", "게스트하우스", "리조트", "펜션", "숙박",
+		"ホテル", "旅館", "民宿", "宿泊",
+	},
+	platform.CategoryTransport: {
+		"taxi", "uber", "railway", "airline", "airport", "parking", "fuel", "gasstation", "metro", "subway", "rentacar",
+		"korail", "ktx", "택시", "주유", "주차", "버스", "지하철", "철도", "코레일", "항공", "고속도로", "통행료", "렌터카",
+		"タクシー", "駐車", "鉄道", "地下鉄", "新幹線", "乗車券", "航空",
+	},
+	platform.CategoryShopping: {
+		"mart", "supermarket", "dutyfree", "outlet", "department", "pharmacy", "7-eleven", "familymart", "lawson", "daiso",
+		"마트", "편의점", "백화점", "면세점", "아울렛", "약국", "올리브영", "다이소", "시장",
+		"スーパー", "コンビニ", "ファミリーマート", "ローソン", "セブン", "百貨店", "ドラッグ", "薬局", "免税",
+	},
+	platform.CategoryActivity: {
+		"museum", "gallery", "ticket", "admission", "aquarium", "cinema", "theater", "themepark", "waterpark",
+		"박물관", "미술관", "입장", "티켓", "투어", "체험", "아쿠아리움", "동물원", "놀이공원", "워터파크", "영화", "온천",
+		"博物館", "美術館", "入場", "チケット", "水族館", "動物園", "温泉", "映画",
+	},
+}
+
+// SuggestCategory suggests a category by keyword rules, or by DefaultCategoryClassifier if no rule matches.
+// It is nil if neither is sure.
+func SuggestCategory(ctx context.Context, receipt *Receipt) (*CategorySuggestion, error) {
+	if category := ruleCategory(receipt); category != "" {
+		return &CategorySuggestion{Category: category, Source: CategorySourceRule}, nil
+	}
+	if DefaultCategoryClassifier == nil {
+		return nil, nil
+	}
+	category, err := DefaultCategoryClassifier.Classify(ctx, receipt, platform.SupportedCategories)
+	if err != nil {
+		return nil, err
+	}
+	for _, supported := range platform.SupportedCategories {
+		if category == supported {
+			return &CategorySuggestion{Category: category, Source: CategorySourceLLM}, nil
+		}
+	}
+	return nil, nil
+}
+
+// ruleCategory scores each category by keywords, where merchant weighs more than items and the whole text.
+// Ties are broken by the order of platform.SupportedCategories, and it is empty if nothing matches.
+func ruleCategory(receipt *Receipt) string {
+	type weightedText struct {
+		text   string
+		weight int
+	}
+	texts := []weightedText{{receipt.Merchant.Value, 3}, {receipt.Text, 1}}
+	for _, item := range receipt.Items {
+		texts = append(texts, weightedText{item.Label, 1})
+	}
+
+	best, bestScore := "", 0
+	for _, category := range platform.SupportedCategories {
+		score := 0
+		for _, text := range texts {
+			if containsAnyKeyword(text.text, categoryKeywords[category]) {
+				score += text.weight
+			}
+		}
+		if score > bestScore {
+			best, bestScore = category, score
+		}
+	}
+	return best
+}
+
+func containsAnyKeyword(text string, keywords []string) bool {
+	normalized := strings.ToLower(strings.Join(strings.Fields(text), ""))
+	if normalized == "" {
+		return false
+	}
+	for _, keyword := range keywords {
+		if strings.Contains(normalized, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+type llmCategoryClassifier struct {
+	name   string
+	client text_completion.LLMClient
+}
+
+// NewOpenAiCategoryClassifier asks the model to choose a category of the merchant and items
+func NewOpenAiCategoryClassifier(model string) CategoryClassifier {
+	config := text_completion.DefaultConfig
+	config.Model = model
+	// the same receipt is answered the same
+	config.Temperature = 0
+	return newLLMCategoryClassifier("open_ai:"+model, text_completion.NewClient(config))
+}
+
+func newLLMCategoryClassifier(name string, client text_completion.LLMClient) CategoryClassifier {
+	return &llmCategoryClassifier{name: name, client: client}
+}
+
+func (c *llmCategoryClassifier) Name() string {
+	return c.name
+}
+
+func (c *llmCategoryClassifier) Classify(ctx context.Context, receipt *Receipt, categories []string) (string, error) {
+	labels := make([]string, 0, len(receipt.Items))
+	for _, item := range receipt.Items {
+		if item.Label != "" {
+			labels = append(labels, item.Label)
+		}
+	}
+	prompt := fmt.Sprintf("Classify a travel expense of the receipt into one of these categories: %s.\n"+
+		"Answer with the category only, or \"unknown\" if you are not sure.\n\nMerchant: %s\nItems: %s",
+		strings.Join(categories, ", "), receipt.Merchant.Value, strings.Join(labels, ", "))
+
+	resp, err := c.client.Complete(ctx, []text_completion.CompletionMessage{{Role: text_completion.ROLE_USER, Content: prompt}})
+	if err != nil {
+		return "", err
+	}
+	answer := strings.ToLower(strings.Trim(strings.TrimSpace(resp), ".\"'"))
+	for _, category := range categories {
+		if answer == category {
+			return category, nil
+		}
+	}
+	return "", nil
+}
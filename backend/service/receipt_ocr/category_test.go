@@ -0,0 +1,151 @@
+package receipt_ocr
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"travel-ai/service/platform"
+	"travel-ai/third_party/open_ai/text_completion"
+)
+
+type fakeCategoryClassifier struct {
+	answer string
+	err    error
+	called bool
+}
+
+func (c *fakeCategoryClassifier) Name() string {
+	return "fake"
+}
+
+func (c *fakeCategoryClassifier) Classify(ctx context.Context, receipt *Receipt, categories []string) (string, error) {
+	c.called = true
+	return c.answer, c.err
+}
+
+func TestSuggestCategoryByRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		receipt  Receipt
+		expected string
+	}{
+		{"merchant", Receipt{Merchant: TextField{Value: "Ravintola Kappeli"}}, platform.CategoryMeal},
+		{"spaced merchant", Receipt{Merchant: TextField{Value: "신라 호텔"}}, platform.CategoryLodgment},
+		{"japanese item", Receipt{Items: []Item{{Label: "タクシー料金"}}}, platform.CategoryTransport},
+		// hotel parking is lodgment, as merchant weighs more
+		{"merchant over items", Receipt{Merchant: TextField{Value: "Grand Hotel"}, Items: []Item{{Label: "Parking"}}},
+			platform.CategoryLodgment},
+		{"unknown", Receipt{Merchant: TextField{Value: "김태준의 탕탕집"}}, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			suggestion, err := SuggestCategory(context.Background(), &test.receipt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.expected == "" {
+				if suggestion != nil {
+					t.Errorf("expected no suggestion, got %+v", suggestion)
+				}
+				return
+			}
+			if suggestion == nil || suggestion.Category != test.expected || suggestion.Source != CategorySourceRule {
+				t.Errorf("expected %s, got %+v", test.expected, suggestion)
+			}
+		})
+	}
+}
+
+func TestSuggestCategoryOfExamples(t *testing.T) {
+	tests := map[string]string{
+		"29":                 platform.CategoryMeal,
+		"SSI_20191213151350": platform.CategoryShopping,
+	}
+	for name, expected := range tests {
+		data, err := os.ReadFile(filepath.Join("testdata/text", name+".txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		receipt := ParseText(string(data)).Receipt()
+		receipt.Text = string(data)
+		if category := ruleCategory(receipt); category != expected {
+			t.Errorf("%s: expected %s, got %q", name, expected, category)
+		}
+	}
+}
+
+func TestSuggestCategoryFallback(t *testing.T) {
+	defer func() { DefaultCategoryClassifier = nil }()
+	receipt := &Receipt{Merchant: TextField{Value: "김태준의 탕탕집"}}
+
+	classifier := &fakeCategoryClassifier{answer: platform.CategoryMeal}
+	DefaultCategoryClassifier = classifier
+	suggestion, err := SuggestCategory(context.Background(), receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if suggestion == nil || suggestion.Category != platform.CategoryMeal || suggestion.Source != CategorySourceLLM {
+		t.Errorf("expected meal by llm, got %+v", suggestion)
+	}
+
+	// rules come first
+	classifier.called = false
+	if _, err := SuggestCategory(context.Background(), &Receipt{Merchant: TextField{Value: "Starbucks"}}); err != nil {
+		t.Fatal(err)
+	}
+	if classifier.called {
+		t.Errorf("expected classifier not to be called")
+	}
+
+	// unsupported answer is not suggested
+	classifier.answer = "souvenir"
+	if suggestion, err := SuggestCategory(context.Background(), receipt); err != nil || suggestion != nil {
+		t.Errorf("expected no suggestion, got %+v (%v)", suggestion, err)
+	}
+
+	classifier.err = errors.New("rate limited")
+	if _, err := SuggestCategory(context.Background(), receipt); err == nil {
+		t.Errorf("expected error of the classifier")
+	}
+}
+
+type fakeLLMClient struct {
+	answer string
+	prompt string
+}
+
+func (c *fakeLLMClient) Complete(ctx context.Context, messages []text_completion.CompletionMessage) (string, error) {
+	c.prompt = messages[len(messages)-1].Content
+	return c.answer, nil
+}
+
+func (c *fakeLLMClient) Stream(ctx context.Context, messages []text_completion.CompletionMessage) (io.ReadCloser, error) {
+	answer, err := c.Complete(ctx, messages)
+	return io.NopCloser(strings.NewReader(answer)), err
+}
+
+func TestLLMCategoryClassifier(t *testing.T) {
+	client := &fakeLLMClient{answer: " Meal.\n"}
+	classifier := newLLMCategoryClassifier("fake", client)
+	receipt := &Receipt{Merchant: TextField{Value: "김태준의 탕탕집"}, Items: []Item{{Label: "탕탕이"}}}
+
+	category, err := classifier.Classify(context.Background(), receipt, platform.SupportedCategories)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if category != platform.CategoryMeal {
+		t.Errorf("expected meal, got %q", category)
+	}
+	if !strings.Contains(client.prompt, "김태준의 탕탕집") || !strings.Contains(client.prompt, "탕탕이") {
+		t.Errorf("prompt does not have merchant and items: %s", client.prompt)
+	}
+
+	client.answer = "unknown"
+	if category, err := classifier.Classify(context.Background(), receipt, platform.SupportedCategories); err != nil || category != "" {
+		t.Errorf("expected no category, got %q (%v)", category, err)
+	}
+}
@@ -0,0 +1,32 @@
+package receipt_ocr
+
+import (
+	"context"
+	"io"
+	"travel-ai/third_party/google_cloud/cloud_vision"
+)
+
+type cloudVisionParser struct{}
+
+// NewCloudVisionParser reads items of the recognized text by ParseText, as cloud vision does not understand receipts
+func NewCloudVisionParser() ReceiptParser {
+	return &cloudVisionParser{}
+}
+
+func (p *cloudVisionParser) Name() string {
+	return "cloud_vision"
+}
+
+func (p *cloudVisionParser) Parse(ctx context.Context, image io.Reader, filename string) (*Receipt, error) {
+	annotations, err := cloud_vision.DetectTexts(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+	if len(annotations) == 0 {
+		return &Receipt{Items: make([]Item, 0)}, nil
+	}
+	text := annotations[0].GetDescription()
+	receipt := ParseText(text).Receipt()
+	receipt.Text = text
+	return receipt, nil
+}
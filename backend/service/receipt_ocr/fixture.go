@@ -0,0 +1,72 @@
+package receipt_ocr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultFixtureName is the fixture given for images which do not have their own
+const DefaultFixtureName = "default"
+
+var ErrFixtureNotFound = errors.New("receipt fixture not found")
+
+type fixtureParser struct {
+	dir      string
+	receipts map[string]Receipt // base name of image without extension
+}
+
+// NewFixtureParser loads receipts of JSON files in dir, without any network access.
+// An image is given the fixture of the same base name (e.g. receipt.json for receipt.jpg),
+// or default.json if it exists.
+func NewFixtureParser(dir string) (ReceiptParser, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	receipts := make(map[string]Receipt)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var receipt Receipt
+		if err := json.Unmarshal(data, &receipt); err != nil {
+			return nil, fmt.Errorf("invalid receipt fixture %s: %w", path, err)
+		}
+		receipts[fixtureName(path)] = receipt
+	}
+	return &fixtureParser{dir: dir, receipts: receipts}, nil
+}
+
+func (p *fixtureParser) Name() string {
+	return "fixture(" + p.dir + ")"
+}
+
+func (p *fixtureParser) Parse(ctx context.Context, image io.Reader, filename string) (*Receipt, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	receipt, ok := p.receipts[fixtureName(filename)]
+	if !ok {
+		receipt, ok = p.receipts[DefaultFixtureName]
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrFixtureNotFound, filename)
+	}
+
+	// items are copied, so that callers can not change the fixture
+	receipt.Items = append(make([]Item, 0, len(receipt.Items)), receipt.Items...)
+	return &receipt, nil
+}
+
+func fixtureName(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
@@ -0,0 +1,44 @@
+package receipt_ocr
+
+import (
+	"fmt"
+	"os"
+	"travel-ai/log"
+)
+
+// DefaultParser is used by platform to parse receipts, which is replaced by Initialize
+var DefaultParser = NewTaggunParser()
+
+// Initialize builds DefaultParser and DefaultCategoryClassifier from environments.
+//
+//	RECEIPT_PARSER: taggun (default), cloud_vision or fixture
+//	RECEIPT_FIXTURE_DIR: directory of receipt JSON files for fixture parser
+//	RECEIPT_CATEGORY_MODEL: open ai model to suggest categories which keyword rules do not know, empty to disable
+func Initialize() error {
+	switch name := os.Getenv("RECEIPT_PARSER"); name {
+	case "", "taggun":
+		DefaultParser = NewTaggunParser()
+	case "cloud_vision":
+		DefaultParser = NewCloudVisionParser()
+	case "fixture":
+		dir := os.Getenv("RECEIPT_FIXTURE_DIR")
+		if dir == "" {
+			return fmt.Errorf("RECEIPT_FIXTURE_DIR is not set for fixture receipt parser")
+		}
+		parser, err := NewFixtureParser(dir)
+		if err != nil {
+			return err
+		}
+		DefaultParser = parser
+	default:
+		return fmt.Errorf("unknown receipt parser: %s", name)
+	}
+	log.Infof("receipt parser: %s", DefaultParser.Name())
+
+	DefaultCategoryClassifier = nil
+	if model := os.Getenv("RECEIPT_CATEGORY_MODEL"); model != "" {
+		DefaultCategoryClassifier = NewOpenAiCategoryClassifier(model)
+		log.Infof("receipt category classifier: %s", DefaultCategoryClassifier.Name())
+	}
+	return nil
+}
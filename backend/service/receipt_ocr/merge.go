@@ -0,0 +1,82 @@
+package receipt_ocr
+
+import (
+	"errors"
+	"travel-ai/libs/money"
+)
+
+// MinConfidence is the confidence which a field needs to be trusted
+const MinConfidence = 0.5
+
+// PaddingItemLabel is the label of the item which fills the gap between items and the total
+const PaddingItemLabel = "unknown"
+
+var ErrNoItem = errors.New("no item found")
+
+// MergedReceipt is the receipt as an itemized expenditure, where amounts are exact in CurrencyCode
+type MergedReceipt struct {
+	CurrencyCode string
+	// CurrencyConfident is true if the currency can be pre-filled
+	CurrencyConfident bool
+	Items             []MergedItem
+	// Tax is pre-filled as a charge, which is nil if it is not confident or already included in prices
+	Tax *money.Money
+}
+
+type MergedItem struct {
+	Label    string
+	Quantity int
+	Price    money.Money
+}
+
+// Merge makes items of the receipt add up to a confident total.
+// Amounts are rounded to minor unit of the detected currency, even if it is not confident.
+// If the total is confident but items (and tax) do not add up to it, an item labelled
+// PaddingItemLabel is added with the difference.
+func Merge(receipt Receipt) (*MergedReceipt, error) {
+	currencyCode := receipt.CurrencyCode.Value
+	merged := &MergedReceipt{
+		CurrencyCode:      currencyCode,
+		CurrencyConfident: receipt.CurrencyCode.Confidence >= MinConfidence && currencyCode != "",
+		Items:             make([]MergedItem, 0, len(receipt.Items)+1),
+	}
+
+	calculatedTotalAmount := money.Zero(currencyCode)
+	for _, item := range receipt.Items {
+		price := money.FromRat(item.Price.Rat(), currencyCode)
+		if item.Label == "" && price.IsZero() {
+			continue
+		}
+		merged.Items = append(merged.Items, MergedItem{
+			Label:    item.Label,
+			Quantity: item.Quantity,
+			Price:    price,
+		})
+		calculatedTotalAmount.Amount += price.Amount
+	}
+
+	totalConfident := receipt.Total.Confidence >= MinConfidence
+	totalAmount := money.FromRat(receipt.Total.Value.Rat(), currencyCode)
+
+	if receipt.Tax.Confidence >= MinConfidence && receipt.Tax.Value.Sign() > 0 {
+		taxAmount := money.FromRat(receipt.Tax.Value.Rat(), currencyCode)
+		// tax which does not fit in the total is already included in prices (e.g. VAT)
+		if !totalConfident || calculatedTotalAmount.Amount+taxAmount.Amount <= totalAmount.Amount {
+			merged.Tax = &taxAmount
+			calculatedTotalAmount.Amount += taxAmount.Amount
+		}
+	}
+
+	if totalConfident && calculatedTotalAmount != totalAmount {
+		merged.Items = append(merged.Items, MergedItem{
+			Label:    PaddingItemLabel,
+			Quantity: 1,
+			Price:    money.New(totalAmount.Amount-calculatedTotalAmount.Amount, currencyCode),
+		})
+	}
+
+	if len(merged.Items) == 0 {
+		return nil, ErrNoItem
+	}
+	return merged, nil
+}
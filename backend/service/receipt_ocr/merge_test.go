@@ -0,0 +1,162 @@
+package receipt_ocr
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"travel-ai/libs/money"
+)
+
+// receiptsDir has sample receipt images, whose fixtures are in testdata/fixtures
+const receiptsDir = "../../../examples/OCR/receipts"
+
+func parseExample(t *testing.T, parser ReceiptParser, name string) *Receipt {
+	t.Helper()
+	f, err := os.Open(filepath.Join(receiptsDir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	receipt, err := parser.Parse(context.Background(), f, name)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return receipt
+}
+
+func sumMergedReceipt(merged *MergedReceipt) int64 {
+	var sum int64
+	for _, item := range merged.Items {
+		sum += item.Price.Amount
+	}
+	if merged.Tax != nil {
+		sum += merged.Tax.Amount
+	}
+	return sum
+}
+
+func TestMergeExamples(t *testing.T) {
+	parser, err := NewFixtureParser("testdata/fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// VAT is included in prices, which must not be charged again
+	receipt := parseExample(t, parser, "다운로드.jfif")
+	merged, err := Merge(*receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.CurrencyCode != "EUR" || !merged.CurrencyConfident {
+		t.Errorf("expected confident EUR, got %q (%v)", merged.CurrencyCode, merged.CurrencyConfident)
+	}
+	if merged.Tax != nil {
+		t.Errorf("included VAT should not be a charge, got %v", merged.Tax)
+	}
+	if len(merged.Items) != 4 {
+		t.Errorf("expected 4 items without padding, got %+v", merged.Items)
+	}
+	if sum := sumMergedReceipt(merged); sum != 2210 {
+		t.Errorf("expected items to add up to 22.10 EUR, got %d", sum)
+	}
+
+	// items above are cut out of the image, which are filled by padding
+	receipt = parseExample(t, parser, "다운로드 (2).jfif")
+	merged, err = Merge(*receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.CurrencyConfident {
+		t.Errorf("currency should not be confident")
+	}
+	if merged.Tax == nil || merged.Tax.Amount != 661627 {
+		t.Errorf("expected tax charge of 6616.27, got %v", merged.Tax)
+	}
+	if len(merged.Items) != 7 {
+		t.Fatalf("expected 6 items and padding, got %+v", merged.Items)
+	}
+	padding := merged.Items[len(merged.Items)-1]
+	if padding.Label != PaddingItemLabel || padding.Price.Amount != 1882599 {
+		t.Errorf("expected padding of 18825.99, got %+v", padding)
+	}
+	if sum := sumMergedReceipt(merged); sum != 4466026 {
+		t.Errorf("expected items and tax to add up to 44660.26, got %d", sum)
+	}
+}
+
+func TestMergeWithoutConfidentTotal(t *testing.T) {
+	receipt := Receipt{
+		CurrencyCode: TextField{Value: "KRW", Confidence: 0.9},
+		Items: []Item{
+			{Label: "americano", Quantity: 2, Price: decimalFromFloat64(9000)},
+			{Label: "", Quantity: 3, Price: money.Decimal{}}, // number without amount
+		},
+		Tax:   AmountField{Value: decimalFromFloat64(900), Confidence: 0.9},
+		Total: AmountField{Value: decimalFromFloat64(12000), Confidence: 0.2},
+	}
+	merged, err := Merge(receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !merged.CurrencyConfident {
+		t.Errorf("currency should be confident by itself, without total")
+	}
+	if len(merged.Items) != 1 || merged.Items[0].Price != money.New(9000, "KRW") {
+		t.Errorf("expected the only item without padding, got %+v", merged.Items)
+	}
+	if merged.Tax == nil || *merged.Tax != money.New(900, "KRW") {
+		t.Errorf("expected tax charge of 900 KRW, got %v", merged.Tax)
+	}
+
+	// a confident total does not make a guessed currency confident
+	receipt.CurrencyCode.Confidence = 0.2
+	receipt.Total.Confidence = 0.9
+	merged, err = Merge(receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.CurrencyConfident {
+		t.Errorf("currency should not be confident with low confidence of its own")
+	}
+
+	if _, err := Merge(Receipt{}); !errors.Is(err, ErrNoItem) {
+		t.Errorf("expected ErrNoItem, got %v", err)
+	}
+}
+
+func TestFixtureParser(t *testing.T) {
+	dir := t.TempDir()
+	parser, err := NewFixtureParser(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parser.Parse(context.Background(), nil, "receipt.jpg"); !errors.Is(err, ErrFixtureNotFound) {
+		t.Errorf("expected ErrFixtureNotFound, got %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, DefaultFixtureName+".json"),
+		[]byte(`{"items": [{"label": "coffee", "quantity": 1, "price": 4.5}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	parser, err = NewFixtureParser(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipt, err := parser.Parse(context.Background(), nil, "receipt.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(receipt.Items) != 1 || receipt.Items[0].Label != "coffee" {
+		t.Errorf("expected default fixture, got %+v", receipt)
+	}
+
+	// changes of callers do not leak into the next parse
+	receipt.Items[0].Label = "changed"
+	receipt, _ = parser.Parse(context.Background(), nil, "other.png")
+	if receipt.Items[0].Label != "coffee" {
+		t.Errorf("fixture is changed by caller: %+v", receipt.Items)
+	}
+}
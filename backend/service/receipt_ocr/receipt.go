@@ -0,0 +1,75 @@
+package receipt_ocr
+
+import (
+	"context"
+	"io"
+	"math/big"
+	"strconv"
+	"time"
+	"travel-ai/libs/money"
+)
+
+// ReceiptParser reads a receipt image and normalizes what the OCR service found.
+// filename is the name of the uploaded image, which some parsers use to identify it.
+type ReceiptParser interface {
+	Name() string
+	Parse(ctx context.Context, image io.Reader, filename string) (*Receipt, error)
+}
+
+// Receipt is a normalized receipt, where each field has its own confidence in [0, 1].
+// Zero confidence means the field is not found.
+type Receipt struct {
+	Merchant        TextField     `json:"merchant"`
+	MerchantAddress TextField     `json:"merchant_address"`
+	Location        LocationField `json:"location"`
+	Date            DateField     `json:"date"`
+	CurrencyCode    TextField     `json:"currency_code"` // ISO 4217
+	Items           []Item        `json:"items"`
+	Tax             AmountField   `json:"tax"`
+	Total           AmountField   `json:"total"`
+	Text            string        `json:"text"` // whole recognized text, if the parser gives
+	// Unparsed are lines of the text which could not be read as items or summary
+	Unparsed []TextLine `json:"unparsed,omitempty"`
+}
+
+type TextField struct {
+	Value      string  `json:"value"`
+	Confidence float64 `json:"confidence"`
+}
+
+type DateField struct {
+	Value      *time.Time `json:"value"`
+	Confidence float64    `json:"confidence"`
+}
+
+// LocationField is where the receipt is paid, where coordinates are nil if not found
+type LocationField struct {
+	CountryCode string   `json:"country_code"` // ISO 3166-1 alpha-2
+	City        string   `json:"city"`
+	Latitude    *float64 `json:"latitude"`
+	Longitude   *float64 `json:"longitude"`
+	Confidence  float64  `json:"confidence"`
+}
+
+// AmountField is an amount in major unit of the receipt currency
+type AmountField struct {
+	Value      money.Decimal `json:"value"`
+	Confidence float64       `json:"confidence"`
+}
+
+// Item is a line of the receipt, where Price is the line total of Quantity
+type Item struct {
+	Label      string        `json:"label"`
+	Quantity   int           `json:"quantity"`
+	Price      money.Decimal `json:"price"`
+	Confidence float64       `json:"confidence"`
+}
+
+// decimalFromFloat64 keeps the shortest decimal representation of f, as OCR services give amounts in float
+func decimalFromFloat64(f float64) money.Decimal {
+	d, err := money.ParseDecimal(strconv.FormatFloat(f, 'f', -1, 64))
+	if err != nil {
+		return money.NewDecimal(new(big.Rat).SetFloat64(f), 2)
+	}
+	return d
+}
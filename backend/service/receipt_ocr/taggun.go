@@ -0,0 +1,144 @@
+package receipt_ocr
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"travel-ai/third_party/taggun_receipt_ocr"
+)
+
+type taggunParser struct{}
+
+func NewTaggunParser() ReceiptParser {
+	return &taggunParser{}
+}
+
+func (p *taggunParser) Name() string {
+	return "taggun"
+}
+
+func (p *taggunParser) Parse(ctx context.Context, image io.Reader, filename string) (*Receipt, error) {
+	resp, err := taggun_receipt_ocr.ParseReceiptContext(ctx, image, filename)
+	if err != nil {
+		return nil, err
+	}
+	return NormalizeTaggunResponse(resp), nil
+}
+
+// NormalizeTaggunResponse makes a receipt of verbose taggun response.
+// Items are read from the text by ParseText if they add up, otherwise amounts and numbers
+// in the same line (index) are merged into an item of the price and quantity.
+func NormalizeTaggunResponse(resp *taggun_receipt_ocr.TaggunReceiptOcrResponse) *Receipt {
+	receipt := &Receipt{
+		CurrencyCode: TextField{
+			Value:      resp.TotalAmount.CurrencyCode,
+			Confidence: resp.TotalAmount.ConfidenceLevel,
+		},
+		Tax: AmountField{
+			Value:      decimalFromFloat64(resp.TaxAmount.Data),
+			Confidence: resp.TaxAmount.ConfidenceLevel,
+		},
+		Total: AmountField{
+			Value:      decimalFromFloat64(resp.TotalAmount.Data),
+			Confidence: resp.TotalAmount.ConfidenceLevel,
+		},
+		Text: resp.Text.Text,
+	}
+	if resp.TotalAmount.CurrencyCode == "" {
+		receipt.CurrencyCode.Confidence = 0
+	}
+	receipt.Merchant.Value, receipt.Merchant.Confidence = taggunText(resp.MerchantName)
+	receipt.MerchantAddress.Value, receipt.MerchantAddress.Confidence = taggunText(resp.MerchantAddress)
+	receipt.Location = taggunLocation(resp)
+	if date, err := time.Parse(time.RFC3339, resp.Date.Data); err == nil {
+		receipt.Date = DateField{Value: &date, Confidence: resp.Date.ConfidenceLevel}
+	}
+
+	textReceipt := ParseText(resp.Text.Text)
+	receipt.Unparsed = textReceipt.Unparsed
+	if textReceipt.Reconciled() {
+		receipt.Items = textReceipt.Receipt().Items
+		return receipt
+	}
+
+	items := make(map[int]*Item)
+	for _, amountRaw := range resp.Amounts {
+		item, ok := items[amountRaw.Index]
+		if !ok {
+			item = &Item{Quantity: 1}
+			items[amountRaw.Index] = item
+		}
+		item.Label = amountRaw.Text
+		item.Price = decimalFromFloat64(amountRaw.Data)
+	}
+	for _, numberRaw := range resp.Numbers {
+		item, ok := items[numberRaw.Index]
+		if !ok {
+			item = &Item{}
+			items[numberRaw.Index] = item
+		}
+		item.Quantity = numberRaw.Data
+	}
+
+	// in the order of lines, as taggun does not give the confidence of each line
+	indices := make([]int, 0, len(items))
+	for index := range items {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+	receipt.Items = make([]Item, 0, len(indices))
+	for _, index := range indices {
+		item := items[index]
+		item.Confidence = resp.ConfidenceLevel
+		receipt.Items = append(receipt.Items, *item)
+	}
+	return receipt
+}
+
+// taggunLocationConfidence is of the location which taggun geolocates by the request,
+// as it is near the merchant only if the receipt is uploaded there
+const taggunLocationConfidence = 0.5
+
+// taggunLocation prefers the country and city read from the merchant, to the geolocated ones
+func taggunLocation(resp *taggun_receipt_ocr.TaggunReceiptOcrResponse) LocationField {
+	location := LocationField{
+		CountryCode: resp.Location.Country.IsoCode,
+		City:        resp.Location.City.Names.En,
+	}
+	if location.CountryCode != "" {
+		location.Confidence = taggunLocationConfidence
+	}
+	if latitude, longitude := resp.Location.Location.Latitude, resp.Location.Location.Longitude; latitude != 0 || longitude != 0 {
+		location.Latitude, location.Longitude = &latitude, &longitude
+		location.Confidence = taggunLocationConfidence
+	}
+
+	if countryCode, confidence := taggunText(resp.MerchantCountryCode); countryCode != "" {
+		countryCode = strings.ToUpper(countryCode)
+		if countryCode != location.CountryCode {
+			// geolocated coordinates are in another country
+			location.City, location.Latitude, location.Longitude = "", nil, nil
+		}
+		location.CountryCode, location.Confidence = countryCode, confidence
+		if city, _ := taggunText(resp.MerchantCity); city != "" {
+			location.City = city
+		}
+	}
+	return location
+}
+
+// taggunText reads fields such as merchantName, which are {"data": ..., "confidenceLevel": ...} if found
+func taggunText(field interface{}) (string, float64) {
+	object, ok := field.(map[string]interface{})
+	if !ok {
+		return "", 0
+	}
+	data, ok := object["data"].(string)
+	if !ok || data == "" {
+		return "", 0
+	}
+	confidence, _ := object["confidenceLevel"].(float64)
+	return data, confidence
+}
@@ -0,0 +1,91 @@
+package receipt_ocr
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+	"travel-ai/third_party/taggun_receipt_ocr"
+)
+
+func TestNormalizeTaggunResponse(t *testing.T) {
+	data, err := os.ReadFile("testdata/taggun/다운로드.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp taggun_receipt_ocr.TaggunReceiptOcrResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	receipt := NormalizeTaggunResponse(&resp)
+	if receipt.CurrencyCode.Value != "EUR" || receipt.CurrencyCode.Confidence != 0.9 {
+		t.Errorf("unexpected currency: %+v", receipt.CurrencyCode)
+	}
+	if receipt.Total.Value.String() != "22.1" || receipt.Tax.Value.String() != "3.68" {
+		t.Errorf("unexpected total %v and tax %v", receipt.Total.Value, receipt.Tax.Value)
+	}
+	if receipt.Merchant.Value != "Ravintola" || receipt.Merchant.Confidence != 0.4 {
+		t.Errorf("unexpected merchant: %+v", receipt.Merchant)
+	}
+	if receipt.Date.Value == nil || !receipt.Date.Value.Equal(time.Date(2016, 7, 10, 17, 8, 0, 0, time.UTC)) {
+		t.Errorf("unexpected date: %+v", receipt.Date)
+	}
+
+	// amounts and numbers are merged by line, in the order of lines
+	expected := []struct {
+		label    string
+		quantity int
+		price    string
+	}{
+		{"", 19131, "0"},
+		{"Cola0.5", 1, "2.8"},
+		{"Krevettisalat", 1, "8.6"},
+		{"Gr kana", 1, "8.9"},
+		{"Friikartul", 1, "1.8"},
+	}
+	if len(receipt.Items) != len(expected) {
+		t.Fatalf("expected %d items, got %+v", len(expected), receipt.Items)
+	}
+	for i, e := range expected {
+		item := receipt.Items[i]
+		if item.Label != e.label || item.Quantity != e.quantity || item.Price.String() != e.price {
+			t.Errorf("item %d: expected %+v, got %+v", i, e, item)
+		}
+	}
+
+	// number without amount is dropped, and included VAT is not charged
+	merged, err := Merge(*receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merged.Items) != 4 || merged.Tax != nil {
+		t.Errorf("unexpected merged receipt: %+v", merged)
+	}
+}
+
+func TestTaggunLocation(t *testing.T) {
+	var resp taggun_receipt_ocr.TaggunReceiptOcrResponse
+	if err := json.Unmarshal([]byte(`{
+		"location": {
+			"city": {"names": {"en": "Seoul"}},
+			"country": {"iso_code": "KR"},
+			"location": {"latitude": 37.5665, "longitude": 126.978}
+		}
+	}`), &resp); err != nil {
+		t.Fatal(err)
+	}
+	location := NormalizeTaggunResponse(&resp).Location
+	if location.CountryCode != "KR" || location.City != "Seoul" || location.Latitude == nil || *location.Latitude != 37.5665 ||
+		location.Confidence != taggunLocationConfidence {
+		t.Errorf("unexpected geolocation: %+v", location)
+	}
+
+	// merchant in another country than the upload
+	resp.MerchantCountryCode = map[string]interface{}{"data": "jp", "confidenceLevel": 0.8}
+	resp.MerchantCity = map[string]interface{}{"data": "Osaka", "confidenceLevel": 0.8}
+	location = NormalizeTaggunResponse(&resp).Location
+	if location.CountryCode != "JP" || location.City != "Osaka" || location.Latitude != nil || location.Confidence != 0.8 {
+		t.Errorf("unexpected merchant location: %+v", location)
+	}
+}
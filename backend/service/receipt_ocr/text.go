@@ -0,0 +1,524 @@
+package receipt_ocr
+
+import (
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"travel-ai/libs/money"
+)
+
+type LineKind string
+
+const (
+	LineItem     LineKind = "item"
+	LineSubtotal LineKind = "subtotal"
+	LineTax      LineKind = "tax"
+	LineTotal    LineKind = "total"
+	LineCharge   LineKind = "charge"  // service charge
+	LinePayment  LineKind = "payment" // cash, card, change, approval
+	LineInfo     LineKind = "info"    // known non-item lines such as points or tax-free amount
+)
+
+// TextReceipt is a receipt reconstructed from OCR text, line by line
+type TextReceipt struct {
+	Items        []TextItem
+	Subtotal     *money.Decimal // first subtotal line
+	Tax          *money.Decimal // sum of tax lines
+	Total        *money.Decimal // last total line
+	CurrencyCode string         // guessed by currency symbols, if any
+	// Date is the first date with time in the same line, in UTC as receipts print the local time without zone
+	Date *time.Time
+	// Unparsed are lines with numbers which are neither items nor known summary lines
+	Unparsed []TextLine
+}
+
+type TextItem struct {
+	Line      int // 1-based line number in the text
+	Label     string
+	Quantity  int
+	UnitPrice *money.Decimal // nil if not printed
+	Price     money.Decimal  // line total
+}
+
+type TextLine struct {
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+// lineKeywords are matched in order against the label without spaces in lower case,
+// since receipts often spread labels (e.g. "합   계").
+var lineKeywords = []struct {
+	keyword string
+	kind    LineKind
+}{
+	{"subtotal", LineSubtotal}, {"sub-total", LineSubtotal},
+	{"小計", LineSubtotal}, {"税抜", LineSubtotal},
+	{"소계", LineSubtotal}, {"공급가", LineSubtotal}, {"과세물품", LineSubtotal},
+
+	{"면세물품", LineInfo}, {"gratuity", LineInfo}, {"포인트", LineInfo}, {"적립", LineInfo}, {"ポイント", LineInfo},
+
+	// tax-inclusive total, before tax
+	{"税込", LineTotal},
+
+	{"tax", LineTax}, {"vat", LineTax}, {"gst", LineTax},
+	{"부가세", LineTax}, {"부가가치세", LineTax}, {"세액", LineTax},
+	{"消費税", LineTax}, {"内税", LineTax}, {"外税", LineTax}, {"税", LineTax},
+
+	{"servicecharge", LineCharge}, {"봉사료", LineCharge}, {"サービス料", LineCharge},
+
+	{"total", LineTotal}, {"amountdue", LineTotal}, {"balancedue", LineTotal},
+	{"합계", LineTotal}, {"총액", LineTotal}, {"결제금액", LineTotal}, {"결제대상금액", LineTotal},
+	{"청구금액", LineTotal}, {"판매금액", LineTotal}, {"받을금액", LineTotal},
+	{"合計", LineTotal}, {"お会計", LineTotal}, {"ご請求", LineTotal},
+
+	{"cash", LinePayment}, {"change", LinePayment}, {"card", LinePayment}, {"visa", LinePayment},
+	{"tendered", LinePayment}, {"paid", LinePayment},
+	{"현금", LinePayment}, {"카드", LinePayment}, {"거스름", LinePayment}, {"받은금액", LinePayment}, {"승인", LinePayment},
+	{"お預", LinePayment}, {"お釣", LinePayment}, {"釣銭", LinePayment}, {"クレジット", LinePayment},
+}
+
+// exactLineKeywords are too short to be contained (e.g. "금액" of "결제금액")
+var exactLineKeywords = map[string]LineKind{
+	"금액": LineSubtotal,
+}
+
+var discountKeywords = []string{"discount", "할인", "割引", "値引"}
+
+var currencySymbols = []struct {
+	symbol       string
+	currencyCode string
+}{
+	{"₩", "KRW"}, {"원", "KRW"}, {"¥", "JPY"}, {"円", "JPY"}, {"€", "EUR"}, {"£", "GBP"}, {"$", "USD"},
+}
+
+var (
+	separatorLinePattern = regexp.MustCompile(`^[-=_*~.·\s]+$`)
+	// 1,234 / 1.234 / 1,234.56 / 1.234,56 / 1234 / 12.5, where a separator followed by 3 digits groups thousands
+	thousandsPattern = regexp.MustCompile(`^(\d{1,3}(?:[,.]\d{3})+)(?:([.,])(\d{1,2}))?$`)
+	plainPattern     = regexp.MustCompile(`^(\d+)(?:([.,])(\d{1,2}))?$`)
+	// 2x, x2, ×2, 2点, 2個, 2コ, 2개
+	quantityPattern = regexp.MustCompile(`^(?:[x×X*](\d{1,3})|(\d{1,3})(?:[x×X点個コ개]))$`)
+	// 1x 2.80, 2 @ 15.00, @ 7.00, 2コ×単600
+	unitLinePattern = regexp.MustCompile(`^(?:(\d{1,3})\s*(?:[x×X@]|[コ個点개]\s*[x×X]?)\s*)?(?:@|単価?)?\s*(\S+)$`)
+	// leading line number such as 01, 03*, 09'
+	indexPattern = regexp.MustCompile(`^\d{1,3}[*'"^.]?$`)
+	// 2018/01/30 12:46:24, [2020-02-14] 15:57:49, 2023年10月01日 12:30, where the year is 4 digits
+	datePattern = regexp.MustCompile(`(\d{4})\s*[-./年]\s*(\d{1,2})\s*[-./月]\s*(\d{1,2})日?(?:\]?\s+(\d{1,2}):(\d{2})(?::(\d{2}))?)?`)
+)
+
+var fullWidthReplacer = strings.NewReplacer(
+	"０", "0", "１", "1", "２", "2", "３", "3", "４", "4", "５", "5", "６", "6", "７", "7", "８", "8", "９", "9",
+	"，", ",", "．", ".", "￥", "¥", "＠", "@", "：", ":", "－", "-", "−", "-", "　", " ",
+)
+
+// ParseText reconstructs line items of OCR text, where an item line ends with its line total.
+// Quantity and unit price are read from the same line (e.g. "피코크 초마짬뽕 8,480 2 16,960"),
+// or from a unit price line right before or after it (e.g. "1x 2.80", "@ 15.00").
+func ParseText(text string) *TextReceipt {
+	receipt := &TextReceipt{Items: make([]TextItem, 0), Unparsed: make([]TextLine, 0)}
+	var pendingUnit *TextLine // unit price line before its item
+	var pendingQuantity int
+	var pendingPrice *money.Decimal
+	totalFound := false // lines after the total are payments or notes, not items
+
+	for i, raw := range strings.Split(text, "\n") {
+		number := i + 1
+		line := strings.TrimSpace(fullWidthReplacer.Replace(raw))
+		if line == "" || separatorLinePattern.MatchString(line) {
+			continue
+		}
+		if receipt.CurrencyCode == "" {
+			receipt.CurrencyCode = detectCurrency(line)
+		}
+		if receipt.Date == nil {
+			receipt.Date = parseDate(line)
+		}
+
+		tokens := amountTokens(line)
+
+		// unit price line, which belongs to the previous item if it matches, or to the next one
+		if quantity, unitPrice, ok := parseUnitLine(line); ok {
+			if n := len(receipt.Items); n > 0 && pendingUnit == nil {
+				item := &receipt.Items[n-1]
+				if item.UnitPrice == nil && multipliesTo(unitPrice, orOne(quantity, item.Quantity), item.Price) {
+					item.UnitPrice = &unitPrice
+					if quantity > 0 {
+						item.Quantity = quantity
+					}
+					continue
+				}
+			}
+			if pendingUnit != nil {
+				receipt.Unparsed = append(receipt.Unparsed, *pendingUnit)
+			}
+			pendingUnit = &TextLine{Line: number, Text: raw}
+			pendingQuantity, pendingPrice = quantity, &unitPrice
+			continue
+		}
+
+		label, amount, ok := splitTrailingAmount(tokens)
+		if !ok {
+			if strings.ContainsAny(line, "0123456789") && !strings.Contains(line, ":") {
+				receipt.Unparsed = append(receipt.Unparsed, TextLine{Line: number, Text: raw})
+			}
+			continue
+		}
+
+		kind := lineKind(strings.Join(label, " "))
+		switch kind {
+		case LineSubtotal:
+			if receipt.Subtotal == nil {
+				receipt.Subtotal = &amount
+			}
+			continue
+		case LineTax:
+			if receipt.Tax == nil {
+				receipt.Tax = &amount
+			} else {
+				sum := money.NewDecimal(new(big.Rat).Add(receipt.Tax.Rat(), amount.Rat()), maxDecimalScale(*receipt.Tax, amount))
+				receipt.Tax = &sum
+			}
+			continue
+		case LineTotal:
+			receipt.Total = &amount
+			totalFound = true
+			continue
+		case LineCharge, LinePayment, LineInfo:
+			continue
+		}
+
+		// "key : value" such as slip numbers
+		if strings.HasSuffix(strings.Join(label, " "), ":") {
+			continue
+		}
+		item, ok := parseItem(number, label, amount)
+		if !ok || totalFound {
+			receipt.Unparsed = append(receipt.Unparsed, TextLine{Line: number, Text: raw})
+			continue
+		}
+		if pendingUnit != nil {
+			quantity := orOne(pendingQuantity, item.Quantity)
+			if item.UnitPrice == nil && multipliesTo(*pendingPrice, quantity, item.Price) {
+				item.UnitPrice = pendingPrice
+				item.Quantity = quantity
+			} else {
+				receipt.Unparsed = append(receipt.Unparsed, *pendingUnit)
+			}
+			pendingUnit = nil
+		}
+		receipt.Items = append(receipt.Items, item)
+	}
+	if pendingUnit != nil {
+		receipt.Unparsed = append(receipt.Unparsed, *pendingUnit)
+	}
+	return receipt
+}
+
+// ItemsTotal is the sum of line totals
+func (r *TextReceipt) ItemsTotal() money.Decimal {
+	sum := new(big.Rat)
+	scale := 0
+	for _, item := range r.Items {
+		sum.Add(sum, item.Price.Rat())
+		if itemScale := decimalScale(item.Price); itemScale > scale {
+			scale = itemScale
+		}
+	}
+	return money.NewDecimal(sum, scale)
+}
+
+// Reconciled is true if items add up to the subtotal, the total or the total without tax
+func (r *TextReceipt) Reconciled() bool {
+	if len(r.Items) == 0 {
+		return false
+	}
+	sum := r.ItemsTotal().Rat()
+	if r.Subtotal != nil && sum.Cmp(r.Subtotal.Rat()) == 0 {
+		return true
+	}
+	if r.Total != nil {
+		if sum.Cmp(r.Total.Rat()) == 0 {
+			return true
+		}
+		if r.Tax != nil && new(big.Rat).Add(sum, r.Tax.Rat()).Cmp(r.Total.Rat()) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Receipt normalizes the text receipt, where items and total are more confident if they add up
+func (r *TextReceipt) Receipt() *Receipt {
+	reconciled := r.Reconciled()
+	receipt := &Receipt{Items: make([]Item, 0, len(r.Items)), Unparsed: r.Unparsed}
+	if r.CurrencyCode != "" {
+		receipt.CurrencyCode = TextField{Value: r.CurrencyCode, Confidence: 0.6}
+	}
+	if r.Date != nil {
+		receipt.Date = DateField{Value: r.Date, Confidence: 0.6}
+	}
+	for _, textItem := range r.Items {
+		confidence := 0.6
+		if textItem.UnitPrice != nil || reconciled {
+			confidence = 0.9
+		}
+		receipt.Items = append(receipt.Items, Item{
+			Label:      textItem.Label,
+			Quantity:   textItem.Quantity,
+			Price:      textItem.Price,
+			Confidence: confidence,
+		})
+	}
+	if r.Tax != nil {
+		receipt.Tax = AmountField{Value: *r.Tax, Confidence: 0.6}
+	}
+	if r.Total != nil {
+		receipt.Total = AmountField{Value: *r.Total, Confidence: 0.6}
+		if reconciled {
+			receipt.Total.Confidence = 0.9
+		}
+	}
+	return receipt
+}
+
+func lineKind(label string) LineKind {
+	compact := strings.ToLower(strings.Join(strings.Fields(label), ""))
+	compact = strings.Trim(compact, ":()[]*")
+	if kind, ok := exactLineKeywords[compact]; ok {
+		return kind
+	}
+	for _, entry := range lineKeywords {
+		if strings.Contains(compact, entry.keyword) {
+			return entry.kind
+		}
+	}
+	return LineItem
+}
+
+// amountTokens splits the line into tokens, where currency symbols standing alone (e.g. "6,818 원") are dropped
+func amountTokens(line string) []string {
+	tokens := make([]string, 0)
+	for _, token := range strings.Fields(line) {
+		if stripCurrency(token) == "" && token != "" {
+			continue
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+// splitTrailingAmount finds the line total at the end of the line
+func splitTrailingAmount(tokens []string) ([]string, money.Decimal, bool) {
+	if len(tokens) == 0 {
+		return nil, money.Decimal{}, false
+	}
+	last := tokens[len(tokens)-1]
+	amount, ok := parseAmount(last)
+	if !ok {
+		// label and amount are stuck together (e.g. "Sub Total:24.48")
+		if index := strings.LastIndex(last, ":"); index >= 0 && index < len(last)-1 {
+			amount, ok = parseAmount(last[index+1:])
+			if ok {
+				return append(tokens[:len(tokens)-1:len(tokens)-1], last[:index+1]), amount, true
+			}
+		}
+		return nil, money.Decimal{}, false
+	}
+	return tokens[:len(tokens)-1], amount, true
+}
+
+// parseItem reads quantity and unit price printed before the line total,
+// as "unit quantity total" (Korean, Japanese) or "quantity total", and a leading quantity or line number.
+func parseItem(number int, label []string, price money.Decimal) (TextItem, bool) {
+	item := TextItem{Line: number, Quantity: 1, Price: price}
+	if discountLabel(label) && price.Sign() > 0 {
+		item.Price = money.NewDecimal(new(big.Rat).Neg(price.Rat()), decimalScale(price))
+	}
+
+	quantityFound := false
+	if n := len(label); n >= 2 {
+		unitPrice, unitOk := parseAmount(label[n-2])
+		quantity, quantityOk := parseQuantity(label[n-1])
+		if unitOk && quantityOk && multipliesTo(unitPrice, quantity, item.Price) {
+			item.UnitPrice, item.Quantity = &unitPrice, quantity
+			label, quantityFound = label[:n-2], true
+		}
+	}
+	if n := len(label); !quantityFound && n >= 1 {
+		if quantity, ok := parseQuantity(label[n-1]); ok && quantity > 0 && quantity < 100 {
+			item.Quantity = quantity
+			label, quantityFound = label[:n-1], true
+		}
+	}
+	if len(label) > 1 && indexPattern.MatchString(label[0]) {
+		if !quantityFound {
+			quantity, _ := strconv.Atoi(strings.TrimRight(label[0], `*'"^.`))
+			if quantity > 0 && quantity < 100 {
+				item.Quantity = quantity
+			}
+		}
+		label = label[1:]
+	}
+
+	item.Label = strings.TrimSpace(strings.TrimLeft(strings.Join(label, " "), "+*-"))
+	if item.Label == "" || !hasLetter(item.Label) {
+		return TextItem{}, false
+	}
+	return item, true
+}
+
+func parseUnitLine(line string) (int, money.Decimal, bool) {
+	if !strings.ContainsAny(line, "@x×X単コ個点개") {
+		return 0, money.Decimal{}, false
+	}
+	match := unitLinePattern.FindStringSubmatch(line)
+	if match == nil || (match[1] == "" && !strings.ContainsAny(line, "@単")) {
+		return 0, money.Decimal{}, false
+	}
+	unitPrice, ok := parseAmount(match[2])
+	if !ok {
+		return 0, money.Decimal{}, false
+	}
+	quantity := 0
+	if match[1] != "" {
+		quantity, _ = strconv.Atoi(match[1])
+	}
+	return quantity, unitPrice, true
+}
+
+func parseQuantity(token string) (int, bool) {
+	if match := quantityPattern.FindStringSubmatch(token); match != nil {
+		quantity, _ := strconv.Atoi(match[1] + match[2])
+		return quantity, true
+	}
+	if len(token) <= 3 && plainPattern.MatchString(token) && !strings.ContainsAny(token, ",.") {
+		quantity, _ := strconv.Atoi(token)
+		return quantity, true
+	}
+	return 0, false
+}
+
+// parseAmount reads an amount with optional sign and currency symbol, such as "-500", "€2.80" or "14,900원"
+func parseAmount(token string) (money.Decimal, bool) {
+	negative := strings.HasPrefix(token, "-")
+	token = stripCurrency(strings.TrimPrefix(token, "-"))
+
+	var integer, fraction string
+	if match := thousandsPattern.FindStringSubmatch(token); match != nil {
+		integer = strings.NewReplacer(",", "", ".", "").Replace(match[1])
+		fraction = match[3]
+	} else if match := plainPattern.FindStringSubmatch(token); match != nil {
+		integer, fraction = match[1], match[3]
+	} else {
+		return money.Decimal{}, false
+	}
+
+	literal := integer
+	if fraction != "" {
+		literal += "." + fraction
+	}
+	if negative {
+		literal = "-" + literal
+	}
+	d, err := money.ParseDecimal(literal)
+	if err != nil {
+		return money.Decimal{}, false
+	}
+	// keep printed fraction digits, such as 60.00
+	return money.NewDecimal(d.Rat(), len(fraction)), true
+}
+
+// parseDate reads the date of the line, which is nil if it is not a valid date
+func parseDate(line string) *time.Time {
+	match := datePattern.FindStringSubmatch(line)
+	if match == nil {
+		return nil
+	}
+	parts := make([]int, 6)
+	for i, part := range match[1:] {
+		if part != "" {
+			parts[i], _ = strconv.Atoi(part)
+		}
+	}
+	year, month, day, hour, minute, second := parts[0], parts[1], parts[2], parts[3], parts[4], parts[5]
+	if hour > 23 || minute > 59 || second > 59 {
+		hour, minute, second = 0, 0, 0
+	}
+	date := time.Date(year, time.Month(month), day, hour, minute, second, 0, time.UTC)
+	// out of range is normalized into another date (e.g. 02/30 into 03/02), and old years are likely serial numbers
+	if date.Month() != time.Month(month) || date.Day() != day || year < 2000 {
+		return nil
+	}
+	return &date
+}
+
+func stripCurrency(token string) string {
+	for _, entry := range currencySymbols {
+		token = strings.TrimPrefix(token, entry.symbol)
+		token = strings.TrimSuffix(token, entry.symbol)
+	}
+	return token
+}
+
+func detectCurrency(line string) string {
+	for _, entry := range currencySymbols {
+		if strings.Contains(line, entry.symbol) {
+			return entry.currencyCode
+		}
+	}
+	return ""
+}
+
+func discountLabel(label []string) bool {
+	compact := strings.ToLower(strings.Join(label, ""))
+	for _, keyword := range discountKeywords {
+		if strings.Contains(compact, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasLetter(s string) bool {
+	for _, r := range s {
+		if r > 127 || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+			return true
+		}
+	}
+	return false
+}
+
+func multipliesTo(unitPrice money.Decimal, quantity int, price money.Decimal) bool {
+	if quantity <= 0 {
+		return false
+	}
+	product := new(big.Rat).Mul(unitPrice.Rat(), big.NewRat(int64(quantity), 1))
+	return product.Cmp(price.Rat()) == 0
+}
+
+func orOne(quantity int, fallback int) int {
+	if quantity > 0 {
+		return quantity
+	}
+	if fallback > 0 {
+		return fallback
+	}
+	return 1
+}
+
+func decimalScale(d money.Decimal) int {
+	s := d.String()
+	if index := strings.IndexByte(s, '.'); index >= 0 {
+		return len(s) - index - 1
+	}
+	return 0
+}
+
+func maxDecimalScale(a money.Decimal, b money.Decimal) int {
+	if decimalScale(a) > decimalScale(b) {
+		return decimalScale(a)
+	}
+	return decimalScale(b)
+}
@@ -0,0 +1,205 @@
+package receipt_ocr
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func decimalString(d interface{ String() string }, ok bool) string {
+	if !ok {
+		return "<nil>"
+	}
+	return d.String()
+}
+
+// testdata/text has OCR text of the sample images in examples/OCR/receipts
+func TestParseTextExamples(t *testing.T) {
+	tests := []struct {
+		name         string
+		items        int
+		itemsTotal   string
+		subtotal     string
+		tax          string
+		total        string
+		currencyCode string
+		reconciled   bool
+		unparsed     []int
+	}{
+		// card slip without items, where "7.500" is OCR of "7,500"
+		{"1517463655748-영수증", 0, "0", "6818", "682", "7500", "KRW", false, []int{21}},
+		// label and price of an item are in different lines
+		{"29", 2, "21.98", "24.48", "1.90", "26.38", "", false, []int{1, 3, 5}},
+		{"images (2)", 3, "13700", "<nil>", "1245", "13700", "", true, []int{11}},
+		// "@ 18.00" of the cut item, and "B1 1 [5.00]" of a set menu
+		{"다운로드 (2)", 6, "19218.00", "<nil>", "6616.27", "44660.26", "", false, []int{1, 5}},
+		// options of zero price, and a note after the total
+		{"제목 없음", 9, "17900", "<nil>", "<nil>", "17900", "KRW", true, []int{18}},
+		// discount lines, and tax-free goods which are not subtotal
+		{"SSI_20191213151350", 26, "137670", "69982", "6998", "137670", "KRW", true, []int{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata/text", test.name+".txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			receipt := ParseText(string(data))
+
+			if len(receipt.Items) != test.items {
+				t.Errorf("expected %d items, got %d: %+v", test.items, len(receipt.Items), receipt.Items)
+			}
+			if s := receipt.ItemsTotal().String(); s != test.itemsTotal {
+				t.Errorf("expected items total %s, got %s", test.itemsTotal, s)
+			}
+			if s := decimalString(receipt.Subtotal, receipt.Subtotal != nil); s != test.subtotal {
+				t.Errorf("expected subtotal %s, got %s", test.subtotal, s)
+			}
+			if s := decimalString(receipt.Tax, receipt.Tax != nil); s != test.tax {
+				t.Errorf("expected tax %s, got %s", test.tax, s)
+			}
+			if s := decimalString(receipt.Total, receipt.Total != nil); s != test.total {
+				t.Errorf("expected total %s, got %s", test.total, s)
+			}
+			if receipt.CurrencyCode != test.currencyCode {
+				t.Errorf("expected currency %q, got %q", test.currencyCode, receipt.CurrencyCode)
+			}
+			if receipt.Reconciled() != test.reconciled {
+				t.Errorf("expected reconciled %v", test.reconciled)
+			}
+			unparsed := make([]int, 0)
+			for _, line := range receipt.Unparsed {
+				unparsed = append(unparsed, line.Line)
+			}
+			if !reflect.DeepEqual(unparsed, test.unparsed) {
+				t.Errorf("expected unparsed lines %v, got %+v", test.unparsed, receipt.Unparsed)
+			}
+		})
+	}
+}
+
+func TestParseTextItemLayouts(t *testing.T) {
+	data, err := os.ReadFile("testdata/text/SSI_20191213151350.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipt := ParseText(string(data))
+	if len(receipt.Items) < 8 {
+		t.Fatalf("expected items, got %+v", receipt.Items)
+	}
+
+	// line number, unit price and quantity of "01 피코크 초마짬뽕 12 8,480 2 16,960"
+	item := receipt.Items[0]
+	if item.Label != "피코크 초마짬뽕 12" || item.Quantity != 2 || item.UnitPrice == nil ||
+		item.UnitPrice.String() != "8480" || item.Price.String() != "16960" {
+		t.Errorf("unexpected item: %+v", item)
+	}
+	if discount := receipt.Items[7]; discount.Label != "@CJ_1만원1천원" || discount.Price.String() != "-500" {
+		t.Errorf("expected discount line, got %+v", discount)
+	}
+
+	// unit price lines after their items
+	data, err = os.ReadFile("testdata/text/다운로드 (2).txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipt = ParseText(string(data))
+	item = receipt.Items[0]
+	if item.Label != "Spiced Chicken" || item.Quantity != 4 || item.UnitPrice == nil || item.UnitPrice.String() != "15.00" {
+		t.Errorf("unexpected item: %+v", item)
+	}
+	item = receipt.Items[5]
+	if item.Label != "Hennessy 1853" || item.Quantity != 1 || item.UnitPrice != nil || item.Price.String() != "19000.00" {
+		t.Errorf("unexpected item: %+v", item)
+	}
+}
+
+func TestParseTextJapanese(t *testing.T) {
+	text := `領収書
+２０２３年１０月０１日 12:30
+ホットコーヒー 2点 ¥800
+サンドイッチ ¥650
+2コ×単300
+おにぎり ¥600
+小計 ¥2,050
+消費税等(8%) ¥164
+合計 ￥２，２１４
+お預り ¥3,000
+お釣り ¥786`
+
+	receipt := ParseText(text)
+	if receipt.CurrencyCode != "JPY" {
+		t.Errorf("expected JPY, got %q", receipt.CurrencyCode)
+	}
+	if len(receipt.Items) != 3 {
+		t.Fatalf("expected 3 items, got %+v", receipt.Items)
+	}
+	if item := receipt.Items[0]; item.Label != "ホットコーヒー" || item.Quantity != 2 || item.Price.String() != "800" {
+		t.Errorf("unexpected item: %+v", item)
+	}
+	// unit price line before its item
+	if item := receipt.Items[2]; item.Label != "おにぎり" || item.Quantity != 2 ||
+		item.UnitPrice == nil || item.UnitPrice.String() != "300" {
+		t.Errorf("unexpected item: %+v", item)
+	}
+	if receipt.Subtotal == nil || receipt.Subtotal.String() != "2050" ||
+		receipt.Tax == nil || receipt.Tax.String() != "164" ||
+		receipt.Total == nil || receipt.Total.String() != "2214" {
+		t.Errorf("unexpected summary: %v, %v, %v", receipt.Subtotal, receipt.Tax, receipt.Total)
+	}
+	if !receipt.Reconciled() || len(receipt.Unparsed) != 0 {
+		t.Errorf("expected reconciled receipt, got unparsed %+v", receipt.Unparsed)
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := map[string]string{
+		"1,234.56": "1234.56",
+		"1.234,56": "1234.56",
+		"7.500":    "7500",
+		"12.5":     "12.5",
+		"60.00":    "60.00",
+		"₩5,000":   "5000",
+		"14,900원":  "14900",
+		"-500":     "-500",
+		"€2.80":    "2.80",
+	}
+	for token, expected := range tests {
+		amount, ok := parseAmount(token)
+		if !ok || amount.String() != expected {
+			t.Errorf("%s: expected %s, got %v (%v)", token, expected, amount, ok)
+		}
+	}
+	for _, token := range []string{"20%", "02-511-3235", "10/07", "[5.00]", "1A79798148"} {
+		if amount, ok := parseAmount(token); ok {
+			t.Errorf("%s: expected not an amount, got %v", token, amount)
+		}
+	}
+}
+
+func TestParseTextDate(t *testing.T) {
+	tests := map[string]string{
+		"거래일시 : 2018/01/30 12:46:24":          "2018-01-30T12:46:24Z",
+		"판매일자: [2020-02-14] 15:57:49 영수:0061": "2020-02-14T15:57:49Z",
+		"２０２３年１０月０１日 12:30":                   "2023-10-01T12:30:00Z",
+		"Date 2019.12.13":                     "2019-12-13T00:00:00Z",
+	}
+	for line, expected := range tests {
+		receipt := ParseText(line)
+		if receipt.Date == nil || receipt.Date.Format(time.RFC3339) != expected {
+			t.Errorf("%s: expected %s, got %v", line, expected, receipt.Date)
+		}
+	}
+	for _, line := range []string{"N617021027/2.05/20170215/0510", "10/07 12:21pTOTAL: 26.38", "2019-02-30", "1234.12.12"} {
+		if receipt := ParseText(line); receipt.Date != nil {
+			t.Errorf("%s: expected no date, got %v", line, receipt.Date)
+		}
+	}
+
+	receipt := ParseText("합계 1,000\n2023-05-01 09:00\n2023-05-02 10:00")
+	if date := receipt.Receipt().Date; date.Value == nil || date.Value.Day() != 1 || date.Confidence == 0 {
+		t.Errorf("expected the first date, got %+v", date)
+	}
+}
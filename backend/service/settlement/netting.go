@@ -0,0 +1,124 @@
+package settlement
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+)
+
+// currencyTransfer is a transfer in its original currency
+type currencyTransfer struct {
+	transfer
+	CurrencyCode string
+	Netted       bool
+}
+
+// netCurrencyTransfers cancels transfers between each pair of users in opposite directions out.
+// Values are compared in the standard currency at settledAt. The direction of less value is cancelled entirely,
+// and transfers of the other direction are reduced by the value in order of currency code.
+func netCurrencyTransfers(transfers []currencyTransfer, currencyCode string, settledAt time.Time,
+	rates *rateCache) ([]currencyTransfer, error) {
+	pairs := make(map[[2]string][]currencyTransfer)
+	keys := make([][2]string, 0)
+	for _, t := range transfers {
+		key := [2]string{t.From, t.To}
+		if key[0] > key[1] {
+			key[0], key[1] = key[1], key[0]
+		}
+		if _, ok := pairs[key]; !ok {
+			keys = append(keys, key)
+		}
+		pairs[key] = append(pairs[key], t)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+
+	netted := make([]currencyTransfer, 0, len(transfers))
+	for _, key := range keys {
+		forward, backward := make([]currencyTransfer, 0), make([]currencyTransfer, 0)
+		for _, t := range pairs[key] {
+			if t.From == key[0] {
+				forward = append(forward, t)
+			} else {
+				backward = append(backward, t)
+			}
+		}
+		if len(forward) == 0 || len(backward) == 0 {
+			netted = append(netted, pairs[key]...)
+			continue
+		}
+
+		forwardValue, err := transfersValue(forward, currencyCode, settledAt, rates)
+		if err != nil {
+			return nil, err
+		}
+		backwardValue, err := transfersValue(backward, currencyCode, settledAt, rates)
+		if err != nil {
+			return nil, err
+		}
+
+		larger, cancelled := forward, backwardValue
+		if forwardValue.Cmp(backwardValue) < 0 {
+			larger, cancelled = backward, forwardValue
+		}
+		reduced, err := reduceTransfers(larger, cancelled, currencyCode, settledAt, rates)
+		if err != nil {
+			return nil, err
+		}
+		netted = append(netted, reduced...)
+	}
+	return netted, nil
+}
+
+func transfersValue(transfers []currencyTransfer, currencyCode string, settledAt time.Time,
+	rates *rateCache) (*big.Rat, error) {
+	value := new(big.Rat)
+	for _, t := range transfers {
+		exchanged, err := rates.convert(t.Amount, t.CurrencyCode, currencyCode, settledAt)
+		if err != nil {
+			return nil, err
+		}
+		value.Add(value, exchanged)
+	}
+	return value, nil
+}
+
+// reduceTransfers takes value (in the standard currency) off transfers, dropping ones which are fully paid
+func reduceTransfers(transfers []currencyTransfer, value *big.Rat, currencyCode string, settledAt time.Time,
+	rates *rateCache) ([]currencyTransfer, error) {
+	sort.SliceStable(transfers, func(i, j int) bool {
+		return transfers[i].CurrencyCode < transfers[j].CurrencyCode
+	})
+
+	remaining := new(big.Rat).Set(value)
+	reduced := make([]currencyTransfer, 0, len(transfers))
+	for _, t := range transfers {
+		if remaining.Sign() == 0 {
+			reduced = append(reduced, t)
+			continue
+		}
+		rate, err := rates.convert(big.NewRat(1, 1), t.CurrencyCode, currencyCode, settledAt)
+		if err != nil {
+			return nil, err
+		}
+		if rate.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid rate from %s to %s: %v", t.CurrencyCode, currencyCode, rate)
+		}
+
+		tValue := new(big.Rat).Mul(t.Amount, rate)
+		if tValue.Cmp(remaining) <= 0 {
+			remaining.Sub(remaining, tValue)
+			continue
+		}
+		t.Amount = new(big.Rat).Sub(t.Amount, new(big.Rat).Quo(remaining, rate))
+		t.Netted = true
+		remaining.SetInt64(0)
+		reduced = append(reduced, t)
+	}
+	return reduced, nil
+}
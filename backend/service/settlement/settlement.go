@@ -0,0 +1,405 @@
+package settlement
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+	"travel-ai/libs/money"
+)
+
+var (
+	ErrNoCurrencyCode      = errors.New("currency code is required")
+	ErrInvalidMode         = errors.New("invalid settlement mode")
+	ErrInvalidCurrencyMode = errors.New("invalid settlement currency mode")
+	ErrKittyNotContributed = errors.New("kitty has no contribution in the currency")
+)
+
+// Calculate builds settlement graph of the session from plain inputs.
+// Every amount is exchanged into input.CurrencyCode and accumulated exactly,
+// and each debt is finally expressed in creditor's default currency, rounded to its minor unit.
+// In CurrencyModePerCurrency, debts are settled in each original currency instead, without any exchange.
+func Calculate(input Input, exchange Exchanger) (*Result, error) {
+	currencyCode := input.CurrencyCode
+	if currencyCode == "" {
+		return nil, ErrNoCurrencyCode
+	}
+	mode := input.Mode
+	if mode == "" {
+		mode = ModeSimplified
+	}
+	if !IsValidMode(mode) {
+		return nil, ErrInvalidMode
+	}
+	currencyMode := input.CurrencyMode
+	if currencyMode == "" {
+		currencyMode = CurrencyModeConverted
+	}
+	if !IsValidCurrencyMode(currencyMode) {
+		return nil, ErrInvalidCurrencyMode
+	}
+
+	result := &Result{
+		CurrencyCode:  currencyCode,
+		Mode:          mode,
+		CurrencyMode:  currencyMode,
+		NetCurrencies: currencyMode == CurrencyModePerCurrency && input.NetCurrencies,
+		UserUsages:    make(map[string]Usage),
+		Balances:      make(map[string]Balance),
+		Debts:         make([]Debt, 0),
+		owes:          make(map[string]map[string]*big.Rat),
+		sessionUsage:  newUsageSum(),
+		userUsages:    make(map[string]*usageSum),
+		kitties:       make(map[string]*kittySum),
+		categories:    input.Categories,
+	}
+	if currencyMode == CurrencyModePerCurrency {
+		result.ledgers = make(map[string]*ledger)
+	}
+	rates := newRateCache(exchange)
+
+	members := make(map[string]string) // uid -> default currency code
+	for _, member := range input.Members {
+		members[member.UserId] = member.DefaultCurrencyCode
+		result.userUsages[member.UserId] = newUsageSum()
+		result.Balances[member.UserId] = newBalance()
+	}
+
+	// accumulate budgets, where budgets of a category or a day are parts of the whole one
+	for _, budget := range input.Budgets {
+		if budget.Partial {
+			continue
+		}
+		exchanged, err := rates.convert(budget.Amount.Rat(), budget.Amount.CurrencyCode, currencyCode, input.SettledAt)
+		if err != nil {
+			return nil, err
+		}
+		result.sessionUsage.totalBudget.Add(result.sessionUsage.totalBudget, exchanged)
+		if usage, ok := result.userUsages[budget.UserId]; ok {
+			usage.totalBudget.Add(usage.totalBudget, exchanged)
+		}
+	}
+
+	// accumulate contributions first, as kitty payments are divided by all of them
+	for _, contribution := range input.KittyContributions {
+		result.kitty(contribution.Amount.CurrencyCode).contribute(contribution.UserId, contribution.Amount.Rat())
+	}
+
+	// accumulate expenditures (ordered, so that the result is reproducible)
+	expenditures := append(input.Expenditures[:0:0], input.Expenditures...)
+	sort.SliceStable(expenditures, func(i, j int) bool {
+		if !expenditures[i].PayedAt.Equal(expenditures[j].PayedAt) {
+			return expenditures[i].PayedAt.Before(expenditures[j].PayedAt)
+		}
+		return expenditures[i].ExpenditureId < expenditures[j].ExpenditureId
+	})
+	for _, exp := range expenditures {
+		if err := result.addExpenditure(exp, input.KittyPayerId, rates); err != nil {
+			return nil, err
+		}
+	}
+
+	// apply transactions to balances
+	if err := result.applyTransactions(input.Transactions, rates); err != nil {
+		return nil, err
+	}
+
+	if result.ledgers != nil {
+		if err := result.settlePerCurrency(input.SettledAt, rates); err != nil {
+			return nil, err
+		}
+	} else if err := result.settleConverted(members, input.SettledAt, rates); err != nil {
+		return nil, err
+	}
+
+	// round usages
+	result.SessionUsage = result.sessionUsage.round(currencyCode, input.Categories)
+	for userId, usage := range result.userUsages {
+		result.UserUsages[userId] = usage.round(currencyCode, input.Categories)
+	}
+
+	// round kitties
+	kittyCurrencyCodes := make([]string, 0, len(result.kitties))
+	for kittyCurrencyCode := range result.kitties {
+		kittyCurrencyCodes = append(kittyCurrencyCodes, kittyCurrencyCode)
+	}
+	sort.Strings(kittyCurrencyCodes)
+	result.Kitty = make([]Kitty, len(kittyCurrencyCodes))
+	for i, kittyCurrencyCode := range kittyCurrencyCodes {
+		result.Kitty[i] = result.kitties[kittyCurrencyCode].round(kittyCurrencyCode)
+	}
+
+	return result, nil
+}
+
+func makeTransfers(mode string, balances map[string]Balance, owes map[string]map[string]*big.Rat) []transfer {
+	switch mode {
+	case ModePairwise:
+		return pairwiseTransfers(owes)
+	default:
+		return simplifiedTransfers(balances)
+	}
+}
+
+// settleConverted settles balances in the standard currency, and expresses each debt in creditor's default currency
+func (r *Result) settleConverted(members map[string]string, settledAt time.Time, rates *rateCache) error {
+	currencyCode := r.CurrencyCode
+	for _, t := range makeTransfers(r.Mode, r.Balances, r.owes) {
+		creditorCurrencyCode, ok := members[t.To]
+		if !ok {
+			return fmt.Errorf("user not found in session: %s", t.To)
+		}
+		exchanged, err := rates.convert(t.Amount, currencyCode, creditorCurrencyCode, settledAt)
+		if err != nil {
+			return err
+		}
+		amount := money.FromRat(exchanged, creditorCurrencyCode)
+		if amount.IsZero() {
+			// less than a minor unit is not worth to transfer
+			continue
+		}
+		r.Debts = append(r.Debts, Debt{From: t.From, To: t.To, Amount: amount})
+	}
+	return nil
+}
+
+// settlePerCurrency settles ledger of each currency independently, then nets them out if asked
+func (r *Result) settlePerCurrency(settledAt time.Time, rates *rateCache) error {
+	currencyCodes := make([]string, 0, len(r.ledgers))
+	for currencyCode := range r.ledgers {
+		currencyCodes = append(currencyCodes, currencyCode)
+	}
+	sort.Strings(currencyCodes)
+
+	transfers := make([]currencyTransfer, 0)
+	for _, currencyCode := range currencyCodes {
+		l := r.ledgers[currencyCode]
+		for _, t := range makeTransfers(r.Mode, l.balances, l.owes) {
+			transfers = append(transfers, currencyTransfer{transfer: t, CurrencyCode: currencyCode})
+		}
+	}
+
+	if r.NetCurrencies {
+		var err error
+		if transfers, err = netCurrencyTransfers(transfers, r.CurrencyCode, settledAt, rates); err != nil {
+			return err
+		}
+	}
+
+	for _, t := range transfers {
+		amount := money.FromRat(t.Amount, t.CurrencyCode)
+		if amount.IsZero() {
+			continue
+		}
+		r.Debts = append(r.Debts, Debt{From: t.From, To: t.To, Amount: amount, Netted: t.Netted})
+	}
+	sort.SliceStable(r.Debts, func(i, j int) bool {
+		if r.Debts[i].From != r.Debts[j].From {
+			return r.Debts[i].From < r.Debts[j].From
+		}
+		if r.Debts[i].To != r.Debts[j].To {
+			return r.Debts[i].To < r.Debts[j].To
+		}
+		return r.Debts[i].Amount.CurrencyCode < r.Debts[j].Amount.CurrencyCode
+	})
+	return nil
+}
+
+// ledger returns ledger of the currency, or nil if ledgers are not kept
+func (r *Result) ledger(currencyCode string) *ledger {
+	if r.ledgers == nil {
+		return nil
+	}
+	if _, ok := r.ledgers[currencyCode]; !ok {
+		r.ledgers[currencyCode] = newLedger()
+	}
+	return r.ledgers[currencyCode]
+}
+
+func (r *Result) addExpenditure(exp Expenditure, kittyPayerId string, rates *rateCache) error {
+	name, category, totalPrice, payedAt := exp.Name, exp.Category, exp.TotalPrice, exp.PayedAt
+	if len(exp.Payers) == 0 {
+		return fmt.Errorf("no payer for %s", name)
+	}
+
+	stdTotalPrice, err := rates.convert(totalPrice.Rat(), totalPrice.CurrencyCode, r.CurrencyCode, payedAt)
+	if err != nil {
+		return err
+	}
+
+	shares, err := r.payerShares(name, totalPrice, exp.Payers, kittyPayerId)
+	if err != nil {
+		return err
+	}
+
+	// add paid amount
+	l := r.ledger(totalPrice.CurrencyCode)
+	for _, share := range shares {
+		balance, ok := r.Balances[share.UserId]
+		if !ok {
+			continue
+		}
+		balance.Paid.Add(balance.Paid, new(big.Rat).Mul(stdTotalPrice, share.Share))
+		if l != nil {
+			paid := l.balance(share.UserId).Paid
+			paid.Add(paid, new(big.Rat).Mul(totalPrice.Rat(), share.Share))
+		}
+	}
+
+	// add used amount
+	for _, dist := range exp.Distributions {
+		if dist.Denominator == 0 {
+			return fmt.Errorf("invalid distribution of %s for %s", name, dist.UserId)
+		}
+		used := big.NewRat(dist.Numerator, dist.Denominator)
+		exchanged, err := rates.convert(used, totalPrice.CurrencyCode, r.CurrencyCode, payedAt)
+		if err != nil {
+			return err
+		}
+
+		balance, ok := r.Balances[dist.UserId]
+		if !ok {
+			continue
+		}
+		balance.Used.Add(balance.Used, exchanged)
+		r.userUsages[dist.UserId].addCategory(category, exchanged)
+
+		// user owes each payer the share
+		for _, share := range shares {
+			if _, ok := r.Balances[share.UserId]; ok {
+				r.addOwe(dist.UserId, share.UserId, new(big.Rat).Mul(exchanged, share.Share))
+				if l != nil {
+					l.addOwe(dist.UserId, share.UserId, new(big.Rat).Mul(used, share.Share))
+				}
+			}
+		}
+		if l != nil {
+			ledgerUsed := l.balance(dist.UserId).Used
+			ledgerUsed.Add(ledgerUsed, used)
+		}
+	}
+	r.sessionUsage.addCategory(category, stdTotalPrice)
+	return nil
+}
+
+// payerShare is the part of a payment which the user paid
+type payerShare struct {
+	UserId string
+	Share  *big.Rat
+}
+
+// payerShares divides the payment equally among payers, where the part of the kitty is spent from the kitty
+// of the currency, and divided among its contributors in proportion to their contributions
+func (r *Result) payerShares(name string, totalPrice money.Money, payers []string, kittyPayerId string) ([]payerShare, error) {
+	share := big.NewRat(1, int64(len(payers)))
+	shares := make([]payerShare, 0, len(payers))
+	for _, payer := range payers {
+		if payer != kittyPayerId {
+			shares = append(shares, payerShare{UserId: payer, Share: share})
+			continue
+		}
+		kitty := r.kitty(totalPrice.CurrencyCode)
+		contributors := kitty.contributors()
+		if len(contributors) == 0 {
+			return nil, fmt.Errorf("%w: %s for %s", ErrKittyNotContributed, totalPrice.CurrencyCode, name)
+		}
+		kitty.spent.Add(kitty.spent, new(big.Rat).Mul(totalPrice.Rat(), share))
+		for _, contributor := range contributors {
+			shares = append(shares, payerShare{UserId: contributor, Share: new(big.Rat).Mul(share, kitty.ratio(contributor))})
+		}
+	}
+	return shares, nil
+}
+
+// kitty returns kitty of the currency, which is made on first use
+func (r *Result) kitty(currencyCode string) *kittySum {
+	if _, ok := r.kitties[currencyCode]; !ok {
+		r.kitties[currencyCode] = newKittySum()
+	}
+	return r.kitties[currencyCode]
+}
+
+func (r *Result) addOwe(from string, to string, amount *big.Rat) {
+	if from == to {
+		return
+	}
+	if _, ok := r.owes[from]; !ok {
+		r.owes[from] = make(map[string]*big.Rat)
+	}
+	if _, ok := r.owes[from][to]; !ok {
+		r.owes[from][to] = new(big.Rat)
+	}
+	r.owes[from][to].Add(r.owes[from][to], amount)
+}
+
+func (r *Result) applyTransactions(transactions []Transaction, rates *rateCache) error {
+	transactions = append(transactions[:0:0], transactions...)
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return transactions[i].SentAt.Before(transactions[j].SentAt)
+	})
+
+	for _, transaction := range transactions {
+		// only payments confirmed by the receiver reduce debts
+		if !transaction.Confirmed {
+			continue
+		}
+		amount := transaction.Amount.Rat()
+		exchanged, err := rates.convert(amount, transaction.Amount.CurrencyCode, r.CurrencyCode, transaction.SentAt)
+		if err != nil {
+			return err
+		}
+		sender, ok := r.Balances[transaction.SenderUid]
+		if !ok {
+			continue
+		}
+		receiver, ok := r.Balances[transaction.ReceiverUid]
+		if !ok {
+			continue
+		}
+		sender.Sent.Add(sender.Sent, exchanged)
+		receiver.Received.Add(receiver.Received, exchanged)
+
+		// paying back means the other way of owing
+		r.addOwe(transaction.ReceiverUid, transaction.SenderUid, exchanged)
+
+		// payment in a currency pays back debts in that currency
+		if l := r.ledger(transaction.Amount.CurrencyCode); l != nil {
+			l.balance(transaction.SenderUid).Sent.Add(l.balance(transaction.SenderUid).Sent, amount)
+			l.balance(transaction.ReceiverUid).Received.Add(l.balance(transaction.ReceiverUid).Received, amount)
+			l.addOwe(transaction.ReceiverUid, transaction.SenderUid, amount)
+		}
+	}
+	return nil
+}
+
+// rateCache asks exchanger once for each pair of currencies and day
+type rateCache struct {
+	exchange Exchanger
+	rates    map[[3]string]*big.Rat
+}
+
+func newRateCache(exchange Exchanger) *rateCache {
+	return &rateCache{exchange: exchange, rates: make(map[[3]string]*big.Rat)}
+}
+
+func (c *rateCache) convert(amount *big.Rat, from string, to string, at time.Time) (*big.Rat, error) {
+	if from == to {
+		return new(big.Rat).Set(amount), nil
+	}
+	day := ""
+	if !at.IsZero() {
+		day = at.UTC().Format("2006-01-02")
+	}
+	key := [3]string{from, to, day}
+	rate, ok := c.rates[key]
+	if !ok {
+		var err error
+		rate, err = c.exchange(from, to, at)
+		if err != nil {
+			return nil, err
+		}
+		c.rates[key] = rate
+	}
+	return new(big.Rat).Mul(amount, rate), nil
+}
@@ -0,0 +1,628 @@
+package settlement
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+	"travel-ai/libs/money"
+)
+
+const (
+	testCategory     = "meal"
+	testKittyPayerId = "kitty"
+)
+
+// units per 1 USD
+var testRates = map[string]int64{
+	"USD": 1,
+	"KRW": 1000,
+	"JPY": 100,
+}
+
+func testExchange(from string, to string, at time.Time) (*big.Rat, error) {
+	return big.NewRat(testRates[to], testRates[from]), nil
+}
+
+func testMembers(currencyCodes map[string]string) []Member {
+	members := make([]Member, 0)
+	for uid, currencyCode := range currencyCodes {
+		members = append(members, Member{UserId: uid, DefaultCurrencyCode: currencyCode})
+	}
+	return members
+}
+
+// testExpenditure makes an expenditure whose total price and distributions are in major unit
+func testExpenditure(id string, currencyCode string, totalPrice int64, payers []string, dists map[string]int64) Expenditure {
+	distributions := make([]Distribution, 0)
+	for uid, amount := range dists {
+		distributions = append(distributions, Distribution{UserId: uid, Numerator: amount, Denominator: 1})
+	}
+	return Expenditure{
+		ExpenditureId: id,
+		Name:          id,
+		Category:      testCategory,
+		TotalPrice:    money.FromRat(big.NewRat(totalPrice, 1), currencyCode),
+		PayedAt:       time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC),
+		Payers:        payers,
+		Distributions: distributions,
+	}
+}
+
+// testTransaction makes a confirmed transaction whose amount is in minor unit
+func testTransaction(from string, to string, currencyCode string, amount int64) Transaction {
+	return Transaction{
+		SenderUid:   from,
+		ReceiverUid: to,
+		Amount:      money.New(amount, currencyCode),
+		SentAt:      time.Date(2023, 7, 2, 12, 0, 0, 0, time.UTC),
+		Confirmed:   true,
+	}
+}
+
+// testUnsettledTransaction makes a transaction which should not be settled
+func testUnsettledTransaction(from string, to string, currencyCode string, amount int64) Transaction {
+	transaction := testTransaction(from, to, currencyCode, amount)
+	transaction.Confirmed = false
+	return transaction
+}
+
+func equalDebts(a []Debt, b []Debt) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCalculate(t *testing.T) {
+	krwMembers := map[string]string{"a": "KRW", "b": "KRW", "c": "KRW", "d": "KRW"}
+
+	tests := []struct {
+		name         string
+		mode         string
+		members      map[string]string
+		expenditures []Expenditure
+		transactions []Transaction
+		want         []Debt
+	}{
+		{
+			name:    "single payer equal split",
+			members: krwMembers,
+			expenditures: []Expenditure{
+				testExpenditure("e1", "KRW", 300, []string{"a"}, map[string]int64{"a": 100, "b": 100, "c": 100}),
+			},
+			want: []Debt{
+				{From: "b", To: "a", Amount: money.New(100, "KRW")},
+				{From: "c", To: "a", Amount: money.New(100, "KRW")},
+			},
+		},
+		{
+			name:    "multi payer",
+			members: krwMembers,
+			expenditures: []Expenditure{
+				testExpenditure("e1", "KRW", 400, []string{"a", "b"}, map[string]int64{"a": 100, "b": 100, "c": 100, "d": 100}),
+			},
+			want: []Debt{
+				{From: "c", To: "a", Amount: money.New(100, "KRW")},
+				{From: "d", To: "b", Amount: money.New(100, "KRW")},
+			},
+		},
+		{
+			name:    "multi currency in creditor's currency",
+			members: map[string]string{"a": "KRW", "b": "USD"},
+			expenditures: []Expenditure{
+				testExpenditure("e1", "JPY", 1000, []string{"a"}, map[string]int64{"a": 500, "b": 500}),
+				testExpenditure("e2", "KRW", 20000, []string{"b"}, map[string]int64{"a": 10000, "b": 10000}),
+			},
+			want: []Debt{
+				{From: "a", To: "b", Amount: money.New(500, "USD")},
+			},
+		},
+		{
+			name:    "multi payer pairwise",
+			mode:    ModePairwise,
+			members: krwMembers,
+			expenditures: []Expenditure{
+				testExpenditure("e1", "KRW", 400, []string{"a", "b"}, map[string]int64{"a": 100, "b": 100, "c": 100, "d": 100}),
+			},
+			want: []Debt{
+				{From: "c", To: "a", Amount: money.New(50, "KRW")},
+				{From: "c", To: "b", Amount: money.New(50, "KRW")},
+				{From: "d", To: "a", Amount: money.New(50, "KRW")},
+				{From: "d", To: "b", Amount: money.New(50, "KRW")},
+			},
+		},
+		{
+			name:    "pairwise nets opposite debts",
+			mode:    ModePairwise,
+			members: krwMembers,
+			expenditures: []Expenditure{
+				testExpenditure("e1", "KRW", 300, []string{"a"}, map[string]int64{"a": 100, "b": 200}),
+				testExpenditure("e2", "KRW", 150, []string{"b"}, map[string]int64{"a": 50, "b": 50, "c": 50}),
+			},
+			want: []Debt{
+				{From: "b", To: "a", Amount: money.New(150, "KRW")},
+				{From: "c", To: "b", Amount: money.New(50, "KRW")},
+			},
+		},
+		{
+			name:    "simplified skips middleman",
+			mode:    ModeSimplified,
+			members: krwMembers,
+			expenditures: []Expenditure{
+				testExpenditure("e1", "KRW", 300, []string{"a"}, map[string]int64{"b": 300}),
+				testExpenditure("e2", "KRW", 300, []string{"b"}, map[string]int64{"c": 300}),
+			},
+			want: []Debt{
+				{From: "c", To: "a", Amount: money.New(300, "KRW")},
+			},
+		},
+		{
+			name:    "partially repaid",
+			members: krwMembers,
+			expenditures: []Expenditure{
+				testExpenditure("e1", "KRW", 300, []string{"a"}, map[string]int64{"a": 100, "b": 100, "c": 100}),
+			},
+			transactions: []Transaction{
+				testTransaction("b", "a", "KRW", 40),
+			},
+			want: []Debt{
+				{From: "b", To: "a", Amount: money.New(60, "KRW")},
+				{From: "c", To: "a", Amount: money.New(100, "KRW")},
+			},
+		},
+		{
+			name:    "partially repaid in other currency",
+			members: map[string]string{"a": "USD", "b": "KRW"},
+			expenditures: []Expenditure{
+				testExpenditure("e1", "USD", 100, []string{"a"}, map[string]int64{"a": 50, "b": 50}),
+			},
+			transactions: []Transaction{
+				testTransaction("b", "a", "KRW", 20000),
+			},
+			want: []Debt{
+				{From: "b", To: "a", Amount: money.New(3000, "USD")},
+			},
+		},
+		{
+			name:    "partially repaid pairwise",
+			mode:    ModePairwise,
+			members: krwMembers,
+			expenditures: []Expenditure{
+				testExpenditure("e1", "KRW", 300, []string{"a"}, map[string]int64{"a": 100, "b": 100, "c": 100}),
+			},
+			transactions: []Transaction{
+				testTransaction("b", "a", "KRW", 40),
+			},
+			want: []Debt{
+				{From: "b", To: "a", Amount: money.New(60, "KRW")},
+				{From: "c", To: "a", Amount: money.New(100, "KRW")},
+			},
+		},
+		{
+			name:    "over repaid turns around",
+			members: krwMembers,
+			expenditures: []Expenditure{
+				testExpenditure("e1", "KRW", 200, []string{"a"}, map[string]int64{"a": 100, "b": 100}),
+			},
+			transactions: []Transaction{
+				testTransaction("b", "a", "KRW", 120),
+			},
+			want: []Debt{
+				{From: "a", To: "b", Amount: money.New(20, "KRW")},
+			},
+		},
+		{
+			name:    "fully repaid",
+			members: krwMembers,
+			expenditures: []Expenditure{
+				testExpenditure("e1", "KRW", 200, []string{"a"}, map[string]int64{"a": 100, "b": 100}),
+			},
+			transactions: []Transaction{
+				testTransaction("b", "a", "KRW", 60),
+				testTransaction("b", "a", "KRW", 40),
+			},
+			want: []Debt{},
+		},
+		{
+			name:    "only confirmed payments are settled",
+			members: krwMembers,
+			expenditures: []Expenditure{
+				testExpenditure("e1", "KRW", 200, []string{"a"}, map[string]int64{"a": 100, "b": 100}),
+			},
+			transactions: []Transaction{
+				testTransaction("b", "a", "KRW", 30),
+				testUnsettledTransaction("b", "a", "KRW", 20),
+				testUnsettledTransaction("b", "a", "KRW", 20),
+			},
+			want: []Debt{
+				{From: "b", To: "a", Amount: money.New(70, "KRW")},
+			},
+		},
+		{
+			name:    "no expenditures",
+			members: krwMembers,
+			want:    []Debt{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Calculate(Input{
+				CurrencyCode: "KRW",
+				Mode:         tt.mode,
+				Members:      testMembers(tt.members),
+				Expenditures: tt.expenditures,
+				Transactions: tt.transactions,
+			}, testExchange)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalDebts(result.Debts, tt.want) {
+				t.Errorf("debts = %v, want %v", result.Debts, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalculateUsage(t *testing.T) {
+	result, err := Calculate(Input{
+		CurrencyCode: "KRW",
+		Categories:   []string{testCategory, "etc"},
+		Members:      testMembers(map[string]string{"a": "KRW", "b": "KRW"}),
+		Expenditures: []Expenditure{
+			testExpenditure("e1", "USD", 10, []string{"a"}, map[string]int64{"a": 4, "b": 6}),
+		},
+		Budgets: []Budget{
+			{UserId: "a", Amount: money.New(50000, "KRW")},
+			{UserId: "b", Amount: money.New(10000, "USD")},
+			// part of b's budget, which is not counted again
+			{UserId: "b", Amount: money.New(3000, "USD"), Partial: true},
+		},
+	}, testExchange)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := result.SessionUsage.ByCategory[testCategory]; got != money.New(10000, "KRW") {
+		t.Errorf("session meal usage = %v, want 10000", got)
+	}
+	if got := result.SessionUsage.TotalBudget; got != money.New(150000, "KRW") {
+		t.Errorf("session total budget = %v, want 150000", got)
+	}
+	if got := result.UsageOf("a").ByCategory[testCategory]; got != money.New(4000, "KRW") {
+		t.Errorf("a's meal usage = %v, want 4000", got)
+	}
+	if got, ok := result.UsageOf("a").ByCategory["etc"]; !ok || got != money.Zero("KRW") {
+		t.Errorf("a's etc usage = %v, want zero", got)
+	}
+	if got := result.UsageOf("b").TotalBudget; got != money.New(100000, "KRW") {
+		t.Errorf("b's total budget = %v, want 100000", got)
+	}
+	if got := result.DebtsOf("b"); !equalDebts(got, []Debt{{From: "b", To: "a", Amount: money.New(6000, "KRW")}}) {
+		t.Errorf("b's debts = %v", got)
+	}
+}
+
+func TestCalculateRounding(t *testing.T) {
+	// 10 USD split by three is exchanged back and forth without losing precision
+	exp := testExpenditure("e1", "USD", 10, []string{"a"}, nil)
+	for _, uid := range []string{"a", "b", "c"} {
+		exp.Distributions = append(exp.Distributions, Distribution{UserId: uid, Numerator: 10, Denominator: 3})
+	}
+
+	result, err := Calculate(Input{
+		CurrencyCode: "KRW",
+		Members:      testMembers(map[string]string{"a": "USD", "b": "KRW", "c": "JPY"}),
+		Expenditures: []Expenditure{exp},
+	}, testExchange)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Debt{
+		{From: "b", To: "a", Amount: money.New(333, "USD")},
+		{From: "c", To: "a", Amount: money.New(333, "USD")},
+	}
+	if !equalDebts(result.Debts, want) {
+		t.Errorf("debts = %v, want %v", result.Debts, want)
+	}
+	if got := result.UsageOf("b").ByCategory[testCategory]; got != money.New(3333, "KRW") {
+		t.Errorf("b's meal usage = %v, want 3333 KRW", got)
+	}
+}
+
+func TestCalculateHistoricalRates(t *testing.T) {
+	day1 := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+	day2 := time.Date(2023, 7, 2, 12, 0, 0, 0, time.UTC)
+	settledAt := time.Date(2023, 7, 10, 0, 0, 0, 0, time.UTC)
+
+	// KRW per 1 USD changes day by day
+	krwPerUsd := map[time.Time]int64{day1: 1000, day2: 1200, settledAt: 1300}
+	exchange := func(from string, to string, at time.Time) (*big.Rat, error) {
+		rate, ok := krwPerUsd[at]
+		if !ok {
+			t.Fatalf("unexpected time to exchange: %v", at)
+		}
+		if from == "USD" {
+			return big.NewRat(rate, 1), nil
+		}
+		return big.NewRat(1, rate), nil
+	}
+
+	exp := testExpenditure("e1", "USD", 100, []string{"a"}, map[string]int64{"a": 50, "b": 50})
+	exp.PayedAt = day1
+	transaction := testTransaction("b", "a", "USD", 2000)
+	transaction.SentAt = day2
+
+	result, err := Calculate(Input{
+		CurrencyCode: "KRW",
+		SettledAt:    settledAt,
+		Members:      testMembers(map[string]string{"a": "KRW", "b": "KRW", "c": "USD"}),
+		Expenditures: []Expenditure{exp},
+		Budgets:      []Budget{{UserId: "c", Amount: money.New(10000, "USD")}},
+		Transactions: []Transaction{transaction},
+	}, exchange)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 50 USD used on day 1 (50000 KRW) - 20 USD sent on day 2 (24000 KRW)
+	want := []Debt{{From: "b", To: "a", Amount: money.New(26000, "KRW")}}
+	if !equalDebts(result.Debts, want) {
+		t.Errorf("debts = %v, want %v", result.Debts, want)
+	}
+	if got := result.UsageOf("c").TotalBudget; got != money.New(130000, "KRW") {
+		t.Errorf("c's total budget = %v, want 130000 KRW", got)
+	}
+}
+
+func TestCalculatePerCurrency(t *testing.T) {
+	members := map[string]string{"a": "KRW", "b": "KRW", "c": "USD"}
+	tests := []struct {
+		name          string
+		mode          string
+		netCurrencies bool
+		expenditures  []Expenditure
+		transactions  []Transaction
+		want          []Debt
+	}{
+		{
+			name: "each currency settled independently",
+			expenditures: []Expenditure{
+				testExpenditure("e1", "JPY", 300, []string{"a"}, map[string]int64{"a": 100, "b": 100, "c": 100}),
+				testExpenditure("e2", "KRW", 3000, []string{"b"}, map[string]int64{"a": 1000, "b": 1000, "c": 1000}),
+			},
+			want: []Debt{
+				{From: "a", To: "b", Amount: money.New(1000, "KRW")},
+				{From: "b", To: "a", Amount: money.New(100, "JPY")},
+				{From: "c", To: "a", Amount: money.New(100, "JPY")},
+				{From: "c", To: "b", Amount: money.New(1000, "KRW")},
+			},
+		},
+		{
+			name:          "netted out of the same value",
+			netCurrencies: true,
+			expenditures: []Expenditure{
+				testExpenditure("e1", "JPY", 300, []string{"a"}, map[string]int64{"a": 100, "b": 100, "c": 100}),
+				testExpenditure("e2", "KRW", 3000, []string{"b"}, map[string]int64{"a": 1000, "b": 1000, "c": 1000}),
+			},
+			want: []Debt{
+				{From: "c", To: "a", Amount: money.New(100, "JPY")},
+				{From: "c", To: "b", Amount: money.New(1000, "KRW")},
+			},
+		},
+		{
+			name:          "partially netted",
+			mode:          ModePairwise,
+			netCurrencies: true,
+			expenditures: []Expenditure{
+				testExpenditure("e1", "JPY", 300, []string{"a"}, map[string]int64{"a": 100, "b": 100, "c": 100}),
+				testExpenditure("e2", "KRW", 6000, []string{"b"}, map[string]int64{"a": 2000, "b": 2000, "c": 2000}),
+			},
+			want: []Debt{
+				{From: "a", To: "b", Amount: money.New(1000, "KRW"), Netted: true},
+				{From: "c", To: "a", Amount: money.New(100, "JPY")},
+				{From: "c", To: "b", Amount: money.New(2000, "KRW")},
+			},
+		},
+		{
+			name: "payment settles debts in its currency",
+			expenditures: []Expenditure{
+				testExpenditure("e1", "JPY", 200, []string{"a"}, map[string]int64{"a": 100, "b": 100}),
+				testExpenditure("e2", "KRW", 2000, []string{"a"}, map[string]int64{"a": 1000, "b": 1000}),
+			},
+			transactions: []Transaction{
+				testTransaction("b", "a", "JPY", 60),
+			},
+			want: []Debt{
+				{From: "b", To: "a", Amount: money.New(40, "JPY")},
+				{From: "b", To: "a", Amount: money.New(1000, "KRW")},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Calculate(Input{
+				CurrencyCode:  "KRW",
+				Mode:          tt.mode,
+				CurrencyMode:  CurrencyModePerCurrency,
+				NetCurrencies: tt.netCurrencies,
+				Members:       testMembers(members),
+				Expenditures:  tt.expenditures,
+				Transactions:  tt.transactions,
+			}, testExchange)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalDebts(result.Debts, tt.want) {
+				t.Errorf("debts = %v, want %v", result.Debts, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalculateDeterministic(t *testing.T) {
+	members := map[string]string{"a": "KRW", "b": "KRW", "c": "KRW", "d": "KRW", "e": "KRW"}
+	expenditures := []Expenditure{
+		testExpenditure("e1", "KRW", 500, []string{"a"}, map[string]int64{"a": 100, "b": 100, "c": 100, "d": 100, "e": 100}),
+		testExpenditure("e2", "KRW", 300, []string{"b"}, map[string]int64{"c": 100, "d": 100, "e": 100}),
+		testExpenditure("e3", "KRW", 200, []string{"c", "d"}, map[string]int64{"a": 100, "e": 100}),
+	}
+
+	for _, mode := range []string{ModePairwise, ModeSimplified} {
+		assertDeterministic(t, mode, members, expenditures)
+	}
+}
+
+func assertDeterministic(t *testing.T, mode string, members map[string]string, expenditures []Expenditure) {
+	var first []Debt
+	for i := 0; i < 20; i++ {
+		// reverse input order each time
+		reversed := make([]Expenditure, len(expenditures))
+		for j := range expenditures {
+			reversed[len(expenditures)-1-j] = expenditures[j]
+		}
+		expenditures = reversed
+
+		result, err := Calculate(Input{
+			CurrencyCode: "KRW",
+			Mode:         mode,
+			Members:      testMembers(members),
+			Expenditures: expenditures,
+		}, testExchange)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first == nil {
+			first = result.Debts
+			continue
+		}
+		if !reflect.DeepEqual(first, result.Debts) {
+			t.Fatalf("[%s] result changed between calls: %v != %v", mode, first, result.Debts)
+		}
+	}
+}
+
+func TestCalculateErrors(t *testing.T) {
+	members := testMembers(map[string]string{"a": "KRW"})
+
+	if _, err := Calculate(Input{Members: members}, testExchange); err != ErrNoCurrencyCode {
+		t.Errorf("err = %v, want %v", err, ErrNoCurrencyCode)
+	}
+
+	_, err := Calculate(Input{
+		CurrencyCode: "KRW",
+		Members:      members,
+		Expenditures: []Expenditure{
+			testExpenditure("e1", "KRW", 100, nil, map[string]int64{"a": 100}),
+		},
+	}, testExchange)
+	if err == nil {
+		t.Error("expected error for expenditure without payer")
+	}
+
+	if _, err := Calculate(Input{CurrencyCode: "KRW", Mode: "unknown", Members: members}, testExchange); err != ErrInvalidMode {
+		t.Errorf("err = %v, want %v", err, ErrInvalidMode)
+	}
+
+	if _, err := Calculate(Input{CurrencyCode: "KRW", CurrencyMode: "unknown", Members: members}, testExchange); err != ErrInvalidCurrencyMode {
+		t.Errorf("err = %v, want %v", err, ErrInvalidCurrencyMode)
+	}
+}
+
+func TestCalculateKitty(t *testing.T) {
+	members := map[string]string{"a": "KRW", "b": "KRW", "c": "KRW"}
+	contributions := []KittyContribution{
+		{UserId: "a", Amount: money.New(40000, "KRW")},
+		{UserId: "b", Amount: money.New(30000, "KRW")},
+		{UserId: "c", Amount: money.New(30000, "KRW")},
+		{UserId: "a", Amount: money.New(20000, "KRW")},
+	}
+	result, err := Calculate(Input{
+		CurrencyCode: "KRW",
+		Members:      testMembers(members),
+		KittyPayerId: testKittyPayerId,
+		Expenditures: []Expenditure{
+			testExpenditure("e1", "KRW", 90000, []string{testKittyPayerId},
+				map[string]int64{"a": 30000, "b": 30000, "c": 30000}),
+		},
+		KittyContributions: contributions,
+	}, testExchange)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a paid half of the dinner by contributing half of the kitty
+	wantDebts := []Debt{
+		{From: "b", To: "a", Amount: money.New(7500, "KRW")},
+		{From: "c", To: "a", Amount: money.New(7500, "KRW")},
+	}
+	if !equalDebts(result.Debts, wantDebts) {
+		t.Errorf("debts = %v, want %v", result.Debts, wantDebts)
+	}
+	wantKitty := []Kitty{{
+		CurrencyCode: "KRW",
+		Contributed:  money.New(120000, "KRW"),
+		Spent:        money.New(90000, "KRW"),
+		Balance:      money.New(30000, "KRW"),
+		Refunds: []KittyRefund{
+			{UserId: "a", Amount: money.New(15000, "KRW")},
+			{UserId: "b", Amount: money.New(7500, "KRW")},
+			{UserId: "c", Amount: money.New(7500, "KRW")},
+		},
+	}}
+	if !reflect.DeepEqual(result.Kitty, wantKitty) {
+		t.Errorf("kitty = %v, want %v", result.Kitty, wantKitty)
+	}
+	if got := result.SessionUsage.ByCategory[testCategory]; got != money.New(90000, "KRW") {
+		t.Errorf("meal usage = %v, want 90000", got)
+	}
+
+	// kitty cannot pay in a currency nobody has put in
+	_, err = Calculate(Input{
+		CurrencyCode: "KRW",
+		Members:      testMembers(members),
+		KittyPayerId: testKittyPayerId,
+		Expenditures: []Expenditure{
+			testExpenditure("e1", "JPY", 900, []string{testKittyPayerId}, map[string]int64{"a": 900}),
+		},
+		KittyContributions: contributions,
+	}, testExchange)
+	if !errors.Is(err, ErrKittyNotContributed) {
+		t.Errorf("expected ErrKittyNotContributed, got %v", err)
+	}
+}
+
+func TestCalculateRefund(t *testing.T) {
+	result, err := Calculate(Input{
+		CurrencyCode: "KRW",
+		Members:      testMembers(map[string]string{"a": "KRW", "b": "KRW"}),
+		Expenditures: []Expenditure{
+			testExpenditure("e1", "KRW", 100000, []string{"a"}, map[string]int64{"a": 50000, "b": 50000}),
+			// deposit given back to b, who did not pay for it
+			testExpenditure("e2", "KRW", -20000, []string{"b"}, map[string]int64{"a": -10000, "b": -10000}),
+		},
+	}, testExchange)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// b owes a 50000 and got 10000 of a's refund
+	wantDebts := []Debt{{From: "b", To: "a", Amount: money.New(60000, "KRW")}}
+	if !equalDebts(result.Debts, wantDebts) {
+		t.Errorf("debts = %v, want %v", result.Debts, wantDebts)
+	}
+	if got := result.SessionUsage.ByCategory[testCategory]; got != money.New(80000, "KRW") {
+		t.Errorf("session meal usage = %v, want 80000", got)
+	}
+	if got := result.UsageOf("a").ByCategory[testCategory]; got != money.New(40000, "KRW") {
+		t.Errorf("a's meal usage = %v, want 40000", got)
+	}
+}
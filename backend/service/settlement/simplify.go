@@ -0,0 +1,249 @@
+package settlement
+
+import (
+	"container/heap"
+	"math/big"
+	"sort"
+)
+
+const (
+	// ModePairwise settles each debt between the one who used and the one who paid for it
+	ModePairwise = "pairwise"
+	// ModeSimplified settles net balances of the session with minimum number of transfers
+	ModeSimplified = "simplified"
+)
+
+// exactSolverLimit is the maximum number of unsettled users to solve minimum transfers exactly,
+// as exact solver takes O(2^n * n) time
+const exactSolverLimit = 16
+
+const (
+	// CurrencyModeConverted exchanges every amount into the standard currency and settles them together
+	CurrencyModeConverted = "converted"
+	// CurrencyModePerCurrency settles each currency independently, e.g. yen debts in yen and won debts in won
+	CurrencyModePerCurrency = "per_currency"
+)
+
+func IsValidMode(mode string) bool {
+	return mode == ModePairwise || mode == ModeSimplified
+}
+
+func IsValidCurrencyMode(currencyMode string) bool {
+	return currencyMode == CurrencyModeConverted || currencyMode == CurrencyModePerCurrency
+}
+
+// transfer is a debt in the standard currency, before it is expressed in creditor's currency
+type transfer struct {
+	From   string
+	To     string
+	Amount *big.Rat
+}
+
+// pairwiseTransfers nets debts of each pair of users, which are owed by using what the other paid
+func pairwiseTransfers(owes map[string]map[string]*big.Rat) []transfer {
+	visited := make(map[string]map[string]bool)
+	transfers := make([]transfer, 0)
+	for from, owesByUser := range owes {
+		for to := range owesByUser {
+			a, b := from, to
+			if a > b {
+				a, b = b, a
+			}
+			if visited[a] == nil {
+				visited[a] = make(map[string]bool)
+			}
+			if visited[a][b] {
+				continue
+			}
+			visited[a][b] = true
+
+			net := new(big.Rat).Sub(oweOf(owes, a, b), oweOf(owes, b, a))
+			switch net.Sign() {
+			case 1:
+				transfers = append(transfers, transfer{From: a, To: b, Amount: net})
+			case -1:
+				transfers = append(transfers, transfer{From: b, To: a, Amount: net.Neg(net)})
+			}
+		}
+	}
+	sortTransfers(transfers)
+	return transfers
+}
+
+func oweOf(owes map[string]map[string]*big.Rat, from string, to string) *big.Rat {
+	if amount, ok := owes[from][to]; ok {
+		return amount
+	}
+	return new(big.Rat)
+}
+
+// simplifiedTransfers settles net balances with minimum number of transfers.
+// Users are split into as many zero-sum groups as possible (exactly for small sessions),
+// then each group is settled by greedy max-heap matching.
+func simplifiedTransfers(balances map[string]Balance) []transfer {
+	nets := make(map[string]*big.Rat)
+	userIds := make([]string, 0)
+	for userId, balance := range balances {
+		if net := balance.Net(); net.Sign() != 0 {
+			nets[userId] = net
+			userIds = append(userIds, userId)
+		}
+	}
+	sort.Strings(userIds)
+
+	groups := [][]string{userIds}
+	if len(userIds) <= exactSolverLimit {
+		groupNets := make([]*big.Rat, len(userIds))
+		for i, userId := range userIds {
+			groupNets[i] = nets[userId]
+		}
+		groups = make([][]string, 0)
+		for _, group := range zeroSumGroups(groupNets) {
+			groupUserIds := make([]string, len(group))
+			for i, index := range group {
+				groupUserIds[i] = userIds[index]
+			}
+			groups = append(groups, groupUserIds)
+		}
+	}
+
+	transfers := make([]transfer, 0)
+	for _, group := range groups {
+		transfers = append(transfers, greedyTransfers(group, nets)...)
+	}
+	sortTransfers(transfers)
+	return transfers
+}
+
+// zeroSumGroups partitions indices of nets into maximum number of groups whose sum is zero.
+// Settling a group of k users needs k-1 transfers, so more groups means fewer transfers.
+func zeroSumGroups(nets []*big.Rat) [][]int {
+	n := len(nets)
+	if n == 0 {
+		return nil
+	}
+	full := 1<<n - 1
+	sums := make([]*big.Rat, full+1)
+	sums[0] = new(big.Rat)
+	counts := make([]int, full+1)
+	for mask := 1; mask <= full; mask++ {
+		lowest := 0
+		for mask&(1<<lowest) == 0 {
+			lowest++
+		}
+		sums[mask] = new(big.Rat).Add(sums[mask&^(1<<lowest)], nets[lowest])
+
+		best := 0
+		for i := 0; i < n; i++ {
+			if mask&(1<<i) != 0 && counts[mask&^(1<<i)] > best {
+				best = counts[mask&^(1<<i)]
+			}
+		}
+		if sums[mask].Sign() == 0 {
+			best++
+		}
+		counts[mask] = best
+	}
+
+	// walk back from full set, splitting a group whenever the remaining set sums to zero
+	groups := make([][]int, 0)
+	group := make([]int, 0)
+	for mask := full; mask != 0; {
+		zero := sums[mask].Sign() == 0
+		if zero && len(group) > 0 {
+			groups = append(groups, group)
+			group = make([]int, 0)
+		}
+		target := counts[mask]
+		if zero {
+			target--
+		}
+		for i := 0; i < n; i++ {
+			if mask&(1<<i) != 0 && counts[mask&^(1<<i)] == target {
+				group = append(group, i)
+				mask &^= 1 << i
+				break
+			}
+		}
+	}
+	if len(group) > 0 {
+		groups = append(groups, group)
+	}
+
+	// order groups by their first member
+	for _, g := range groups {
+		sort.Ints(g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i][0] < groups[j][0]
+	})
+	return groups
+}
+
+type balanceItem struct {
+	UserId string
+	Amount *big.Rat
+}
+
+// balanceHeap is a max-heap of amounts, ties are broken by user id
+type balanceHeap []balanceItem
+
+func (h balanceHeap) Len() int { return len(h) }
+func (h balanceHeap) Less(i, j int) bool {
+	if c := h[i].Amount.Cmp(h[j].Amount); c != 0 {
+		return c > 0
+	}
+	return h[i].UserId < h[j].UserId
+}
+func (h balanceHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *balanceHeap) Push(x interface{}) { *h = append(*h, x.(balanceItem)) }
+func (h *balanceHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// greedyTransfers matches the largest debtor with the largest creditor until all settled
+func greedyTransfers(userIds []string, nets map[string]*big.Rat) []transfer {
+	debtors, creditors := &balanceHeap{}, &balanceHeap{}
+	for _, userId := range userIds {
+		net := nets[userId]
+		switch net.Sign() {
+		case 1:
+			heap.Push(debtors, balanceItem{UserId: userId, Amount: new(big.Rat).Set(net)})
+		case -1:
+			heap.Push(creditors, balanceItem{UserId: userId, Amount: new(big.Rat).Neg(net)})
+		}
+	}
+
+	transfers := make([]transfer, 0)
+	for debtors.Len() > 0 && creditors.Len() > 0 {
+		debtor := heap.Pop(debtors).(balanceItem)
+		creditor := heap.Pop(creditors).(balanceItem)
+
+		amount := debtor.Amount
+		if creditor.Amount.Cmp(amount) < 0 {
+			amount = creditor.Amount
+		}
+		amount = new(big.Rat).Set(amount)
+		transfers = append(transfers, transfer{From: debtor.UserId, To: creditor.UserId, Amount: amount})
+
+		if rest := new(big.Rat).Sub(debtor.Amount, amount); rest.Sign() > 0 {
+			heap.Push(debtors, balanceItem{UserId: debtor.UserId, Amount: rest})
+		}
+		if rest := new(big.Rat).Sub(creditor.Amount, amount); rest.Sign() > 0 {
+			heap.Push(creditors, balanceItem{UserId: creditor.UserId, Amount: rest})
+		}
+	}
+	return transfers
+}
+
+func sortTransfers(transfers []transfer) {
+	sort.Slice(transfers, func(i, j int) bool {
+		if transfers[i].From != transfers[j].From {
+			return transfers[i].From < transfers[j].From
+		}
+		return transfers[i].To < transfers[j].To
+	})
+}
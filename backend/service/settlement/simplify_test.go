@@ -0,0 +1,125 @@
+package settlement
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+func testBalances(nets map[string]*big.Rat) map[string]Balance {
+	balances := make(map[string]Balance)
+	for userId, net := range nets {
+		balance := newBalance()
+		if net.Sign() > 0 {
+			balance.Used.Set(net)
+		} else {
+			balance.Paid.Neg(net)
+		}
+		balances[userId] = balance
+	}
+	return balances
+}
+
+func testNets(nets map[string]int64) map[string]*big.Rat {
+	rats := make(map[string]*big.Rat)
+	for userId, net := range nets {
+		rats[userId] = big.NewRat(net, 1)
+	}
+	return rats
+}
+
+// assertSettles checks that applying transfers to balances settles everyone exactly
+func assertSettles(t *testing.T, balances map[string]Balance, transfers []transfer) {
+	nets := make(map[string]*big.Rat)
+	for userId, balance := range balances {
+		nets[userId] = balance.Net()
+	}
+	for _, transfer := range transfers {
+		nets[transfer.From].Sub(nets[transfer.From], transfer.Amount)
+		nets[transfer.To].Add(nets[transfer.To], transfer.Amount)
+	}
+	for userId, net := range nets {
+		if net.Sign() != 0 {
+			t.Errorf("%s is not settled: %v", userId, net)
+		}
+	}
+}
+
+func TestSimplifiedTransfers(t *testing.T) {
+	tests := []struct {
+		name      string
+		nets      map[string]*big.Rat
+		transfers int
+	}{
+		{
+			name:      "settled",
+			nets:      testNets(map[string]int64{"a": 0, "b": 0}),
+			transfers: 0,
+		},
+		{
+			name:      "largest first",
+			nets:      testNets(map[string]int64{"a": -3, "b": -2, "c": 2, "d": 3}),
+			transfers: 2,
+		},
+		{
+			name:      "greedy is not optimal",
+			nets:      testNets(map[string]int64{"a": 4, "b": 3, "c": 3, "d": -6, "e": -4}),
+			transfers: 3,
+		},
+		{
+			name:      "one creditor",
+			nets:      testNets(map[string]int64{"a": -30, "b": 10, "c": 10, "d": 10}),
+			transfers: 3,
+		},
+		{
+			name:      "fractions",
+			nets:      map[string]*big.Rat{"a": big.NewRat(1, 3), "b": big.NewRat(2, 3), "c": big.NewRat(-1, 2), "d": big.NewRat(-1, 2)},
+			transfers: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			balances := testBalances(tt.nets)
+			transfers := simplifiedTransfers(balances)
+			if len(transfers) != tt.transfers {
+				t.Errorf("transfers = %d (%v), want %d", len(transfers), transfers, tt.transfers)
+			}
+			assertSettles(t, balances, transfers)
+		})
+	}
+}
+
+func TestSimplifiedTransfersLargeGroup(t *testing.T) {
+	// more users than exact solver limit falls back to greedy matching
+	nets := make(map[string]int64)
+	for i := 0; i < exactSolverLimit+4; i++ {
+		nets[fmt.Sprintf("u%02d", i)] = int64(i%5) - 2
+	}
+	balances := testBalances(testNets(nets))
+	transfers := simplifiedTransfers(balances)
+	assertSettles(t, balances, transfers)
+	if len(transfers) >= len(nets) {
+		t.Errorf("transfers = %d, want less than %d", len(transfers), len(nets))
+	}
+}
+
+func TestZeroSumGroups(t *testing.T) {
+	nets := make([]*big.Rat, 0)
+	for _, net := range []int64{1, -1, 2, -2, 3, -3} {
+		nets = append(nets, big.NewRat(net, 1))
+	}
+	groups := zeroSumGroups(nets)
+	if len(groups) != 3 {
+		t.Fatalf("groups = %v, want 3 groups", groups)
+	}
+	for _, group := range groups {
+		sum := new(big.Rat)
+		for _, index := range group {
+			sum.Add(sum, nets[index])
+		}
+		if sum.Sign() != 0 {
+			t.Errorf("group %v does not sum to zero", group)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package settlement
+
+import (
+	"math/big"
+	"sort"
+	"time"
+	"travel-ai/libs/money"
+)
+
+// Exchanger returns the rate which converts 1 of from currency into to currency at the moment.
+// Zero time means now.
+type Exchanger func(from string, to string, at time.Time) (*big.Rat, error)
+
+type Input struct {
+	// CurrencyCode is the standard currency which every amount is accumulated in
+	CurrencyCode string
+	// Mode is one of ModePairwise and ModeSimplified (default)
+	Mode string
+	// CurrencyMode is one of CurrencyModeConverted (default) and CurrencyModePerCurrency
+	CurrencyMode string
+	// NetCurrencies cancels debts between two users in different currencies out, in CurrencyModePerCurrency
+	NetCurrencies bool
+	// SettledAt is the moment when budgets and debts are exchanged, zero means now.
+	// Expenditures and transactions are exchanged at their own PayedAt and SentAt.
+	SettledAt time.Time
+	// Categories are every category of expenditures, which usages have even if nothing is spent in
+	Categories []string
+	// KittyPayerId is the payer of expenditures which are paid from the kitty
+	KittyPayerId string
+	Members      []Member
+	Expenditures []Expenditure
+	Budgets      []Budget
+	// Transactions which are not confirmed are ignored
+	Transactions []Transaction
+	// KittyContributions are paid into the kitty, which pays expenditures of KittyPayerId.
+	// They are not debts, as kitty payments are paid by contributors and the balance is refunded to them.
+	KittyContributions []KittyContribution
+}
+
+type Member struct {
+	UserId              string
+	DefaultCurrencyCode string
+}
+
+type Expenditure struct {
+	ExpenditureId string
+	Name          string
+	Category      string
+	TotalPrice    money.Money
+	PayedAt       time.Time
+	// Payers divide the payment equally, where KittyPayerId means the kitty
+	Payers        []string
+	Distributions []Distribution
+}
+
+// Distribution is the amount which user used, in major unit of the expenditure currency
+type Distribution struct {
+	UserId      string
+	Numerator   int64
+	Denominator int64
+}
+
+type Budget struct {
+	UserId string
+	Amount money.Money
+	// Partial budget is of a category or a day, which is a part of the whole one and not counted again
+	Partial bool
+}
+
+type Transaction struct {
+	SenderUid   string
+	ReceiverUid string
+	Amount      money.Money
+	SentAt      time.Time
+	// Confirmed is true if the receiver has confirmed the payment and it is not voided
+	Confirmed bool
+}
+
+type KittyContribution struct {
+	UserId string
+	Amount money.Money
+}
+
+// Usage is expressed in the standard currency, rounded to its minor unit
+type Usage struct {
+	ByCategory  map[string]money.Money
+	TotalBudget money.Money
+}
+
+// Balance is accumulated exactly in the standard currency.
+// Paid includes shares of kitty payments, which contributors paid in proportion to their contributions.
+type Balance struct {
+	Used     *big.Rat
+	Paid     *big.Rat
+	Sent     *big.Rat
+	Received *big.Rat
+}
+
+func newBalance() Balance {
+	return Balance{Used: new(big.Rat), Paid: new(big.Rat), Sent: new(big.Rat), Received: new(big.Rat)}
+}
+
+// Net returns how much user still owes (positive) or is owed (negative)
+func (b Balance) Net() *big.Rat {
+	net := new(big.Rat).Sub(b.Used, b.Paid)
+	net.Sub(net, b.Sent)
+	return net.Add(net, b.Received)
+}
+
+// Debt is an edge of settlement graph, which means From owes To the Amount
+type Debt struct {
+	From   string
+	To     string
+	Amount money.Money
+	// Netted is true if the debt is reduced by debts in other currencies
+	Netted bool
+}
+
+// Kitty is the common pot in a currency, whose balance is refunded to contributors in proportion to contributions
+type Kitty struct {
+	CurrencyCode string
+	Contributed  money.Money
+	Spent        money.Money
+	// Balance is negative if the kitty spent more than contributed, which contributors make up for
+	Balance money.Money
+	// Refunds are in order of user id
+	Refunds []KittyRefund
+}
+
+type KittyRefund struct {
+	UserId string
+	Amount money.Money
+}
+
+type Result struct {
+	CurrencyCode  string
+	Mode          string
+	CurrencyMode  string
+	NetCurrencies bool
+	SessionUsage  Usage
+	UserUsages    map[string]Usage
+	// Balances are accumulated in the standard currency regardless of CurrencyMode
+	Balances map[string]Balance
+	Debts    []Debt
+	// Kitty is of each currency the kitty has, in order of currency code
+	Kitty []Kitty
+
+	// owes[from][to] is the amount which from owes to, before netting
+	owes map[string]map[string]*big.Rat
+	// ledgers of each original currency, which are kept only in CurrencyModePerCurrency
+	ledgers map[string]*ledger
+	// exact usages, which are rounded into SessionUsage and UserUsages at last
+	sessionUsage *usageSum
+	userUsages   map[string]*usageSum
+	// kitties of each currency, which are rounded into Kitty at last
+	kitties map[string]*kittySum
+	// categories which usages have zero amount of at least
+	categories []string
+}
+
+// ledger is balances and owes in a currency without any exchange
+type ledger struct {
+	balances map[string]Balance
+	owes     map[string]map[string]*big.Rat
+}
+
+func newLedger() *ledger {
+	return &ledger{balances: make(map[string]Balance), owes: make(map[string]map[string]*big.Rat)}
+}
+
+func (l *ledger) balance(userId string) Balance {
+	if _, ok := l.balances[userId]; !ok {
+		l.balances[userId] = newBalance()
+	}
+	return l.balances[userId]
+}
+
+func (l *ledger) addOwe(from string, to string, amount *big.Rat) {
+	if from == to {
+		return
+	}
+	if _, ok := l.owes[from]; !ok {
+		l.owes[from] = make(map[string]*big.Rat)
+	}
+	if _, ok := l.owes[from][to]; !ok {
+		l.owes[from][to] = new(big.Rat)
+	}
+	l.owes[from][to].Add(l.owes[from][to], amount)
+}
+
+// kittySum is contributions and spending of the kitty in its currency
+type kittySum struct {
+	contributed *big.Rat
+	spent       *big.Rat
+	byUser      map[string]*big.Rat
+}
+
+func newKittySum() *kittySum {
+	return &kittySum{contributed: new(big.Rat), spent: new(big.Rat), byUser: make(map[string]*big.Rat)}
+}
+
+func (k *kittySum) contribute(userId string, amount *big.Rat) {
+	if _, ok := k.byUser[userId]; !ok {
+		k.byUser[userId] = new(big.Rat)
+	}
+	k.byUser[userId].Add(k.byUser[userId], amount)
+	k.contributed.Add(k.contributed, amount)
+}
+
+// contributors returns user ids in order, who have contributed more than zero
+func (k *kittySum) contributors() []string {
+	userIds := make([]string, 0, len(k.byUser))
+	for userId, amount := range k.byUser {
+		if amount.Sign() > 0 {
+			userIds = append(userIds, userId)
+		}
+	}
+	sort.Strings(userIds)
+	return userIds
+}
+
+// ratio is the part of the kitty which the user has contributed
+func (k *kittySum) ratio(userId string) *big.Rat {
+	if k.contributed.Sign() == 0 {
+		return new(big.Rat)
+	}
+	return new(big.Rat).Quo(k.byUser[userId], k.contributed)
+}
+
+func (k *kittySum) round(currencyCode string) Kitty {
+	balance := new(big.Rat).Sub(k.contributed, k.spent)
+	kitty := Kitty{
+		CurrencyCode: currencyCode,
+		Contributed:  money.FromRat(k.contributed, currencyCode),
+		Spent:        money.FromRat(k.spent, currencyCode),
+		Balance:      money.FromRat(balance, currencyCode),
+		Refunds:      make([]KittyRefund, 0),
+	}
+	for _, userId := range k.contributors() {
+		refund := money.FromRat(new(big.Rat).Mul(balance, k.ratio(userId)), currencyCode)
+		if !refund.IsZero() {
+			kitty.Refunds = append(kitty.Refunds, KittyRefund{UserId: userId, Amount: refund})
+		}
+	}
+	return kitty
+}
+
+type usageSum struct {
+	byCategory  map[string]*big.Rat
+	totalBudget *big.Rat
+}
+
+func newUsageSum() *usageSum {
+	return &usageSum{byCategory: make(map[string]*big.Rat), totalBudget: new(big.Rat)}
+}
+
+func (s *usageSum) addCategory(category string, amount *big.Rat) {
+	if _, ok := s.byCategory[category]; !ok {
+		s.byCategory[category] = new(big.Rat)
+	}
+	s.byCategory[category].Add(s.byCategory[category], amount)
+}
+
+func (s *usageSum) round(currencyCode string, categories []string) Usage {
+	usage := newUsage(currencyCode, categories)
+	for category, amount := range s.byCategory {
+		usage.ByCategory[category] = money.FromRat(amount, currencyCode)
+	}
+	usage.TotalBudget = money.FromRat(s.totalBudget, currencyCode)
+	return usage
+}
+
+// newUsage makes usage which has zero amount for every category
+func newUsage(currencyCode string, categories []string) Usage {
+	usage := Usage{
+		ByCategory:  make(map[string]money.Money),
+		TotalBudget: money.Zero(currencyCode),
+	}
+	for _, category := range categories {
+		usage.ByCategory[category] = money.Zero(currencyCode)
+	}
+	return usage
+}
+
+// DebtsOf returns debts which user owes or is owed
+func (r *Result) DebtsOf(userId string) []Debt {
+	debts := make([]Debt, 0)
+	for _, debt := range r.Debts {
+		if debt.From == userId || debt.To == userId {
+			debts = append(debts, debt)
+		}
+	}
+	return debts
+}
+
+// UsageOf returns usage of user, or empty usage if user has not used anything
+func (r *Result) UsageOf(userId string) Usage {
+	usage, ok := r.UserUsages[userId]
+	if !ok {
+		return newUsage(r.CurrencyCode, r.categories)
+	}
+	return usage
+}
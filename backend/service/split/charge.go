@@ -0,0 +1,65 @@
+package split
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+const (
+	ChargeTax     = "tax"
+	ChargeTip     = "tip"
+	ChargeService = "service"
+)
+
+var (
+	ErrNoAllocation     = errors.New("no allocation specified for item")
+	ErrChargeNoSubtotal = errors.New("charges cannot be spread over items of zero")
+)
+
+func IsValidChargeKind(kind string) bool {
+	return kind == ChargeTax || kind == ChargeTip || kind == ChargeService
+}
+
+// Item is an item of a receipt, whose price is divided equally among UserIds
+type Item struct {
+	Price   *big.Rat
+	UserIds []string
+}
+
+// PercentOf computes percent of subtotal, e.g. 10% service charge of items
+func PercentOf(subtotal *big.Rat, percent *big.Rat) *big.Rat {
+	amount := new(big.Rat).Mul(subtotal, percent)
+	return amount.Quo(amount, big.NewRat(100, 1))
+}
+
+// Itemized computes how much of items and charges each user uses, exactly.
+// Charges (tax, tip, service charge, ...) are spread in proportion to each user's share of items,
+// so the distributions sum up to items and charges.
+func Itemized(items []Item, charges *big.Rat) (map[string]*big.Rat, error) {
+	allocated := make(map[string]*big.Rat)
+	for i, item := range items {
+		if len(item.UserIds) == 0 {
+			return nil, fmt.Errorf("%w: #%d", ErrNoAllocation, i)
+		}
+		divided := new(big.Rat).Quo(item.Price, big.NewRat(int64(len(item.UserIds)), 1))
+		for _, userId := range item.UserIds {
+			if _, ok := allocated[userId]; !ok {
+				allocated[userId] = new(big.Rat)
+			}
+			allocated[userId].Add(allocated[userId], divided)
+		}
+	}
+	if charges == nil || charges.Sign() == 0 {
+		return allocated, nil
+	}
+
+	spread := weighted(charges, allocated)
+	if spread == nil {
+		return nil, ErrChargeNoSubtotal
+	}
+	for userId, charge := range spread {
+		allocated[userId].Add(allocated[userId], charge)
+	}
+	return allocated, nil
+}
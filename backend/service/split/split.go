@@ -0,0 +1,153 @@
+package split
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+const (
+	// ModeEqual splits equally among UserIds
+	ModeEqual = "equal"
+	// ModePercentage splits by Values in percent, which sum up to 100
+	ModePercentage = "percentage"
+	// ModeShares splits by Values as weights, e.g. 2:1:1
+	ModeShares = "shares"
+	// ModeExact takes Values as amounts, which sum up to the total
+	ModeExact = "exact"
+	// ModeExcept splits equally among every member except UserIds
+	ModeExcept = "except"
+)
+
+var (
+	ErrInvalidMode     = errors.New("invalid split mode")
+	ErrNoParticipant   = errors.New("no one to split")
+	ErrNotMember       = errors.New("user is not in session")
+	ErrNegativeValue   = errors.New("split value should not be negative")
+	ErrPercentageSum   = errors.New("percentages do not sum up to 100")
+	ErrExactSum        = errors.New("amounts do not sum up to total")
+	ErrTooFineFraction = errors.New("distribution is too fine to store")
+)
+
+// Spec is a higher-level split of an expenditure, which is computed into distributions on server
+type Spec struct {
+	Mode string
+	// UserIds are participants for ModeEqual, or excluded members for ModeExcept
+	UserIds []string
+	// Values are percentages, shares or amounts of each user, for the other modes
+	Values map[string]*big.Rat
+}
+
+func IsValidMode(mode string) bool {
+	return mode == ModeEqual || mode == ModePercentage || mode == ModeShares || mode == ModeExact || mode == ModeExcept
+}
+
+// Distribute computes how much of total each user uses, exactly. Users of zero are omitted.
+// Every user should be one of members, and the distributions always sum up to total.
+func Distribute(spec Spec, total *big.Rat, members []string) (map[string]*big.Rat, error) {
+	isMember := make(map[string]bool)
+	for _, member := range members {
+		isMember[member] = true
+	}
+	for _, userId := range spec.UserIds {
+		if !isMember[userId] {
+			return nil, fmt.Errorf("%w: %s", ErrNotMember, userId)
+		}
+	}
+	for userId, value := range spec.Values {
+		if !isMember[userId] {
+			return nil, fmt.Errorf("%w: %s", ErrNotMember, userId)
+		}
+		if value.Sign() < 0 {
+			return nil, fmt.Errorf("%w: %s", ErrNegativeValue, userId)
+		}
+	}
+
+	var distributions map[string]*big.Rat
+	switch spec.Mode {
+	case ModeEqual:
+		distributions = weighted(total, equalWeights(spec.UserIds))
+	case ModeExcept:
+		excluded := make(map[string]bool)
+		for _, userId := range spec.UserIds {
+			excluded[userId] = true
+		}
+		participants := make([]string, 0)
+		for _, member := range members {
+			if !excluded[member] {
+				participants = append(participants, member)
+			}
+		}
+		distributions = weighted(total, equalWeights(participants))
+	case ModePercentage:
+		if sum(spec.Values).Cmp(big.NewRat(100, 1)) != 0 {
+			return nil, ErrPercentageSum
+		}
+		distributions = weighted(total, spec.Values)
+	case ModeShares:
+		distributions = weighted(total, spec.Values)
+	case ModeExact:
+		if sum(spec.Values).Cmp(total) != 0 {
+			return nil, ErrExactSum
+		}
+		distributions = make(map[string]*big.Rat)
+		for userId, value := range spec.Values {
+			distributions[userId] = new(big.Rat).Set(value)
+		}
+	default:
+		return nil, ErrInvalidMode
+	}
+	if distributions == nil {
+		return nil, ErrNoParticipant
+	}
+
+	for userId, distribution := range distributions {
+		if distribution.Sign() == 0 {
+			delete(distributions, userId)
+			continue
+		}
+		// stored as int64 numerator and denominator
+		if !distribution.Num().IsInt64() || !distribution.Denom().IsInt64() {
+			return nil, fmt.Errorf("%w: %s", ErrTooFineFraction, userId)
+		}
+	}
+	return distributions, nil
+}
+
+func equalWeights(userIds []string) map[string]*big.Rat {
+	weights := make(map[string]*big.Rat)
+	for _, userId := range userIds {
+		weights[userId] = big.NewRat(1, 1)
+	}
+	return weights
+}
+
+// weighted splits total in proportion to weights, or returns nil if weights sum up to zero
+func weighted(total *big.Rat, weights map[string]*big.Rat) map[string]*big.Rat {
+	weightSum := sum(weights)
+	if weightSum.Sign() == 0 {
+		return nil
+	}
+
+	userIds := make([]string, 0, len(weights))
+	for userId := range weights {
+		userIds = append(userIds, userId)
+	}
+	sort.Strings(userIds)
+
+	distributions := make(map[string]*big.Rat)
+	for _, userId := range userIds {
+		distribution := new(big.Rat).Mul(total, weights[userId])
+		distributions[userId] = distribution.Quo(distribution, weightSum)
+	}
+	return distributions
+}
+
+func sum(values map[string]*big.Rat) *big.Rat {
+	s := new(big.Rat)
+	for _, value := range values {
+		s.Add(s, value)
+	}
+	return s
+}
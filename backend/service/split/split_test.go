@@ -0,0 +1,137 @@
+package split
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+var testMembers = []string{"a", "b", "c", "d"}
+
+func rats(values map[string]int64) map[string]*big.Rat {
+	r := make(map[string]*big.Rat)
+	for userId, value := range values {
+		r[userId] = big.NewRat(value, 1)
+	}
+	return r
+}
+
+func TestDistribute(t *testing.T) {
+	total := big.NewRat(100, 1)
+	tests := []struct {
+		name string
+		spec Spec
+		want map[string]*big.Rat
+	}{
+		{
+			name: "equal among selected",
+			spec: Spec{Mode: ModeEqual, UserIds: []string{"a", "b", "c"}},
+			want: map[string]*big.Rat{"a": big.NewRat(100, 3), "b": big.NewRat(100, 3), "c": big.NewRat(100, 3)},
+		},
+		{
+			name: "everyone except",
+			spec: Spec{Mode: ModeExcept, UserIds: []string{"d"}},
+			want: map[string]*big.Rat{"a": big.NewRat(100, 3), "b": big.NewRat(100, 3), "c": big.NewRat(100, 3)},
+		},
+		{
+			name: "percentage",
+			spec: Spec{Mode: ModePercentage, Values: map[string]*big.Rat{"a": big.NewRat(125, 2), "b": big.NewRat(75, 2)}},
+			want: map[string]*big.Rat{"a": big.NewRat(125, 2), "b": big.NewRat(75, 2)},
+		},
+		{
+			name: "shares",
+			spec: Spec{Mode: ModeShares, Values: rats(map[string]int64{"a": 2, "b": 1, "c": 1, "d": 0})},
+			want: map[string]*big.Rat{"a": big.NewRat(50, 1), "b": big.NewRat(25, 1), "c": big.NewRat(25, 1)},
+		},
+		{
+			name: "exact",
+			spec: Spec{Mode: ModeExact, Values: rats(map[string]int64{"a": 70, "b": 30})},
+			want: rats(map[string]int64{"a": 70, "b": 30}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Distribute(tt.spec, total, testMembers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("distributions = %v, want %v", got, tt.want)
+			}
+			sum := new(big.Rat)
+			for userId, want := range tt.want {
+				if got[userId] == nil || got[userId].Cmp(want) != 0 {
+					t.Errorf("%s = %v, want %v", userId, got[userId], want)
+				}
+				sum.Add(sum, got[userId])
+			}
+			if sum.Cmp(total) != 0 {
+				t.Errorf("sum = %v, want %v", sum, total)
+			}
+		})
+	}
+}
+
+func TestDistributeErrors(t *testing.T) {
+	total := big.NewRat(100, 1)
+	tests := []struct {
+		name string
+		spec Spec
+		want error
+	}{
+		{"invalid mode", Spec{Mode: "unknown"}, ErrInvalidMode},
+		{"not member", Spec{Mode: ModeEqual, UserIds: []string{"a", "x"}}, ErrNotMember},
+		{"no one selected", Spec{Mode: ModeEqual}, ErrNoParticipant},
+		{"everyone excepted", Spec{Mode: ModeExcept, UserIds: testMembers}, ErrNoParticipant},
+		{"percentage not 100", Spec{Mode: ModePercentage, Values: rats(map[string]int64{"a": 50, "b": 40})}, ErrPercentageSum},
+		{"zero shares", Spec{Mode: ModeShares, Values: rats(map[string]int64{"a": 0})}, ErrNoParticipant},
+		{"negative share", Spec{Mode: ModeShares, Values: rats(map[string]int64{"a": -1, "b": 2})}, ErrNegativeValue},
+		{"exact not total", Spec{Mode: ModeExact, Values: rats(map[string]int64{"a": 70, "b": 20})}, ErrExactSum},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Distribute(tt.spec, total, testMembers); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestItemized(t *testing.T) {
+	// 10,000 of items and 10% service charge, where a takes 6,000 and b takes 4,000 of items
+	items := []Item{
+		{Price: big.NewRat(4000, 1), UserIds: []string{"a"}},
+		{Price: big.NewRat(4000, 1), UserIds: []string{"a", "b"}},
+		{Price: big.NewRat(2000, 1), UserIds: []string{"b"}},
+	}
+	charges := PercentOf(big.NewRat(10000, 1), big.NewRat(10, 1))
+	if charges.Cmp(big.NewRat(1000, 1)) != 0 {
+		t.Fatalf("charges = %v, want 1000", charges)
+	}
+
+	got, err := Itemized(items, charges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := rats(map[string]int64{"a": 6600, "b": 4400})
+	if len(got) != len(want) {
+		t.Fatalf("distributions = %v, want %v", got, want)
+	}
+	for userId, w := range want {
+		if got[userId] == nil || got[userId].Cmp(w) != 0 {
+			t.Errorf("%s = %v, want %v", userId, got[userId], w)
+		}
+	}
+}
+
+func TestItemizedErrors(t *testing.T) {
+	if _, err := Itemized([]Item{{Price: big.NewRat(10, 1)}}, nil); !errors.Is(err, ErrNoAllocation) {
+		t.Errorf("err = %v, want %v", err, ErrNoAllocation)
+	}
+	items := []Item{{Price: new(big.Rat), UserIds: []string{"a"}}}
+	if _, err := Itemized(items, big.NewRat(1, 1)); !errors.Is(err, ErrChargeNoSubtotal) {
+		t.Errorf("err = %v, want %v", err, ErrChargeNoSubtotal)
+	}
+}
@@ -5,31 +5,57 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 )
 
 func GetExchangeRate(from string, to string) (float64, error) {
+	rate, _, err := getExchangeRate("latest", from, to)
+	return rate, err
+}
+
+// GetLatestExchangeRate returns the latest rate with the date (UTC) it is published on
+func GetLatestExchangeRate(from string, to string) (float64, time.Time, error) {
+	return getExchangeRate("latest", from, to)
+}
+
+// GetHistoricalExchangeRate returns the rate published on the date (UTC)
+func GetHistoricalExchangeRate(from string, to string, date time.Time) (float64, error) {
+	rate, _, err := getExchangeRate(date.UTC().Format("2006-01-02"), from, to)
+	return rate, err
+}
+
+// getExchangeRate requests the rate of version, which is either "latest" or a date formatted as 2006-01-02.
+// The date of the rate is read from the response, which is zero if not given.
+func getExchangeRate(version string, from string, to string) (float64, time.Time, error) {
 	// lowercase
 	uFrom := strings.ToLower(from)
 	uTo := strings.ToLower(to)
 
-	url := fmt.Sprintf("https://cdn.jsdelivr.net/gh/fawazahmed0/currency-api@1/latest/currencies/%s/%s.min.json", uFrom, uTo)
+	url := fmt.Sprintf("https://cdn.jsdelivr.net/gh/fawazahmed0/currency-api@1/%s/currencies/%s/%s.min.json", version, uFrom, uTo)
 	resp, err := http.Get(url)
 	if err != nil {
-		return 0, err
+		return 0, time.Time{}, err
 	}
 	defer resp.Body.Close()
 
 	// check if response is 200
 	if resp.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("response status code is %d", resp.StatusCode)
+		return 0, time.Time{}, fmt.Errorf("response status code is %d", resp.StatusCode)
 	}
 
 	// parse response
 	var data map[string]interface{}
 	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return 0, err
+		return 0, time.Time{}, err
 	}
 
-	value := data[uTo].(float64)
-	return value, nil
+	value, ok := data[uTo].(float64)
+	if !ok {
+		return 0, time.Time{}, fmt.Errorf("rate of %s is not found in response", uTo)
+	}
+	var date time.Time
+	if raw, ok := data["date"].(string); ok {
+		date, _ = time.Parse("2006-01-02", raw)
+	}
+	return value, date, nil
 }
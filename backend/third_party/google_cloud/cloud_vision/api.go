@@ -5,6 +5,7 @@ import (
 	pb "cloud.google.com/go/vision/v2/apiv1/visionpb"
 	"context"
 	"google.golang.org/api/option"
+	"io"
 	"os"
 	"path/filepath"
 	"travel-ai/log"
@@ -20,19 +21,24 @@ func Initialize() {
 // TODO :: [Future] delete this function?
 
 func RequestImageToText(path string) ([]*pb.EntityAnnotation, error) {
-	ctx := context.Background()
-	client, err := vision.NewImageAnnotatorClient(ctx, option.WithCredentialsFile(KeyFile))
+	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
-	defer client.Close()
+	defer f.Close()
 
-	f, err := os.Open(path)
+	return DetectTexts(context.Background(), f)
+}
+
+// DetectTexts returns text annotations of the image, where the first one is the whole text
+func DetectTexts(ctx context.Context, r io.Reader) ([]*pb.EntityAnnotation, error) {
+	client, err := vision.NewImageAnnotatorClient(ctx, option.WithCredentialsFile(KeyFile))
 	if err != nil {
 		return nil, err
 	}
+	defer client.Close()
 
-	image, err := vision.NewImageFromReader(f)
+	image, err := vision.NewImageFromReader(r)
 	if err != nil {
 		return nil, err
 	}
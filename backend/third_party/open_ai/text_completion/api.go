@@ -1,17 +1,5 @@
 package text_completion
 
-import (
-	"bufio"
-	"encoding/json"
-	"fmt"
-	"io"
-	"net/http"
-	"strings"
-	"travel-ai/log"
-	"travel-ai/third_party/open_ai"
-	"travel-ai/util"
-)
-
 const (
 	MODEL_GPT_3_5_TURBO      = "gpt-3.5-turbo"
 	MODEL_GPT_3_5_TURBO_0301 = "gpt-3.5-turbo-0301"
@@ -20,8 +8,6 @@ const (
 	MODEL_GPT_4_32k          = "gpt-4-32k"
 	MODEL_GPT_4_32k_0314     = "gpt-4-32k-0314"
 
-	REQUEST_URL = "https://api.openai.com/v1/chat/completions"
-
 	ROLE_USER      = "user"
 	ROLE_SYSTEM    = "system"
 	ROLE_ASSISTANT = "assistant"
@@ -42,7 +28,7 @@ type CompletionRequest struct {
 type CompletionMessage struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
-	Name    string `json:"name"`
+	Name    string `json:"name,omitempty"`
 }
 
 type CompletionSyncResponse struct {
@@ -53,13 +39,15 @@ type CompletionSyncResponse struct {
 	} `json:"choices"`
 }
 
+type CompletionError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Param   string `json:"param"`
+}
+
 type CompletionErrorResponse struct {
-	Error struct {
-		Code    string `json:"code"`
-		Message string `json:"message"`
-		Type    string `json:"type"`
-		Param   string `json:"param"`
-	}
+	Error CompletionError `json:"error"`
 }
 
 type CompletionStreamResponse struct {
@@ -70,140 +58,5 @@ type CompletionStreamResponse struct {
 		Index        int    `json:"index"`
 		FinishReason string `json:"finish_reason"`
 	} `json:"choices"`
-}
-
-func RequestCompletionSync(model string, role string, prompt string) (CompletionSyncResponse, error) {
-	// make http request
-	message := CompletionMessage{
-		Role:    role,
-		Content: prompt,
-		Name:    "Traveler",
-	}
-	request := CompletionRequest{
-		Messages:         []CompletionMessage{message},
-		Temperature:      0.7,
-		TopP:             1,
-		FrequencyPenalty: 0,
-		PresencePenalty:  0,
-		Stop:             nil,
-		Model:            model,
-		Stream:           false,
-	}
-	requestBody := util.StructToReadable(request)
-
-	req, err := http.NewRequest("POST", REQUEST_URL, requestBody)
-	if err != nil {
-		return CompletionSyncResponse{}, err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+open_ai.GetOpenAiApiKey())
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return CompletionSyncResponse{}, err
-	}
-	defer resp.Body.Close()
-
-	bodyContent, err := io.ReadAll(resp.Body)
-
-	// parse response
-	if resp.StatusCode == http.StatusOK {
-		var response CompletionSyncResponse
-		if err = json.Unmarshal(bodyContent, &response); err != nil {
-			return CompletionSyncResponse{}, err
-		}
-		return response, nil
-	} else {
-		var response CompletionErrorResponse
-		if err = json.Unmarshal(bodyContent, &response); err != nil {
-			return CompletionSyncResponse{}, err
-		}
-		return CompletionSyncResponse{}, fmt.Errorf("RequestError[%d] %s :: %s", resp.StatusCode, response.Error.Type, response.Error.Message)
-	}
-}
-
-func RequestCompletionEx(model string, role string, prompt string) (*io.PipeReader, error) {
-	// make http request
-	message := CompletionMessage{
-		Role:    role,
-		Content: prompt,
-		Name:    "Traveler",
-	}
-	return RequestCompletion(model, []CompletionMessage{message})
-}
-
-func RequestCompletion(model string, prompts []CompletionMessage) (*io.PipeReader, error) {
-	request := CompletionRequest{
-		Messages:         prompts,
-		Temperature:      0.7,
-		TopP:             1,
-		FrequencyPenalty: 0,
-		PresencePenalty:  0,
-		Stop:             nil,
-		Model:            model,
-		Stream:           true,
-	}
-	requestBody := util.StructToReadable(request)
-
-	req, err := http.NewRequest("POST", REQUEST_URL, requestBody)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+open_ai.GetOpenAiApiKey())
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-
-	// parse response
-	if resp.StatusCode == http.StatusOK {
-		src, dst := io.Pipe()
-
-		go func() {
-			defer func() {
-				resp.Body.Close()
-				dst.Close()
-			}()
-			reader := bufio.NewReader(resp.Body)
-
-			for {
-				lineBuffer, isPrefix, err := reader.ReadLine()
-				if err != nil {
-					if err == io.EOF {
-						break
-					}
-					log.Errorf("Failed to read line: %s", err.Error())
-					break
-				}
-				if !isPrefix && len(lineBuffer) > 0 {
-					line := string(lineBuffer)
-					data := strings.TrimPrefix(line, "data:")
-
-					var chunk CompletionStreamResponse
-					if err = json.Unmarshal([]byte(data), &chunk); err != nil {
-						//log.Warnf("Failed to parse chunk: %s", err.Error())
-						continue
-					}
-					content := chunk.Choices[0].Delta.Content
-
-					if _, err = dst.Write([]byte(content)); err != nil {
-						log.Errorf("Failed to write to pipe: %s", err.Error())
-						continue
-					}
-				}
-			}
-		}()
-		return src, nil
-	} else {
-		defer resp.Body.Close()
-		bodyContent, err := io.ReadAll(resp.Body)
-		log.Debug(bodyContent)
-		var response CompletionErrorResponse
-		if err = json.Unmarshal(bodyContent, &response); err != nil {
-			return nil, err
-		}
-		return nil, fmt.Errorf("RequestError[%d] %s :: %s", resp.StatusCode, response.Error.Type, response.Error.Message)
-	}
+	Error *CompletionError `json:"error"` // sent instead of choices if the stream fails
 }
@@ -0,0 +1,157 @@
+package text_completion
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"travel-ai/util"
+)
+
+// LLMClient completes chat messages with a language model
+type LLMClient interface {
+	// Complete answers the messages at once
+	Complete(ctx context.Context, messages []CompletionMessage) (string, error)
+	// Stream answers the messages in pieces as they are generated, and reading fails with the error of the stream.
+	// The reader should be closed, which stops the request as cancelling ctx does.
+	Stream(ctx context.Context, messages []CompletionMessage) (io.ReadCloser, error)
+}
+
+type Config struct {
+	BaseUrl     string // e.g. https://api.openai.com/v1, where /chat/completions is requested
+	ApiKey      string
+	Model       string
+	Temperature float64
+	HttpClient  *http.Client // http.DefaultClient if nil
+}
+
+type openAiClient struct {
+	config Config
+}
+
+// NewClient makes LLMClient of the chat completions api, which open ai compatible servers also have
+func NewClient(config Config) LLMClient {
+	if config.HttpClient == nil {
+		config.HttpClient = http.DefaultClient
+	}
+	config.BaseUrl = strings.TrimSuffix(config.BaseUrl, "/")
+	return &openAiClient{config: config}
+}
+
+func (c *openAiClient) Complete(ctx context.Context, messages []CompletionMessage) (string, error) {
+	resp, err := c.request(ctx, messages, false)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var response CompletionSyncResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return "", err
+	}
+	if len(response.Choices) == 0 {
+		return "", nil
+	}
+	return response.Choices[0].Message.Content, nil
+}
+
+func (c *openAiClient) Stream(ctx context.Context, messages []CompletionMessage) (io.ReadCloser, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	resp, err := c.request(ctx, messages, true)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	src, dst := io.Pipe()
+	go func() {
+		defer cancel()
+		defer resp.Body.Close()
+		_ = dst.CloseWithError(readStream(resp.Body, dst))
+	}()
+	return &completionStream{PipeReader: src, cancel: cancel}, nil
+}
+
+// request posts the messages, and returns the response only if it is OK
+func (c *openAiClient) request(ctx context.Context, messages []CompletionMessage, stream bool) (*http.Response, error) {
+	request := CompletionRequest{
+		Messages:         messages,
+		Temperature:      c.config.Temperature,
+		TopP:             1,
+		FrequencyPenalty: 0,
+		PresencePenalty:  0,
+		Stop:             nil,
+		Model:            c.config.Model,
+		Stream:           stream,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.BaseUrl+"/chat/completions",
+		util.StructToReadable(request))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.config.ApiKey)
+
+	resp, err := c.config.HttpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		bodyContent, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return nil, newRequestError(resp.StatusCode, bodyContent)
+	}
+	return resp, nil
+}
+
+type completionStream struct {
+	*io.PipeReader
+	cancel context.CancelFunc
+}
+
+func (s *completionStream) Close() error {
+	s.cancel()
+	return s.PipeReader.Close()
+}
+
+// readStream writes contents of server-sent events until [DONE].
+// The stream cut before [DONE] is io.ErrUnexpectedEOF, so that a partial answer is not taken as a whole.
+func readStream(body io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		// events are separated by empty lines, and comments or other fields are ignored
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			return nil
+		}
+
+		var chunk CompletionStreamResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return err
+		}
+		if chunk.Error != nil {
+			return &RequestError{StatusCode: http.StatusOK, CompletionError: *chunk.Error}
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+		if _, err := io.WriteString(w, chunk.Choices[0].Delta.Content); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
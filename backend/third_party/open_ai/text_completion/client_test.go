@@ -0,0 +1,170 @@
+package text_completion_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+	"travel-ai/third_party/open_ai/text_completion"
+	"travel-ai/third_party/open_ai/text_completion/fake"
+)
+
+var testMessages = []text_completion.CompletionMessage{
+	{Role: text_completion.ROLE_USER, Content: "Where to eat in Seoul?", Name: "Traveler"},
+}
+
+func newFakeServer(t *testing.T, replies ...fake.Reply) *fake.Server {
+	server := fake.NewServer()
+	t.Cleanup(server.Close)
+	server.Enqueue(replies...)
+	return server
+}
+
+func TestComplete(t *testing.T) {
+	server := newFakeServer(t, fake.Answer("Gwangjang", " Market"))
+	config := server.Config()
+	config.BaseUrl += "/"
+	config.Temperature = 0.2
+
+	answer, err := text_completion.NewClient(config).Complete(context.Background(), testMessages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer != "Gwangjang Market" {
+		t.Errorf("answer = %q", answer)
+	}
+	request := server.Requests()[0]
+	if request.Model != fake.Model || request.Temperature != 0.2 || request.Stream {
+		t.Errorf("unexpected request: %+v", request.CompletionRequest)
+	}
+	if got := request.Header.Get("Authorization"); got != "Bearer "+fake.ApiKey {
+		t.Errorf("authorization = %q", got)
+	}
+}
+
+func TestStream(t *testing.T) {
+	server := newFakeServer(t, fake.Answer("Gwangjang", "", " Market"))
+
+	stream, err := text_completion.NewClient(server.Config()).Stream(context.Background(), testMessages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	answer, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(answer) != "Gwangjang Market" {
+		t.Errorf("answer = %q", answer)
+	}
+	if !server.Requests()[0].Stream {
+		t.Errorf("expected stream request")
+	}
+}
+
+func TestStreamCut(t *testing.T) {
+	server := newFakeServer(t, fake.Reply{Chunks: []string{"Gwang"}, Cut: true})
+
+	stream, err := text_completion.NewClient(server.Config()).Stream(context.Background(), testMessages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	if _, err := io.ReadAll(stream); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestStreamCancel(t *testing.T) {
+	server := newFakeServer(t, fake.Reply{Chunks: []string{"Gwang"}, Hang: true})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := text_completion.NewClient(server.Config()).Stream(ctx, testMessages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	buffer := make([]byte, 5)
+	if _, err := io.ReadFull(stream, buffer); err != nil || string(buffer) != "Gwang" {
+		t.Fatalf("first chunk = %q (%v)", buffer, err)
+	}
+	cancel()
+	if _, err := io.ReadAll(stream); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestCompleteCanceled(t *testing.T) {
+	server := newFakeServer(t, fake.Reply{Hang: true})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := text_completion.NewClient(server.Config()).Complete(ctx, testMessages); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestRequestErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		reply    fake.Reply
+		expected error
+	}{
+		{"rate limit", fake.Fail(http.StatusTooManyRequests, "rate_limit_exceeded", "Rate limit reached"),
+			text_completion.ErrRateLimit},
+		{"context length", fake.Fail(http.StatusBadRequest, "context_length_exceeded", "maximum context length is 8192 tokens"),
+			text_completion.ErrContextLength},
+		{"auth", fake.Fail(http.StatusUnauthorized, "invalid_api_key", "Incorrect API key provided"),
+			text_completion.ErrAuth},
+		{"server", fake.Fail(http.StatusBadGateway, "", "bad gateway"), nil},
+	}
+	for _, test := range tests {
+		server := newFakeServer(t, test.reply, test.reply)
+		client := text_completion.NewClient(server.Config())
+
+		for _, stream := range []bool{false, true} {
+			var err error
+			if stream {
+				_, err = client.Stream(context.Background(), testMessages)
+			} else {
+				_, err = client.Complete(context.Background(), testMessages)
+			}
+			var requestError *text_completion.RequestError
+			if !errors.As(err, &requestError) || requestError.StatusCode != test.reply.StatusCode {
+				t.Errorf("%s (stream %v): expected RequestError[%d], got %v", test.name, stream, test.reply.StatusCode, err)
+				continue
+			}
+			if errors.Unwrap(err) != test.expected {
+				t.Errorf("%s (stream %v): expected %v, got %v", test.name, stream, test.expected, errors.Unwrap(err))
+			}
+		}
+	}
+}
+
+func TestWrongApiKey(t *testing.T) {
+	server := newFakeServer(t, fake.Answer("Gwangjang Market"))
+	config := server.Config()
+	config.ApiKey = "wrong"
+
+	if _, err := text_completion.NewClient(config).Complete(context.Background(), testMessages); !errors.Is(err, text_completion.ErrAuth) {
+		t.Errorf("expected ErrAuth, got %v", err)
+	}
+}
+
+func TestStreamError(t *testing.T) {
+	reply := fake.Fail(http.StatusOK, "rate_limit_exceeded", "Rate limit reached")
+	reply.Chunks = []string{"Gwang"}
+	server := newFakeServer(t, reply)
+
+	stream, err := text_completion.NewClient(server.Config()).Stream(context.Background(), testMessages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	if _, err := io.ReadAll(stream); !errors.Is(err, text_completion.ErrRateLimit) {
+		t.Errorf("expected ErrRateLimit, got %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package text_completion
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	ErrRateLimit     = errors.New("rate limit of the model is exceeded")
+	ErrContextLength = errors.New("messages exceed context length of the model")
+	ErrAuth          = errors.New("api key is not authorized")
+)
+
+// RequestError is an error answered by the api.
+// It is one of ErrRateLimit, ErrContextLength and ErrAuth by errors.Is, if known.
+type RequestError struct {
+	StatusCode int
+	CompletionError
+}
+
+func newRequestError(statusCode int, body []byte) *RequestError {
+	var response CompletionErrorResponse
+	if err := json.Unmarshal(body, &response); err != nil || response.Error.Message == "" {
+		// not from the api itself, such as a proxy in front of it
+		response.Error.Message = string(body)
+	}
+	return &RequestError{StatusCode: statusCode, CompletionError: response.Error}
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("RequestError[%d] %s :: %s", e.StatusCode, e.Type, e.Message)
+}
+
+func (e *RequestError) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusTooManyRequests || e.Code == "rate_limit_exceeded":
+		return ErrRateLimit
+	case e.Code == "context_length_exceeded":
+		return ErrContextLength
+	case e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden || e.Code == "invalid_api_key":
+		return ErrAuth
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+// Package fake is an open ai compatible server in process, which replays scripted replies of chat completions.
+// It lets clients of text_completion be tested without the api:
+//
+//	server := fake.NewServer()
+//	defer server.Close()
+//	server.Enqueue(fake.Answer("Gwangjang", " Market"), fake.Fail(http.StatusTooManyRequests, "rate_limit_exceeded", "slow down"))
+//	client := text_completion.NewClient(server.Config())
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"travel-ai/third_party/open_ai/text_completion"
+)
+
+const (
+	ApiKey = "fake-api-key"
+	Model  = "fake-model"
+)
+
+// Reply is a scripted reply of a request.
+// A streamed request gets each chunk as an event, and the others get chunks joined as a message.
+type Reply struct {
+	StatusCode int                              // http.StatusOK if zero
+	Chunks     []string                         // contents of the answer
+	Error      *text_completion.CompletionError // body of a failed reply, or the last event of a stream with http.StatusOK
+	Cut        bool                             // the stream ends without [DONE]
+	Hang       bool                             // kept open until the client goes away, after chunks of a stream
+}
+
+// Answer replies chunks of the answer
+func Answer(chunks ...string) Reply {
+	return Reply{Chunks: chunks}
+}
+
+// Fail replies the error of the api, e.g. http.StatusTooManyRequests with rate_limit_exceeded
+func Fail(statusCode int, code string, message string) Reply {
+	return Reply{StatusCode: statusCode, Error: &text_completion.CompletionError{Code: code, Message: message}}
+}
+
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	replies  []Reply
+	requests []Request
+}
+
+// Request is what the server has received
+type Request struct {
+	text_completion.CompletionRequest
+	Header http.Header
+}
+
+func NewServer() *Server {
+	s := &Server{}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Config is of clients to the server
+func (s *Server) Config() text_completion.Config {
+	return text_completion.Config{BaseUrl: s.URL + "/v1", ApiKey: ApiKey, Model: Model, Temperature: 0.7}
+}
+
+// Enqueue scripts replies of the next requests in order
+func (s *Server) Enqueue(replies ...Reply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replies = append(s.replies, replies...)
+}
+
+// Requests returns requests received so far
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request{}, s.requests...)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/v1/chat/completions" {
+		http.NotFound(w, r)
+		return
+	}
+	var request Request
+	if err := json.NewDecoder(r.Body).Decode(&request.CompletionRequest); err != nil {
+		writeError(w, http.StatusBadRequest, &text_completion.CompletionError{Message: err.Error()})
+		return
+	}
+	request.Header = r.Header.Clone()
+
+	s.mu.Lock()
+	s.requests = append(s.requests, request)
+	s.mu.Unlock()
+
+	// the api key is checked as the api does, before a reply is taken
+	if r.Header.Get("Authorization") != "Bearer "+ApiKey {
+		writeError(w, http.StatusUnauthorized, &text_completion.CompletionError{
+			Code: "invalid_api_key", Message: "Incorrect API key provided", Type: "invalid_request_error",
+		})
+		return
+	}
+
+	s.mu.Lock()
+	if len(s.replies) == 0 {
+		s.mu.Unlock()
+		writeError(w, http.StatusInternalServerError, &text_completion.CompletionError{Message: "no reply is scripted"})
+		return
+	}
+	reply := s.replies[0]
+	s.replies = s.replies[1:]
+	s.mu.Unlock()
+
+	if reply.StatusCode != 0 && reply.StatusCode != http.StatusOK {
+		writeError(w, reply.StatusCode, reply.Error)
+		return
+	}
+	if request.Stream {
+		writeStream(w, r, reply)
+		return
+	}
+	if reply.Hang {
+		<-r.Context().Done()
+		return
+	}
+	if reply.Error != nil {
+		writeError(w, http.StatusInternalServerError, reply.Error)
+		return
+	}
+	message := text_completion.CompletionMessage{Role: text_completion.ROLE_ASSISTANT, Content: strings.Join(reply.Chunks, "")}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"choices": []interface{}{map[string]interface{}{"message": message, "index": 0, "finish_reason": "stop"}},
+	})
+}
+
+func writeError(w http.ResponseWriter, statusCode int, completionError *text_completion.CompletionError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if completionError == nil {
+		completionError = &text_completion.CompletionError{}
+	}
+	_ = json.NewEncoder(w).Encode(text_completion.CompletionErrorResponse{Error: *completionError})
+}
+
+func writeStream(w http.ResponseWriter, r *http.Request, reply Reply) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	writeEvent := func(data string) {
+		_, _ = fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+	}
+
+	// the api starts with the role, and ends with the finish reason
+	writeEvent(`{"choices":[{"delta":{"role":"assistant"},"index":0,"finish_reason":null}]}`)
+	for _, chunk := range reply.Chunks {
+		data, _ := json.Marshal(chunk)
+		writeEvent(fmt.Sprintf(`{"choices":[{"delta":{"content":%s},"index":0,"finish_reason":null}]}`, data))
+	}
+	if reply.Hang {
+		<-r.Context().Done()
+		return
+	}
+	if reply.Error != nil {
+		data, _ := json.Marshal(text_completion.CompletionErrorResponse{Error: *reply.Error})
+		writeEvent(string(data))
+		return
+	}
+	if reply.Cut {
+		return
+	}
+	writeEvent(`{"choices":[{"delta":{},"index":0,"finish_reason":"stop"}]}`)
+	_, _ = io.WriteString(w, "data: [DONE]\n\n")
+}
@@ -0,0 +1,53 @@
+package text_completion
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"travel-ai/log"
+	"travel-ai/third_party/open_ai"
+)
+
+const (
+	DefaultBaseUrl     = "https://api.openai.com/v1"
+	DefaultModel       = MODEL_GPT_4
+	DefaultTemperature = 0.7
+)
+
+// DefaultConfig is the base of clients, where the api key is set by Initialize
+var DefaultConfig = Config{BaseUrl: DefaultBaseUrl, Model: DefaultModel, Temperature: DefaultTemperature}
+
+// DefaultClient is used by the assistant, which is replaced by Initialize
+var DefaultClient = NewClient(DefaultConfig)
+
+// Initialize builds DefaultConfig and DefaultClient from environments, after open_ai.Initialize.
+//
+//	OPEN_AI_BASE_URL: base url of the api, https://api.openai.com/v1 by default
+//	OPEN_AI_MODEL: model of the assistant, gpt-4 by default
+//	OPEN_AI_TEMPERATURE: sampling temperature between 0 and 2, 0.7 by default
+func Initialize() error {
+	config := Config{
+		BaseUrl:     DefaultBaseUrl,
+		ApiKey:      open_ai.GetOpenAiApiKey(),
+		Model:       DefaultModel,
+		Temperature: DefaultTemperature,
+	}
+	if baseUrl := os.Getenv("OPEN_AI_BASE_URL"); baseUrl != "" {
+		config.BaseUrl = baseUrl
+	}
+	if model := os.Getenv("OPEN_AI_MODEL"); model != "" {
+		config.Model = model
+	}
+	if raw := os.Getenv("OPEN_AI_TEMPERATURE"); raw != "" {
+		temperature, err := strconv.ParseFloat(raw, 64)
+		if err != nil || temperature < 0 || temperature > 2 {
+			return fmt.Errorf("invalid OPEN_AI_TEMPERATURE: %s", raw)
+		}
+		config.Temperature = temperature
+	}
+
+	DefaultConfig = config
+	DefaultClient = NewClient(config)
+	log.Infof("open ai client: %s of %s", config.Model, config.BaseUrl)
+	return nil
+}
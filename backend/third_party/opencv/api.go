@@ -2,6 +2,7 @@ package opencv
 
 import (
 	"image"
+	"image/color"
 	"math"
 	"os"
 	"travel-ai/log"
@@ -10,7 +11,88 @@ import (
 	"gocv.io/x/gocv"
 )
 
+// ReceiptPipelineParams tunes ProcessReceiptImage, whose intermediate images are given in Debug mode.
+// Form tags are for the test endpoint, which binds them over DefaultReceiptPipelineParams.
+type ReceiptPipelineParams struct {
+	// receipt paper is masked with these, as bright and unsaturated area
+	BlurBlock              int     `form:"blur_block"`
+	Threshold              int     `form:"threshold"`
+	AdaptiveThresholdBlock int     `form:"adaptive_threshold_block"`
+	AdaptiveThresholdC     int     `form:"adaptive_threshold_c"`
+	LowH                   float64 `form:"low_h"` // hue is in [0, 180)
+	LowS                   float64 `form:"low_s"`
+	LowV                   float64 `form:"low_v"`
+	UpH                    float64 `form:"up_h"`
+	UpS                    float64 `form:"up_s"`
+	UpV                    float64 `form:"up_v"`
+	// receipt corners are given up below these, as the contour is not likely a receipt
+	MinConfidence           float64 `form:"min_confidence"`
+	MinWhitePixelConfidence float64 `form:"min_white_pixel_confidence"`
+
+	// text lines tilted up to this are deskewed, zero to skip
+	MaxSkewAngle float64 `form:"max_skew_angle"` // degrees
+	// contrast is enhanced with CLAHE into grayscale, zero clip limit to skip
+	ClaheClipLimit float64 `form:"clahe_clip_limit"`
+	ClaheTileSize  int     `form:"clahe_tile_size"`
+	// binarization with gaussian adaptive threshold, after contrast enhancement
+	Binarize      bool `form:"binarize"`
+	BinarizeBlock int  `form:"binarize_block"`
+	BinarizeC     int  `form:"binarize_c"`
+
+	Debug bool `form:"debug"`
+}
+
+// DefaultReceiptPipelineParams are used for receipt uploads.
+// Binarization is off, as OCR services read grayscale images better than binarized photos.
+func DefaultReceiptPipelineParams() ReceiptPipelineParams {
+	return ReceiptPipelineParams{
+		BlurBlock:               1,
+		Threshold:               0,
+		AdaptiveThresholdBlock:  13,
+		AdaptiveThresholdC:      7,
+		LowH:                    15,
+		LowS:                    0,
+		LowV:                    100,
+		UpH:                     175,
+		UpS:                     255,
+		UpV:                     255,
+		MinConfidence:           0.1,
+		MinWhitePixelConfidence: 0.15,
+		MaxSkewAngle:            15,
+		ClaheClipLimit:          2,
+		ClaheTileSize:           8,
+		Binarize:                false,
+		BinarizeBlock:           15,
+		BinarizeC:               10,
+	}
+}
+
+type ReceiptPipelineStep struct {
+	Name  string
+	Image image.Image
+}
+
+type ReceiptPipelineResult struct {
+	Image image.Image
+	// Corners are top-left, top-right, bottom-right and bottom-left of the receipt in the original image,
+	// which is nil if the receipt is not found
+	Corners   []image.Point
+	SkewAngle float64               // degrees rotated counterclockwise to deskew
+	Steps     []ReceiptPipelineStep // intermediate images in Debug mode
+}
+
 func CropReceiptSubImage(img image.Image) (image.Image, error) {
+	result, err := ProcessReceiptImage(img, DefaultReceiptPipelineParams())
+	if err != nil {
+		return nil, err
+	}
+	return result.Image, nil
+}
+
+// ProcessReceiptImage flattens the receipt of the photo for OCR.
+// The receipt is warped into a rectangle by its four corners, deskewed by its text lines,
+// and its contrast is enhanced. Each step is skipped if it is not confident.
+func ProcessReceiptImage(img image.Image, params ReceiptPipelineParams) (*ReceiptPipelineResult, error) {
 	// save img as temp file
 	filepath, _ := util.GenerateTempFilePath()
 	if err := util.SaveImageFileAsPng(img, filepath, false); err != nil {
@@ -28,174 +110,153 @@ func CropReceiptSubImage(img image.Image) (image.Image, error) {
 	// image
 	cvImage := gocv.IMRead(filepath, gocv.IMReadColor)
 	defer cvImage.Close()
+
+	result := &ReceiptPipelineResult{}
+	step := func(name string, mat gocv.Mat) {
+		if !params.Debug {
+			return
+		}
+		stepImage, err := mat.ToImage()
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		result.Steps = append(result.Steps, ReceiptPipelineStep{Name: name, Image: stepImage})
+	}
+	step("original", cvImage)
+
+	// perspective correction
+	processed := cvImage.Clone()
+	if corners, ok := findReceiptCorners(cvImage, params, step); ok {
+		warped := warpReceipt(cvImage, corners)
+		_ = processed.Close()
+		processed = warped
+		result.Corners = corners
+		step("warped", processed)
+	}
+
+	// deskew
+	if params.MaxSkewAngle > 0 {
+		gray := grayscale(&processed)
+		angle, ok := detectSkewAngle(*gray, params.MaxSkewAngle)
+		_ = gray.Close()
+		if ok && angle != 0 {
+			rotated := rotate(processed, angle)
+			_ = processed.Close()
+			processed = *rotated
+			result.SkewAngle = angle
+			step("deskewed", processed)
+		}
+	}
+
+	// contrast and binarization
+	if params.ClaheClipLimit > 0 || params.Binarize {
+		gray := grayscale(&processed)
+		_ = processed.Close()
+		processed = *gray
+	}
+	if params.ClaheClipLimit > 0 {
+		clahe := gocv.NewCLAHEWithParams(params.ClaheClipLimit, image.Pt(params.ClaheTileSize, params.ClaheTileSize))
+		enhanced := gocv.NewMat()
+		clahe.Apply(processed, &enhanced)
+		_ = clahe.Close()
+		_ = processed.Close()
+		processed = enhanced
+		step("contrast", processed)
+	}
+	if params.Binarize {
+		binarized := gocv.NewMat()
+		gocv.AdaptiveThreshold(processed, &binarized, 255, gocv.AdaptiveThresholdGaussian, gocv.ThresholdBinary,
+			2*params.BinarizeBlock+1, float32(params.BinarizeC))
+		_ = processed.Close()
+		processed = binarized
+		step("binarized", processed)
+	}
+	defer processed.Close()
+
+	newImage, err := processed.ToImage()
+	if err != nil {
+		return nil, err
+	}
+	result.Image = newImage
+	return result, nil
+}
+
+// findReceiptCorners finds the largest bright contour, and its four corners if it is likely a receipt
+func findReceiptCorners(cvImage gocv.Mat, params ReceiptPipelineParams, step func(string, gocv.Mat)) ([]image.Point, bool) {
 	// calculate cvImage volume
 	cvImageVolume := float64(cvImage.Rows() * cvImage.Cols())
 
-	//_blurBlock := 1
-	//_threshold := 0
-	//_adaptiveThresholdBlock := 27
-	//_adaptiveThresholdC := 7
-	//lowH, upH := 15, 175
-	//lowS, upS := 0, 255
-	//lowV, upV := 100, 255
-
-	_blurBlock := 1
-	_threshold := 0
-	_adaptiveThresholdBlock := 13
-	_adaptiveThresholdC := 7
-	lowH, upH := 15, 175
-	lowS, upS := 0, 255
-	lowV, upV := 100, 255
-
-	blurredImg := blur(&cvImage, _blurBlock)
-	thresholdedImg := threshold(blurredImg, _threshold, gocv.ThresholdToZero)
+	blurredImg := blur(&cvImage, params.BlurBlock)
+	defer blurredImg.Close()
+	thresholdedImg := threshold(blurredImg, params.Threshold, gocv.ThresholdToZero)
+	defer thresholdedImg.Close()
 	grayScaledImg := grayscale(thresholdedImg)
-	adaptiveThresholdedImg := adaptiveThreshold(grayScaledImg, _adaptiveThresholdBlock, _adaptiveThresholdC)
+	defer grayScaledImg.Close()
+	adaptiveThresholdedImg := adaptiveThreshold(grayScaledImg, params.AdaptiveThresholdBlock, params.AdaptiveThresholdC)
+	defer adaptiveThresholdedImg.Close()
+	step("adaptive_threshold", *adaptiveThresholdedImg)
 	bitwisedImg := bitwiseAnd(*blurredImg, *adaptiveThresholdedImg)
+	defer bitwisedImg.Close()
 	hsvTransformed := hsv(*bitwisedImg)
-	//hsvImg, err := hsvTransformed.ToImage()
-	//if err != nil {
-	//	return nil, err
-	//}
-	//defer hsvTransformed.Close()
-	//hsvRgbImg, err := gocv.ImageToMatRGB(hsvImg)
-	//if err != nil {
-	//	return nil, err
-	//}
-	//return hsvRgbImg.ToImage()
-	//hsvRgbHsvImg := hsv(hsvRgbImg)
-	masked := mask(*hsvTransformed, float64(lowH), float64(lowS), float64(lowV), float64(upH), float64(upS), float64(upV))
+	defer hsvTransformed.Close()
+	masked := mask(*hsvTransformed, params.LowH, params.LowS, params.LowV, params.UpH, params.UpS, params.UpV)
+	defer masked.Close()
+	step("mask", *masked)
 	// calculate white pixel volume
 	whitePixelVolume := float64(gocv.CountNonZero(*masked))
-	//return masked.ToImage()
-
-	// crop receipt
-	newImg, mask := gocv.NewMat(), gocv.NewMat()
-	cvImage.CopyTo(&newImg)
-	cvImage.CopyTo(&mask)
 
 	// find contours
 	contours := gocv.FindContours(*masked, gocv.RetrievalExternal, gocv.ChainApproxSimple)
+	defer contours.Close()
 	if contours.Size() == 0 {
-		// no receipt found, just return original image
 		log.Debugf("Crop: no receipt found")
-		return img, nil
+		return nil, false
 	}
 
 	// find largest contour
-	var largestContour *gocv.PointVector
+	largestContourIdx := 0
+	largestContourVolume := 0.0
 	for i := 0; i < contours.Size(); i++ {
-		contour := contours.At(i)
-		if largestContour == nil || contour.Size() > largestContour.Size() {
-			largestContour = &contour
+		if volume := gocv.ContourArea(contours.At(i)); volume > largestContourVolume {
+			largestContourIdx, largestContourVolume = i, volume
 		}
 	}
-	largestContourVolume := gocv.ContourArea(*largestContour)
-
-	// poly set
-	epsilon := 0.03 * gocv.ArcLength(*largestContour, true)
-	approx := gocv.ApproxPolyDP(*largestContour, epsilon, true)
-
-	// draw approx
-	//approxList := gocv.NewPointsVector()
-	//approxList.Append(approx)
-	//gocv.DrawContours(&mask, approxList, -1, color.RGBA{
-	//	R: 255,
-	//	G: 0,
-	//	B: 0,
-	//}, 2)
-	//return mask.ToImage()
-
-	// bounds
-	boundingRect := gocv.BoundingRect(approx)
-
-	// draw contours
-	//largestContourList := gocv.NewPointsVector()
-	//largestContourList.Append(*largestContour)
-	//gocv.DrawContours(&mask, largestContourList, -1, color.RGBA{
-	//	R: 0,
-	//	G: 255,
-	//	B: 0,
-	//	A: 255,
-	//}, 2)
-	//return mask.ToImage()
-
-	// convex hull
-	hull := gocv.NewMatWithSize(cvImage.Rows(), cvImage.Cols(), cvImage.Type())
-	gocv.ConvexHull(approx, &hull, true, false)
-
-	// rect points
-	type Point struct {
-		x, y int32
+	largestContour := contours.At(largestContourIdx)
+	if largestContourVolume == 0 || largestContour.Size() < 4 {
+		log.Debugf("Crop: receipt contour is too small")
+		return nil, false
 	}
-	lu := Point{0, 0}
-	ru := Point{int32(boundingRect.Dx()) - 1, 0}
-	ld := Point{0, int32(boundingRect.Dy()) - 1}
-	rd := Point{int32(boundingRect.Dx()) - 1, int32(boundingRect.Dy()) - 1}
 
-	// find extreme points
-	sums := make([]int, hull.Rows())
-	diffs := make([]int, hull.Rows())
-	hullPoints := gocv.NewPointVector()
-
-	for i := 0; i < hull.Rows(); i++ {
-		index := hull.GetIntAt(i, 0)
-		point := approx.At(int(index))
-
-		x := int32(point.X)
-		y := int32(point.Y)
-
-		// sums와 diffs 계산
-		sums[i] = int(x + y)
-		diffs[i] = int(x - y)
-
-		hullPoints.Append(image.Pt(int(x), int(y)))
+	// poly set, which is a quadrilateral if the receipt is fully in the photo
+	epsilon := 0.03 * gocv.ArcLength(largestContour, true)
+	approx := gocv.ApproxPolyDP(largestContour, epsilon, true)
+	defer approx.Close()
+	points := approx.ToPoints()
+	if len(points) < 4 {
+		points = gocv.MinAreaRect(largestContour).Points
+	}
+	corners, ok := orderCorners(points)
+	if !ok {
+		log.Debugf("Crop: receipt corners not found")
+		return nil, false
 	}
 
-	if len(sums) < 4 {
-		log.Debugf("convex hull points not found")
-		return img, nil
+	if params.Debug {
+		drawn := cvImage.Clone()
+		cornersVector := gocv.NewPointsVector()
+		cornerVector := gocv.NewPointVectorFromPoints(corners)
+		cornersVector.Append(cornerVector)
+		gocv.Polylines(&drawn, cornersVector, true, color.RGBA{R: 0, G: 255, B: 0, A: 255}, 3)
+		step("corners", drawn)
+		cornerVector.Close()
+		cornersVector.Close()
+		_ = drawn.Close()
 	}
 
-	// 극단점 찾기
-	leftTopMostIdx := indexOfMin(sums)
-	rightBottomMostIdx := indexOfMax(sums)
-	rightTopMostIdx := indexOfMax(diffs)
-	leftBottomMostIdx := indexOfMin(diffs)
-
-	leftTopMost := approx.At(int(hull.GetIntAt(leftTopMostIdx, 0)))
-	rightBottomMost := approx.At(int(hull.GetIntAt(rightBottomMostIdx, 0)))
-	rightTopMost := approx.At(int(hull.GetIntAt(rightTopMostIdx, 0)))
-	leftBottomMost := approx.At(int(hull.GetIntAt(leftBottomMostIdx, 0)))
-
-	//hulls := gocv.NewPointsVector()
-	//hulls.Append(hullPoints)
-	//gocv.DrawContours(&newImg, hulls, -1, color.RGBA{
-	//	R: 0,
-	//	G: 255,
-	//	B: 0,
-	//	A: 255,
-	//}, 2)
-	//
-	//hullPoints.Close()
-	//hulls.Close()
-	//
-	//return newImg.ToImage()
-
-	// make transform src and dst points
-	srcPointVector := gocv.NewPointVector()
-	srcPointVector.Append(image.Pt(leftTopMost.X, leftTopMost.Y))
-	srcPointVector.Append(image.Pt(leftBottomMost.X, leftBottomMost.Y))
-	srcPointVector.Append(image.Pt(rightBottomMost.X, rightBottomMost.Y))
-	srcPointVector.Append(image.Pt(rightTopMost.X, rightTopMost.Y))
-
-	dstPointVector := gocv.NewPointVector()
-	dstPointVector.Append(image.Pt(int(lu.x), int(lu.y)))
-	dstPointVector.Append(image.Pt(int(ld.x), int(ld.y)))
-	dstPointVector.Append(image.Pt(int(rd.x), int(rd.y)))
-	dstPointVector.Append(image.Pt(int(ru.x), int(ru.y)))
-
-	extremeVolume := gocv.ContourArea(srcPointVector)
+	cornerVector := gocv.NewPointVectorFromPoints(corners)
+	defer cornerVector.Close()
+	extremeVolume := gocv.ContourArea(cornerVector)
 	extremeProportion := extremeVolume / largestContourVolume
 	suppressRate := extremeVolume / cvImageVolume
 	suppressRate2 := extremeVolume / whitePixelVolume
@@ -209,48 +270,53 @@ func CropReceiptSubImage(img image.Image) (image.Image, error) {
 	log.Debugf("confidence: %v", confidence*100)
 	log.Debugf("confidence2: %v", confidence2*100)
 
-	if confidence < 0.1 || confidence2 < 0.15 {
+	if confidence < params.MinConfidence || confidence2 < params.MinWhitePixelConfidence {
 		log.Debugf("give up as low confidence: %v, %v", confidence, confidence2)
-		return img, nil
-	}
-
-	// perspective transform
-	transformed := gocv.GetPerspectiveTransform(srcPointVector, dstPointVector)
-	warped := gocv.NewMat()
-	gocv.WarpPerspective(newImg, &warped, transformed, image.Pt(boundingRect.Dx(), boundingRect.Dy()))
-
-	newImage, err := warped.ToImage()
-	if err != nil {
-		return nil, err
+		return nil, false
 	}
-
-	return newImage, nil
+	return corners, true
 }
 
-func indexOfMin(slice []int) int {
-	min := slice[0]
-	minIdx := 0
+// warpReceipt transforms the quadrilateral of corners into a rectangle of its longer edges
+func warpReceipt(src gocv.Mat, corners []image.Point) gocv.Mat {
+	width, height := rectangleSize(corners)
 
-	for i, value := range slice {
-		if value < min {
-			min = value
-			minIdx = i
-		}
-	}
+	srcPointVector := gocv.NewPointVectorFromPoints(corners)
+	defer srcPointVector.Close()
+	dstPointVector := gocv.NewPointVectorFromPoints([]image.Point{
+		image.Pt(0, 0),
+		image.Pt(width-1, 0),
+		image.Pt(width-1, height-1),
+		image.Pt(0, height-1),
+	})
+	defer dstPointVector.Close()
 
-	return minIdx
+	// perspective transform
+	transformed := gocv.GetPerspectiveTransform(srcPointVector, dstPointVector)
+	defer transformed.Close()
+	warped := gocv.NewMat()
+	gocv.WarpPerspective(src, &warped, transformed, image.Pt(width, height))
+	return warped
 }
 
-func indexOfMax(slice []int) int {
-	max := slice[0]
-	maxIdx := 0
-
-	for i, value := range slice {
-		if value > max {
-			max = value
-			maxIdx = i
+// detectSkewAngle finds the tilt of text lines by long straight edges
+func detectSkewAngle(gray gocv.Mat, maxAngle float64) (float64, bool) {
+	edges := gocv.NewMat()
+	defer edges.Close()
+	gocv.Canny(gray, &edges, 50, 150)
+
+	lines := gocv.NewMat()
+	defer lines.Close()
+	minLineLength := float32(gray.Cols()) / 4
+	gocv.HoughLinesPWithParams(edges, &lines, 1, math.Pi/180, 100, minLineLength, 20)
+
+	segments := make([][4]int32, 0, lines.Rows())
+	for i := 0; i < lines.Rows(); i++ {
+		line := lines.GetVeciAt(i, 0)
+		if len(line) < 4 {
+			continue
 		}
+		segments = append(segments, [4]int32{line[0], line[1], line[2], line[3]})
 	}
-
-	return maxIdx
+	return medianSkewAngle(segments, maxAngle)
 }
@@ -3,6 +3,9 @@ package opencv
 import (
 	"gocv.io/x/gocv"
 	"image"
+	"image/color"
+	"math"
+	"sort"
 )
 
 func blur(img *gocv.Mat, size int) *gocv.Mat {
@@ -57,3 +60,90 @@ func mask(img gocv.Mat, lh, ls, lv, uh, us, uv float64) *gocv.Mat {
 		gocv.NewScalar(uh, us, uv, 0), &newImg)
 	return &newImg
 }
+
+// rotate turns the image counterclockwise by angle degrees around its center, keeping its size
+func rotate(img gocv.Mat, angle float64) *gocv.Mat {
+	newImg := gocv.NewMat()
+	center := image.Pt(img.Cols()/2, img.Rows()/2)
+	matrix := gocv.GetRotationMatrix2D(center, angle, 1)
+	defer matrix.Close()
+	gocv.WarpAffineWithParams(img, &newImg, matrix, image.Pt(img.Cols(), img.Rows()),
+		gocv.InterpolationLinear, gocv.BorderReplicate, color.RGBA{})
+	return &newImg
+}
+
+// orderCorners picks top-left, top-right, bottom-right and bottom-left of the points,
+// as the extreme points of x+y and x-y
+func orderCorners(points []image.Point) ([]image.Point, bool) {
+	if len(points) < 4 {
+		return nil, false
+	}
+	topLeft, topRight, bottomRight, bottomLeft := points[0], points[0], points[0], points[0]
+	for _, point := range points[1:] {
+		if point.X+point.Y < topLeft.X+topLeft.Y {
+			topLeft = point
+		}
+		if point.X+point.Y > bottomRight.X+bottomRight.Y {
+			bottomRight = point
+		}
+		if point.X-point.Y > topRight.X-topRight.Y {
+			topRight = point
+		}
+		if point.X-point.Y < bottomLeft.X-bottomLeft.Y {
+			bottomLeft = point
+		}
+	}
+	corners := []image.Point{topLeft, topRight, bottomRight, bottomLeft}
+
+	// degenerated into a line or a triangle
+	for i := range corners {
+		for j := i + 1; j < len(corners); j++ {
+			if corners[i] == corners[j] {
+				return nil, false
+			}
+		}
+	}
+	return corners, true
+}
+
+// rectangleSize is the size of the rectangle which the quadrilateral is flattened into
+func rectangleSize(corners []image.Point) (int, int) {
+	distance := func(a, b image.Point) float64 {
+		return math.Hypot(float64(a.X-b.X), float64(a.Y-b.Y))
+	}
+	width := math.Max(distance(corners[0], corners[1]), distance(corners[3], corners[2]))
+	height := math.Max(distance(corners[0], corners[3]), distance(corners[1], corners[2]))
+	return int(math.Round(width)), int(math.Round(height))
+}
+
+// medianSkewAngle is the median angle of nearly horizontal segments (x1, y1, x2, y2) in degrees,
+// where positive means the right side is lower
+func medianSkewAngle(segments [][4]int32, maxAngle float64) (float64, bool) {
+	angles := make([]float64, 0, len(segments))
+	for _, segment := range segments {
+		dx := float64(segment[2] - segment[0])
+		dy := float64(segment[3] - segment[1])
+		if dx == 0 && dy == 0 {
+			continue
+		}
+		angle := math.Atan2(dy, dx) * 180 / math.Pi
+		// direction of segments does not matter
+		if angle > 90 {
+			angle -= 180
+		} else if angle <= -90 {
+			angle += 180
+		}
+		if math.Abs(angle) <= maxAngle {
+			angles = append(angles, angle)
+		}
+	}
+	if len(angles) == 0 {
+		return 0, false
+	}
+	sort.Float64s(angles)
+	middle := len(angles) / 2
+	if len(angles)%2 == 0 {
+		return (angles[middle-1] + angles[middle]) / 2, true
+	}
+	return angles[middle], true
+}
@@ -2,6 +2,7 @@ package taggun_receipt_ocr
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -77,6 +78,7 @@ type TaggunReceiptOcrResponse struct {
 	ConfidenceLevel float64          `json:"confidenceLevel"`
 	Date            struct {
 		// rest of the fields are not sure
+		Data            string  `json:"data"` // ISO 8601, e.g. 2016-07-10T17:08:00.000Z
 		ConfidenceLevel float64 `json:"confidenceLevel"`
 	} `json:"date"`
 	DueDate struct {
@@ -149,11 +151,16 @@ type TaggunReceiptOcrResponse struct {
 }
 
 func ParseReceipt(f *os.File) (*TaggunReceiptOcrResponse, error) {
+	return ParseReceiptContext(context.Background(), f, f.Name())
+}
+
+// ParseReceiptContext sends the receipt image, where filename is used for multipart form
+func ParseReceiptContext(ctx context.Context, r io.Reader, filename string) (*TaggunReceiptOcrResponse, error) {
 	url := "https://api.taggun.io/api/receipt/v1/verbose/file"
 	payload := &bytes.Buffer{}
 	writer := multipart.NewWriter(payload)
-	filePart, _ := writer.CreateFormFile("file", f.Name())
-	if _, err := io.Copy(filePart, f); err != nil {
+	filePart, _ := writer.CreateFormFile("file", filename)
+	if _, err := io.Copy(filePart, r); err != nil {
 		return nil, err
 	}
 	if err := writer.Close(); err != nil {
@@ -161,17 +168,26 @@ func ParseReceipt(f *os.File) (*TaggunReceiptOcrResponse, error) {
 	}
 
 	contentType := fmt.Sprintf("multipart/form-data; boundary=%v", writer.Boundary())
-	req, _ := http.NewRequest("POST", url, payload)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, payload)
+	if err != nil {
+		return nil, err
+	}
 	req.Header.Add("accept", "application/json")
 	req.Header.Add("content-type", contentType)
 	req.Header.Add("apikey", GetTaggunApiKey())
-	res, _ := http.DefaultClient.Do(req)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
 	defer res.Body.Close()
 
 	body, err := io.ReadAll(res.Body)
 	if err != nil {
 		return nil, err
 	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("taggun responded %d: %s", res.StatusCode, body)
+	}
 
 	// parse body
 	var taggunResp TaggunReceiptOcrResponse